@@ -10,16 +10,24 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/hospital-emr/backend/internal/access"
+	"github.com/hospital-emr/backend/internal/audit"
 	"github.com/hospital-emr/backend/internal/auth"
 	"github.com/hospital-emr/backend/internal/common/config"
 	"github.com/hospital-emr/backend/internal/common/database"
 	"github.com/hospital-emr/backend/internal/common/logger"
 	"github.com/hospital-emr/backend/internal/common/middleware"
+	"github.com/hospital-emr/backend/internal/detector"
 	"github.com/hospital-emr/backend/internal/encounter"
 	"github.com/hospital-emr/backend/internal/models"
+	"github.com/hospital-emr/backend/internal/mpi"
+	"github.com/hospital-emr/backend/internal/numbering"
 	"github.com/hospital-emr/backend/internal/patient"
 	"github.com/hospital-emr/backend/internal/scheduling"
+	"github.com/hospital-emr/backend/internal/serviceaccount"
 	"github.com/hospital-emr/backend/internal/user"
+	"github.com/hospital-emr/backend/pkg/email"
+	"github.com/hospital-emr/backend/pkg/jwt"
 	"github.com/hospital-emr/backend/pkg/messaging"
 	_ "github.com/hospital-emr/backend/api/docs"
 	swaggerFiles "github.com/swaggo/files"
@@ -69,13 +77,6 @@ func main() {
 	}
 	defer db.Close()
 
-	// Auto-migrate database models in background to avoid blocking startup
-	go func() {
-		if err := autoMigrate(db); err != nil {
-			logger.Errorf("Failed to migrate database: %v", err)
-		}
-	}()
-
 	// Connect to NATS
 	var natsClient *messaging.NATSClient
 	if cfg.NATS.URL != "" {
@@ -91,22 +92,124 @@ func main() {
 		logger.Info("NATS URL not provided, skipping NATS connection")
 	}
 
+	// Load JWT signing keys
+	jwtKeys, err := auth.NewKeySet(cfg)
+	if err != nil {
+		logger.Fatalf("Failed to load JWT keys: %v", err)
+	}
+
+	// Load password policy
+	passwordPolicy, err := auth.NewPasswordPolicy(cfg)
+	if err != nil {
+		logger.Fatalf("Failed to load password policy: %v", err)
+	}
+
 	// Initialize services
-	authService := auth.NewService(db.DB, cfg)
-	patientService := patient.NewService(db.DB, natsClient)
-	encounterService := encounter.NewService(db.DB, natsClient)
-	schedulingService := scheduling.NewService(db.DB, natsClient)
-	userService := user.NewService(db.DB)
+	var auditChain *audit.Chain
+	if cfg.Audit.ChainEnabled {
+		auditChain = audit.NewChain([]byte(cfg.Audit.HMACKey))
+	}
+	auditWriter := audit.NewWriter(db.DB, auditChain, audit.WriterConfig{
+		QueueSize:     cfg.Audit.QueueSize,
+		BatchSize:     cfg.Audit.BatchSize,
+		FlushInterval: cfg.GetAuditFlushInterval(),
+		SpillDir:      cfg.Audit.SpillDir,
+		RetryInterval: cfg.GetAuditRetryInterval(),
+	})
+	auditRecorder := audit.NewAsyncRecorder(auditWriter)
+	if err := audit.TrackChanges(db.DB, auditRecorder); err != nil {
+		logger.Fatalf("Failed to register change tracking: %v", err)
+	}
+	var auditRetention *audit.Retention
+	if cfg.Audit.RetentionEnabled {
+		auditRetention = audit.NewRetention(db.DB, auditChain, auditRecorder, audit.RetentionConfig{
+			ArchiveDir:     cfg.Audit.ArchiveDir,
+			OnlineMonths:   cfg.Audit.OnlineMonths,
+			RetentionYears: cfg.Security.AuditLogRetentionYears,
+			MonthsAhead:    cfg.Audit.PartitionMonthsAhead,
+			Interval:       cfg.GetAuditRetentionInterval(),
+		})
+	}
+	var reencryption *patient.Reencryption
+	if cfg.Security.DataEncryptionEnabled && cfg.Keys.ReencryptEnabled {
+		reencryption = patient.NewReencryption(db.DB, cfg.GetReencryptInterval(), cfg.Keys.ReencryptBatchSize)
+	}
+	var accessDetector *detector.Detector
+	switch cfg.Detector.Mode {
+	case config.DetectorModeInProcess:
+		accessDetector, err = detector.New(db.DB, auditRecorder, natsClient, cfg)
+		if err != nil {
+			logger.Fatalf("Failed to start access detector: %v", err)
+		}
+		auditRecorder.Observe(accessDetector.Observe)
+	case config.DetectorModeNATS:
+		if natsClient == nil {
+			logger.Warn("DETECTOR_MODE is nats but NATS is not connected; audit entries will not be checked for suspicious access")
+		}
+		auditRecorder.Observe(detector.Publish(natsClient))
+	}
+
+	// Auto-migrate database models in background to avoid blocking startup
+	go func() {
+		if err := autoMigrate(db); err != nil {
+			logger.Errorf("Failed to migrate database: %v", err)
+			return
+		}
+		// The retention job works on tables the migrations create
+		if auditRetention != nil {
+			auditRetention.Start()
+		}
+		if reencryption != nil {
+			reencryption.Start()
+		}
+	}()
+	mailer := email.NewSMTPSender(cfg.Email.SMTPHost, cfg.Email.SMTPPort, cfg.Email.SMTPUser, cfg.Email.SMTPPassword, cfg.Email.EmailFrom)
+	sessionCache := auth.NewSessionCache(db.DB, cfg.GetSessionCacheTTL(), cfg.GetSessionIdleTimeout())
+	permissionCache := auth.NewPermissionCache(db.DB, cfg.GetPermissionCacheTTL())
+	apiKeyAuthenticator := auth.NewAPIKeyAuthenticator(db.DB, cfg.GetSessionCacheTTL())
+	accessPolicy := access.NewPolicy(db.DB, natsClient, cfg, auditRecorder)
+	authService := auth.NewService(db.DB, cfg, jwtKeys, sessionCache, passwordPolicy, mailer, auditRecorder)
+	sso := auth.NewSSO(authService, permissionCache, cfg)
+	if cfg.SSO.OIDCEnabled {
+		sso.RegisterRedirectProvider(auth.NewOIDCProvider(cfg))
+	}
+	if cfg.SSO.LDAPEnabled {
+		sso.RegisterPasswordProvider(auth.NewLDAPProvider(cfg))
+	}
+	var passkeys *auth.WebAuthn
+	if cfg.WebAuthn.Enabled {
+		if passkeys, err = auth.NewWebAuthn(authService, cfg); err != nil {
+			logger.Fatalf("Failed to configure WebAuthn: %v", err)
+		}
+	}
+	mpiService := mpi.NewService(db.DB, cfg)
+	var duplicateCheck *mpi.Service
+	if cfg.MPI.Enabled {
+		duplicateCheck = mpiService
+	}
+	numberingService := numbering.NewService(db.DB, cfg)
+	patientService := patient.NewService(db.DB, natsClient, accessPolicy, numberingService, duplicateCheck, cfg.GetUnmergeGracePeriod())
+	encounterService := encounter.NewService(db.DB, natsClient, accessPolicy, numberingService)
+	schedulingService := scheduling.NewService(db.DB, natsClient, accessPolicy, numberingService)
+	userService := user.NewService(db.DB, passwordPolicy, permissionCache, authService, auditRecorder)
+	serviceAccountService := serviceaccount.NewService(db.DB, cfg, apiKeyAuthenticator, permissionCache, auditRecorder)
 
 	// Initialize handlers
 	authHandler := auth.NewHandler(authService)
+	ssoHandler := auth.NewSSOHandler(sso)
+	webAuthnHandler := auth.NewWebAuthnHandler(passkeys)
 	patientHandler := patient.NewHandler(patientService)
 	encounterHandler := encounter.NewHandler(encounterService)
 	schedulingHandler := scheduling.NewHandler(schedulingService)
 	userHandler := user.NewHandler(userService)
+	accessHandler := access.NewHandler(accessPolicy)
+	serviceAccountHandler := serviceaccount.NewHandler(serviceAccountService)
+	auditHandler := audit.NewHandler(audit.NewService(db.DB))
+	mpiHandler := mpi.NewHandler(mpiService)
+	numberingHandler := numbering.NewHandler(numberingService)
 
 	// Setup router
-	router := setupRouter(cfg, authHandler, patientHandler, encounterHandler, schedulingHandler, userHandler)
+	router := setupRouter(cfg, jwtKeys, sessionCache, permissionCache, apiKeyAuthenticator, accessPolicy, auditRecorder, authHandler, ssoHandler, webAuthnHandler, patientHandler, encounterHandler, schedulingHandler, userHandler, accessHandler, serviceAccountHandler, auditHandler, mpiHandler, numberingHandler)
 
 	// Create HTTP server
 	srv := &http.Server{
@@ -141,10 +244,34 @@ func main() {
 		logger.Errorf("Server forced to shutdown: %v", err)
 	}
 
+	if auditRetention != nil {
+		if err := auditRetention.Close(ctx); err != nil {
+			logger.Errorf("Failed to stop audit retention job: %v", err)
+		}
+	}
+
+	if reencryption != nil {
+		if err := reencryption.Close(ctx); err != nil {
+			logger.Errorf("Failed to stop patient re-encryption job: %v", err)
+		}
+	}
+
+	// Alerts raised while draining still go through the audit writer
+	if accessDetector != nil {
+		if err := accessDetector.Close(ctx); err != nil {
+			logger.Errorf("Failed to stop access detector: %v", err)
+		}
+	}
+
+	// Write out queued audit entries; anything left over stays spilled on disk
+	if err := auditWriter.Close(ctx); err != nil {
+		logger.Errorf("Failed to flush audit trail: %v", err)
+	}
+
 	logger.Info("Server exited")
 }
 
-func setupRouter(cfg *config.Config, authHandler *auth.Handler, patientHandler *patient.Handler, encounterHandler *encounter.Handler, schedulingHandler *scheduling.Handler, userHandler *user.Handler) *gin.Engine {
+func setupRouter(cfg *config.Config, jwtKeys *jwt.KeySet, sessionCache *auth.SessionCache, permissionCache *auth.PermissionCache, apiKeyAuthenticator *auth.APIKeyAuthenticator, accessPolicy *access.Policy, auditRecorder *audit.Recorder, authHandler *auth.Handler, ssoHandler *auth.SSOHandler, webAuthnHandler *auth.WebAuthnHandler, patientHandler *patient.Handler, encounterHandler *encounter.Handler, schedulingHandler *scheduling.Handler, userHandler *user.Handler, accessHandler *access.Handler, serviceAccountHandler *serviceaccount.Handler, auditHandler *audit.Handler, mpiHandler *mpi.Handler, numberingHandler *numbering.Handler) *gin.Engine {
 	// Set Gin mode
 	if cfg.IsProduction() {
 		gin.SetMode(gin.ReleaseMode)
@@ -166,6 +293,9 @@ func setupRouter(cfg *config.Config, authHandler *auth.Handler, patientHandler *
 	router.GET("/kaithheathcheck", healthCheck) // Handle likely typo in probe
 	router.GET("/ready", readyCheck)
 
+	// Public signing keys for services that verify our access tokens
+	router.GET("/.well-known/jwks.json", authHandler.JWKS)
+
 	// API v1 routes
 	v1 := router.Group("/api/v1")
 	{
@@ -174,61 +304,181 @@ func setupRouter(cfg *config.Config, authHandler *auth.Handler, patientHandler *
 		{
 			auth.POST("/masuk", authHandler.Login)
 			auth.POST("/segarkan", authHandler.RefreshToken)
+			auth.POST("/kata-sandi/kedaluwarsa", authHandler.ChangeExpiredPassword)
+			auth.POST("/mfa/verifikasi", authHandler.VerifyMFALogin)
+			auth.POST("/lupa-kata-sandi", authHandler.ForgotPassword)
+			auth.POST("/atur-ulang-kata-sandi", authHandler.ResetPassword)
+			auth.GET("/sso", ssoHandler.ListProviders)
+			auth.GET("/sso/:provider", ssoHandler.BeginLogin)
+			auth.GET("/sso/:provider/callback", ssoHandler.Callback)
+			auth.POST("/sso/:provider/masuk", ssoHandler.PasswordLogin)
+			auth.POST("/webauthn/verifikasi/mulai", webAuthnHandler.BeginSecondFactor)
+			auth.POST("/webauthn/verifikasi", webAuthnHandler.FinishSecondFactor)
+			auth.POST("/webauthn/masuk/mulai", webAuthnHandler.BeginPasswordless)
+			auth.POST("/webauthn/masuk", webAuthnHandler.FinishPasswordless)
 		}
 
 		// Protected routes (authentication required)
 		authenticated := v1.Group("")
-		authenticated.Use(middleware.AuthMiddleware(cfg.JWT.Secret))
-		authenticated.Use(middleware.AuditLog())
+		authenticated.Use(middleware.AuthMiddleware(jwtKeys, sessionCache, apiKeyAuthenticator))
+		authenticated.Use(middleware.AuditLog(auditRecorder))
+		authenticated.Use(accessPolicy.ResolveSubject())
+
+		// Every protected route declares the permissions it needs
+		requirePermission := func(permissions ...string) gin.HandlerFunc {
+			return middleware.RequirePermission(permissionCache, permissions...)
+		}
+
+		// Clinicians only reach patients they have an active care relationship with
+		patientAccess := accessPolicy.RequirePatientAccess("id")
+		encounterAccess := accessPolicy.RequireEncounterAccess("id")
+		appointmentAccess := accessPolicy.RequireAppointmentAccess("id")
 		{
-			// Auth routes
+			// Auth routes; available to every signed-in user
 			authRoutes := authenticated.Group("/otentikasi")
 			{
 				authRoutes.POST("/keluar", authHandler.Logout)
+				authRoutes.POST("/keluar-perangkat-lain", authHandler.LogoutOtherDevices)
+				authRoutes.GET("/sesi", authHandler.ListMySessions)
 				authRoutes.GET("/verifikasi", authHandler.VerifyToken)
+				authRoutes.POST("/ganti-kata-sandi", authHandler.ChangePassword)
+				authRoutes.POST("/mfa/daftar", authHandler.EnrollMFA)
+				authRoutes.POST("/mfa/konfirmasi", authHandler.ConfirmMFA)
+				authRoutes.POST("/mfa/kode-pemulihan", authHandler.RegenerateRecoveryCodes)
+				authRoutes.POST("/mfa/nonaktifkan", authHandler.DisableMFA)
+				authRoutes.POST("/webauthn/daftar/mulai", webAuthnHandler.BeginRegistration)
+				authRoutes.POST("/webauthn/daftar", webAuthnHandler.FinishRegistration)
+				authRoutes.GET("/webauthn/kredensial", webAuthnHandler.ListCredentials)
+				authRoutes.DELETE("/webauthn/kredensial/:id", webAuthnHandler.DeleteCredential)
 			}
 
 			// Patient routes
 			patients := authenticated.Group("/pasien")
 			{
-				patients.GET("", patientHandler.ListPatients)
-				patients.POST("", patientHandler.CreatePatient)
-				patients.GET("/:id", patientHandler.GetPatient)
-				patients.PUT("/:id", patientHandler.UpdatePatient)
-				// Only admins can delete patients
-				patients.DELETE("/:id", middleware.RequireRole(models.RoleAdmin), patientHandler.DeletePatient)
-				patients.GET("/:id/riwayat", patientHandler.GetPatientTimeline)
+				patients.GET("", requirePermission(models.PermissionViewPatients), patientHandler.ListPatients)
+				patients.POST("", requirePermission(models.PermissionCreatePatients), patientHandler.CreatePatient)
+				patients.GET("/mrn/:mrn", requirePermission(models.PermissionViewPatients), patientHandler.GetPatientByMRN)
+				patients.GET("/:id", requirePermission(models.PermissionViewPatients), patientAccess, patientHandler.GetPatient)
+				patients.PUT("/:id", requirePermission(models.PermissionUpdatePatients), patientAccess, patientHandler.UpdatePatient)
+				patients.DELETE("/:id", requirePermission(models.PermissionDeletePatients), patientAccess, patientHandler.DeletePatient)
+				patients.GET("/:id/riwayat", requirePermission(models.PermissionViewPatients, models.PermissionViewEncounters), patientAccess, patientHandler.GetPatientTimeline)
+
+				// Care team
+				patients.GET("/:id/tim-perawatan", requirePermission(models.PermissionViewPatients), patientAccess, accessHandler.ListCareTeam)
+				patients.POST("/:id/tim-perawatan", requirePermission(models.PermissionManageCareTeam), accessHandler.AssignCareTeam)
+				patients.DELETE("/:id/tim-perawatan/:assignment_id", requirePermission(models.PermissionManageCareTeam), patientAccess, accessHandler.EndCareTeamAssignment)
+
+				// Break-the-glass override; deliberately not behind patientAccess
+				patients.POST("/:id/akses-darurat", requirePermission(models.PermissionBreakGlass), accessHandler.BreakGlass)
+			}
+
+			// Emergency access review queue
+			emergencyAccess := authenticated.Group("/akses-darurat")
+			{
+				emergencyAccess.GET("", requirePermission(models.PermissionReviewEmergencyAccess), accessHandler.ListEmergencyAccess)
+				emergencyAccess.PUT("/:id/tinjauan", requirePermission(models.PermissionReviewEmergencyAccess), accessHandler.ReviewEmergencyAccess)
+			}
+
+			// Suspected duplicate patient work queue
+			duplicates := authenticated.Group("/duplikat-pasien")
+			{
+				duplicates.GET("", requirePermission(models.PermissionManageDuplicatePatients), mpiHandler.ListDuplicates)
+				duplicates.GET("/:id", requirePermission(models.PermissionManageDuplicatePatients), mpiHandler.GetDuplicate)
+				duplicates.PUT("/:id/tinjauan", requirePermission(models.PermissionManageDuplicatePatients), mpiHandler.ReviewDuplicate)
+			}
+
+			// Patient record merges
+			merges := authenticated.Group("/penggabungan-pasien")
+			{
+				merges.GET("", requirePermission(models.PermissionManageDuplicatePatients), patientHandler.ListMerges)
+				merges.POST("", requirePermission(models.PermissionManageDuplicatePatients), patientHandler.MergePatients)
+				merges.GET("/:id", requirePermission(models.PermissionManageDuplicatePatients), patientHandler.GetMerge)
+				merges.POST("/:id/pembatalan", requirePermission(models.PermissionManageDuplicatePatients), patientHandler.UnmergePatients)
+			}
+
+			// MRN and document number formats
+			numberFormats := authenticated.Group("/format-nomor")
+			{
+				numberFormats.GET("", requirePermission(models.PermissionManageNumbering), numberingHandler.ListFormats)
+				numberFormats.PUT("", requirePermission(models.PermissionManageNumbering), numberingHandler.SaveFormat)
 			}
 
 			// Encounter routes
 			encounters := authenticated.Group("/kunjungan")
 			{
-				encounters.GET("", encounterHandler.ListEncounters)
-				encounters.POST("", encounterHandler.CreateEncounter)
-				encounters.GET("/:id", encounterHandler.GetEncounter)
-				encounters.PUT("/:id/status", encounterHandler.UpdateEncounterStatus)
-				encounters.POST("/:id/selesai", encounterHandler.CompleteEncounter)
-				encounters.POST("/:id/catatan", encounterHandler.AddClinicalNote)
-				encounters.POST("/:id/diagnosis", encounterHandler.AddDiagnosis)
-				encounters.POST("/:id/tanda-vital", encounterHandler.RecordVitalSigns)
+				encounters.GET("", requirePermission(models.PermissionViewEncounters), encounterHandler.ListEncounters)
+				encounters.POST("", requirePermission(models.PermissionCreateEncounters), encounterHandler.CreateEncounter)
+				encounters.GET("/nomor/:number", requirePermission(models.PermissionViewEncounters), encounterHandler.GetEncounterByNumber)
+				encounters.GET("/:id", requirePermission(models.PermissionViewEncounters), encounterAccess, encounterHandler.GetEncounter)
+				encounters.PUT("/:id/status", requirePermission(models.PermissionUpdateEncounters), encounterAccess, encounterHandler.UpdateEncounterStatus)
+				encounters.POST("/:id/selesai", requirePermission(models.PermissionUpdateEncounters), encounterAccess, encounterHandler.CompleteEncounter)
+				encounters.POST("/:id/catatan", requirePermission(models.PermissionCreateClinicalNotes), encounterAccess, encounterHandler.AddClinicalNote)
+				encounters.POST("/:id/diagnosis", requirePermission(models.PermissionManageDiagnoses), encounterAccess, encounterHandler.AddDiagnosis)
+				encounters.POST("/:id/tanda-vital", requirePermission(models.PermissionRecordVitalSigns), encounterAccess, encounterHandler.RecordVitalSigns)
 			}
 
 			// Appointment/Scheduling routes
 			appointments := authenticated.Group("/janji-temu")
 			{
-				appointments.GET("", schedulingHandler.ListAppointments)
-				appointments.POST("", schedulingHandler.CreateAppointment)
-				appointments.GET("/:id", schedulingHandler.GetAppointment)
-				appointments.PUT("/:id", schedulingHandler.UpdateAppointment)
-				appointments.POST("/:id/check-in", schedulingHandler.CheckInAppointment)
-				appointments.POST("/:id/batal", schedulingHandler.CancelAppointment)
-				appointments.GET("/ketersediaan", schedulingHandler.GetAvailability)
+				appointments.GET("", requirePermission(models.PermissionViewAppointments), schedulingHandler.ListAppointments)
+				appointments.POST("", requirePermission(models.PermissionCreateAppointments), schedulingHandler.CreateAppointment)
+				appointments.GET("/nomor/:number", requirePermission(models.PermissionViewAppointments), schedulingHandler.GetAppointmentByNumber)
+				appointments.GET("/:id", requirePermission(models.PermissionViewAppointments), appointmentAccess, schedulingHandler.GetAppointment)
+				appointments.PUT("/:id", requirePermission(models.PermissionUpdateAppointments), appointmentAccess, schedulingHandler.UpdateAppointment)
+				appointments.POST("/:id/check-in", requirePermission(models.PermissionUpdateAppointments), appointmentAccess, schedulingHandler.CheckInAppointment)
+				appointments.POST("/:id/batal", requirePermission(models.PermissionUpdateAppointments), appointmentAccess, schedulingHandler.CancelAppointment)
+				appointments.GET("/ketersediaan", requirePermission(models.PermissionViewAppointments), schedulingHandler.GetAvailability)
 			}
 
 			// User routes
 			users := authenticated.Group("/pengguna")
 			{
-				users.GET("", userHandler.ListUsers)
+				users.GET("", requirePermission(models.PermissionViewUsers), userHandler.ListUsers)
+				users.POST("", requirePermission(models.PermissionManageUsers), userHandler.CreateUser)
+				users.GET("/:id", requirePermission(models.PermissionViewUsers), userHandler.GetUser)
+				users.PUT("/:id", requirePermission(models.PermissionManageUsers), userHandler.UpdateUser)
+				users.PUT("/:id/status", requirePermission(models.PermissionManageUsers), userHandler.SetUserStatus)
+				users.POST("/:id/buka-kunci", requirePermission(models.PermissionManageUsers), userHandler.UnlockUser)
+				users.POST("/:id/peran", requirePermission(models.PermissionManageUsers), userHandler.AssignRoles)
+				users.DELETE("/:id/peran/:role", requirePermission(models.PermissionManageUsers), userHandler.RemoveRole)
+
+				// Credential and session administration
+				users.GET("/:id/sesi", requirePermission(models.PermissionManageUsers), authHandler.ListUserSessions)
+				users.DELETE("/:id/sesi", requirePermission(models.PermissionManageUsers), authHandler.RevokeAllSessions)
+				users.DELETE("/:id/sesi/:session_id", requirePermission(models.PermissionManageUsers), authHandler.RevokeSession)
+				users.POST("/:id/kata-sandi-sementara", requirePermission(models.PermissionManageUsers), authHandler.IssueTemporaryPassword)
+			}
+
+			// Role and permission administration
+			roles := authenticated.Group("/peran")
+			{
+				roles.GET("", requirePermission(models.PermissionManageRoles), userHandler.ListRoles)
+				roles.POST("", requirePermission(models.PermissionManageRoles), userHandler.CreateRole)
+				roles.GET("/:id", requirePermission(models.PermissionManageRoles), userHandler.GetRole)
+				roles.PUT("/:id", requirePermission(models.PermissionManageRoles), userHandler.UpdateRole)
+				roles.DELETE("/:id", requirePermission(models.PermissionManageRoles), userHandler.DeleteRole)
+				roles.PUT("/:id/izin", requirePermission(models.PermissionManageRoles), userHandler.SetRolePermissions)
+			}
+			authenticated.GET("/izin", requirePermission(models.PermissionManageRoles), userHandler.ListPermissions)
+
+			// Service accounts for machine-to-machine integrations
+			serviceAccounts := authenticated.Group("/akun-layanan")
+			{
+				serviceAccounts.GET("", requirePermission(models.PermissionManageServiceAccounts), serviceAccountHandler.ListServiceAccounts)
+				serviceAccounts.POST("", requirePermission(models.PermissionManageServiceAccounts), serviceAccountHandler.CreateServiceAccount)
+				serviceAccounts.GET("/:id", requirePermission(models.PermissionManageServiceAccounts), serviceAccountHandler.GetServiceAccount)
+				serviceAccounts.PUT("/:id/status", requirePermission(models.PermissionManageServiceAccounts), serviceAccountHandler.SetServiceAccountActive)
+				serviceAccounts.POST("/:id/kunci", requirePermission(models.PermissionManageServiceAccounts), serviceAccountHandler.CreateAPIKey)
+				serviceAccounts.DELETE("/:id/kunci/:key_id", requirePermission(models.PermissionManageServiceAccounts), serviceAccountHandler.RevokeAPIKey)
+			}
+
+			// Audit trail
+			auditRoutes := authenticated.Group("/audit")
+			{
+				auditRoutes.GET("", requirePermission(models.PermissionViewAuditLog), auditHandler.SearchAuditLogs)
+				auditRoutes.GET("/ekspor", requirePermission(models.PermissionViewAuditLog), auditHandler.ExportAuditLogs)
+				auditRoutes.GET("/pasien/:id/akses", requirePermission(models.PermissionViewAuditLog), auditHandler.GetPatientAccessReport)
+				auditRoutes.GET("/perubahan/:resource/:id", requirePermission(models.PermissionViewAuditLog), auditHandler.GetChangeHistory)
 			}
 		}
 	}
@@ -280,21 +530,39 @@ func autoMigrate(db *database.DB) error {
 		&models.Role{},
 		&models.Permission{},
 		&models.Session{},
+		&models.MFARecoveryCode{},
+		&models.PasswordHistory{},
+		&models.PasswordResetToken{},
 		&models.Patient{},
 		&models.Allergy{},
 		&models.Medication{},
+		&models.PatientDuplicate{},
+		&models.PatientMerge{},
+		&models.PatientMRNAlias{},
+		&models.NumberFormat{},
+		&models.DataKey{},
 		&models.Encounter{},
 		&models.ClinicalNote{},
 		&models.Diagnosis{},
 		&models.Procedure{},
 		&models.VitalSign{},
 		&models.Appointment{},
+		&models.CareTeamAssignment{},
+		&models.EmergencyAccess{},
+		&models.ServiceAccount{},
+		&models.APIKey{},
+		&models.UserIdentity{},
+		&models.SSOLoginState{},
+		&models.WebAuthnCredential{},
+		&models.WebAuthnChallenge{},
 		&models.Order{},
 		&models.LabTest{},
 		&models.LabResult{},
 		&models.RadiologyExam{},
 		&models.Prescription{},
 		&models.AuditLog{},
+		&models.AuditArchive{},
+		&models.LegalHold{},
 	}
 
 	for _, model := range models {
@@ -303,6 +571,11 @@ func autoMigrate(db *database.DB) error {
 		}
 	}
 
+	// The audit trail is append-only
+	if err := audit.ProtectTable(db.DB); err != nil {
+		return fmt.Errorf("failed to protect audit log: %w", err)
+	}
+
 	logger.Info("Database migrations completed successfully")
 	return nil
 }
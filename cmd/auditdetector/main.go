@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/hospital-emr/backend/internal/audit"
+	"github.com/hospital-emr/backend/internal/common/config"
+	"github.com/hospital-emr/backend/internal/common/database"
+	"github.com/hospital-emr/backend/internal/common/logger"
+	"github.com/hospital-emr/backend/internal/detector"
+	"github.com/hospital-emr/backend/pkg/messaging"
+)
+
+// auditdetector evaluates audit entries the API publishes on NATS when
+// DETECTOR_MODE=nats. Several instances may run; each entry is evaluated by
+// one of them.
+func main() {
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Initialize logger
+	logger.Init(logger.Config{
+		Level:  cfg.App.LogLevel,
+		Format: cfg.App.LogFormat,
+	})
+
+	if cfg.Detector.Mode != config.DetectorModeNATS {
+		logger.Fatalf("DETECTOR_MODE must be %s to run the detector as a separate process", config.DetectorModeNATS)
+	}
+
+	// Connect to database
+	db, err := database.New(cfg)
+	if err != nil {
+		logger.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	// Connect to NATS
+	natsClient, err := messaging.NewNATSClient(cfg.NATS.URL)
+	if err != nil {
+		logger.Fatalf("Failed to connect to NATS: %v", err)
+	}
+	defer natsClient.Close()
+
+	var chain *audit.Chain
+	if cfg.Audit.ChainEnabled {
+		chain = audit.NewChain([]byte(cfg.Audit.HMACKey))
+	}
+	accessDetector, err := detector.New(db.DB, audit.NewRecorder(db.DB, chain), natsClient, cfg)
+	if err != nil {
+		logger.Fatalf("Failed to start access detector: %v", err)
+	}
+
+	subscription, err := accessDetector.Subscribe(natsClient)
+	if err != nil {
+		logger.Fatalf("Failed to subscribe to audit events: %v", err)
+	}
+	logger.Info("Watching audit events for suspicious access")
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	logger.Info("Shutting down access detector...")
+	if err := subscription.Unsubscribe(); err != nil {
+		logger.Errorf("Failed to unsubscribe from audit events: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := accessDetector.Close(ctx); err != nil {
+		logger.Errorf("Failed to stop access detector: %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/audit"
+	"github.com/hospital-emr/backend/internal/common/config"
+	"github.com/hospital-emr/backend/internal/common/database"
+	"github.com/hospital-emr/backend/internal/common/logger"
+	"github.com/hospital-emr/backend/internal/models"
+)
+
+const usage = `Usage: auditretention COMMAND [options]
+
+  partition       Convert audit_logs to monthly partitions (locks the table; run in a maintenance window)
+  run             Create upcoming partitions, archive old ones and purge expired archives
+  archive         Archive one partition now
+                    -partition NAME    e.g. audit_logs_y2024m03
+  archives        List archives
+  restore         Restore an archive into audit_logs_restored_* for investigation
+                    -partition NAME
+  drop-restored   Drop the table an archive was restored into
+                    -partition NAME
+  hold            Place a legal hold that exempts a patient's or user's entries from purging
+                    -patient ID | -user ID
+                    -reason TEXT -reference CASE -by NAME
+  release         Release a legal hold
+                    -id ID -by NAME
+  holds           List active legal holds
+                    -all               include released holds`
+
+var commands = map[string]bool{
+	"partition": true, "run": true, "archive": true, "archives": true, "restore": true,
+	"drop-restored": true, "hold": true, "release": true, "holds": true,
+}
+
+func main() {
+	if len(os.Args) < 2 || !commands[os.Args[1]] {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+
+	command := os.Args[1]
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	partition := flags.String("partition", "", "partition name")
+	patientID := flags.String("patient", "", "patient ID")
+	userID := flags.String("user", "", "user ID")
+	reason := flags.String("reason", "", "reason for the legal hold")
+	reference := flags.String("reference", "", "case or request number")
+	by := flags.String("by", "", "who is placing or releasing the hold")
+	holdID := flags.String("id", "", "legal hold ID")
+	all := flags.Bool("all", false, "include released holds")
+	_ = flags.Parse(os.Args[2:])
+
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Initialize logger
+	logger.Init(logger.Config{
+		Level:  "info",
+		Format: "console",
+	})
+
+	// Connect to database
+	db, err := database.New(cfg)
+	if err != nil {
+		logger.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	var chain *audit.Chain
+	if cfg.Audit.ChainEnabled {
+		chain = audit.NewChain([]byte(cfg.Audit.HMACKey))
+	}
+	retention := audit.NewRetention(db.DB, chain, audit.NewRecorder(db.DB, chain), audit.RetentionConfig{
+		ArchiveDir:     cfg.Audit.ArchiveDir,
+		OnlineMonths:   cfg.Audit.OnlineMonths,
+		RetentionYears: cfg.Security.AuditLogRetentionYears,
+		MonthsAhead:    cfg.Audit.PartitionMonthsAhead,
+	})
+	ctx := context.Background()
+
+	switch command {
+	case "partition":
+		if err := audit.Partition(ctx, db.DB, cfg.Audit.PartitionMonthsAhead); err != nil {
+			logger.Fatalf("Failed to partition audit_logs: %v", err)
+		}
+		logger.Info("audit_logs is partitioned by month")
+
+	case "run":
+		report, err := retention.Run(ctx, time.Now())
+		if err != nil {
+			logger.Fatalf("Retention run failed: %v", err)
+		}
+		printJSON(report)
+
+	case "archive":
+		requireFlag("partition", *partition)
+		archive, err := retention.ArchivePartition(ctx, *partition)
+		if err != nil {
+			logger.Fatalf("Failed to archive %s: %v", *partition, err)
+		}
+		printJSON(archive)
+
+	case "archives":
+		archives, err := retention.Archives(ctx)
+		if err != nil {
+			logger.Fatalf("Failed to list archives: %v", err)
+		}
+		printJSON(archives)
+
+	case "restore":
+		requireFlag("partition", *partition)
+		report, err := retention.Restore(ctx, *partition)
+		if err != nil {
+			logger.Fatalf("Failed to restore %s: %v", *partition, err)
+		}
+		printJSON(report)
+		if report.Break != nil {
+			logger.Errorf("Restored entries fail chain verification at entry %d: %s", report.Break.Sequence, report.Break.Reason)
+			os.Exit(1)
+		}
+
+	case "drop-restored":
+		requireFlag("partition", *partition)
+		if err := retention.DropRestored(ctx, *partition); err != nil {
+			logger.Fatalf("Failed to drop restored %s: %v", *partition, err)
+		}
+
+	case "hold":
+		hold := &models.LegalHold{Reason: *reason, Reference: *reference, PlacedBy: *by}
+		switch {
+		case *patientID != "" && *userID == "":
+			hold.SubjectType, hold.SubjectID = models.LegalHoldPatient, parseID("patient", *patientID)
+		case *userID != "" && *patientID == "":
+			hold.SubjectType, hold.SubjectID = models.LegalHoldUser, parseID("user", *userID)
+		default:
+			fmt.Println("Exactly one of -patient or -user is required")
+			os.Exit(2)
+		}
+		if err := retention.PlaceHold(ctx, hold); err != nil {
+			logger.Fatalf("Failed to place legal hold: %v", err)
+		}
+		printJSON(hold)
+
+	case "release":
+		requireFlag("id", *holdID)
+		if err := retention.ReleaseHold(ctx, parseID("id", *holdID), *by); err != nil {
+			logger.Fatalf("Failed to release legal hold: %v", err)
+		}
+
+	case "holds":
+		holds, err := retention.Holds(ctx, *all)
+		if err != nil {
+			logger.Fatalf("Failed to list legal holds: %v", err)
+		}
+		printJSON(holds)
+	}
+}
+
+func requireFlag(name, value string) {
+	if value == "" {
+		fmt.Printf("-%s is required\n", name)
+		os.Exit(2)
+	}
+}
+
+func parseID(name, value string) uuid.UUID {
+	id, err := uuid.Parse(value)
+	if err != nil {
+		fmt.Printf("-%s must be a UUID\n", name)
+		os.Exit(2)
+	}
+	return id
+}
+
+func printJSON(value interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(value)
+}
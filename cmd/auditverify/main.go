@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/hospital-emr/backend/internal/audit"
+	"github.com/hospital-emr/backend/internal/common/config"
+	"github.com/hospital-emr/backend/internal/common/database"
+	"github.com/hospital-emr/backend/internal/common/logger"
+)
+
+const usage = `Usage: auditverify [verify|checkpoint] [options]
+
+  verify      Walk the audit hash chain and report the first broken link
+                -checkpoints FILE  also require the chain to match exported checkpoints
+  checkpoint  Verify the chain and export signed checkpoints for offline storage
+                -every N           checkpoint every N entries as well as the head (default 10000)
+                -out FILE          write checkpoints to FILE instead of stdout`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+
+	command := os.Args[1]
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	checkpointsFile := flags.String("checkpoints", "", "exported checkpoints the chain must match")
+	every := flags.Int64("every", 10000, "checkpoint interval in entries")
+	out := flags.String("out", "", "checkpoint output file")
+
+	if command != "verify" && command != "checkpoint" {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+	_ = flags.Parse(os.Args[2:])
+
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+	if len(cfg.Audit.HMACKey) == 0 {
+		fmt.Println("AUDIT_HMAC_KEY is required to verify the audit hash chain")
+		os.Exit(1)
+	}
+	chain := audit.NewChain([]byte(cfg.Audit.HMACKey))
+
+	// Initialize logger
+	logger.Init(logger.Config{
+		Level:  "warn",
+		Format: "console",
+	})
+
+	var opts audit.VerifyOptions
+	if *checkpointsFile != "" {
+		if opts.Checkpoints, err = readCheckpoints(*checkpointsFile); err != nil {
+			fmt.Printf("Failed to read checkpoints: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if command == "checkpoint" {
+		opts.CheckpointEvery = *every
+	}
+
+	// Connect to database
+	db, err := database.New(cfg)
+	if err != nil {
+		logger.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	report, err := chain.Verify(context.Background(), db.DB, opts)
+	if err != nil {
+		fmt.Printf("Verification failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	if report.Break != nil {
+		fmt.Printf("BROKEN at entry %d (%s): %s\n", report.Break.Sequence, report.Break.EntryID, report.Break.Reason)
+		fmt.Printf("%d entries verified before the break\n", report.Entries)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "OK: %d entries verified, head is entry %d (%s)\n", report.Entries, report.LastSequence, report.LastHash)
+
+	if command == "checkpoint" {
+		if err := writeCheckpoints(*out, report.Checkpoints); err != nil {
+			fmt.Printf("Failed to write checkpoints: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "%d checkpoints exported\n", len(report.Checkpoints))
+	}
+}
+
+// readCheckpoints loads checkpoints exported as newline-delimited JSON
+func readCheckpoints(name string) ([]audit.Checkpoint, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var checkpoints []audit.Checkpoint
+	decoder := json.NewDecoder(file)
+	for decoder.More() {
+		var cp audit.Checkpoint
+		if err := decoder.Decode(&cp); err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, cp)
+	}
+	return checkpoints, nil
+}
+
+// writeCheckpoints writes one checkpoint per line
+func writeCheckpoints(name string, checkpoints []audit.Checkpoint) error {
+	output := os.Stdout
+	if name != "" {
+		file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		output = file
+	}
+
+	writer := bufio.NewWriter(output)
+	encoder := json.NewEncoder(writer)
+	for _, cp := range checkpoints {
+		if err := encoder.Encode(cp); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/hospital-emr/backend/internal/common/config"
+	"github.com/hospital-emr/backend/internal/common/database"
+	"github.com/hospital-emr/backend/internal/common/logger"
+	"github.com/hospital-emr/backend/internal/models"
+)
+
+const usage = `Usage: datakeys COMMAND
+
+  status   List the data keys and the KEK each is wrapped with
+  rotate   Start a new data key version; patient data is re-encrypted with it
+           by the API's re-encryption job or make encrypt-patients
+  rewrap   Rewrap the data keys with KEY_ACTIVE_KEK so older KEKs can be removed`
+
+var commands = map[string]bool{"status": true, "rotate": true, "rewrap": true}
+
+func main() {
+	if len(os.Args) < 2 || !commands[os.Args[1]] {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Initialize logger
+	logger.Init(logger.Config{
+		Level:  "info",
+		Format: "console",
+	})
+
+	// Connect to database
+	db, err := database.New(cfg)
+	if err != nil {
+		logger.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	cipher := models.FieldCipher()
+	if cipher == nil {
+		logger.Fatalf("Data encryption is not enabled")
+	}
+	keys := cipher.Keys()
+	ctx := context.Background()
+
+	switch os.Args[1] {
+	case "status":
+		if _, err := keys.ActiveVersion(ctx); err != nil {
+			logger.Fatalf("Failed to load data keys: %v", err)
+		}
+		var dataKeys []models.DataKey
+		if err := db.WithContext(ctx).Order("scope, version").Find(&dataKeys).Error; err != nil {
+			logger.Fatalf("Failed to list data keys: %v", err)
+		}
+		printJSON(dataKeys)
+
+	case "rotate":
+		version, err := keys.Rotate(ctx)
+		if err != nil {
+			logger.Fatalf("Failed to rotate data key: %v", err)
+		}
+		logger.Infof("Data key version %d is active", version)
+
+	case "rewrap":
+		rewrapped, err := keys.Rewrap(ctx)
+		if err != nil {
+			logger.Fatalf("Rewrap failed after %d data keys: %v", rewrapped, err)
+		}
+		logger.Infof("Rewrapped %d data keys with KEK %s", rewrapped, cfg.Keys.ActiveKEK)
+	}
+}
+
+func printJSON(value interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(value)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/hospital-emr/backend/internal/audit"
+	"github.com/hospital-emr/backend/internal/common/config"
+	"github.com/hospital-emr/backend/internal/common/database"
+	"github.com/hospital-emr/backend/internal/common/logger"
+	"github.com/hospital-emr/backend/internal/patient"
+)
+
+// encryptpatients encrypts the PHI of patients stored before data encryption
+// was enabled or with an older data key, and computes their lookup indexes.
+// Rows already under the active data key are skipped, so it is safe to run
+// repeatedly.
+func main() {
+	batchSize := flag.Int("batch", 500, "patients rewritten per batch")
+	flag.Parse()
+
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Initialize logger
+	logger.Init(logger.Config{
+		Level:  "info",
+		Format: "console",
+	})
+
+	// Connect to database
+	db, err := database.New(cfg)
+	if err != nil {
+		logger.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	logger.Info("Encrypting patient records...")
+	report, err := patient.EncryptExisting(audit.WithJob(context.Background(), "encryptpatients"), db.DB, *batchSize)
+	if err != nil {
+		if report != nil {
+			logger.Fatalf("Encryption failed after %d patients: %v", report.Encrypted, err)
+		}
+		logger.Fatalf("Encryption failed: %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(report)
+}
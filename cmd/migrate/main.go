@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/hospital-emr/backend/internal/audit"
 	"github.com/hospital-emr/backend/internal/common/config"
 	"github.com/hospital-emr/backend/internal/common/database"
 	"github.com/hospital-emr/backend/internal/common/logger"
@@ -63,21 +64,39 @@ func migrateUp(db *database.DB) {
 		&models.Role{},
 		&models.Permission{},
 		&models.Session{},
+		&models.MFARecoveryCode{},
+		&models.PasswordHistory{},
+		&models.PasswordResetToken{},
 		&models.Patient{},
 		&models.Allergy{},
 		&models.Medication{},
+		&models.PatientDuplicate{},
+		&models.PatientMerge{},
+		&models.PatientMRNAlias{},
+		&models.NumberFormat{},
+		&models.DataKey{},
 		&models.Encounter{},
 		&models.ClinicalNote{},
 		&models.Diagnosis{},
 		&models.Procedure{},
 		&models.VitalSign{},
 		&models.Appointment{},
+		&models.CareTeamAssignment{},
+		&models.EmergencyAccess{},
+		&models.ServiceAccount{},
+		&models.APIKey{},
+		&models.UserIdentity{},
+		&models.SSOLoginState{},
+		&models.WebAuthnCredential{},
+		&models.WebAuthnChallenge{},
 		&models.Order{},
 		&models.LabTest{},
 		&models.LabResult{},
 		&models.RadiologyExam{},
 		&models.Prescription{},
 		&models.AuditLog{},
+		&models.AuditArchive{},
+		&models.LegalHold{},
 	}
 
 	for _, model := range models {
@@ -87,6 +106,11 @@ func migrateUp(db *database.DB) {
 		logger.Infof("Migrated: %T", model)
 	}
 
+	// The audit trail is append-only
+	if err := audit.ProtectTable(db.DB); err != nil {
+		logger.Fatalf("Failed to protect audit log: %v", err)
+	}
+
 	logger.Info("All migrations completed successfully")
 }
 
@@ -102,22 +126,40 @@ func migrateDown(db *database.DB) {
 	}
 
 	models := []interface{}{
+		&models.LegalHold{},
+		&models.AuditArchive{},
 		&models.AuditLog{},
 		&models.Prescription{},
 		&models.RadiologyExam{},
 		&models.LabResult{},
 		&models.LabTest{},
 		&models.Order{},
+		&models.WebAuthnChallenge{},
+		&models.WebAuthnCredential{},
+		&models.SSOLoginState{},
+		&models.UserIdentity{},
+		&models.APIKey{},
+		&models.ServiceAccount{},
+		&models.EmergencyAccess{},
+		&models.CareTeamAssignment{},
 		&models.Appointment{},
 		&models.VitalSign{},
 		&models.Procedure{},
 		&models.Diagnosis{},
 		&models.ClinicalNote{},
 		&models.Encounter{},
+		&models.DataKey{},
+		&models.NumberFormat{},
+		&models.PatientMRNAlias{},
+		&models.PatientMerge{},
+		&models.PatientDuplicate{},
 		&models.Medication{},
 		&models.Allergy{},
 		&models.Patient{},
 		&models.Session{},
+		&models.MFARecoveryCode{},
+		&models.PasswordHistory{},
+		&models.PasswordResetToken{},
 		&models.Permission{},
 		&models.Role{},
 		&models.User{},
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/hospital-emr/backend/internal/audit"
+	"github.com/hospital-emr/backend/internal/common/config"
+	"github.com/hospital-emr/backend/internal/common/database"
+	"github.com/hospital-emr/backend/internal/common/logger"
+	"github.com/hospital-emr/backend/internal/mpi"
+)
+
+// mpiscan checks every patient against the master patient index and queues
+// suspected duplicates for review. Pairs already in the queue keep their
+// review, so it is safe to run repeatedly.
+func main() {
+	batchSize := flag.Int("batch", 500, "patients loaded per batch")
+	flag.Parse()
+
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Initialize logger
+	logger.Init(logger.Config{
+		Level:  "info",
+		Format: "console",
+	})
+
+	// Connect to database
+	db, err := database.New(cfg)
+	if err != nil {
+		logger.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	logger.Info("Scanning patients for duplicates...")
+	report, err := mpi.NewService(db.DB, cfg).Scan(audit.WithJob(context.Background(), "mpiscan"), *batchSize)
+	if err != nil {
+		logger.Fatalf("Duplicate scan failed after %d patients: %v", report.Patients, err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(report)
+}
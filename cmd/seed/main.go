@@ -59,17 +59,30 @@ func seedRolesAndPermissions(db *database.DB) {
 		{Name: "Create Patients", Code: models.PermissionCreatePatients, Resource: "patient", Action: "create"},
 		{Name: "Update Patients", Code: models.PermissionUpdatePatients, Resource: "patient", Action: "update"},
 		{Name: "Delete Patients", Code: models.PermissionDeletePatients, Resource: "patient", Action: "delete"},
+		{Name: "Manage Duplicate Patients", Code: models.PermissionManageDuplicatePatients, Resource: "patient", Action: "merge"},
 		{Name: "View Encounters", Code: models.PermissionViewEncounters, Resource: "encounter", Action: "view"},
 		{Name: "Create Encounters", Code: models.PermissionCreateEncounters, Resource: "encounter", Action: "create"},
 		{Name: "Update Encounters", Code: models.PermissionUpdateEncounters, Resource: "encounter", Action: "update"},
+		{Name: "Create Clinical Notes", Code: models.PermissionCreateClinicalNotes, Resource: "clinical_note", Action: "create"},
+		{Name: "Manage Diagnoses", Code: models.PermissionManageDiagnoses, Resource: "diagnosis", Action: "manage"},
+		{Name: "Record Vital Signs", Code: models.PermissionRecordVitalSigns, Resource: "vital_sign", Action: "create"},
+		{Name: "View Appointments", Code: models.PermissionViewAppointments, Resource: "appointment", Action: "view"},
+		{Name: "Create Appointments", Code: models.PermissionCreateAppointments, Resource: "appointment", Action: "create"},
+		{Name: "Update Appointments", Code: models.PermissionUpdateAppointments, Resource: "appointment", Action: "update"},
+		{Name: "Manage Care Team", Code: models.PermissionManageCareTeam, Resource: "care_team", Action: "manage"},
+		{Name: "Break the Glass", Code: models.PermissionBreakGlass, Resource: "emergency_access", Action: "create"},
+		{Name: "Review Emergency Access", Code: models.PermissionReviewEmergencyAccess, Resource: "emergency_access", Action: "review"},
 		{Name: "View Orders", Code: models.PermissionViewOrders, Resource: "order", Action: "view"},
 		{Name: "Create Orders", Code: models.PermissionCreateOrders, Resource: "order", Action: "create"},
 		{Name: "Update Orders", Code: models.PermissionUpdateOrders, Resource: "order", Action: "update"},
 		{Name: "View Results", Code: models.PermissionViewResults, Resource: "result", Action: "view"},
 		{Name: "Update Results", Code: models.PermissionUpdateResults, Resource: "result", Action: "update"},
+		{Name: "View Users", Code: models.PermissionViewUsers, Resource: "user", Action: "view"},
 		{Name: "Manage Users", Code: models.PermissionManageUsers, Resource: "user", Action: "manage"},
 		{Name: "Manage Roles", Code: models.PermissionManageRoles, Resource: "role", Action: "manage"},
+		{Name: "Manage Service Accounts", Code: models.PermissionManageServiceAccounts, Resource: "service_account", Action: "manage"},
 		{Name: "View Audit Log", Code: models.PermissionViewAuditLog, Resource: "audit", Action: "view"},
+		{Name: "Manage Number Formats", Code: models.PermissionManageNumbering, Resource: "number_format", Action: "manage"},
 	}
 
 	for i := range permissions {
@@ -86,45 +99,88 @@ func seedRolesAndPermissions(db *database.DB) {
 	db.FirstOrCreate(&adminRole, models.Role{Code: models.RoleAdmin})
 	db.Model(&adminRole).Association("Permissions").Replace(permissions)
 
-	doctorPermissions := []models.Permission{}
-	doctorPermissionCodes := []string{
-		models.PermissionViewPatients, models.PermissionCreatePatients, models.PermissionUpdatePatients,
-		models.PermissionViewEncounters, models.PermissionCreateEncounters, models.PermissionUpdateEncounters,
-		models.PermissionViewOrders, models.PermissionCreateOrders,
-		models.PermissionViewResults,
+	roles := []struct {
+		role            models.Role
+		permissionCodes []string
+	}{
+		{
+			role: models.Role{Name: "Doctor", Code: models.RoleDoctor, Description: "Medical doctor with clinical access", IsActive: true},
+			permissionCodes: []string{
+				models.PermissionViewPatients, models.PermissionCreatePatients, models.PermissionUpdatePatients,
+				models.PermissionViewEncounters, models.PermissionCreateEncounters, models.PermissionUpdateEncounters,
+				models.PermissionCreateClinicalNotes, models.PermissionManageDiagnoses, models.PermissionRecordVitalSigns,
+				models.PermissionViewAppointments, models.PermissionCreateAppointments, models.PermissionUpdateAppointments,
+				models.PermissionManageCareTeam, models.PermissionBreakGlass,
+				models.PermissionViewOrders, models.PermissionCreateOrders,
+				models.PermissionViewResults,
+				models.PermissionViewUsers,
+			},
+		},
+		{
+			role: models.Role{Name: "Nurse", Code: models.RoleNurse, Description: "Nursing staff", IsActive: true},
+			permissionCodes: []string{
+				models.PermissionViewPatients,
+				models.PermissionViewEncounters, models.PermissionUpdateEncounters,
+				models.PermissionCreateClinicalNotes, models.PermissionRecordVitalSigns,
+				models.PermissionViewAppointments,
+				models.PermissionBreakGlass,
+				models.PermissionViewOrders,
+				models.PermissionViewResults,
+				models.PermissionViewUsers,
+			},
+		},
+		{
+			role: models.Role{Name: "Receptionist", Code: models.RoleReceptionist, Description: "Front desk staff", IsActive: true},
+			permissionCodes: []string{
+				models.PermissionViewPatients, models.PermissionCreatePatients, models.PermissionUpdatePatients,
+				models.PermissionViewEncounters, models.PermissionCreateEncounters,
+				models.PermissionViewAppointments, models.PermissionCreateAppointments, models.PermissionUpdateAppointments,
+				models.PermissionViewUsers,
+			},
+		},
+		{
+			role: models.Role{Name: "Pharmacist", Code: models.RolePharmacist, Description: "Pharmacy staff", IsActive: true},
+			permissionCodes: []string{
+				models.PermissionViewPatients,
+				models.PermissionViewEncounters,
+				models.PermissionViewOrders, models.PermissionUpdateOrders,
+				models.PermissionViewResults,
+			},
+		},
+		{
+			role: models.Role{Name: "Lab Technician", Code: models.RoleLabTech, Description: "Laboratory staff", IsActive: true},
+			permissionCodes: []string{
+				models.PermissionViewPatients,
+				models.PermissionViewEncounters,
+				models.PermissionViewOrders, models.PermissionUpdateOrders,
+				models.PermissionViewResults, models.PermissionUpdateResults,
+			},
+		},
+		{
+			role: models.Role{Name: "Radiologist", Code: models.RoleRadiologist, Description: "Radiology staff", IsActive: true},
+			permissionCodes: []string{
+				models.PermissionViewPatients,
+				models.PermissionViewEncounters,
+				models.PermissionViewOrders, models.PermissionUpdateOrders,
+				models.PermissionViewResults, models.PermissionUpdateResults,
+			},
+		},
 	}
-	for _, code := range doctorPermissionCodes {
-		for _, perm := range permissions {
-			if perm.Code == code {
-				doctorPermissions = append(doctorPermissions, perm)
+
+	for _, r := range roles {
+		rolePermissions := []models.Permission{}
+		for _, code := range r.permissionCodes {
+			for _, perm := range permissions {
+				if perm.Code == code {
+					rolePermissions = append(rolePermissions, perm)
+				}
 			}
 		}
-	}
-
-	doctorRole := models.Role{
-		Name:        "Doctor",
-		Code:        models.RoleDoctor,
-		Description: "Medical doctor with clinical access",
-		IsActive:    true,
-	}
-	db.FirstOrCreate(&doctorRole, models.Role{Code: models.RoleDoctor})
-	db.Model(&doctorRole).Association("Permissions").Replace(doctorPermissions)
 
-	nurseRole := models.Role{
-		Name:        "Nurse",
-		Code:        models.RoleNurse,
-		Description: "Nursing staff",
-		IsActive:    true,
-	}
-	db.FirstOrCreate(&nurseRole, models.Role{Code: models.RoleNurse})
-
-	receptionistRole := models.Role{
-		Name:        "Receptionist",
-		Code:        models.RoleReceptionist,
-		Description: "Front desk staff",
-		IsActive:    true,
+		role := r.role
+		db.FirstOrCreate(&role, models.Role{Code: role.Code})
+		db.Model(&role).Association("Permissions").Replace(rolePermissions)
 	}
-	db.FirstOrCreate(&receptionistRole, models.Role{Code: models.RoleReceptionist})
 
 	logger.Info("Roles and permissions seeded successfully")
 }
@@ -163,6 +219,8 @@ func seedUsers(db *database.DB) {
 		Status:       models.UserStatusActive,
 		MFAEnabled:   false,
 		Department:   "Administration",
+		// Default credentials must be replaced at first login
+		MustChangePassword: true,
 	}
 
 	if err := db.Create(&adminUser).Error; err != nil {
@@ -184,16 +242,17 @@ func seedUsers(db *database.DB) {
 	db.Where("code = ?", models.RoleDoctor).First(&doctorRole)
 
 	doctorUser := models.User{
-		Email:         "doctor@hospital-emr.com",
-		PasswordHash:  doctorPassword,
-		FirstName:     "Budi",
-		LastName:      "Santoso",
-		PhoneNumber:   "+6281234567890",
-		Status:        models.UserStatusActive,
-		MFAEnabled:    false,
-		LicenseNumber: "STR-123456",
-		Specialty:     "Penyakit Dalam",
-		Department:    "Poli Umum",
+		Email:              "doctor@hospital-emr.com",
+		PasswordHash:       doctorPassword,
+		FirstName:          "Budi",
+		LastName:           "Santoso",
+		PhoneNumber:        "+6281234567890",
+		Status:             models.UserStatusActive,
+		MFAEnabled:         false,
+		LicenseNumber:      "STR-123456",
+		Specialty:          "Penyakit Dalam",
+		Department:         "Poli Umum",
+		MustChangePassword: true,
 	}
 
 	if err := db.Create(&doctorUser).Error; err == nil {
@@ -0,0 +1,152 @@
+package access
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// AssignCareTeamRequest represents a request to add a clinician to a patient's care team
+type AssignCareTeamRequest struct {
+	UserID   uuid.UUID  `json:"user_id" binding:"required"`
+	Role     string     `json:"role" binding:"required"`
+	Reason   string     `json:"reason"`
+	StartsAt *time.Time `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at"`
+}
+
+// ListCareTeam lists the care-team assignments of a patient. Ended assignments
+// are only included when includeEnded is set.
+func (p *Policy) ListCareTeam(ctx context.Context, patientID uuid.UUID, includeEnded bool) ([]models.CareTeamAssignment, error) {
+	query := p.db.WithContext(ctx).
+		Preload("User").
+		Where("patient_id = ?", patientID)
+
+	if !includeEnded {
+		query = query.Where("ends_at IS NULL OR ends_at > ?", time.Now())
+	}
+
+	var assignments []models.CareTeamAssignment
+	if err := query.Order("starts_at DESC").Find(&assignments).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+
+	for i := range assignments {
+		assignments[i].User.PasswordHash = ""
+		assignments[i].User.MFASecret = ""
+	}
+
+	return assignments, nil
+}
+
+// AssignCareTeam adds a clinician to a patient's care team, granting them
+// access to the patient's record for the assignment period. Restricted
+// subjects can only assign others to patients they already have access to,
+// so an assignment cannot be used to get around the care relationship rule.
+func (p *Policy) AssignCareTeam(ctx context.Context, patientID uuid.UUID, req *AssignCareTeamRequest, assignedBy uuid.UUID) (*models.CareTeamAssignment, error) {
+	if subject := SubjectFromContext(ctx); subject != nil && subject.Restricted {
+		if req.UserID == assignedBy {
+			return nil, errors.ErrForbidden.WithDetails("You cannot assign yourself to a patient's care team")
+		}
+		if err := p.CheckPatient(ctx, patientID); err != nil {
+			return nil, err
+		}
+	}
+
+	var patient models.Patient
+	if err := p.db.WithContext(ctx).Select("id").First(&patient, "id = ?", patientID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrPatientNotFound(patientID.String())
+		}
+		return nil, errors.ErrDatabaseError
+	}
+
+	var user models.User
+	if err := p.db.WithContext(ctx).
+		Where("id = ? AND status = ?", req.UserID, models.UserStatusActive).
+		First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrUserNotFound(req.UserID.String())
+		}
+		return nil, errors.ErrDatabaseError
+	}
+
+	startsAt := time.Now()
+	if req.StartsAt != nil {
+		startsAt = *req.StartsAt
+	}
+	if req.EndsAt != nil && !req.EndsAt.After(startsAt) {
+		return nil, errors.ErrValidation.WithDetails("ends_at must be after starts_at")
+	}
+
+	assignment := models.CareTeamAssignment{
+		PatientID:  patientID,
+		UserID:     user.ID,
+		Role:       req.Role,
+		Reason:     req.Reason,
+		StartsAt:   startsAt,
+		EndsAt:     req.EndsAt,
+		AssignedBy: assignedBy,
+	}
+
+	if err := p.db.WithContext(ctx).Create(&assignment).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+
+	p.recordCareTeamChange(ctx, assignedBy, patientID, assignment.ID, models.AuditActionCreate,
+		fmt.Sprintf("Added %s %s to care team as %s", user.FirstName, user.LastName, req.Role))
+
+	return &assignment, nil
+}
+
+// EndCareTeamAssignment ends a care-team assignment immediately
+func (p *Policy) EndCareTeamAssignment(ctx context.Context, patientID, assignmentID, endedBy uuid.UUID) error {
+	now := time.Now()
+	result := p.db.WithContext(ctx).
+		Model(&models.CareTeamAssignment{}).
+		Where("id = ? AND patient_id = ?", assignmentID, patientID).
+		Where("ends_at IS NULL OR ends_at > ?", now).
+		Updates(map[string]interface{}{
+			"ends_at":  now,
+			"ended_by": endedBy,
+		})
+	if result.Error != nil {
+		return errors.ErrDatabaseError
+	}
+	if result.RowsAffected == 0 {
+		return errors.ErrCareTeamAssignmentNotFound(assignmentID.String())
+	}
+
+	p.recordCareTeamChange(ctx, endedBy, patientID, assignmentID, models.AuditActionUpdate,
+		fmt.Sprintf("Ended care team assignment %s", assignmentID))
+
+	return nil
+}
+
+// recordCareTeamChange records a care-team change in the audit log
+func (p *Policy) recordCareTeamChange(ctx context.Context, userID, patientID, assignmentID uuid.UUID, action, description string) {
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"patient_id": patientID,
+	})
+
+	entry := &models.AuditLog{
+		UserID:      &userID,
+		Action:      action,
+		Resource:    "care_team_assignment",
+		ResourceID:  &assignmentID,
+		Description: description,
+		Metadata:    string(metadata),
+	}
+	if subject := SubjectFromContext(ctx); subject != nil {
+		entry.IPAddress = subject.IPAddress
+		entry.UserAgent = subject.UserAgent
+	}
+
+	p.audit.Record(ctx, entry)
+}
@@ -0,0 +1,191 @@
+package access
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/common/logger"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/hospital-emr/backend/pkg/messaging"
+	"gorm.io/gorm"
+)
+
+// BreakGlassRequest represents a request for emergency access to a patient
+type BreakGlassRequest struct {
+	Reason string `json:"reason" binding:"required,min=10"`
+}
+
+// ReviewEmergencyAccessRequest represents a privacy officer's verdict on an override
+type ReviewEmergencyAccessRequest struct {
+	Status models.EmergencyAccessReviewStatus `json:"status" binding:"required,oneof=justified unjustified"`
+	Notes  string                             `json:"notes"`
+}
+
+// BreakGlass grants the user a time-boxed override to one patient's record.
+// The override is recorded as a critical audit entry, announced to privacy
+// officers over NATS and queued for review.
+func (p *Policy) BreakGlass(ctx context.Context, patientID uuid.UUID, req *BreakGlassRequest, userID uuid.UUID) (*models.EmergencyAccess, error) {
+	var patient models.Patient
+	if err := p.db.WithContext(ctx).Select("id", "mrn").First(&patient, "id = ?", patientID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrPatientNotFound(patientID.String())
+		}
+		return nil, errors.ErrDatabaseError
+	}
+
+	grant := models.EmergencyAccess{
+		PatientID:    patientID,
+		UserID:       userID,
+		Reason:       req.Reason,
+		ExpiresAt:    time.Now().Add(p.breakGlassDuration),
+		ReviewStatus: models.EmergencyAccessPending,
+	}
+	subject := SubjectFromContext(ctx)
+	if subject != nil {
+		grant.IPAddress = subject.IPAddress
+	}
+
+	if err := p.db.WithContext(ctx).Create(&grant).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"emergency_access_id": grant.ID,
+		"reason":              grant.Reason,
+		"expires_at":          grant.ExpiresAt,
+	})
+	entry := &models.AuditLog{
+		UserID:      &userID,
+		Action:      models.AuditActionEmergencyAccess,
+		Resource:    "patient",
+		ResourceID:  &patientID,
+		Description: fmt.Sprintf("Break-the-glass access to patient %s", patient.MRN),
+		IPAddress:   grant.IPAddress,
+		Metadata:    string(metadata),
+		Severity:    models.AuditSeverityCritical,
+	}
+	if subject != nil {
+		entry.UserAgent = subject.UserAgent
+	}
+	p.audit.Record(ctx, entry)
+
+	if err := p.natsClient.Publish(messaging.SubjectEmergencyAccess, map[string]interface{}{
+		"emergency_access_id": grant.ID,
+		"patient_id":          patientID,
+		"mrn":                 patient.MRN,
+		"user_id":             userID,
+		"reason":              grant.Reason,
+		"expires_at":          grant.ExpiresAt,
+	}); err != nil {
+		logger.Errorf("Failed to publish emergency access %s: %v", grant.ID, err)
+	}
+
+	return &grant, nil
+}
+
+// ListEmergencyAccess lists break-the-glass overrides for review, newest first
+func (p *Policy) ListEmergencyAccess(ctx context.Context, page, pageSize int, status *models.EmergencyAccessReviewStatus, patientID *uuid.UUID) ([]models.EmergencyAccess, int64, error) {
+	var grants []models.EmergencyAccess
+	var total int64
+
+	query := p.db.WithContext(ctx).Model(&models.EmergencyAccess{})
+
+	// Apply filters
+	if status != nil {
+		query = query.Where("review_status = ?", *status)
+	}
+	if patientID != nil {
+		query = query.Where("patient_id = ?", *patientID)
+	}
+
+	// Get total count
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, errors.ErrDatabaseError
+	}
+
+	// Get paginated results
+	offset := (page - 1) * pageSize
+	if err := query.
+		Preload("User").
+		Offset(offset).
+		Limit(pageSize).
+		Order("created_at DESC").
+		Find(&grants).Error; err != nil {
+		return nil, 0, errors.ErrDatabaseError
+	}
+
+	for i := range grants {
+		grants[i].User.PasswordHash = ""
+		grants[i].User.MFASecret = ""
+	}
+
+	return grants, total, nil
+}
+
+// ReviewEmergencyAccess records a reviewer's verdict on an override. Each
+// override is reviewed once, and never by the user who invoked it.
+func (p *Policy) ReviewEmergencyAccess(ctx context.Context, id uuid.UUID, req *ReviewEmergencyAccessRequest, reviewerID uuid.UUID) (*models.EmergencyAccess, error) {
+	var grant models.EmergencyAccess
+	if err := p.db.WithContext(ctx).First(&grant, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrEmergencyAccessNotFound(id.String())
+		}
+		return nil, errors.ErrDatabaseError
+	}
+
+	if grant.UserID == reviewerID {
+		return nil, errors.ErrForbidden.WithDetails("You cannot review your own emergency access")
+	}
+
+	now := time.Now()
+	result := p.db.WithContext(ctx).
+		Model(&models.EmergencyAccess{}).
+		Where("id = ? AND review_status = ?", id, models.EmergencyAccessPending).
+		Updates(map[string]interface{}{
+			"review_status": req.Status,
+			"reviewed_by":   reviewerID,
+			"reviewed_at":   now,
+			"review_notes":  req.Notes,
+		})
+	if result.Error != nil {
+		return nil, errors.ErrDatabaseError
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.ErrEmergencyAccessReviewed(id.String())
+	}
+
+	grant.ReviewStatus = req.Status
+	grant.ReviewedBy = &reviewerID
+	grant.ReviewedAt = &now
+	grant.ReviewNotes = req.Notes
+
+	severity := models.AuditSeverityInfo
+	if req.Status == models.EmergencyAccessUnjustified {
+		severity = models.AuditSeverityWarning
+	}
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"patient_id":    grant.PatientID,
+		"user_id":       grant.UserID,
+		"review_status": req.Status,
+	})
+	entry := &models.AuditLog{
+		UserID:      &reviewerID,
+		Action:      models.AuditActionEmergencyReview,
+		Resource:    "emergency_access",
+		ResourceID:  &grant.ID,
+		Description: fmt.Sprintf("Emergency access reviewed as %s", req.Status),
+		Metadata:    string(metadata),
+		Severity:    severity,
+	}
+	if subject := SubjectFromContext(ctx); subject != nil {
+		entry.IPAddress = subject.IPAddress
+		entry.UserAgent = subject.UserAgent
+	}
+	p.audit.Record(ctx, entry)
+
+	return &grant, nil
+}
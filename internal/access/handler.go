@@ -0,0 +1,272 @@
+package access
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/models"
+)
+
+// Handler handles care-team and emergency access HTTP requests
+type Handler struct {
+	policy *Policy
+}
+
+// NewHandler creates a new access handler
+func NewHandler(policy *Policy) *Handler {
+	return &Handler{policy: policy}
+}
+
+// ListCareTeam godoc
+// @Summary List patient care team
+// @Description List the clinicians explicitly assigned to a patient's care team
+// @Tags care-team
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Patient ID"
+// @Param include_ended query bool false "Include ended assignments"
+// @Success 200 {array} models.CareTeamAssignment
+// @Failure 403 {object} errors.AppError
+// @Router /api/v1/pasien/{id}/tim-perawatan [get]
+func (h *Handler) ListCareTeam(c *gin.Context) {
+	patientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails("Invalid patient ID"))
+		return
+	}
+
+	assignments, err := h.policy.ListCareTeam(c.Request.Context(), patientID, c.Query("include_ended") == "true")
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, assignments)
+}
+
+// AssignCareTeam godoc
+// @Summary Assign care team member
+// @Description Grant a clinician access to a patient's record by adding them to the care team
+// @Tags care-team
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Patient ID"
+// @Param request body AssignCareTeamRequest true "Assignment"
+// @Success 201 {object} models.CareTeamAssignment
+// @Failure 400 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Router /api/v1/pasien/{id}/tim-perawatan [post]
+func (h *Handler) AssignCareTeam(c *gin.Context) {
+	patientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails("Invalid patient ID"))
+		return
+	}
+
+	var req AssignCareTeamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails(err.Error()))
+		return
+	}
+
+	userIDValue, _ := c.Get("user_id")
+	assignedBy, _ := userIDValue.(uuid.UUID)
+
+	assignment, err := h.policy.AssignCareTeam(c.Request.Context(), patientID, &req, assignedBy)
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, assignment)
+}
+
+// EndCareTeamAssignment godoc
+// @Summary End care team assignment
+// @Description Remove a clinician from a patient's care team
+// @Tags care-team
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Patient ID"
+// @Param assignment_id path string true "Assignment ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/pasien/{id}/tim-perawatan/{assignment_id} [delete]
+func (h *Handler) EndCareTeamAssignment(c *gin.Context) {
+	patientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails("Invalid patient ID"))
+		return
+	}
+
+	assignmentID, err := uuid.Parse(c.Param("assignment_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails("Invalid assignment ID"))
+		return
+	}
+
+	userIDValue, _ := c.Get("user_id")
+	endedBy, _ := userIDValue.(uuid.UUID)
+
+	if err := h.policy.EndCareTeamAssignment(c.Request.Context(), patientID, assignmentID, endedBy); err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Care team assignment ended successfully"})
+}
+
+// BreakGlass godoc
+// @Summary Break-the-glass emergency access
+// @Description Grant a time-boxed override to a patient's record outside any care relationship. The override is audited as critical and queued for review.
+// @Tags emergency-access
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Patient ID"
+// @Param request body BreakGlassRequest true "Justification"
+// @Success 201 {object} models.EmergencyAccess
+// @Failure 400 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/pasien/{id}/akses-darurat [post]
+func (h *Handler) BreakGlass(c *gin.Context) {
+	patientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails("Invalid patient ID"))
+		return
+	}
+
+	var req BreakGlassRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails(err.Error()))
+		return
+	}
+
+	userIDValue, _ := c.Get("user_id")
+	userID, _ := userIDValue.(uuid.UUID)
+
+	grant, err := h.policy.BreakGlass(c.Request.Context(), patientID, &req, userID)
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, grant)
+}
+
+// ListEmergencyAccess godoc
+// @Summary List emergency access overrides
+// @Description List break-the-glass overrides for privacy review
+// @Tags emergency-access
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Page size" default(20)
+// @Param status query string false "Review status (pending, justified, unjustified)"
+// @Param patient_id query string false "Patient ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/akses-darurat [get]
+func (h *Handler) ListEmergencyAccess(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	var status *models.EmergencyAccessReviewStatus
+	if statusStr := c.Query("status"); statusStr != "" {
+		s := models.EmergencyAccessReviewStatus(statusStr)
+		status = &s
+	}
+
+	var patientID *uuid.UUID
+	if patientIDStr := c.Query("patient_id"); patientIDStr != "" {
+		id, err := uuid.Parse(patientIDStr)
+		if err == nil {
+			patientID = &id
+		}
+	}
+
+	grants, total, err := h.policy.ListEmergencyAccess(c.Request.Context(), page, pageSize, status, patientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":        grants,
+		"total":       total,
+		"page":        page,
+		"page_size":   pageSize,
+		"total_pages": (total + int64(pageSize) - 1) / int64(pageSize),
+	})
+}
+
+// ReviewEmergencyAccess godoc
+// @Summary Review emergency access override
+// @Description Mark a break-the-glass override as justified or unjustified
+// @Tags emergency-access
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Emergency access ID"
+// @Param request body ReviewEmergencyAccessRequest true "Review"
+// @Success 200 {object} models.EmergencyAccess
+// @Failure 404 {object} errors.AppError
+// @Failure 409 {object} errors.AppError
+// @Router /api/v1/akses-darurat/{id}/tinjauan [put]
+func (h *Handler) ReviewEmergencyAccess(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails("Invalid emergency access ID"))
+		return
+	}
+
+	var req ReviewEmergencyAccessRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails(err.Error()))
+		return
+	}
+
+	userIDValue, _ := c.Get("user_id")
+	reviewerID, _ := userIDValue.(uuid.UUID)
+
+	grant, err := h.policy.ReviewEmergencyAccess(c.Request.Context(), id, &req, reviewerID)
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, grant)
+}
@@ -0,0 +1,124 @@
+package access
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// ResolveSubject middleware builds the access subject of the authenticated
+// user and stores it in the request context for services to apply the policy.
+// It must run after the auth middleware.
+func (p *Policy) ResolveSubject() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDValue, _ := c.Get("user_id")
+		userID, ok := userIDValue.(uuid.UUID)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, errors.ErrUnauthorized)
+			c.Abort()
+			return
+		}
+
+		rolesValue, _ := c.Get("roles")
+		roles, _ := rolesValue.([]string)
+
+		subject, err := p.NewSubject(c.Request.Context(), userID, roles)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, errors.ErrServiceUnavailable)
+			c.Abort()
+			return
+		}
+		subject.IPAddress = c.ClientIP()
+		subject.UserAgent = c.Request.UserAgent()
+
+		c.Request = c.Request.WithContext(WithSubject(c.Request.Context(), subject))
+		c.Next()
+	}
+}
+
+// RequirePatientAccess middleware checks access to the patient identified by
+// the given path parameter
+func (p *Policy) RequirePatientAccess(param string) gin.HandlerFunc {
+	return p.requireAccess(param, func(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
+		return id, nil
+	})
+}
+
+// RequireEncounterAccess middleware checks access to the patient of the
+// encounter identified by the given path parameter
+func (p *Policy) RequireEncounterAccess(param string) gin.HandlerFunc {
+	return p.requireAccess(param, func(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
+		return p.patientOf(ctx, &models.Encounter{}, id)
+	})
+}
+
+// RequireAppointmentAccess middleware checks access to the patient of the
+// appointment identified by the given path parameter
+func (p *Policy) RequireAppointmentAccess(param string) gin.HandlerFunc {
+	return p.requireAccess(param, func(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
+		return p.patientOf(ctx, &models.Appointment{}, id)
+	})
+}
+
+// requireAccess resolves the patient behind a path parameter and applies the
+// policy. Malformed or unknown IDs are passed through so the handler can
+// report them as usual.
+func (p *Policy) requireAccess(param string, patientOf func(ctx context.Context, id uuid.UUID) (uuid.UUID, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		subject := SubjectFromContext(ctx)
+		if subject == nil || !subject.Restricted {
+			c.Next()
+			return
+		}
+
+		id, err := uuid.Parse(c.Param(param))
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		patientID, err := patientOf(ctx, id)
+		if err == gorm.ErrRecordNotFound {
+			c.Next()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errors.ErrDatabaseError)
+			c.Abort()
+			return
+		}
+
+		if err := p.CheckPatient(ctx, patientID); err != nil {
+			if appErr, ok := err.(*errors.AppError); ok {
+				c.JSON(appErr.StatusCode, appErr)
+			} else {
+				c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+			}
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// patientOf returns the patient ID of an encounter or appointment
+func (p *Policy) patientOf(ctx context.Context, model interface{}, id uuid.UUID) (uuid.UUID, error) {
+	var patientIDs []uuid.UUID
+	if err := p.db.WithContext(ctx).
+		Model(model).
+		Where("id = ?", id).
+		Pluck("patient_id", &patientIDs).Error; err != nil {
+		return uuid.Nil, err
+	}
+	if len(patientIDs) == 0 {
+		return uuid.Nil, gorm.ErrRecordNotFound
+	}
+	return patientIDs[0], nil
+}
@@ -0,0 +1,207 @@
+package access
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/audit"
+	"github.com/hospital-emr/backend/internal/common/config"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/hospital-emr/backend/pkg/messaging"
+	"gorm.io/gorm"
+)
+
+// Subject is the user on whose behalf a request accesses patient records
+type Subject struct {
+	UserID     uuid.UUID
+	Roles      []string
+	Department string
+	IPAddress  string
+	UserAgent  string
+	// Restricted subjects may only access patients they have an active care relationship with
+	Restricted bool
+}
+
+type subjectKey struct{}
+
+// WithSubject returns a context carrying the access subject
+func WithSubject(ctx context.Context, subject *Subject) context.Context {
+	return context.WithValue(ctx, subjectKey{}, subject)
+}
+
+// SubjectFromContext returns the access subject of the context, or nil for
+// system contexts such as background jobs
+func SubjectFromContext(ctx context.Context) *Subject {
+	subject, _ := ctx.Value(subjectKey{}).(*Subject)
+	return subject
+}
+
+// Policy decides whether a user may access a patient's record. Clinicians in
+// a restricted role can only reach a patient through an active relationship:
+// an open encounter they are the provider of, an upcoming appointment with
+// them, an explicit care-team assignment, an open encounter in their
+// department, or an unexpired break-the-glass override.
+type Policy struct {
+	db                 *gorm.DB
+	natsClient         *messaging.NATSClient
+	restrictedRoles    map[string]struct{}
+	exemptRoles        map[string]struct{}
+	appointmentWindow  time.Duration
+	breakGlassDuration time.Duration
+	audit              *audit.Recorder
+}
+
+// NewPolicy creates a new access policy
+func NewPolicy(db *gorm.DB, natsClient *messaging.NATSClient, cfg *config.Config, auditRecorder *audit.Recorder) *Policy {
+	p := &Policy{
+		db:                 db,
+		natsClient:         natsClient,
+		restrictedRoles:    make(map[string]struct{}),
+		exemptRoles:        make(map[string]struct{}),
+		appointmentWindow:  time.Duration(cfg.Security.CareAppointmentWindowDays) * 24 * time.Hour,
+		breakGlassDuration: cfg.GetBreakGlassDuration(),
+		audit:              auditRecorder,
+	}
+	for _, role := range cfg.Security.CareRelationshipRoles {
+		p.restrictedRoles[role] = struct{}{}
+	}
+	for _, role := range cfg.Security.CareAccessExemptRoles {
+		p.exemptRoles[role] = struct{}{}
+	}
+	return p
+}
+
+// NewSubject builds the access subject for a user. The department is only
+// looked up for restricted users since only they need it.
+func (p *Policy) NewSubject(ctx context.Context, userID uuid.UUID, roles []string) (*Subject, error) {
+	subject := &Subject{UserID: userID, Roles: roles}
+
+	restricted, exempt := false, false
+	for _, role := range roles {
+		if _, ok := p.restrictedRoles[role]; ok {
+			restricted = true
+		}
+		if _, ok := p.exemptRoles[role]; ok {
+			exempt = true
+		}
+	}
+	subject.Restricted = restricted && !exempt
+	if !subject.Restricted {
+		return subject, nil
+	}
+
+	var departments []string
+	if err := p.db.WithContext(ctx).
+		Model(&models.User{}).
+		Where("id = ?", userID).
+		Pluck("department", &departments).Error; err != nil {
+		return nil, err
+	}
+	if len(departments) > 0 {
+		subject.Department = strings.TrimSpace(departments[0])
+	}
+
+	return subject, nil
+}
+
+// CheckPatient returns PATIENT_ACCESS_DENIED unless the subject of the
+// context may access the patient. Denials are recorded in the audit log.
+func (p *Policy) CheckPatient(ctx context.Context, patientID uuid.UUID) error {
+	subject := SubjectFromContext(ctx)
+	if p == nil || subject == nil || !subject.Restricted {
+		return nil
+	}
+
+	var count int64
+	if err := p.db.WithContext(ctx).
+		Table("(?) AS accessible", p.accessiblePatients(ctx, subject)).
+		Where("accessible.patient_id = ?", patientID).
+		Count(&count).Error; err != nil {
+		return errors.ErrDatabaseError
+	}
+	if count > 0 {
+		return nil
+	}
+
+	p.recordDenial(ctx, subject, patientID)
+	return errors.ErrPatientAccessDenied(patientID.String())
+}
+
+// ScopePatients returns a GORM scope limiting a query to rows whose patient
+// column refers to a patient the subject of the context may access
+func (p *Policy) ScopePatients(ctx context.Context, column string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		subject := SubjectFromContext(ctx)
+		if p == nil || subject == nil || !subject.Restricted {
+			return db
+		}
+		return db.Where(column+" IN (?)", p.accessiblePatients(ctx, subject))
+	}
+}
+
+// accessiblePatients builds a subquery selecting the IDs of every patient the
+// subject currently has a care relationship with
+func (p *Policy) accessiblePatients(ctx context.Context, subject *Subject) *gorm.DB {
+	now := time.Now()
+
+	encounterRelation := "provider_id = @user"
+	if subject.Department != "" {
+		encounterRelation = "(provider_id = @user OR LOWER(department) = LOWER(@department))"
+	}
+
+	return p.db.WithContext(ctx).Raw(`
+		SELECT patient_id FROM encounters
+		WHERE deleted_at IS NULL AND status IN @open_encounters AND `+encounterRelation+`
+		UNION
+		SELECT patient_id FROM appointments
+		WHERE deleted_at IS NULL AND provider_id = @user AND status IN @upcoming_appointments
+			AND end_time >= @now AND start_time <= @window_end
+		UNION
+		SELECT patient_id FROM care_team_assignments
+		WHERE deleted_at IS NULL AND user_id = @user
+			AND starts_at <= @now AND (ends_at IS NULL OR ends_at > @now)
+		UNION
+		SELECT patient_id FROM emergency_accesses
+		WHERE deleted_at IS NULL AND user_id = @user AND expires_at > @now`,
+		map[string]interface{}{
+			"user":       subject.UserID,
+			"department": subject.Department,
+			"now":        now,
+			"window_end": now.Add(p.appointmentWindow),
+			"open_encounters": []models.EncounterStatus{
+				models.EncounterStatusScheduled,
+				models.EncounterStatusInProgress,
+			},
+			"upcoming_appointments": []models.AppointmentStatus{
+				models.AppointmentStatusScheduled,
+				models.AppointmentStatusConfirmed,
+				models.AppointmentStatusCheckedIn,
+				models.AppointmentStatusInProgress,
+			},
+		},
+	)
+}
+
+// recordDenial records a denied access attempt in the audit log
+func (p *Policy) recordDenial(ctx context.Context, subject *Subject, patientID uuid.UUID) {
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"roles":      subject.Roles,
+		"department": subject.Department,
+	})
+
+	p.audit.Record(ctx, &models.AuditLog{
+		UserID:      &subject.UserID,
+		Action:      models.AuditActionAccessDenied,
+		Resource:    "patient",
+		ResourceID:  &patientID,
+		Description: "Patient record access denied: no active care relationship",
+		IPAddress:   subject.IPAddress,
+		UserAgent:   subject.UserAgent,
+		Metadata:    string(metadata),
+		Severity:    models.AuditSeverityWarning,
+	})
+}
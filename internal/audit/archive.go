@@ -0,0 +1,210 @@
+package audit
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hospital-emr/backend/internal/models"
+)
+
+const (
+	archiveFileSuffix     = ".ndjson.gz"
+	archiveManifestSuffix = ".manifest.json"
+)
+
+// Segment is a run of consecutive chain sequences moved into an archive. The
+// hash before the run and the hash of its last entry let the chain still be
+// verified across the gap the run leaves in the database.
+type Segment struct {
+	First    int64  `json:"first"`
+	Last     int64  `json:"last"`
+	PrevHash string `json:"prev_hash"`
+	LastHash string `json:"last_hash"`
+}
+
+// archivePayload is the signed content of an archive record
+func archivePayload(archive *models.AuditArchive) string {
+	return fmt.Sprintf("audit-archive|%s|%s|%s|%s|%d|%s",
+		archive.Partition,
+		archive.PeriodStart.UTC().Format(time.RFC3339),
+		archive.PeriodEnd.UTC().Format(time.RFC3339),
+		archive.SHA256,
+		archive.Entries,
+		archive.Segments)
+}
+
+// SignArchive signs an archive record in place, so its segments cannot be
+// forged to hide entries deleted from the chain
+func (c *Chain) SignArchive(archive *models.AuditArchive) {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(archivePayload(archive)))
+	archive.Signature = hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyArchive reports whether an archive record was signed with the
+// chain's key
+func (c *Chain) VerifyArchive(archive *models.AuditArchive) bool {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(archivePayload(archive)))
+	signature, err := hex.DecodeString(archive.Signature)
+	return err == nil && hmac.Equal(signature, mac.Sum(nil))
+}
+
+// archiveSegments decodes the segments of an archive record
+func archiveSegments(archive *models.AuditArchive) ([]Segment, error) {
+	var segments []Segment
+	if archive.Segments == "" {
+		return nil, nil
+	}
+	if err := json.Unmarshal([]byte(archive.Segments), &segments); err != nil {
+		return nil, fmt.Errorf("archive %s: %w", archive.Partition, err)
+	}
+	return segments, nil
+}
+
+// archiveFile writes entries as gzip-compressed newline-delimited JSON. The
+// file is written under a temporary name and renamed once it is complete and
+// synced, so a crash never leaves a truncated archive behind.
+type archiveFile struct {
+	path    string
+	file    *os.File
+	digest  hash.Hash
+	buf     *bufio.Writer
+	gz      *gzip.Writer
+	encoder *json.Encoder
+	entries int64
+}
+
+func createArchiveFile(path string) (*archiveFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.New()
+	buf := bufio.NewWriter(io.MultiWriter(file, digest))
+	gz := gzip.NewWriter(buf)
+	return &archiveFile{
+		path:    path,
+		file:    file,
+		digest:  digest,
+		buf:     buf,
+		gz:      gz,
+		encoder: json.NewEncoder(gz),
+	}, nil
+}
+
+func (a *archiveFile) write(entries []models.AuditLog) error {
+	for i := range entries {
+		if err := a.encoder.Encode(&entries[i]); err != nil {
+			return err
+		}
+		a.entries++
+	}
+	return nil
+}
+
+// commit finishes the file and moves it into place, returning its checksum
+// and size
+func (a *archiveFile) commit() (string, int64, error) {
+	defer a.file.Close()
+
+	if err := a.gz.Close(); err != nil {
+		return "", 0, err
+	}
+	if err := a.buf.Flush(); err != nil {
+		return "", 0, err
+	}
+	if err := a.file.Sync(); err != nil {
+		return "", 0, err
+	}
+	info, err := a.file.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(a.path+".tmp", a.path); err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(a.digest.Sum(nil)), info.Size(), nil
+}
+
+// abort removes a partially written file
+func (a *archiveFile) abort() {
+	a.file.Close()
+	os.Remove(a.path + ".tmp")
+}
+
+// readArchive checks an archive file against its recorded checksum and hands
+// its entries to fn in batches. The checksum covers the whole file and is
+// only known at the end, so callers must not act on the entries until
+// readArchive returns without error.
+func readArchive(path, checksum string, batchSize int, fn func([]models.AuditLog) error) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	digest := sha256.New()
+	tee := io.TeeReader(file, digest)
+	gz, err := gzip.NewReader(bufio.NewReader(tee))
+	if err != nil {
+		return 0, err
+	}
+	defer gz.Close()
+
+	var count int64
+	decoder := json.NewDecoder(gz)
+	batch := make([]models.AuditLog, 0, batchSize)
+	for decoder.More() {
+		var entry models.AuditLog
+		if err := decoder.Decode(&entry); err != nil {
+			return count, fmt.Errorf("entry %d: %w", count+1, err)
+		}
+		batch = append(batch, entry)
+		count++
+		if len(batch) == batchSize {
+			if err := fn(batch); err != nil {
+				return count, err
+			}
+			batch = make([]models.AuditLog, 0, batchSize)
+		}
+	}
+	if len(batch) > 0 {
+		if err := fn(batch); err != nil {
+			return count, err
+		}
+	}
+
+	// Hash whatever follows the gzip stream too
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return count, err
+	}
+	if sum := hex.EncodeToString(digest.Sum(nil)); sum != checksum {
+		return count, fmt.Errorf("checksum mismatch: archive is %s, expected %s", sum, checksum)
+	}
+	return count, nil
+}
+
+// writeManifest stores the archive record next to the archive file so the
+// file is self-describing without the database
+func writeManifest(path string, archive *models.AuditArchive) error {
+	encoded, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(encoded, '\n'), 0o600)
+}
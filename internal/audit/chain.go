@@ -0,0 +1,204 @@
+package audit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// chainLockID is the advisory lock that serializes appends to the chain
+// across every API instance
+const chainLockID = 0x617564697463 // "auditc"
+
+// Chain seals audit entries into a tamper-evident hash chain. Each entry is
+// given the next sequence number and the HMAC of the entry before it, then
+// signed with a key reserved for the audit trail. Changing, removing or
+// reordering an entry breaks every link after it.
+type Chain struct {
+	key []byte
+}
+
+// NewChain creates a chain signed with the given key
+func NewChain(key []byte) *Chain {
+	return &Chain{key: key}
+}
+
+// chainedEntry fixes the fields covered by an entry's HMAC and their order
+type chainedEntry struct {
+	ID               uuid.UUID       `json:"id"`
+	Sequence         int64           `json:"sequence"`
+	Timestamp        string          `json:"timestamp"`
+	UserID           *uuid.UUID      `json:"user_id"`
+	Username         string          `json:"username"`
+	ServiceAccountID *uuid.UUID      `json:"service_account_id"`
+	Action           string          `json:"action"`
+	Resource         string          `json:"resource"`
+	ResourceID       *uuid.UUID      `json:"resource_id"`
+	Description      string          `json:"description"`
+	IPAddress        string          `json:"ip_address"`
+	UserAgent        string          `json:"user_agent"`
+	RequestMethod    string          `json:"request_method"`
+	RequestPath      string          `json:"request_path"`
+	StatusCode       int             `json:"status_code"`
+	RequestID        string          `json:"request_id"`
+	ChangesOld       json.RawMessage `json:"changes_old"`
+	ChangesNew       json.RawMessage `json:"changes_new"`
+	Metadata         json.RawMessage `json:"metadata"`
+	Severity         string          `json:"severity"`
+	PrevHash         string          `json:"prev_hash"`
+}
+
+// Sign returns the HMAC of an entry. JSON columns are canonicalized first
+// because PostgreSQL stores jsonb in its own normalized form.
+func (c *Chain) Sign(entry *models.AuditLog) (string, error) {
+	var sequence int64
+	if entry.Sequence != nil {
+		sequence = *entry.Sequence
+	}
+
+	payload := chainedEntry{
+		ID:               entry.ID,
+		Sequence:         sequence,
+		Timestamp:        entry.Timestamp.UTC().Format(time.RFC3339Nano),
+		UserID:           entry.UserID,
+		Username:         entry.Username,
+		ServiceAccountID: entry.ServiceAccountID,
+		Action:           entry.Action,
+		Resource:         entry.Resource,
+		ResourceID:       entry.ResourceID,
+		Description:      entry.Description,
+		IPAddress:        entry.IPAddress,
+		UserAgent:        entry.UserAgent,
+		RequestMethod:    entry.RequestMethod,
+		RequestPath:      entry.RequestPath,
+		StatusCode:       entry.StatusCode,
+		RequestID:        entry.RequestID,
+		Severity:         string(entry.Severity),
+		PrevHash:         entry.PrevHash,
+	}
+
+	var err error
+	if payload.ChangesOld, err = canonicalJSON(entry.ChangesOld); err != nil {
+		return "", fmt.Errorf("changes_old: %w", err)
+	}
+	if payload.ChangesNew, err = canonicalJSON(entry.ChangesNew); err != nil {
+		return "", fmt.Errorf("changes_new: %w", err)
+	}
+	if payload.Metadata, err = canonicalJSON(entry.Metadata); err != nil {
+		return "", fmt.Errorf("metadata: %w", err)
+	}
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write(encoded)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// canonicalJSON re-encodes a JSON document with sorted keys and no
+// insignificant whitespace, and numbers in one notation (jsonb rewrites 1e2
+// as 100). Empty columns are stored as {}.
+func canonicalJSON(value string) (json.RawMessage, error) {
+	if value == "" {
+		value = "{}"
+	}
+
+	var document interface{}
+	if err := json.Unmarshal([]byte(value), &document); err != nil {
+		return nil, err
+	}
+	return json.Marshal(document)
+}
+
+// seal links entries to the chain after prev and signs them
+func (c *Chain) seal(entries []*models.AuditLog, sequence int64, prevHash string) error {
+	for _, entry := range entries {
+		// PostgreSQL keeps microseconds; the signed timestamp must survive a round trip
+		entry.Timestamp = entry.Timestamp.UTC().Truncate(time.Microsecond)
+
+		sequence++
+		seq := sequence
+		entry.Sequence = &seq
+		entry.PrevHash = prevHash
+
+		hash, err := c.Sign(entry)
+		if err != nil {
+			return fmt.Errorf("audit entry %s: %w", entry.ID, err)
+		}
+		entry.HMAC = hash
+		prevHash = hash
+	}
+	return nil
+}
+
+// Append writes entries at the end of the chain. Appends are serialized with
+// an advisory lock so concurrent writers never fork the chain, and entries
+// already in the table, such as those from an interrupted replay, are skipped
+// rather than being given a second position.
+func (c *Chain) Append(ctx context.Context, db *gorm.DB, entries []*models.AuditLog, batchSize int) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", chainLockID).Error; err != nil {
+			return err
+		}
+
+		ids := make([]uuid.UUID, 0, len(entries))
+		for _, entry := range entries {
+			if entry.ID == uuid.Nil {
+				entry.ID = uuid.New()
+			}
+			if entry.Timestamp.IsZero() {
+				entry.Timestamp = time.Now().UTC()
+			}
+			ids = append(ids, entry.ID)
+		}
+
+		var existing []uuid.UUID
+		if err := tx.Model(&models.AuditLog{}).Where("id IN ?", ids).Pluck("id", &existing).Error; err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			written := make(map[uuid.UUID]bool, len(existing))
+			for _, id := range existing {
+				written[id] = true
+			}
+			pending := make([]*models.AuditLog, 0, len(entries))
+			for _, entry := range entries {
+				if !written[entry.ID] {
+					pending = append(pending, entry)
+				}
+			}
+			entries = pending
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+
+		var last models.AuditLog
+		var sequence int64
+		err := tx.Select("sequence", "hmac").
+			Where("sequence IS NOT NULL").
+			Order("sequence DESC").
+			Take(&last).Error
+		switch {
+		case err == nil:
+			sequence = *last.Sequence
+		case err != gorm.ErrRecordNotFound:
+			return err
+		}
+
+		if err := c.seal(entries, sequence, last.HMAC); err != nil {
+			return err
+		}
+		return tx.CreateInBatches(entries, batchSize).Error
+	})
+}
@@ -0,0 +1,95 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sealedEntries(t *testing.T, chain *Chain, n int) []*models.AuditLog {
+	entries := make([]*models.AuditLog, n)
+	for i := range entries {
+		entries[i] = &models.AuditLog{
+			ID:         uuid.New(),
+			Timestamp:  time.Now().Add(time.Duration(i) * time.Second),
+			Action:     models.AuditActionUpdate,
+			Resource:   "patient",
+			ChangesNew: `{"city":"Bandung","allergies":[1,2]}`,
+		}
+	}
+	require.NoError(t, chain.seal(entries, 0, ""))
+	return entries
+}
+
+func verifyEntries(chain *Chain, entries []*models.AuditLog, checkpoints ...Checkpoint) *ChainBreak {
+	verifier := newChainVerifier(chain, checkpoints, nil)
+	for _, entry := range entries {
+		if brk := verifier.next(entry); brk != nil {
+			return brk
+		}
+	}
+	return nil
+}
+
+func TestChainVerifies(t *testing.T) {
+	chain := NewChain([]byte("0123456789abcdef0123456789abcdef"))
+	entries := sealedEntries(t, chain, 5)
+
+	assert.Nil(t, verifyEntries(chain, entries))
+	assert.Equal(t, int64(5), *entries[4].Sequence)
+	assert.Equal(t, entries[3].HMAC, entries[4].PrevHash)
+
+	// jsonb rewrites documents in its own form
+	entries[2].ChangesNew = `{"allergies": [1, 2], "city": "Bandung"}`
+	assert.Nil(t, verifyEntries(chain, entries))
+}
+
+func TestChainDetectsTampering(t *testing.T) {
+	chain := NewChain([]byte("0123456789abcdef0123456789abcdef"))
+
+	t.Run("modified entry", func(t *testing.T) {
+		entries := sealedEntries(t, chain, 5)
+		entries[2].Username = "someone-else"
+		brk := verifyEntries(chain, entries)
+		require.NotNil(t, brk)
+		assert.Equal(t, int64(3), brk.Sequence)
+	})
+
+	t.Run("removed entry", func(t *testing.T) {
+		entries := sealedEntries(t, chain, 5)
+		brk := verifyEntries(chain, append(entries[:1], entries[2:]...))
+		require.NotNil(t, brk)
+		assert.Equal(t, int64(3), brk.Sequence)
+	})
+
+	t.Run("rewritten with another key", func(t *testing.T) {
+		entries := sealedEntries(t, NewChain([]byte("another key entirely, 32 bytes..")), 3)
+		brk := verifyEntries(chain, entries)
+		require.NotNil(t, brk)
+		assert.Equal(t, int64(1), brk.Sequence)
+	})
+
+	t.Run("rewritten chain no longer matches checkpoint", func(t *testing.T) {
+		original := sealedEntries(t, chain, 3)
+		cp := chain.checkpoint(original[1])
+		assert.True(t, chain.VerifyCheckpoint(&cp))
+
+		rewritten := sealedEntries(t, chain, 3)
+		brk := verifyEntries(chain, rewritten, cp)
+		require.NotNil(t, brk)
+		assert.Equal(t, int64(2), brk.Sequence)
+	})
+}
+
+func TestCheckpointSignature(t *testing.T) {
+	chain := NewChain([]byte("0123456789abcdef0123456789abcdef"))
+	cp := chain.checkpoint(sealedEntries(t, chain, 1)[0])
+	assert.True(t, chain.VerifyCheckpoint(&cp))
+
+	cp.Hash = "00" + cp.Hash[2:]
+	assert.False(t, chain.VerifyCheckpoint(&cp))
+}
@@ -0,0 +1,342 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/logger"
+	"github.com/hospital-emr/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	changesBeforeKey = "audit:changes_before"
+
+	// MaskedValue replaces secrets in recorded changes; a changed secret
+	// still shows up as a changed field
+	MaskedValue = "[MASKED]"
+
+	// maxTrackedRows bounds the rows loaded for a single bulk update or delete
+	maxTrackedRows = 1000
+
+	// unnamedJob names changes made outside a request by code that did not
+	// set a job with WithJob
+	unnamedJob = "system"
+)
+
+// untrackedColumns change on every write and carry no information of their own
+var untrackedColumns = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+	"deleted_at": true,
+}
+
+// snapshot holds a record's column values keyed by column name
+type snapshot map[string]interface{}
+
+// trackedRow is a record loaded around an update or delete
+type trackedRow struct {
+	id   interface{}
+	data snapshot
+}
+
+// changeTracker records field-level changes to models.Auditable records
+type changeTracker struct {
+	recorder *Recorder
+}
+
+// TrackChanges registers GORM callbacks that record every create, update and
+// delete of an auditable model with the fields it changed. Old and new values
+// are stored in ChangesOld and ChangesNew; secrets are masked.
+func TrackChanges(db *gorm.DB, recorder *Recorder) error {
+	t := &changeTracker{recorder: recorder}
+
+	if err := db.Callback().Create().After("gorm:create").Register("audit:track_create", t.afterCreate); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("gorm:update").Register("audit:load_update", t.loadBefore); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("audit:track_update", t.afterUpdate); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().Before("gorm:delete").Register("audit:load_delete", t.loadBefore); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("gorm:delete").Register("audit:track_delete", t.afterDelete)
+}
+
+// tracked reports whether the statement writes an auditable model
+func tracked(db *gorm.DB) bool {
+	if db.Statement.Schema == nil || db.Statement.Schema.PrioritizedPrimaryField == nil {
+		return false
+	}
+	_, ok := reflect.New(db.Statement.Schema.ModelType).Interface().(models.Auditable)
+	return ok
+}
+
+func (t *changeTracker) afterCreate(db *gorm.DB) {
+	if db.Error != nil || !tracked(db) {
+		return
+	}
+
+	s := db.Statement.Schema
+	forEachRecord(db.Statement.ReflectValue, func(rv reflect.Value) {
+		data := takeSnapshot(db.Statement.Context, s, rv)
+		// Unset fields are left out of a new record
+		for column, value := range data {
+			if value == nil || reflect.ValueOf(value).IsZero() {
+				delete(data, column)
+			}
+		}
+		id, _ := s.PrioritizedPrimaryField.ValueOf(db.Statement.Context, rv)
+		t.record(db, models.AuditActionCreate, trackedRow{id: id}, nil, data)
+	})
+}
+
+// loadBefore keeps the records an update or delete is about to change
+func (t *changeTracker) loadBefore(db *gorm.DB) {
+	if db.Error != nil || !tracked(db) {
+		return
+	}
+
+	rows, err := loadRows(db)
+	if err != nil {
+		logger.WithFields(map[string]interface{}{
+			"table": db.Statement.Schema.Table,
+			"error": err.Error(),
+		}).Error("Failed to load records for change tracking")
+		return
+	}
+	if len(rows) > 0 {
+		db.InstanceSet(changesBeforeKey, rows)
+	}
+}
+
+func (t *changeTracker) afterUpdate(db *gorm.DB) {
+	before, ok := trackedBefore(db)
+	if !ok {
+		return
+	}
+
+	ids := make([]interface{}, len(before))
+	for i, row := range before {
+		ids[i] = row.id
+	}
+	after, err := findRows(db, db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).
+		Where(clause.IN{Column: clause.PrimaryColumn, Values: ids}))
+	if err != nil {
+		logger.WithFields(map[string]interface{}{
+			"table": db.Statement.Schema.Table,
+			"error": err.Error(),
+		}).Error("Failed to reload records for change tracking")
+		return
+	}
+
+	current := make(map[interface{}]trackedRow, len(after))
+	for _, row := range after {
+		current[row.id] = row
+	}
+	for _, row := range before {
+		updated, ok := current[row.id]
+		if !ok {
+			continue
+		}
+		oldValues, newValues := diffSnapshots(row.data, updated.data)
+		if len(newValues) == 0 {
+			continue
+		}
+		t.record(db, models.AuditActionUpdate, updated, oldValues, newValues)
+	}
+}
+
+func (t *changeTracker) afterDelete(db *gorm.DB) {
+	before, ok := trackedBefore(db)
+	if !ok {
+		return
+	}
+	for _, row := range before {
+		t.record(db, models.AuditActionDelete, row, row.data, nil)
+	}
+}
+
+// trackedBefore returns the records loaded before a successful update or delete
+func trackedBefore(db *gorm.DB) ([]trackedRow, bool) {
+	if db.Error != nil || db.RowsAffected == 0 {
+		return nil, false
+	}
+	value, ok := db.InstanceGet(changesBeforeKey)
+	if !ok {
+		return nil, false
+	}
+	rows, ok := value.([]trackedRow)
+	return rows, ok
+}
+
+// loadRows reads the records matched by the statement's conditions and the
+// primary key of its model. Statements with neither are not tracked rather
+// than reading the whole table.
+func loadRows(db *gorm.DB) ([]trackedRow, error) {
+	stmt := db.Statement
+	query := db.Session(&gorm.Session{NewDB: true, SkipHooks: true})
+	conditions := false
+
+	if where, ok := stmt.Clauses["WHERE"]; ok {
+		if expr, ok := where.Expression.(clause.Where); ok && len(expr.Exprs) > 0 {
+			query = query.Clauses(expr)
+			conditions = true
+		}
+	}
+
+	if rv := reflect.Indirect(stmt.ReflectValue); rv.Kind() == reflect.Struct {
+		pk := stmt.Schema.PrioritizedPrimaryField
+		if id, zero := pk.ValueOf(stmt.Context, rv); !zero {
+			query = query.Where(clause.Eq{Column: clause.PrimaryColumn, Value: id})
+			conditions = true
+		}
+	}
+
+	if !conditions {
+		return nil, nil
+	}
+	return findRows(db, query)
+}
+
+// findRows runs query against the statement's model and snapshots each record
+func findRows(db *gorm.DB, query *gorm.DB) ([]trackedRow, error) {
+	s := db.Statement.Schema
+	records := reflect.New(reflect.SliceOf(s.ModelType))
+	if err := query.Limit(maxTrackedRows).Find(records.Interface()).Error; err != nil {
+		return nil, err
+	}
+
+	slice := records.Elem()
+	rows := make([]trackedRow, 0, slice.Len())
+	for i := 0; i < slice.Len(); i++ {
+		rv := slice.Index(i)
+		id, _ := s.PrioritizedPrimaryField.ValueOf(db.Statement.Context, rv)
+		rows = append(rows, trackedRow{id: id, data: takeSnapshot(db.Statement.Context, s, rv)})
+	}
+	return rows, nil
+}
+
+// forEachRecord calls fn for a single record or each record of a batch
+func forEachRecord(rv reflect.Value, fn func(reflect.Value)) {
+	rv = reflect.Indirect(rv)
+	switch rv.Kind() {
+	case reflect.Struct:
+		fn(rv)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if elem := reflect.Indirect(rv.Index(i)); elem.Kind() == reflect.Struct {
+				fn(elem)
+			}
+		}
+	}
+}
+
+// takeSnapshot returns the column values of a record
+func takeSnapshot(ctx context.Context, s *schema.Schema, rv reflect.Value) snapshot {
+	data := make(snapshot, len(s.DBNames))
+	for _, field := range s.Fields {
+		if field.DBName == "" || untrackedColumns[field.DBName] {
+			continue
+		}
+		value, _ := field.ValueOf(ctx, rv)
+		data[field.DBName] = value
+	}
+	return data
+}
+
+// diffSnapshots returns the old and new values of the columns that differ
+func diffSnapshots(before, after snapshot) (snapshot, snapshot) {
+	oldValues := make(snapshot)
+	newValues := make(snapshot)
+	for column, value := range after {
+		previous, _ := json.Marshal(before[column])
+		current, _ := json.Marshal(value)
+		if string(previous) != string(current) {
+			oldValues[column] = before[column]
+			newValues[column] = value
+		}
+	}
+	return oldValues, newValues
+}
+
+// maskedColumns returns the columns whose values are never written to the
+// audit trail: fields hidden from the API (json:"-") and fields tagged
+// audit:"mask"
+func maskedColumns(s *schema.Schema) map[string]bool {
+	masked := make(map[string]bool)
+	for _, field := range s.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		if field.Tag.Get("json") == "-" || field.Tag.Get("audit") == "mask" {
+			masked[field.DBName] = true
+		}
+	}
+	return masked
+}
+
+// encodeChanges serializes changed values with secrets masked
+func encodeChanges(s *schema.Schema, data snapshot) string {
+	if len(data) == 0 {
+		return "{}"
+	}
+
+	masked := maskedColumns(s)
+	out := make(map[string]interface{}, len(data))
+	for column, value := range data {
+		if masked[column] {
+			out[column] = MaskedValue
+		} else {
+			out[column] = value
+		}
+	}
+
+	encoded, err := json.Marshal(out)
+	if err != nil {
+		return "{}"
+	}
+	return string(encoded)
+}
+
+func (t *changeTracker) record(db *gorm.DB, action string, row trackedRow, oldValues, newValues snapshot) {
+	s := db.Statement.Schema
+	ctx := db.Statement.Context
+
+	entry := &models.AuditLog{
+		Action:      action,
+		Resource:    db.NamingStrategy.ColumnName("", s.Name),
+		Description: fmt.Sprintf("%s %s", action, s.Table),
+		ChangesOld:  encodeChanges(s, oldValues),
+		ChangesNew:  encodeChanges(s, newValues),
+		Metadata:    changeMetadata(ctx, s.Table),
+	}
+	if id, ok := row.id.(uuid.UUID); ok {
+		entry.ResourceID = &id
+	}
+
+	t.recorder.Record(ctx, entry)
+}
+
+// changeMetadata describes where a change came from. Outside a request no
+// user is acting, so the entry is left without one and names the job making
+// the change instead; the record's last editor did not make it.
+func changeMetadata(ctx context.Context, table string) string {
+	if ActorFromContext(ctx) != nil || ServiceAccountFromContext(ctx) != nil {
+		return fmt.Sprintf(`{"source":%q,"table":%q}`, changeTrackingSource, table)
+	}
+
+	job := JobFromContext(ctx)
+	if job == "" {
+		job = unnamedJob
+	}
+	return fmt.Sprintf(`{"source":%q,"table":%q,"job":%q}`, changeTrackingSource, table, job)
+}
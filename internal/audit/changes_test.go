@@ -0,0 +1,83 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm/schema"
+)
+
+func TestPatientChangesAreDiffedAndMasked(t *testing.T) {
+	s, err := schema.Parse(&models.Patient{}, &sync.Map{}, schema.NamingStrategy{})
+	require.NoError(t, err)
+
+	before := models.Patient{FirstName: "Siti", LastName: "Rahayu", SSN: "3174000000000001", City: "Jakarta"}
+	before.ID = uuid.New()
+	after := before
+	after.City = "Bandung"
+	after.SSN = "3174000000000002"
+	after.UpdatedBy = uuid.New()
+
+	ctx := context.Background()
+	oldValues, newValues := diffSnapshots(
+		takeSnapshot(ctx, s, reflect.ValueOf(before)),
+		takeSnapshot(ctx, s, reflect.ValueOf(after)),
+	)
+	assert.ElementsMatch(t, []string{"city", "ssn", "updated_by"}, keys(newValues))
+	assert.Equal(t, "Jakarta", oldValues["city"])
+
+	var encoded map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(encodeChanges(s, newValues)), &encoded))
+	assert.Equal(t, "Bandung", encoded["city"])
+	assert.Equal(t, MaskedValue, encoded["ssn"])
+	assert.Equal(t, "{}", encodeChanges(s, nil))
+}
+
+func TestHiddenFieldsAreMasked(t *testing.T) {
+	s, err := schema.Parse(&models.User{}, &sync.Map{}, schema.NamingStrategy{})
+	require.NoError(t, err)
+
+	masked := maskedColumns(s)
+	assert.True(t, masked["password_hash"])
+	assert.True(t, masked["mfa_secret"])
+	assert.False(t, masked["email"])
+}
+
+func TestChangeMetadataNamesJobOutsideRequests(t *testing.T) {
+	userID := uuid.New()
+	tests := []struct {
+		name string
+		ctx  context.Context
+		job  interface{}
+	}{
+		{"request", WithActor(context.Background(), &Actor{UserID: &userID}), nil},
+		{"service account", WithServiceAccount(context.Background(), &ServiceAccount{ID: uuid.New(), Name: "lab-sync"}), nil},
+		{"named job", WithJob(context.Background(), "encryptpatients"), "encryptpatients"},
+		{"unnamed job", context.Background(), unnamedJob},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var metadata map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(changeMetadata(tt.ctx, "patients")), &metadata))
+			assert.Equal(t, changeTrackingSource, metadata["source"])
+			assert.Equal(t, "patients", metadata["table"])
+			assert.Equal(t, tt.job, metadata["job"])
+		})
+	}
+}
+
+func keys(data snapshot) []string {
+	out := make([]string, 0, len(data))
+	for key := range data {
+		out = append(out, key)
+	}
+	return out
+}
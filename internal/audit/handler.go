@@ -0,0 +1,391 @@
+package audit
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/common/logger"
+	"github.com/hospital-emr/backend/internal/models"
+)
+
+// exportColumns are the CSV export columns, in order
+var exportColumns = []string{
+	"id", "sequence", "timestamp", "user_id", "username", "service_account_id",
+	"action", "resource", "resource_id", "description", "ip_address", "user_agent",
+	"request_method", "request_path", "status_code", "request_id", "severity",
+}
+
+// Handler handles audit trail HTTP requests
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a new audit handler
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// GetChangeHistory godoc
+// @Summary Get record change history
+// @Description List every recorded create, update and delete of a record with the old and new value of each changed field. Secrets are masked.
+// @Tags audit
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param resource path string true "Resource type, e.g. patient, encounter, diagnosis, allergy"
+// @Param id path string true "Record ID"
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Page size" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} errors.AppError
+// @Router /api/v1/audit/perubahan/{resource}/{id} [get]
+func (h *Handler) GetChangeHistory(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails("Invalid record ID"))
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	entries, total, err := h.service.ChangeHistory(c.Request.Context(), strings.ToLower(c.Param("resource")), id, page, pageSize)
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":        entries,
+		"total":       total,
+		"page":        page,
+		"page_size":   pageSize,
+		"total_pages": (total + int64(pageSize) - 1) / int64(pageSize),
+	})
+}
+
+// SearchAuditLogs godoc
+// @Summary Search audit trail
+// @Description Search audit entries by user, patient, resource, action, severity and time range, newest first
+// @Tags audit
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param user_id query string false "User ID"
+// @Param patient_id query string false "Patient ID; includes the patient's encounters and appointments"
+// @Param resource query string false "Resource type, e.g. patient, encounter"
+// @Param resource_id query string false "Resource ID"
+// @Param action query string false "Action, e.g. READ, UPDATE, EMERGENCY_ACCESS"
+// @Param severity query string false "Severity (info, warning, error, critical)"
+// @Param request_id query string false "Request ID"
+// @Param from query string false "Start time (RFC3339 or YYYY-MM-DD)"
+// @Param to query string false "End time (RFC3339, or YYYY-MM-DD inclusive)"
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Page size" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} errors.AppError
+// @Router /api/v1/audit [get]
+func (h *Handler) SearchAuditLogs(c *gin.Context) {
+	filter, err := parseSearchFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails(err.Error()))
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	entries, total, err := h.service.Search(c.Request.Context(), filter, page, pageSize)
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":        entries,
+		"total":       total,
+		"page":        page,
+		"page_size":   pageSize,
+		"total_pages": (total + int64(pageSize) - 1) / int64(pageSize),
+	})
+}
+
+// ExportAuditLogs godoc
+// @Summary Export audit trail
+// @Description Download every audit entry matching the search filters as CSV or newline-delimited JSON, oldest first
+// @Tags audit
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Security BearerAuth
+// @Param format query string false "Export format (csv, ndjson)" default(csv)
+// @Param user_id query string false "User ID"
+// @Param patient_id query string false "Patient ID; includes the patient's encounters and appointments"
+// @Param resource query string false "Resource type"
+// @Param resource_id query string false "Resource ID"
+// @Param action query string false "Action"
+// @Param severity query string false "Severity"
+// @Param request_id query string false "Request ID"
+// @Param from query string false "Start time (RFC3339 or YYYY-MM-DD)"
+// @Param to query string false "End time (RFC3339, or YYYY-MM-DD inclusive)"
+// @Success 200 {file} file
+// @Failure 400 {object} errors.AppError
+// @Router /api/v1/audit/ekspor [get]
+func (h *Handler) ExportAuditLogs(c *gin.Context) {
+	filter, err := parseSearchFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails(err.Error()))
+		return
+	}
+
+	format := strings.ToLower(c.DefaultQuery("format", "csv"))
+	var contentType string
+	switch format {
+	case "csv":
+		contentType = "text/csv; charset=utf-8"
+	case "ndjson":
+		contentType = "application/x-ndjson"
+	default:
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails("format must be csv or ndjson"))
+		return
+	}
+
+	filename := fmt.Sprintf("audit-%s.%s", time.Now().UTC().Format("20060102T150405Z"), format)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	var write func([]models.AuditLog) error
+	if format == "csv" {
+		writer := csv.NewWriter(c.Writer)
+		if err := writer.Write(exportColumns); err != nil {
+			return
+		}
+		write = func(entries []models.AuditLog) error {
+			for i := range entries {
+				if err := writer.Write(csvRecord(&entries[i])); err != nil {
+					return err
+				}
+			}
+			writer.Flush()
+			c.Writer.Flush()
+			return writer.Error()
+		}
+	} else {
+		encoder := json.NewEncoder(c.Writer)
+		write = func(entries []models.AuditLog) error {
+			for i := range entries {
+				if err := encoder.Encode(&entries[i]); err != nil {
+					return err
+				}
+			}
+			c.Writer.Flush()
+			return nil
+		}
+	}
+
+	// Headers are already sent; a failure part way through can only be logged
+	if err := h.service.Export(c.Request.Context(), filter, write); err != nil {
+		logger.WithFields(map[string]interface{}{
+			"error":      err.Error(),
+			"request_id": c.GetString("request_id"),
+		}).Error("Audit export aborted")
+	}
+}
+
+// GetPatientAccessReport godoc
+// @Summary Get patient access report
+// @Description List who viewed or changed a patient's record, including their encounters and appointments, with user names and roles. Supports the data subject's right of access under UU PDP.
+// @Tags audit
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Patient ID"
+// @Param from query string false "Start time (RFC3339 or YYYY-MM-DD)"
+// @Param to query string false "End time (RFC3339, or YYYY-MM-DD inclusive)"
+// @Param include_denied query bool false "Include denied requests" default(false)
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Page size" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/audit/pasien/{id}/akses [get]
+func (h *Handler) GetPatientAccessReport(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails("Invalid patient ID"))
+		return
+	}
+
+	from, err := parseTimeParam(c.Query("from"), false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails("Invalid from: "+err.Error()))
+		return
+	}
+	to, err := parseTimeParam(c.Query("to"), true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails("Invalid to: "+err.Error()))
+		return
+	}
+	includeDenied := c.Query("include_denied") == "true"
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	report, total, err := h.service.PatientAccessReport(c.Request.Context(), id, from, to, includeDenied, page, pageSize)
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":        report,
+		"total":       total,
+		"page":        page,
+		"page_size":   pageSize,
+		"total_pages": (total + int64(pageSize) - 1) / int64(pageSize),
+	})
+}
+
+// parseSearchFilter reads search filters from the query string. Malformed
+// values are rejected rather than ignored so a typo never widens a search.
+func parseSearchFilter(c *gin.Context) (*SearchFilter, error) {
+	filter := &SearchFilter{
+		Resource:  strings.ToLower(c.Query("resource")),
+		Action:    strings.ToUpper(c.Query("action")),
+		Severity:  models.AuditSeverity(strings.ToLower(c.Query("severity"))),
+		RequestID: c.Query("request_id"),
+	}
+
+	ids := map[string]**uuid.UUID{
+		"user_id":     &filter.UserID,
+		"patient_id":  &filter.PatientID,
+		"resource_id": &filter.ResourceID,
+	}
+	for param, target := range ids {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s", param)
+		}
+		*target = &id
+	}
+
+	var err error
+	if filter.From, err = parseTimeParam(c.Query("from"), false); err != nil {
+		return nil, fmt.Errorf("invalid from: %v", err)
+	}
+	if filter.To, err = parseTimeParam(c.Query("to"), true); err != nil {
+		return nil, fmt.Errorf("invalid to: %v", err)
+	}
+	return filter, nil
+}
+
+// parseTimeParam accepts RFC3339 timestamps or YYYY-MM-DD dates. A date used
+// as an end bound covers the whole day.
+func parseTimeParam(value string, end bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, fmt.Errorf("expected RFC3339 or YYYY-MM-DD")
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// csvRecord flattens an entry into the export columns
+func csvRecord(entry *models.AuditLog) []string {
+	optional := func(id *uuid.UUID) string {
+		if id == nil {
+			return ""
+		}
+		return id.String()
+	}
+	var sequence string
+	if entry.Sequence != nil {
+		sequence = strconv.FormatInt(*entry.Sequence, 10)
+	}
+
+	record := []string{
+		entry.ID.String(),
+		sequence,
+		entry.Timestamp.UTC().Format(time.RFC3339Nano),
+		optional(entry.UserID),
+		entry.Username,
+		optional(entry.ServiceAccountID),
+		entry.Action,
+		entry.Resource,
+		optional(entry.ResourceID),
+		entry.Description,
+		entry.IPAddress,
+		entry.UserAgent,
+		entry.RequestMethod,
+		entry.RequestPath,
+		strconv.Itoa(entry.StatusCode),
+		entry.RequestID,
+		string(entry.Severity),
+	}
+	for i, cell := range record {
+		record[i] = escapeCSVCell(cell)
+	}
+	return record
+}
+
+// escapeCSVCell stops spreadsheets from evaluating user-controlled values,
+// such as a user agent, as formulas
+func escapeCSVCell(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
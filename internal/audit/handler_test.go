@@ -0,0 +1,53 @@
+package audit
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func searchContext(query string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/api/v1/audit?"+query, nil)
+	return c
+}
+
+func TestParseSearchFilter(t *testing.T) {
+	filter, err := parseSearchFilter(searchContext(
+		"patient_id=6f1c1a44-54d4-4f4e-9d0c-3b8a2f0c9e11&action=read&severity=Warning&from=2024-03-01&to=2024-03-31"))
+	require.NoError(t, err)
+
+	require.NotNil(t, filter.PatientID)
+	assert.Equal(t, "6f1c1a44-54d4-4f4e-9d0c-3b8a2f0c9e11", filter.PatientID.String())
+	assert.Nil(t, filter.UserID)
+	assert.Equal(t, models.AuditActionRead, filter.Action)
+	assert.Equal(t, models.AuditSeverityWarning, filter.Severity)
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), *filter.From)
+	// A date as the end bound covers the whole day
+	assert.Equal(t, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), *filter.To)
+
+	filter, err = parseSearchFilter(searchContext("to=2024-03-31T12:00:00Z"))
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC), *filter.To)
+
+	// Malformed filters are rejected, not dropped
+	for _, query := range []string{"user_id=42", "resource_id=abc", "from=yesterday", "to=31-03-2024"} {
+		_, err := parseSearchFilter(searchContext(query))
+		assert.Error(t, err, query)
+	}
+}
+
+func TestEscapeCSVCell(t *testing.T) {
+	assert.Equal(t, "'=HYPERLINK(\"http://evil\")", escapeCSVCell("=HYPERLINK(\"http://evil\")"))
+	assert.Equal(t, "'+1", escapeCSVCell("+1"))
+	assert.Equal(t, "'-2+3", escapeCSVCell("-2+3"))
+	assert.Equal(t, "'@SUM(A1)", escapeCSVCell("@SUM(A1)"))
+	assert.Equal(t, "Mozilla/5.0", escapeCSVCell("Mozilla/5.0"))
+	assert.Equal(t, "", escapeCSVCell(""))
+}
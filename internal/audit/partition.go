@@ -0,0 +1,194 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/hospital-emr/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// defaultPartition catches entries outside every monthly partition, such as
+// spilled entries replayed after their month was archived. It is never
+// archived.
+const defaultPartition = "audit_logs_default"
+
+// partitionPattern matches the name of a monthly partition
+var partitionPattern = regexp.MustCompile(`^audit_logs_y(\d{4})m(\d{2})$`)
+
+// partitionName returns the name of the partition holding a month
+func partitionName(month time.Time) string {
+	return fmt.Sprintf("audit_logs_y%04dm%02d", month.Year(), int(month.Month()))
+}
+
+// partitionMonth parses the month out of a partition name
+func partitionMonth(name string) (time.Time, bool) {
+	if !partitionPattern.MatchString(name) {
+		return time.Time{}, false
+	}
+	month, err := time.Parse("2006-01", name[12:16]+"-"+name[17:19])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return month, true
+}
+
+// monthStart truncates a time to the first instant of its month in UTC
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// IsPartitioned reports whether audit_logs has been converted to a
+// partitioned table
+func IsPartitioned(ctx context.Context, db *gorm.DB) (bool, error) {
+	var partitioned bool
+	err := db.WithContext(ctx).Raw(`SELECT EXISTS (
+		SELECT 1 FROM pg_partitioned_table pt
+		JOIN pg_class c ON c.oid = pt.partrelid
+		WHERE c.relname = 'audit_logs' AND c.relnamespace = current_schema()::regnamespace)`).
+		Scan(&partitioned).Error
+	return partitioned, err
+}
+
+// Partition converts audit_logs into a table partitioned by month. Existing
+// entries are copied into monthly partitions in one transaction, so the
+// table is locked for the duration; run it from cmd/auditretention during a
+// maintenance window. Partitioned tables cannot enforce uniqueness without
+// the partition key, so the primary key becomes (id, timestamp) and the
+// chain sequence stays unique through the advisory lock held by appends.
+func Partition(ctx context.Context, db *gorm.DB, monthsAhead int) error {
+	partitioned, err := IsPartitioned(ctx, db)
+	if err != nil {
+		return err
+	}
+	if partitioned {
+		return EnsurePartitions(ctx, db, time.Now(), monthsAhead)
+	}
+
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("LOCK TABLE audit_logs IN ACCESS EXCLUSIVE MODE").Error; err != nil {
+			return err
+		}
+
+		var oldest *time.Time
+		if err := tx.Raw(`SELECT MIN("timestamp") FROM audit_logs`).Scan(&oldest).Error; err != nil {
+			return err
+		}
+
+		statements := []string{
+			`ALTER TABLE audit_logs RENAME TO audit_logs_unpartitioned`,
+			`CREATE TABLE audit_logs (LIKE audit_logs_unpartitioned INCLUDING DEFAULTS) PARTITION BY RANGE ("timestamp")`,
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+
+		from := time.Now()
+		if oldest != nil && oldest.Before(from) {
+			from = *oldest
+		}
+		if err := createPartitions(tx, from, time.Now(), monthsAhead); err != nil {
+			return err
+		}
+
+		// Constraint and index names are freed by dropping the old table
+		statements = []string{
+			`INSERT INTO audit_logs SELECT * FROM audit_logs_unpartitioned`,
+			`DROP TABLE audit_logs_unpartitioned`,
+			`ALTER TABLE audit_logs ADD PRIMARY KEY (id, "timestamp")`,
+			`CREATE UNIQUE INDEX idx_audit_logs_sequence ON audit_logs (sequence, "timestamp")`,
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Recreate the remaining indexes and the append-only triggers
+	if err := db.WithContext(ctx).AutoMigrate(&models.AuditLog{}); err != nil {
+		return err
+	}
+	return ProtectTable(db)
+}
+
+// EnsurePartitions creates the partitions for the current month and the
+// months ahead, so entries never fall through to the default partition.
+// Nothing is done until audit_logs has been partitioned.
+func EnsurePartitions(ctx context.Context, db *gorm.DB, now time.Time, monthsAhead int) error {
+	partitioned, err := IsPartitioned(ctx, db)
+	if err != nil || !partitioned {
+		return err
+	}
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return createPartitions(tx, now, now, monthsAhead)
+	})
+}
+
+// createPartitions creates the monthly partitions from the month of from to
+// monthsAhead months after now, and the default partition. Every partition
+// gets its own TRUNCATE trigger, since truncating a partition directly does
+// not fire the parent's.
+func createPartitions(tx *gorm.DB, from, now time.Time, monthsAhead int) error {
+	last := monthStart(now).AddDate(0, monthsAhead, 0)
+	for month := monthStart(from); !month.After(last); month = month.AddDate(0, 1, 0) {
+		name := partitionName(month)
+		statement := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s PARTITION OF audit_logs FOR VALUES FROM ('%s') TO ('%s')`,
+			name, month.Format(time.RFC3339), month.AddDate(0, 1, 0).Format(time.RFC3339))
+		if err := tx.Exec(statement).Error; err != nil {
+			return fmt.Errorf("create partition %s: %w", name, err)
+		}
+		if err := protectPartition(tx, name); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s PARTITION OF audit_logs DEFAULT`, defaultPartition)).Error; err != nil {
+		return fmt.Errorf("create partition %s: %w", defaultPartition, err)
+	}
+	return protectPartition(tx, defaultPartition)
+}
+
+// protectPartition rejects TRUNCATE on a single partition
+func protectPartition(tx *gorm.DB, name string) error {
+	statements := []string{
+		fmt.Sprintf(`DROP TRIGGER IF EXISTS audit_logs_no_truncate ON %s`, name),
+		fmt.Sprintf(`CREATE TRIGGER audit_logs_no_truncate BEFORE TRUNCATE ON %s
+	FOR EACH STATEMENT EXECUTE FUNCTION audit_logs_append_only()`, name),
+	}
+	for _, statement := range statements {
+		if err := tx.Exec(statement).Error; err != nil {
+			return fmt.Errorf("protect partition %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// monthlyPartitions lists the monthly partitions of audit_logs, oldest first
+func monthlyPartitions(ctx context.Context, db *gorm.DB) ([]string, error) {
+	var names []string
+	if err := db.WithContext(ctx).Raw(`SELECT c.relname FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class p ON p.oid = i.inhparent
+		WHERE p.relname = 'audit_logs' AND p.relnamespace = current_schema()::regnamespace
+		ORDER BY c.relname`).Scan(&names).Error; err != nil {
+		return nil, err
+	}
+
+	monthly := names[:0]
+	for _, name := range names {
+		if _, ok := partitionMonth(name); ok {
+			monthly = append(monthly, name)
+		}
+	}
+	return monthly, nil
+}
@@ -0,0 +1,37 @@
+package audit
+
+import "gorm.io/gorm"
+
+// protectStatements make audit_logs append-only. Row triggers reject UPDATE
+// and DELETE and a statement trigger rejects TRUNCATE, so application code,
+// including a compromised query, cannot rewrite entries. They do not stop the
+// table owner, which the application's role is since it runs the migrations:
+// it can still drop or disable the triggers. Tampering beyond that is caught
+// by the hash chain rather than prevented.
+var protectStatements = []string{
+	`CREATE OR REPLACE FUNCTION audit_logs_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_logs is append-only: % is not allowed', TG_OP
+		USING ERRCODE = 'insufficient_privilege';
+END;
+$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS audit_logs_no_modify ON audit_logs`,
+	`CREATE TRIGGER audit_logs_no_modify BEFORE UPDATE OR DELETE ON audit_logs
+	FOR EACH ROW EXECUTE FUNCTION audit_logs_append_only()`,
+	`DROP TRIGGER IF EXISTS audit_logs_no_truncate ON audit_logs`,
+	`CREATE TRIGGER audit_logs_no_truncate BEFORE TRUNCATE ON audit_logs
+	FOR EACH STATEMENT EXECUTE FUNCTION audit_logs_append_only()`,
+}
+
+// ProtectTable installs the triggers that keep audit_logs append-only. It is
+// safe to run on every migration.
+func ProtectTable(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range protectStatements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
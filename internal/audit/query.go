@@ -0,0 +1,254 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// exportBatchSize is the number of entries read per query while exporting
+const exportBatchSize = 1000
+
+// SearchFilter narrows an audit trail search. Zero fields are not applied.
+type SearchFilter struct {
+	UserID     *uuid.UUID
+	PatientID  *uuid.UUID // Entries about the patient, their encounters or appointments
+	Resource   string
+	ResourceID *uuid.UUID
+	Action     string
+	Severity   models.AuditSeverity
+	RequestID  string
+	From       *time.Time
+	To         *time.Time
+}
+
+// AccessReportEntry is one access to a patient's record, with the user who
+// made it resolved to a name and roles
+type AccessReportEntry struct {
+	Timestamp      time.Time  `json:"timestamp"`
+	UserID         *uuid.UUID `json:"user_id"`
+	UserName       string     `json:"user_name"`
+	Email          string     `json:"email,omitempty"`
+	Roles          []string   `json:"roles"`
+	ServiceAccount string     `json:"service_account,omitempty"`
+	Action         string     `json:"action"`
+	Resource       string     `json:"resource"`
+	ResourceID     *uuid.UUID `json:"resource_id"`
+	Description    string     `json:"description"`
+	StatusCode     int        `json:"status_code"`
+	Severity       string     `json:"severity"`
+}
+
+// applyFilter adds a search filter's conditions to a query on audit_logs
+func applyFilter(query *gorm.DB, filter *SearchFilter) *gorm.DB {
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.PatientID != nil {
+		query = query.Where(
+			"(resource = 'patient' AND resource_id = @patient) OR "+
+				"(resource = 'encounter' AND resource_id IN (SELECT id FROM encounters WHERE patient_id = @patient)) OR "+
+				"(resource = 'appointment' AND resource_id IN (SELECT id FROM appointments WHERE patient_id = @patient))",
+			map[string]interface{}{"patient": *filter.PatientID},
+		)
+	}
+	if filter.Resource != "" {
+		query = query.Where("resource = ?", filter.Resource)
+	}
+	if filter.ResourceID != nil {
+		query = query.Where("resource_id = ?", *filter.ResourceID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.Severity != "" {
+		query = query.Where("severity = ?", filter.Severity)
+	}
+	if filter.RequestID != "" {
+		query = query.Where("request_id = ?", filter.RequestID)
+	}
+	if filter.From != nil {
+		query = query.Where("timestamp >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("timestamp < ?", *filter.To)
+	}
+	return query
+}
+
+// Search returns audit entries matching a filter, newest first
+func (s *Service) Search(ctx context.Context, filter *SearchFilter, page, pageSize int) ([]models.AuditLog, int64, error) {
+	var entries []models.AuditLog
+	var total int64
+
+	query := applyFilter(s.db.WithContext(ctx).Model(&models.AuditLog{}), filter)
+
+	// Get total count
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, errors.ErrDatabaseError
+	}
+
+	// Get paginated results
+	offset := (page - 1) * pageSize
+	if err := query.
+		Offset(offset).
+		Limit(pageSize).
+		Order("timestamp DESC, id DESC").
+		Find(&entries).Error; err != nil {
+		return nil, 0, errors.ErrDatabaseError
+	}
+
+	return entries, total, nil
+}
+
+// Export streams every entry matching a filter to fn in batches, oldest
+// first
+func (s *Service) Export(ctx context.Context, filter *SearchFilter, fn func([]models.AuditLog) error) error {
+	return streamEntries(func() *gorm.DB {
+		return applyFilter(s.db.WithContext(ctx).Model(&models.AuditLog{}), filter)
+	}, exportBatchSize, fn)
+}
+
+// streamEntries hands every entry a query selects to fn in batches, oldest
+// first. Batches are read by keyset on (timestamp, id) so reads of any size
+// use constant memory; query builds a fresh statement for each batch.
+func streamEntries(query func() *gorm.DB, batchSize int, fn func([]models.AuditLog) error) error {
+	var after *models.AuditLog
+	for {
+		q := query()
+		if after != nil {
+			q = q.Where("(timestamp, id) > (?, ?)", after.Timestamp, after.ID)
+		}
+
+		var batch []models.AuditLog
+		if err := q.Order("timestamp ASC, id ASC").Limit(batchSize).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+		if len(batch) < batchSize {
+			return nil
+		}
+		after = &batch[len(batch)-1]
+	}
+}
+
+// PatientAccessReport lists who accessed a patient's record, including the
+// patient's encounters and appointments, newest first. Denied requests
+// disclosed nothing and are left out unless includeDenied is set.
+func (s *Service) PatientAccessReport(ctx context.Context, patientID uuid.UUID, from, to *time.Time, includeDenied bool, page, pageSize int) ([]AccessReportEntry, int64, error) {
+	var patientCount int64
+	if err := s.db.WithContext(ctx).Model(&models.Patient{}).Unscoped().Where("id = ?", patientID).Count(&patientCount).Error; err != nil {
+		return nil, 0, errors.ErrDatabaseError
+	}
+	if patientCount == 0 {
+		return nil, 0, errors.ErrPatientNotFound(patientID.String())
+	}
+
+	var entries []models.AuditLog
+	var total int64
+
+	query := applyFilter(s.db.WithContext(ctx).Model(&models.AuditLog{}), &SearchFilter{PatientID: &patientID, From: from, To: to}).
+		Where("user_id IS NOT NULL OR service_account_id IS NOT NULL")
+	if !includeDenied {
+		query = query.Where("status_code = 0 OR status_code < 400")
+	}
+
+	// Get total count
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, errors.ErrDatabaseError
+	}
+
+	// Get paginated results
+	offset := (page - 1) * pageSize
+	if err := query.
+		Offset(offset).
+		Limit(pageSize).
+		Order("timestamp DESC, id DESC").
+		Find(&entries).Error; err != nil {
+		return nil, 0, errors.ErrDatabaseError
+	}
+
+	report, err := s.resolveAccessors(ctx, entries)
+	if err != nil {
+		return nil, 0, err
+	}
+	return report, total, nil
+}
+
+// resolveAccessors turns audit entries into report rows with the names and
+// roles of the users and service accounts behind them
+func (s *Service) resolveAccessors(ctx context.Context, entries []models.AuditLog) ([]AccessReportEntry, error) {
+	var userIDs, accountIDs []uuid.UUID
+	for _, entry := range entries {
+		if entry.UserID != nil {
+			userIDs = append(userIDs, *entry.UserID)
+		}
+		if entry.ServiceAccountID != nil {
+			accountIDs = append(accountIDs, *entry.ServiceAccountID)
+		}
+	}
+
+	users := make(map[uuid.UUID]models.User)
+	if len(userIDs) > 0 {
+		var found []models.User
+		if err := s.db.WithContext(ctx).Unscoped().Preload("Roles").Where("id IN ?", userIDs).Find(&found).Error; err != nil {
+			return nil, errors.ErrDatabaseError
+		}
+		for _, user := range found {
+			users[user.ID] = user
+		}
+	}
+
+	accounts := make(map[uuid.UUID]string)
+	if len(accountIDs) > 0 {
+		var found []models.ServiceAccount
+		if err := s.db.WithContext(ctx).Unscoped().Where("id IN ?", accountIDs).Find(&found).Error; err != nil {
+			return nil, errors.ErrDatabaseError
+		}
+		for _, account := range found {
+			accounts[account.ID] = account.Name
+		}
+	}
+
+	report := make([]AccessReportEntry, 0, len(entries))
+	for _, entry := range entries {
+		row := AccessReportEntry{
+			Timestamp:   entry.Timestamp,
+			UserID:      entry.UserID,
+			UserName:    entry.Username,
+			Roles:       []string{},
+			Action:      entry.Action,
+			Resource:    entry.Resource,
+			ResourceID:  entry.ResourceID,
+			Description: entry.Description,
+			StatusCode:  entry.StatusCode,
+			Severity:    string(entry.Severity),
+		}
+		if entry.UserID != nil {
+			if user, ok := users[*entry.UserID]; ok {
+				row.UserName = user.FirstName + " " + user.LastName
+				row.Email = user.Email
+				for _, role := range user.Roles {
+					row.Roles = append(row.Roles, role.Name)
+				}
+			}
+		}
+		if entry.ServiceAccountID != nil {
+			row.ServiceAccount = accounts[*entry.ServiceAccountID]
+			if row.UserName == "" {
+				row.UserName = row.ServiceAccount
+			}
+		}
+		report = append(report, row)
+	}
+	return report, nil
+}
@@ -0,0 +1,170 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/logger"
+	"github.com/hospital-emr/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// ServiceAccount identifies a service account acting through an API key
+type ServiceAccount struct {
+	ID   uuid.UUID
+	Name string
+}
+
+type serviceAccountKey struct{}
+
+// WithServiceAccount returns a context whose audit entries are attributed to
+// the given service account
+func WithServiceAccount(ctx context.Context, account *ServiceAccount) context.Context {
+	return context.WithValue(ctx, serviceAccountKey{}, account)
+}
+
+// ServiceAccountFromContext returns the acting service account, or nil when a
+// user is acting
+func ServiceAccountFromContext(ctx context.Context) *ServiceAccount {
+	account, _ := ctx.Value(serviceAccountKey{}).(*ServiceAccount)
+	return account
+}
+
+// Actor describes the request on whose behalf entries are recorded
+type Actor struct {
+	UserID    *uuid.UUID
+	Username  string
+	RequestID string
+	IPAddress string
+	UserAgent string
+}
+
+type actorKey struct{}
+
+// WithActor returns a context whose audit entries are attributed to the
+// given request
+func WithActor(ctx context.Context, actor *Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the request being audited, or nil outside a request
+func ActorFromContext(ctx context.Context) *Actor {
+	actor, _ := ctx.Value(actorKey{}).(*Actor)
+	return actor
+}
+
+type jobKey struct{}
+
+// WithJob returns a context for a background job or command. Changes it
+// makes outside a request are attributed to the job by name.
+func WithJob(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, jobKey{}, name)
+}
+
+// JobFromContext returns the name of the job acting, or "" when none was set
+func JobFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(jobKey{}).(string)
+	return name
+}
+
+// Recorder writes entries to the audit trail
+type Recorder struct {
+	db        *gorm.DB
+	chain     *Chain
+	writer    *Writer
+	observers []func(models.AuditLog)
+}
+
+// NewRecorder creates an audit recorder that writes each entry immediately,
+// appending it to chain when one is given
+func NewRecorder(db *gorm.DB, chain *Chain) *Recorder {
+	return &Recorder{db: db, chain: chain}
+}
+
+// NewAsyncRecorder creates an audit recorder that hands entries to a
+// background writer
+func NewAsyncRecorder(writer *Writer) *Recorder {
+	return &Recorder{writer: writer}
+}
+
+// Observe registers fn to be handed a copy of every entry recorded, with
+// request details filled in. Observers run on the request path and must not
+// block; register them before the recorder is in use.
+func (r *Recorder) Observe(fn func(models.AuditLog)) {
+	r.observers = append(r.observers, fn)
+}
+
+// Record persists an audit entry. Failures are logged rather than returned
+// so that auditing never breaks the request being audited.
+func (r *Recorder) Record(ctx context.Context, entry *models.AuditLog) {
+	if r == nil || entry == nil {
+		return
+	}
+
+	if entry.Severity == "" {
+		entry.Severity = models.AuditSeverityInfo
+	}
+
+	// Fill in request details the caller did not set
+	if actor := ActorFromContext(ctx); actor != nil {
+		if entry.UserID == nil && entry.ServiceAccountID == nil {
+			entry.UserID = actor.UserID
+		}
+		if entry.Username == "" {
+			entry.Username = actor.Username
+		}
+		if entry.RequestID == "" {
+			entry.RequestID = actor.RequestID
+		}
+		if entry.IPAddress == "" {
+			entry.IPAddress = actor.IPAddress
+		}
+		if entry.UserAgent == "" {
+			entry.UserAgent = actor.UserAgent
+		}
+	}
+
+	// Services pass the caller's ID as the acting user; for service accounts
+	// that ID belongs to the account, not to a user
+	if account := ServiceAccountFromContext(ctx); account != nil {
+		entry.ServiceAccountID = &account.ID
+		if entry.UserID != nil && *entry.UserID == account.ID {
+			entry.UserID = nil
+		}
+		if entry.Username == "" {
+			entry.Username = account.Name
+		}
+	}
+
+	if len(r.observers) > 0 {
+		if entry.ID == uuid.Nil {
+			entry.ID = uuid.New()
+		}
+		if entry.Timestamp.IsZero() {
+			entry.Timestamp = time.Now().UTC()
+		}
+		for _, observe := range r.observers {
+			observe(*entry)
+		}
+	}
+
+	if r.writer != nil {
+		r.writer.Enqueue(entry)
+		return
+	}
+
+	var err error
+	if r.chain != nil {
+		err = r.chain.Append(ctx, r.db, []*models.AuditLog{entry}, 1)
+	} else {
+		err = r.db.WithContext(ctx).Create(entry).Error
+	}
+	if err != nil {
+		logger.WithFields(map[string]interface{}{
+			"action":   entry.Action,
+			"resource": entry.Resource,
+			"error":    err.Error(),
+		}).Error("Failed to write audit log")
+	}
+}
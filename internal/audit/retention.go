@@ -0,0 +1,650 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/logger"
+	"github.com/hospital-emr/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// retentionLockID is the advisory lock that keeps the retention job to one
+// API instance at a time
+const retentionLockID = 0x617564697472 // "auditr"
+
+// archiveBatchSize is the number of entries read or restored per query
+const archiveBatchSize = 1000
+
+// RetentionConfig controls partitioning, archival and purging of the audit
+// trail
+type RetentionConfig struct {
+	ArchiveDir     string        // Where archive files are written
+	OnlineMonths   int           // Months kept in the database before a partition is archived
+	RetentionYears int           // Years an archive is kept after its month ends
+	MonthsAhead    int           // Monthly partitions created ahead of time
+	Interval       time.Duration // How often the scheduled job runs
+}
+
+// RetentionReport summarizes one run of the retention job
+type RetentionReport struct {
+	Archived []string `json:"archived"` // Partitions moved to archive files
+	Purged   []string `json:"purged"`   // Archives deleted after the retention period
+	Held     []string `json:"held"`     // Archives past retention kept for a legal hold
+}
+
+// RestoreReport describes an archive restored for investigation
+type RestoreReport struct {
+	Table   string      `json:"table"`
+	Entries int64       `json:"entries"`
+	Break   *ChainBreak `json:"break,omitempty"` // First entry that fails chain verification
+}
+
+// Retention enforces the audit trail's retention policy. audit_logs is
+// partitioned by month; partitions older than the online period are written
+// to compressed, checksummed archive files and dropped, and archives are
+// deleted once the retention period has passed unless they hold entries
+// about a patient or user under legal hold. Archives can be restored into a
+// separate table for investigation.
+type Retention struct {
+	db       *gorm.DB
+	chain    *Chain
+	recorder *Recorder
+	cfg      RetentionConfig
+
+	mu      sync.Mutex
+	started bool
+	stopped bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewRetention creates the retention job. Archive records are signed with
+// chain when one is given.
+func NewRetention(db *gorm.DB, chain *Chain, recorder *Recorder, cfg RetentionConfig) *Retention {
+	if cfg.RetentionYears <= 0 {
+		cfg.RetentionYears = 25
+	}
+	if cfg.OnlineMonths <= 0 {
+		cfg.OnlineMonths = 24
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 24 * time.Hour
+	}
+	return &Retention{
+		db:       db,
+		chain:    chain,
+		recorder: recorder,
+		cfg:      cfg,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start runs the job now and then at every interval until Close
+func (r *Retention) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.started || r.stopped {
+		return
+	}
+	r.started = true
+
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(r.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			r.runScheduled()
+			select {
+			case <-ticker.C:
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the scheduled job, waiting for a run in progress to finish
+func (r *Retention) Close(ctx context.Context) error {
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		return nil
+	}
+	r.stopped = true
+	started := r.started
+	close(r.stop)
+	r.mu.Unlock()
+
+	if !started {
+		return nil
+	}
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Retention) runScheduled() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-r.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	report, err := r.Run(ctx, time.Now())
+	if err != nil {
+		logger.WithFields(map[string]interface{}{
+			"error": err.Error(),
+		}).Error("Audit retention run failed")
+		return
+	}
+	if len(report.Archived)+len(report.Purged)+len(report.Held) > 0 {
+		logger.WithFields(map[string]interface{}{
+			"archived": report.Archived,
+			"purged":   report.Purged,
+			"held":     report.Held,
+		}).Info("Audit retention run completed")
+	}
+}
+
+// Run creates upcoming partitions, archives partitions past the online
+// period and purges archives past the retention period. Only one instance
+// runs at a time; a concurrent call returns an empty report.
+func (r *Retention) Run(ctx context.Context, now time.Time) (*RetentionReport, error) {
+	report := &RetentionReport{}
+
+	unlock, locked, err := r.lock(ctx)
+	if err != nil || !locked {
+		return report, err
+	}
+	defer unlock()
+
+	if err := EnsurePartitions(ctx, r.db, now, r.cfg.MonthsAhead); err != nil {
+		return report, fmt.Errorf("create partitions: %w", err)
+	}
+
+	partitions, err := monthlyPartitions(ctx, r.db)
+	if err != nil {
+		return report, err
+	}
+	cutoff := monthStart(now).AddDate(0, -r.cfg.OnlineMonths, 0)
+	for _, name := range partitions {
+		month, _ := partitionMonth(name)
+		if !month.Before(cutoff) {
+			continue
+		}
+		if _, err := r.ArchivePartition(ctx, name); err != nil {
+			return report, fmt.Errorf("archive %s: %w", name, err)
+		}
+		report.Archived = append(report.Archived, name)
+	}
+
+	var expired []models.AuditArchive
+	if err := r.db.WithContext(ctx).
+		Where("purged_at IS NULL AND retain_until < ?", now).
+		Order("period_start ASC").
+		Find(&expired).Error; err != nil {
+		return report, err
+	}
+	for i := range expired {
+		held, err := r.PurgeArchive(ctx, &expired[i])
+		if err != nil {
+			return report, fmt.Errorf("purge %s: %w", expired[i].Partition, err)
+		}
+		if held {
+			report.Held = append(report.Held, expired[i].Partition)
+		} else {
+			report.Purged = append(report.Purged, expired[i].Partition)
+		}
+	}
+	return report, nil
+}
+
+// lock takes the session-level advisory lock on a dedicated connection
+func (r *Retention) lock(ctx context.Context) (func(), bool, error) {
+	sqlDB, err := r.db.DB()
+	if err != nil {
+		return nil, false, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", retentionLockID).Scan(&locked); err != nil || !locked {
+		conn.Close()
+		return nil, false, err
+	}
+	return func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", retentionLockID); err != nil {
+			logger.Warnf("Failed to release audit retention lock: %v", err)
+		}
+		conn.Close()
+	}, true, nil
+}
+
+// ArchivePartition writes a monthly partition to an archive file, checks the
+// file against the partition and then drops the partition
+func (r *Retention) ArchivePartition(ctx context.Context, name string) (*models.AuditArchive, error) {
+	month, ok := partitionMonth(name)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a monthly audit_logs partition", name)
+	}
+	partitions, err := monthlyPartitions(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	if !containsString(partitions, name) {
+		return nil, fmt.Errorf("partition %s does not exist", name)
+	}
+
+	path := filepath.Join(r.cfg.ArchiveDir, name+archiveFileSuffix)
+	file, err := createArchiveFile(path)
+	if err != nil {
+		return nil, err
+	}
+	err = streamEntries(func() *gorm.DB {
+		return r.db.WithContext(ctx).Table(name)
+	}, archiveBatchSize, file.write)
+	if err != nil {
+		file.abort()
+		return nil, err
+	}
+	checksum, size, err := file.commit()
+	if err != nil {
+		file.abort()
+		return nil, err
+	}
+
+	// Read the file back before anything is dropped
+	count, err := readArchive(path, checksum, archiveBatchSize, func([]models.AuditLog) error { return nil })
+	if err != nil {
+		return nil, fmt.Errorf("archive file does not read back: %w", err)
+	}
+	if count != file.entries {
+		return nil, fmt.Errorf("archive file holds %d entries, %d were written", count, file.entries)
+	}
+
+	segments, err := partitionSegments(ctx, r.db, name)
+	if err != nil {
+		return nil, err
+	}
+	encodedSegments, err := json.Marshal(segments)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	periodEnd := month.AddDate(0, 1, 0)
+	archive := &models.AuditArchive{
+		Partition:   name,
+		PeriodStart: month,
+		PeriodEnd:   periodEnd,
+		FileName:    filepath.Base(path),
+		SHA256:      checksum,
+		SizeBytes:   size,
+		Entries:     count,
+		Segments:    string(encodedSegments),
+		ArchivedAt:  now,
+		RetainUntil: periodEnd.AddDate(r.cfg.RetentionYears, 0, 0),
+	}
+	if r.chain != nil {
+		r.chain.SignArchive(archive)
+	}
+
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Entries replayed into the month while it was being written would be lost
+		if err := tx.Exec(fmt.Sprintf("LOCK TABLE %s IN SHARE MODE", name)).Error; err != nil {
+			return err
+		}
+		var current int64
+		if err := tx.Table(name).Count(&current).Error; err != nil {
+			return err
+		}
+		if current != count {
+			return fmt.Errorf("partition changed while it was archived (%d entries, %d archived); retry", current, count)
+		}
+
+		// A previous attempt may have recorded the archive before failing
+		if err := tx.Where("partition = ?", name).Delete(&models.AuditArchive{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(archive).Error; err != nil {
+			return err
+		}
+		if err := writeManifest(filepath.Join(r.cfg.ArchiveDir, name+archiveManifestSuffix), archive); err != nil {
+			return err
+		}
+		if err := tx.Exec(fmt.Sprintf("ALTER TABLE audit_logs DETACH PARTITION %s", name)).Error; err != nil {
+			return err
+		}
+		return tx.Exec(fmt.Sprintf("DROP TABLE %s", name)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r.record(ctx, models.AuditActionArchive, fmt.Sprintf("Archived audit partition %s (%d entries)", name, count), archive)
+	return archive, nil
+}
+
+// partitionSegments finds the runs of consecutive chain sequences in a
+// partition. Sequences follow insertion order and partitions follow
+// timestamps, so entries replayed late interleave and a month can hold more
+// than one run.
+func partitionSegments(ctx context.Context, db *gorm.DB, name string) ([]Segment, error) {
+	var segments []Segment
+	err := db.WithContext(ctx).Raw(fmt.Sprintf(`WITH runs AS (
+		SELECT MIN(sequence) AS first, MAX(sequence) AS last FROM (
+			SELECT sequence, sequence - ROW_NUMBER() OVER (ORDER BY sequence) AS run
+			FROM %[1]s WHERE sequence IS NOT NULL
+		) numbered GROUP BY run
+	)
+	SELECT runs.first, runs.last, f.prev_hash, l.hmac AS last_hash
+	FROM runs
+	JOIN %[1]s f ON f.sequence = runs.first
+	JOIN %[1]s l ON l.sequence = runs.last
+	ORDER BY runs.first`, name)).Scan(&segments).Error
+	return segments, err
+}
+
+// PurgeArchive deletes an archive file past its retention period. Archives
+// holding entries about a patient or user under legal hold are kept, and
+// held is returned. The archive record stays behind for chain verification.
+func (r *Retention) PurgeArchive(ctx context.Context, archive *models.AuditArchive) (bool, error) {
+	if archive.PurgedAt != nil {
+		return false, nil
+	}
+	if time.Now().Before(archive.RetainUntil) {
+		return false, fmt.Errorf("archive %s must be retained until %s", archive.Partition, archive.RetainUntil.Format("2006-01-02"))
+	}
+
+	holds, err := r.activeHolds(ctx)
+	if err != nil {
+		return false, err
+	}
+	path := filepath.Join(r.cfg.ArchiveDir, archive.FileName)
+	if !holds.empty() {
+		held := false
+		_, err := readArchive(path, archive.SHA256, archiveBatchSize, func(entries []models.AuditLog) error {
+			for i := range entries {
+				if holds.covers(&entries[i]) {
+					held = true
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return false, err
+		}
+		if held {
+			return true, nil
+		}
+	}
+
+	for _, name := range []string{path, filepath.Join(r.cfg.ArchiveDir, archive.Partition+archiveManifestSuffix)} {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	now := time.Now().UTC()
+	if err := r.db.WithContext(ctx).Model(archive).Update("purged_at", now).Error; err != nil {
+		return false, err
+	}
+
+	r.record(ctx, models.AuditActionPurge, fmt.Sprintf("Purged audit archive %s after the retention period", archive.Partition), archive)
+	return false, nil
+}
+
+// Restore loads an archive into its own table for investigation. The file
+// is checked against its checksum, and each entry against the hash chain when
+// a key is configured; entries are never put back into audit_logs.
+func (r *Retention) Restore(ctx context.Context, partition string) (*RestoreReport, error) {
+	archive, err := r.archive(ctx, partition)
+	if err != nil {
+		return nil, err
+	}
+	if archive.PurgedAt != nil {
+		return nil, fmt.Errorf("archive %s was purged on %s", partition, archive.PurgedAt.Format("2006-01-02"))
+	}
+	if r.chain != nil && !r.chain.VerifyArchive(archive) {
+		return nil, fmt.Errorf("archive record %s has an invalid signature", partition)
+	}
+
+	report := &RestoreReport{Table: restoredTable(partition)}
+	verifier := newSegmentVerifier(r.chain)
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(fmt.Sprintf("CREATE TABLE %s (LIKE audit_logs INCLUDING DEFAULTS)", report.Table)).Error; err != nil {
+			return err
+		}
+
+		// The checksum is only known at the end; a mismatch rolls the table back
+		count, err := readArchive(filepath.Join(r.cfg.ArchiveDir, archive.FileName), archive.SHA256, archiveBatchSize, func(entries []models.AuditLog) error {
+			for i := range entries {
+				if report.Break == nil {
+					report.Break = verifier.next(&entries[i])
+				}
+			}
+			return tx.Table(report.Table).Session(&gorm.Session{SkipHooks: true}).CreateInBatches(entries, archiveBatchSize).Error
+		})
+		if err != nil {
+			return err
+		}
+		if count != archive.Entries {
+			return fmt.Errorf("archive holds %d entries, %d were recorded", count, archive.Entries)
+		}
+		report.Entries = count
+
+		now := time.Now().UTC()
+		return tx.Model(archive).Updates(map[string]interface{}{"restored_table": report.Table, "restored_at": now}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r.record(ctx, models.AuditActionRestore, fmt.Sprintf("Restored audit archive %s into %s", partition, report.Table), archive)
+	return report, nil
+}
+
+// DropRestored removes the table an archive was restored into
+func (r *Retention) DropRestored(ctx context.Context, partition string) error {
+	archive, err := r.archive(ctx, partition)
+	if err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", restoredTable(partition))).Error; err != nil {
+			return err
+		}
+		return tx.Model(archive).Updates(map[string]interface{}{"restored_table": "", "restored_at": nil}).Error
+	})
+}
+
+// Archives lists archive records, oldest first
+func (r *Retention) Archives(ctx context.Context) ([]models.AuditArchive, error) {
+	var archives []models.AuditArchive
+	err := r.db.WithContext(ctx).Order("period_start ASC").Find(&archives).Error
+	return archives, err
+}
+
+func (r *Retention) archive(ctx context.Context, partition string) (*models.AuditArchive, error) {
+	var archive models.AuditArchive
+	if err := r.db.WithContext(ctx).Where("partition = ?", partition).First(&archive).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("no archive of partition %s", partition)
+		}
+		return nil, err
+	}
+	return &archive, nil
+}
+
+// restoredTable names the table an archive is restored into
+func restoredTable(partition string) string {
+	return strings.Replace(partition, "audit_logs_", "audit_logs_restored_", 1)
+}
+
+// PlaceHold exempts a patient's or user's audit trail from purging
+func (r *Retention) PlaceHold(ctx context.Context, hold *models.LegalHold) error {
+	var subject interface{}
+	switch hold.SubjectType {
+	case models.LegalHoldPatient:
+		subject = &models.Patient{}
+	case models.LegalHoldUser:
+		subject = &models.User{}
+	default:
+		return fmt.Errorf("legal hold subject must be %s or %s", models.LegalHoldPatient, models.LegalHoldUser)
+	}
+	if strings.TrimSpace(hold.Reason) == "" || strings.TrimSpace(hold.PlacedBy) == "" {
+		return fmt.Errorf("a legal hold needs a reason and who placed it")
+	}
+
+	var count int64
+	if err := r.db.WithContext(ctx).Model(subject).Unscoped().Where("id = ?", hold.SubjectID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("%s %s not found", hold.SubjectType, hold.SubjectID)
+	}
+
+	hold.ID = uuid.New()
+	hold.PlacedAt = time.Now().UTC()
+	hold.ReleasedAt = nil
+	if err := r.db.WithContext(ctx).Create(hold).Error; err != nil {
+		return err
+	}
+
+	r.record(ctx, models.AuditActionLegalHold, fmt.Sprintf("Legal hold placed on %s %s by %s: %s", hold.SubjectType, hold.SubjectID, hold.PlacedBy, hold.Reason), hold)
+	return nil
+}
+
+// ReleaseHold lifts a legal hold; archives it kept are purged on the next run
+func (r *Retention) ReleaseHold(ctx context.Context, id uuid.UUID, releasedBy string) error {
+	if strings.TrimSpace(releasedBy) == "" {
+		return fmt.Errorf("releasing a legal hold needs who released it")
+	}
+
+	now := time.Now().UTC()
+	result := r.db.WithContext(ctx).Model(&models.LegalHold{}).
+		Where("id = ? AND released_at IS NULL", id).
+		Updates(map[string]interface{}{"released_at": now, "released_by": releasedBy})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("no active legal hold %s", id)
+	}
+
+	r.record(ctx, models.AuditActionLegalHoldRelease, fmt.Sprintf("Legal hold %s released by %s", id, releasedBy), map[string]interface{}{"id": id})
+	return nil
+}
+
+// Holds lists legal holds, newest first
+func (r *Retention) Holds(ctx context.Context, includeReleased bool) ([]models.LegalHold, error) {
+	var holds []models.LegalHold
+	query := r.db.WithContext(ctx)
+	if !includeReleased {
+		query = query.Where("released_at IS NULL")
+	}
+	err := query.Order("placed_at DESC").Find(&holds).Error
+	return holds, err
+}
+
+// heldSubjects is the set of audit entries under legal hold
+type heldSubjects struct {
+	users   map[uuid.UUID]bool
+	records map[string]map[uuid.UUID]bool // resource -> IDs of held patients and their encounters and appointments
+}
+
+func (h *heldSubjects) empty() bool {
+	return len(h.users) == 0 && len(h.records) == 0
+}
+
+// covers reports whether an entry was made by or is about a held subject
+func (h *heldSubjects) covers(entry *models.AuditLog) bool {
+	if entry.UserID != nil && h.users[*entry.UserID] {
+		return true
+	}
+	return entry.ResourceID != nil && h.records[entry.Resource][*entry.ResourceID]
+}
+
+func (r *Retention) activeHolds(ctx context.Context) (*heldSubjects, error) {
+	holds, err := r.Holds(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	held := &heldSubjects{users: map[uuid.UUID]bool{}, records: map[string]map[uuid.UUID]bool{}}
+	var patients []uuid.UUID
+	for _, hold := range holds {
+		switch hold.SubjectType {
+		case models.LegalHoldUser:
+			held.users[hold.SubjectID] = true
+			held.records["user"] = addID(held.records["user"], hold.SubjectID)
+		case models.LegalHoldPatient:
+			patients = append(patients, hold.SubjectID)
+			held.records["patient"] = addID(held.records["patient"], hold.SubjectID)
+		}
+	}
+	if len(patients) == 0 {
+		return held, nil
+	}
+
+	for resource, table := range map[string]string{"encounter": "encounters", "appointment": "appointments"} {
+		var ids []uuid.UUID
+		if err := r.db.WithContext(ctx).Table(table).Where("patient_id IN ?", patients).Pluck("id", &ids).Error; err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			held.records[resource] = addID(held.records[resource], id)
+		}
+	}
+	return held, nil
+}
+
+func addID(set map[uuid.UUID]bool, id uuid.UUID) map[uuid.UUID]bool {
+	if set == nil {
+		set = map[uuid.UUID]bool{}
+	}
+	set[id] = true
+	return set
+}
+
+// record writes a retention event to the audit trail
+func (r *Retention) record(ctx context.Context, action, description string, subject interface{}) {
+	metadata, _ := json.Marshal(subject)
+	r.recorder.Record(ctx, &models.AuditLog{
+		Username:    "audit-retention",
+		Action:      action,
+		Resource:    "audit_log",
+		Description: description,
+		Metadata:    string(metadata),
+		Severity:    models.AuditSeverityWarning,
+	})
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartitionNames(t *testing.T) {
+	month := time.Date(2024, time.March, 17, 23, 0, 0, 0, time.FixedZone("WIB", 7*3600))
+	name := partitionName(monthStart(month))
+	assert.Equal(t, "audit_logs_y2024m03", name)
+
+	parsed, ok := partitionMonth(name)
+	require.True(t, ok)
+	assert.Equal(t, time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC), parsed)
+
+	for _, other := range []string{defaultPartition, "audit_logs_restored_y2024m03", "audit_logs_y2024m13", "audit_logs"} {
+		_, ok := partitionMonth(other)
+		assert.False(t, ok, other)
+	}
+	assert.Equal(t, "audit_logs_restored_y2024m03", restoredTable(name))
+}
+
+func TestVerifierSkipsArchivedSegments(t *testing.T) {
+	chain := NewChain([]byte("0123456789abcdef0123456789abcdef"))
+	entries := sealedEntries(t, chain, 6)
+	archived := Segment{First: 1, Last: 2, PrevHash: "", LastHash: entries[1].HMAC}
+
+	verify := func(segments []Segment, remaining []*models.AuditLog) *ChainBreak {
+		verifier := newChainVerifier(chain, nil, segments)
+		for _, entry := range remaining {
+			if brk := verifier.next(entry); brk != nil {
+				return brk
+			}
+		}
+		return nil
+	}
+
+	assert.Nil(t, verify([]Segment{archived}, entries[2:]))
+
+	// A run archived from the middle of the chain
+	middle := Segment{First: 3, Last: 4, PrevHash: entries[1].HMAC, LastHash: entries[3].HMAC}
+	assert.Nil(t, verify([]Segment{middle}, append(entries[:2:2], entries[4:]...)))
+
+	// Without an archive record the gap is a deletion
+	brk := verify(nil, entries[2:])
+	require.NotNil(t, brk)
+	assert.Equal(t, int64(3), brk.Sequence)
+
+	// A record that does not continue the chain does not cover the gap
+	forged := archived
+	forged.LastHash = entries[0].HMAC
+	brk = verify([]Segment{forged}, entries[2:])
+	require.NotNil(t, brk)
+	assert.Equal(t, int64(3), brk.Sequence)
+}
+
+func TestArchiveSignature(t *testing.T) {
+	chain := NewChain([]byte("0123456789abcdef0123456789abcdef"))
+	archive := &models.AuditArchive{
+		Partition:   "audit_logs_y2024m03",
+		PeriodStart: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
+		PeriodEnd:   time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC),
+		SHA256:      "ab",
+		Entries:     2,
+		Segments:    `[{"first":1,"last":2,"prev_hash":"","last_hash":"cd"}]`,
+	}
+	chain.SignArchive(archive)
+	assert.True(t, chain.VerifyArchive(archive))
+
+	archive.Segments = `[{"first":1,"last":3,"prev_hash":"","last_hash":"cd"}]`
+	assert.False(t, chain.VerifyArchive(archive))
+}
+
+func TestArchiveFileRoundTrip(t *testing.T) {
+	chain := NewChain([]byte("0123456789abcdef0123456789abcdef"))
+	sealed := sealedEntries(t, chain, 5)
+	entries := make([]models.AuditLog, len(sealed))
+	for i, entry := range sealed {
+		entry.Timestamp = entry.Timestamp.UTC().Truncate(time.Microsecond)
+		entries[i] = *entry
+	}
+
+	path := filepath.Join(t.TempDir(), "audit_logs_y2024m03"+archiveFileSuffix)
+	file, err := createArchiveFile(path)
+	require.NoError(t, err)
+	require.NoError(t, file.write(entries[:3]))
+	require.NoError(t, file.write(entries[3:]))
+	checksum, size, err := file.commit()
+	require.NoError(t, err)
+	assert.Greater(t, size, int64(0))
+	_, err = os.Stat(path + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+
+	// Entries come back intact and still verify, in any order
+	var restored []models.AuditLog
+	count, err := readArchive(path, checksum, 2, func(batch []models.AuditLog) error {
+		restored = append(restored, batch...)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), count)
+	require.Len(t, restored, 5)
+
+	verifier := newSegmentVerifier(chain)
+	for _, i := range []int{4, 0, 2, 1, 3} {
+		assert.Nil(t, verifier.next(&restored[i]))
+	}
+
+	// A modified entry is caught
+	restored[2].Description = "edited"
+	brk := newSegmentVerifier(chain).next(&restored[2])
+	require.NotNil(t, brk)
+	assert.Equal(t, int64(3), brk.Sequence)
+
+	// So is a corrupted file
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	raw[len(raw)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(path, raw, 0o600))
+	_, err = readArchive(path, checksum, 2, func([]models.AuditLog) error { return nil })
+	assert.Error(t, err)
+}
+
+func TestHeldSubjectsCover(t *testing.T) {
+	user, patient, encounter := uuid.New(), uuid.New(), uuid.New()
+	held := &heldSubjects{
+		users: map[uuid.UUID]bool{user: true},
+		records: map[string]map[uuid.UUID]bool{
+			"patient":   {patient: true},
+			"encounter": {encounter: true},
+		},
+	}
+
+	other := uuid.New()
+	assert.True(t, held.covers(&models.AuditLog{UserID: &user, Resource: "role"}))
+	assert.True(t, held.covers(&models.AuditLog{UserID: &other, Resource: "patient", ResourceID: &patient}))
+	assert.True(t, held.covers(&models.AuditLog{Resource: "encounter", ResourceID: &encounter}))
+	assert.False(t, held.covers(&models.AuditLog{UserID: &other, Resource: "encounter", ResourceID: &patient}))
+	assert.False(t, held.covers(&models.AuditLog{Resource: "patient", ResourceID: &other}))
+}
@@ -0,0 +1,51 @@
+package audit
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// changeTrackingSource marks entries written by TrackChanges
+const changeTrackingSource = "change_tracking"
+
+// Service queries the audit trail
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates a new audit service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// ChangeHistory returns the field-level changes recorded for a record, oldest
+// first
+func (s *Service) ChangeHistory(ctx context.Context, resource string, resourceID uuid.UUID, page, pageSize int) ([]models.AuditLog, int64, error) {
+	var entries []models.AuditLog
+	var total int64
+
+	query := s.db.WithContext(ctx).Model(&models.AuditLog{}).
+		Where("resource = ? AND resource_id = ?", resource, resourceID).
+		Where("metadata->>'source' = ?", changeTrackingSource)
+
+	// Get total count
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, errors.ErrDatabaseError
+	}
+
+	// Get paginated results
+	offset := (page - 1) * pageSize
+	if err := query.
+		Offset(offset).
+		Limit(pageSize).
+		Order("timestamp ASC").
+		Find(&entries).Error; err != nil {
+		return nil, 0, errors.ErrDatabaseError
+	}
+
+	return entries, total, nil
+}
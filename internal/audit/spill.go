@@ -0,0 +1,140 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hospital-emr/backend/internal/common/logger"
+	"github.com/hospital-emr/backend/internal/models"
+)
+
+const spillFileSuffix = ".ndjson"
+
+// spillStore keeps audit entries on disk as newline-delimited JSON. Writes
+// append to an open file; a replay closes it so that every file it reads is
+// complete, and removes each file once its entries are in the database.
+type spillStore struct {
+	dir  string
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newSpillStore(dir string) *spillStore {
+	return &spillStore{dir: dir}
+}
+
+func (s *spillStore) write(entries []*models.AuditLog) error {
+	if s.dir == "" {
+		return fmt.Errorf("no audit spill directory configured")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		if err := os.MkdirAll(s.dir, 0o700); err != nil {
+			return err
+		}
+		name := fmt.Sprintf("audit-%020d%s", time.Now().UnixNano(), spillFileSuffix)
+		file, err := os.OpenFile(filepath.Join(s.dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return err
+		}
+		s.file = file
+	}
+
+	var buf []byte
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+	if _, err := s.file.Write(buf); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// replay hands each spilled file's entries to insert, oldest first, and stops
+// at the first failure so the remaining files are retried later
+func (s *spillStore) replay(insert func([]*models.AuditLog) error) error {
+	if s.dir == "" {
+		return nil
+	}
+
+	// Files created after this point are left for the next replay
+	s.mu.Lock()
+	s.closeLocked()
+	names, err := filepath.Glob(filepath.Join(s.dir, "audit-*"+spillFileSuffix))
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		entries, err := readSpillFile(name)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			if err := insert(entries); err != nil {
+				return err
+			}
+		}
+		if err := os.Remove(name); err != nil {
+			return err
+		}
+		logger.Infof("Replayed %d spilled audit entries from %s", len(entries), filepath.Base(name))
+	}
+	return nil
+}
+
+func (s *spillStore) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeLocked()
+}
+
+func (s *spillStore) closeLocked() {
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+}
+
+// readSpillFile decodes a spill file. A line cut short by a crash is skipped
+// rather than blocking the rest of the file.
+func readSpillFile(name string) ([]*models.AuditLog, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []*models.AuditLog
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var entry models.AuditLog
+		if err := json.Unmarshal([]byte(text), &entry); err != nil {
+			logger.Errorf("Skipping unreadable audit entry at %s:%d: %v", filepath.Base(name), line, err)
+			continue
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, scanner.Err()
+}
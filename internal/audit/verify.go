@@ -0,0 +1,289 @@
+package audit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// ChainBreak describes the first entry that does not fit the chain
+type ChainBreak struct {
+	Sequence int64     `json:"sequence"`
+	EntryID  uuid.UUID `json:"entry_id"`
+	Reason   string    `json:"reason"`
+}
+
+// Checkpoint attests to the head of the chain at one entry. Checkpoints are
+// signed and meant to be stored offline: a chain rewritten from scratch,
+// even with the key, no longer matches them.
+type Checkpoint struct {
+	Sequence  int64     `json:"sequence"`
+	EntryID   uuid.UUID `json:"entry_id"`
+	Timestamp time.Time `json:"timestamp"`
+	Hash      string    `json:"hash"`
+	IssuedAt  time.Time `json:"issued_at"`
+	Signature string    `json:"signature"`
+}
+
+// VerifyOptions controls a walk of the chain
+type VerifyOptions struct {
+	PageSize        int          // Entries read per query
+	CheckpointEvery int64        // Issue a checkpoint every N entries and at the head; 0 for none
+	Checkpoints     []Checkpoint // Previously exported checkpoints the chain must still match
+}
+
+// VerifyReport summarizes a walk of the chain
+type VerifyReport struct {
+	Entries      int64        `json:"entries"`
+	LastSequence int64        `json:"last_sequence"`
+	LastHash     string       `json:"last_hash"`
+	Break        *ChainBreak  `json:"break,omitempty"`
+	Checkpoints  []Checkpoint `json:"checkpoints,omitempty"`
+}
+
+// checkpointPayload is the signed content of a checkpoint
+func checkpointPayload(cp *Checkpoint) string {
+	return fmt.Sprintf("audit-checkpoint|%d|%s|%s|%s|%s",
+		cp.Sequence, cp.EntryID, cp.Timestamp.UTC().Format(time.RFC3339Nano), cp.Hash, cp.IssuedAt.UTC().Format(time.RFC3339Nano))
+}
+
+// SignCheckpoint signs a checkpoint in place
+func (c *Chain) SignCheckpoint(cp *Checkpoint) {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(checkpointPayload(cp)))
+	cp.Signature = hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyCheckpoint reports whether a checkpoint was signed with the chain's key
+func (c *Chain) VerifyCheckpoint(cp *Checkpoint) bool {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(checkpointPayload(cp)))
+	signature, err := hex.DecodeString(cp.Signature)
+	return err == nil && hmac.Equal(signature, mac.Sum(nil))
+}
+
+// chainVerifier checks entries one at a time in sequence order
+type chainVerifier struct {
+	chain    *Chain
+	expected int64
+	prevHash string
+	known    map[int64]Checkpoint
+	archived map[int64]Segment // Keyed by first sequence
+}
+
+func newChainVerifier(chain *Chain, checkpoints []Checkpoint, segments []Segment) *chainVerifier {
+	known := make(map[int64]Checkpoint, len(checkpoints))
+	for _, cp := range checkpoints {
+		known[cp.Sequence] = cp
+	}
+	archived := make(map[int64]Segment, len(segments))
+	for _, segment := range segments {
+		archived[segment.First] = segment
+	}
+	return &chainVerifier{chain: chain, expected: 1, known: known, archived: archived}
+}
+
+// next checks an entry against the one before it, its own HMAC and any
+// checkpoint at its position
+func (v *chainVerifier) next(entry *models.AuditLog) *ChainBreak {
+	if entry.Sequence == nil {
+		return &ChainBreak{EntryID: entry.ID, Reason: "entry has no sequence number"}
+	}
+	broken := func(reason string, args ...interface{}) *ChainBreak {
+		return &ChainBreak{Sequence: *entry.Sequence, EntryID: entry.ID, Reason: fmt.Sprintf(reason, args...)}
+	}
+
+	// Skip runs moved to archives, as long as each continues the chain
+	for *entry.Sequence > v.expected {
+		segment, ok := v.archived[v.expected]
+		if !ok || segment.PrevHash != v.prevHash {
+			break
+		}
+		v.expected = segment.Last + 1
+		v.prevHash = segment.LastHash
+	}
+
+	if *entry.Sequence != v.expected {
+		return broken("sequence gap: expected entry %d; entries were removed", v.expected)
+	}
+	if entry.PrevHash != v.prevHash {
+		return broken("previous hash does not match entry %d; entries were removed or reordered", v.expected-1)
+	}
+	hash, err := v.chain.Sign(entry)
+	if err != nil {
+		return broken("entry cannot be signed: %v", err)
+	}
+	if !hmac.Equal([]byte(hash), []byte(entry.HMAC)) {
+		return broken("HMAC mismatch; the entry was modified")
+	}
+	if cp, ok := v.known[*entry.Sequence]; ok && (cp.Hash != entry.HMAC || cp.EntryID != entry.ID) {
+		return broken("entry does not match the checkpoint issued at %s", cp.IssuedAt.Format(time.RFC3339))
+	}
+
+	v.expected++
+	v.prevHash = entry.HMAC
+	return nil
+}
+
+// Verify walks the chain from its first entry, stopping at the first broken
+// link. Entries moved to archives are accounted for by the signed archive
+// records. Checkpoints passed in must carry a valid signature and still
+// match the chain; the chain must reach the last of them.
+func (c *Chain) Verify(ctx context.Context, db *gorm.DB, opts VerifyOptions) (*VerifyReport, error) {
+	if opts.PageSize <= 0 {
+		opts.PageSize = 1000
+	}
+	for i := range opts.Checkpoints {
+		if !c.VerifyCheckpoint(&opts.Checkpoints[i]) {
+			return nil, fmt.Errorf("checkpoint at entry %d has an invalid signature", opts.Checkpoints[i].Sequence)
+		}
+	}
+
+	segments, err := c.archivedSegments(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &VerifyReport{}
+	verifier := newChainVerifier(c, opts.Checkpoints, segments)
+	var last *models.AuditLog
+
+	for {
+		var page []models.AuditLog
+		if err := db.WithContext(ctx).
+			Where("sequence > ?", report.LastSequence).
+			Order("sequence ASC").
+			Limit(opts.PageSize).
+			Find(&page).Error; err != nil {
+			return nil, err
+		}
+
+		for i := range page {
+			entry := &page[i]
+			if brk := verifier.next(entry); brk != nil {
+				report.Break = brk
+				return report, nil
+			}
+			report.Entries++
+			report.LastSequence = *entry.Sequence
+			report.LastHash = entry.HMAC
+			if opts.CheckpointEvery > 0 && *entry.Sequence%opts.CheckpointEvery == 0 {
+				report.Checkpoints = append(report.Checkpoints, c.checkpoint(entry))
+			}
+			last = entry
+		}
+
+		if len(page) < opts.PageSize {
+			break
+		}
+	}
+
+	// A truncated chain verifies up to its new head; checkpoints catch it
+	for _, cp := range opts.Checkpoints {
+		if cp.Sequence > report.LastSequence && !verifier.isArchived(cp.Sequence) {
+			report.Break = &ChainBreak{
+				Sequence: cp.Sequence,
+				EntryID:  cp.EntryID,
+				Reason:   fmt.Sprintf("checkpointed entry is missing; the chain ends at entry %d", report.LastSequence),
+			}
+			return report, nil
+		}
+	}
+
+	if opts.CheckpointEvery > 0 && last != nil && *last.Sequence%opts.CheckpointEvery != 0 {
+		report.Checkpoints = append(report.Checkpoints, c.checkpoint(last))
+	}
+	return report, nil
+}
+
+// archivedSegments loads the runs of the chain moved to archives. An archive
+// record with a bad signature could hide deleted entries, so it fails the
+// verification outright.
+func (c *Chain) archivedSegments(ctx context.Context, db *gorm.DB) ([]Segment, error) {
+	var archives []models.AuditArchive
+	if err := db.WithContext(ctx).Find(&archives).Error; err != nil {
+		return nil, err
+	}
+
+	var segments []Segment
+	for i := range archives {
+		if !c.VerifyArchive(&archives[i]) {
+			return nil, fmt.Errorf("archive record %s has an invalid signature", archives[i].Partition)
+		}
+		archived, err := archiveSegments(&archives[i])
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, archived...)
+	}
+	return segments, nil
+}
+
+// isArchived reports whether a sequence lies in an archived run
+func (v *chainVerifier) isArchived(sequence int64) bool {
+	for _, segment := range v.archived {
+		if sequence >= segment.First && sequence <= segment.Last {
+			return true
+		}
+	}
+	return false
+}
+
+// segmentVerifier checks entries restored from an archive, which arrive in
+// timestamp order: each entry must carry a valid HMAC and link to whichever
+// of its neighbours in the chain are also in the archive
+type segmentVerifier struct {
+	chain      *Chain
+	hashes     map[int64]string
+	prevHashes map[int64]string
+}
+
+func newSegmentVerifier(chain *Chain) *segmentVerifier {
+	return &segmentVerifier{chain: chain, hashes: map[int64]string{}, prevHashes: map[int64]string{}}
+}
+
+func (v *segmentVerifier) next(entry *models.AuditLog) *ChainBreak {
+	if v.chain == nil || entry.Sequence == nil {
+		return nil
+	}
+	sequence := *entry.Sequence
+	broken := func(reason string) *ChainBreak {
+		return &ChainBreak{Sequence: sequence, EntryID: entry.ID, Reason: reason}
+	}
+
+	hash, err := v.chain.Sign(entry)
+	if err != nil {
+		return broken(fmt.Sprintf("entry cannot be signed: %v", err))
+	}
+	if !hmac.Equal([]byte(hash), []byte(entry.HMAC)) {
+		return broken("HMAC mismatch; the entry was modified")
+	}
+	if prev, ok := v.hashes[sequence-1]; ok && prev != entry.PrevHash {
+		return broken("previous hash does not match the entry before it")
+	}
+	if next, ok := v.prevHashes[sequence+1]; ok && next != entry.HMAC {
+		return broken("hash does not match the entry after it")
+	}
+	v.hashes[sequence] = entry.HMAC
+	v.prevHashes[sequence] = entry.PrevHash
+	return nil
+}
+
+func (c *Chain) checkpoint(entry *models.AuditLog) Checkpoint {
+	cp := Checkpoint{
+		Sequence:  *entry.Sequence,
+		EntryID:   entry.ID,
+		Timestamp: entry.Timestamp.UTC(),
+		Hash:      entry.HMAC,
+		IssuedAt:  time.Now().UTC().Truncate(time.Second),
+	}
+	c.SignCheckpoint(&cp)
+	return cp
+}
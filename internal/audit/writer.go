@@ -0,0 +1,234 @@
+package audit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/logger"
+	"github.com/hospital-emr/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// WriterConfig tunes the asynchronous audit writer
+type WriterConfig struct {
+	QueueSize     int           // Entries buffered in memory; overflow spills to disk
+	BatchSize     int           // Entries written per insert
+	FlushInterval time.Duration // Longest an entry waits in the queue
+	SpillDir      string        // Holds entries while the database is unavailable
+	RetryInterval time.Duration // How often spilled entries are retried
+}
+
+// Writer persists audit entries in batches off the request path. The queue is
+// bounded: when it is full, or while the database is unavailable, entries are
+// spilled to disk and replayed once inserts succeed again, so no entry is
+// dropped and no request waits on the audit table.
+type Writer struct {
+	db     *gorm.DB
+	chain  *Chain
+	cfg    WriterConfig
+	queue  chan *models.AuditLog
+	spill  *spillStore
+	stop   chan struct{}
+	done   chan struct{}
+	mu     sync.RWMutex
+	closed bool
+
+	// Owned by the run loop
+	retryAt time.Time
+}
+
+// NewWriter creates an audit writer and starts its background loop. Entries
+// are appended to chain when one is given.
+func NewWriter(db *gorm.DB, chain *Chain, cfg WriterConfig) *Writer {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 10000
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 200
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = 30 * time.Second
+	}
+
+	w := &Writer{
+		db:    db,
+		chain: chain,
+		cfg:   cfg,
+		queue: make(chan *models.AuditLog, cfg.QueueSize),
+		spill: newSpillStore(cfg.SpillDir),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Enqueue hands an entry to the writer without blocking. The entry's ID and
+// timestamp are fixed here so they reflect the request rather than the write.
+func (w *Writer) Enqueue(entry *models.AuditLog) {
+	if entry.ID == uuid.Nil {
+		entry.ID = uuid.New()
+	}
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now().UTC()
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if !w.closed {
+		select {
+		case w.queue <- entry:
+			return
+		default:
+		}
+	}
+	w.spillEntries([]*models.AuditLog{entry})
+}
+
+// Close stops accepting entries into the queue and writes out everything
+// already queued. Entries that cannot be written before ctx ends remain in
+// the spill directory for the next start.
+func (w *Writer) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	close(w.stop)
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *Writer) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	// Entries spilled by a previous run are replayed first
+	w.replay()
+
+	batch := make([]*models.AuditLog, 0, w.cfg.BatchSize)
+	for {
+		select {
+		case entry := <-w.queue:
+			batch = append(batch, entry)
+			if len(batch) >= w.cfg.BatchSize {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+			if !w.retryAt.IsZero() && !time.Now().Before(w.retryAt) {
+				w.replay()
+			}
+		case <-w.stop:
+			w.drain(batch)
+			return
+		}
+	}
+}
+
+// drain writes out everything still queued once the writer is closed
+func (w *Writer) drain(batch []*models.AuditLog) {
+	defer w.spill.close()
+	for {
+		select {
+		case entry := <-w.queue:
+			batch = append(batch, entry)
+		default:
+			w.flush(batch)
+			if w.retryAt.IsZero() {
+				w.replay()
+			}
+			return
+		}
+	}
+}
+
+// flush inserts a batch, spilling it when the database is unavailable. While
+// a retry is pending new batches go straight to disk so they stay behind the
+// entries already spilled.
+func (w *Writer) flush(batch []*models.AuditLog) {
+	if len(batch) == 0 {
+		return
+	}
+
+	if w.retryAt.IsZero() {
+		err := w.insert(batch)
+		if err == nil {
+			return
+		}
+		logger.WithFields(map[string]interface{}{
+			"entries": len(batch),
+			"error":   err.Error(),
+		}).Warn("Audit database unavailable, spilling entries to disk")
+		w.retryAt = time.Now().Add(w.cfg.RetryInterval)
+	}
+	w.spillEntries(batch)
+}
+
+// replay writes spilled entries back to the database, oldest file first
+func (w *Writer) replay() {
+	if err := w.spill.replay(w.insert); err != nil {
+		logger.Warnf("Failed to replay spilled audit entries: %v", err)
+		w.retryAt = time.Now().Add(w.cfg.RetryInterval)
+		return
+	}
+	w.retryAt = time.Time{}
+}
+
+// insert writes entries in batches. Replayed entries keep their IDs, so
+// entries already written by an interrupted replay are skipped.
+func (w *Writer) insert(entries []*models.AuditLog) error {
+	if w.chain == nil {
+		return w.db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(entries, w.cfg.BatchSize).Error
+	}
+
+	for start := 0; start < len(entries); start += w.cfg.BatchSize {
+		end := start + w.cfg.BatchSize
+		if end > len(entries) {
+			end = len(entries)
+		}
+		if err := w.chain.Append(context.Background(), w.db, entries[start:end], w.cfg.BatchSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Writer) spillEntries(entries []*models.AuditLog) {
+	if err := w.spill.write(entries); err != nil {
+		// Last resort: the entries at least reach the application log
+		for _, entry := range entries {
+			logger.WithFields(map[string]interface{}{
+				"audit_id":    entry.ID,
+				"timestamp":   entry.Timestamp,
+				"user_id":     entry.UserID,
+				"action":      entry.Action,
+				"resource":    entry.Resource,
+				"resource_id": entry.ResourceID,
+				"request_id":  entry.RequestID,
+				"status_code": entry.StatusCode,
+				"error":       err.Error(),
+			}).Error("Failed to spill audit entry")
+		}
+	}
+}
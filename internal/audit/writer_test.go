@@ -0,0 +1,78 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// unreachableDB returns a handle whose every statement fails to connect
+func unreachableDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(postgres.Open("host=127.0.0.1 port=1 user=emr dbname=emr sslmode=disable connect_timeout=1"), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               gormlogger.Discard,
+	})
+	require.NoError(t, err)
+	return db
+}
+
+func TestWriterSpillsWhenDatabaseUnavailable(t *testing.T) {
+	dir := t.TempDir()
+	writer := NewWriter(unreachableDB(t), nil, WriterConfig{
+		QueueSize:     2,
+		BatchSize:     10,
+		FlushInterval: time.Hour,
+		SpillDir:      dir,
+		RetryInterval: time.Hour,
+	})
+
+	for i := 0; i < 5; i++ {
+		writer.Enqueue(&models.AuditLog{Action: models.AuditActionRead, Resource: "patient", RequestID: "req"})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, writer.Close(ctx))
+
+	// Entries written after close still reach the spill directory
+	writer.Enqueue(&models.AuditLog{Action: models.AuditActionUpdate, Resource: "patient"})
+	writer.spill.close()
+
+	var replayed []*models.AuditLog
+	require.NoError(t, newSpillStore(dir).replay(func(entries []*models.AuditLog) error {
+		replayed = append(replayed, entries...)
+		return nil
+	}))
+	require.Len(t, replayed, 6)
+	for _, entry := range replayed {
+		assert.NotEmpty(t, entry.ID)
+		assert.False(t, entry.Timestamp.IsZero())
+	}
+
+	// Replayed files are removed
+	require.NoError(t, newSpillStore(dir).replay(func(entries []*models.AuditLog) error {
+		t.Fatalf("unexpected replay of %d entries", len(entries))
+		return nil
+	}))
+}
+
+func TestSpillReplayKeepsFilesOnFailure(t *testing.T) {
+	store := newSpillStore(t.TempDir())
+	require.NoError(t, store.write([]*models.AuditLog{{Action: models.AuditActionRead, Resource: "encounter"}}))
+
+	assert.Error(t, store.replay(func([]*models.AuditLog) error { return errors.New("database down") }))
+
+	var replayed int
+	require.NoError(t, store.replay(func(entries []*models.AuditLog) error {
+		replayed += len(entries)
+		return nil
+	}))
+	assert.Equal(t, 1, replayed)
+}
@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/common/middleware"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/hospital-emr/backend/pkg/encryption"
+	"gorm.io/gorm"
+)
+
+// APIKeyPrefix starts every API key so leaked keys are easy to recognise
+const APIKeyPrefix = "emr_"
+
+// apiKeyTouchInterval limits how often last-used tracking writes to the database
+const apiKeyTouchInterval = time.Minute
+
+// APIKeyAuthenticator validates service account API keys, caching lookups
+// in-process like SessionCache. Revocations made through this instance take
+// effect immediately; others are picked up once the cached entry expires.
+type APIKeyAuthenticator struct {
+	db      *gorm.DB
+	ttl     time.Duration
+	mu      sync.RWMutex
+	entries map[string]*apiKeyCacheEntry
+}
+
+type apiKeyCacheEntry struct {
+	key       *models.APIKey // nil when no usable key has this hash
+	expiresAt time.Time
+	touchedAt time.Time
+}
+
+// NewAPIKeyAuthenticator creates a new API key authenticator
+func NewAPIKeyAuthenticator(db *gorm.DB, ttl time.Duration) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{
+		db:      db,
+		ttl:     ttl,
+		entries: make(map[string]*apiKeyCacheEntry),
+	}
+}
+
+// GenerateAPIKey returns a new random API key and its display prefix
+func GenerateAPIKey() (key, prefix string, err error) {
+	id, err := encryption.GenerateRandomToken(6)
+	if err != nil {
+		return "", "", err
+	}
+	secret, err := encryption.GenerateRandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	prefix = APIKeyPrefix + id
+	return prefix + "_" + secret, prefix, nil
+}
+
+// ValidateAPIKey authenticates an API key used from clientIP and returns the
+// service account behind it. The key must be unrevoked and unexpired, its
+// service account active, and clientIP within the key's allow-list.
+func (a *APIKeyAuthenticator) ValidateAPIKey(ctx context.Context, rawKey, clientIP string) (*middleware.ServicePrincipal, error) {
+	if !strings.HasPrefix(rawKey, APIKeyPrefix) {
+		return nil, errors.ErrAPIKeyInvalid()
+	}
+
+	now := time.Now()
+	hash := encryption.HashToken(rawKey)
+
+	a.mu.RLock()
+	entry, ok := a.entries[hash]
+	a.mu.RUnlock()
+	if !ok || now.After(entry.expiresAt) {
+		var err error
+		if entry, err = a.load(ctx, hash, now); err != nil {
+			return nil, err
+		}
+	}
+
+	key := entry.key
+	if key == nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return nil, errors.ErrAPIKeyInvalid()
+	}
+	if !ipAllowed(key.AllowedIPs, clientIP) {
+		return nil, errors.ErrAPIKeyIPNotAllowed()
+	}
+
+	a.touch(ctx, entry, clientIP, now)
+
+	return &middleware.ServicePrincipal{
+		ServiceAccountID: key.ServiceAccountID,
+		Name:             key.ServiceAccount.Name,
+		KeyID:            key.ID,
+		Scopes:           key.Scopes,
+	}, nil
+}
+
+// InvalidateServiceAccount drops cached keys of a service account, e.g. after
+// a key is revoked or the account is deactivated
+func (a *APIKeyAuthenticator) InvalidateServiceAccount(serviceAccountID uuid.UUID) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for hash, entry := range a.entries {
+		if entry.key != nil && entry.key.ServiceAccountID == serviceAccountID {
+			delete(a.entries, hash)
+		}
+	}
+}
+
+// load looks up an API key by hash and caches the result, including misses
+func (a *APIKeyAuthenticator) load(ctx context.Context, hash string, now time.Time) (*apiKeyCacheEntry, error) {
+	var key models.APIKey
+	err := a.db.WithContext(ctx).
+		Joins("ServiceAccount").
+		Where("api_keys.key_hash = ? AND api_keys.revoked_at IS NULL", hash).
+		Where(`"ServiceAccount".is_active = ?`, true).
+		First(&key).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	entry := &apiKeyCacheEntry{expiresAt: now.Add(a.ttl)}
+	if err == nil {
+		entry.key = &key
+		if key.LastUsedAt != nil {
+			entry.touchedAt = *key.LastUsedAt
+		}
+	}
+
+	a.mu.Lock()
+	if len(a.entries) >= maxSessionCacheEntries {
+		for h, e := range a.entries {
+			if now.After(e.expiresAt) {
+				delete(a.entries, h)
+			}
+		}
+	}
+	a.entries[hash] = entry
+	a.mu.Unlock()
+
+	return entry, nil
+}
+
+// touch records when and from where a key was last used, at most once per
+// apiKeyTouchInterval
+func (a *APIKeyAuthenticator) touch(ctx context.Context, entry *apiKeyCacheEntry, clientIP string, now time.Time) {
+	a.mu.Lock()
+	if now.Sub(entry.touchedAt) < apiKeyTouchInterval {
+		a.mu.Unlock()
+		return
+	}
+	entry.touchedAt = now
+	a.mu.Unlock()
+
+	a.db.WithContext(ctx).
+		Model(&models.APIKey{}).
+		Where("id = ?", entry.key.ID).
+		Updates(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": clientIP,
+		})
+}
+
+// ipAllowed reports whether ip matches an entry of the allow-list. Entries
+// are plain addresses or CIDR ranges; an empty list allows any address.
+func ipAllowed(allowed []string, ip string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+
+	for _, entry := range allowed {
+		if strings.Contains(entry, "/") {
+			if _, network, err := net.ParseCIDR(entry); err == nil && network.Contains(addr) {
+				return true
+			}
+			continue
+		}
+		if allowedAddr := net.ParseIP(entry); allowedAddr != nil && allowedAddr.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, prefix, err := GenerateAPIKey()
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(prefix, APIKeyPrefix))
+	assert.True(t, strings.HasPrefix(key, prefix+"_"))
+	assert.Greater(t, len(key), 40)
+
+	other, _, err := GenerateAPIKey()
+	require.NoError(t, err)
+	assert.NotEqual(t, key, other)
+}
+
+func TestIPAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		ip      string
+		want    bool
+	}{
+		{"empty list allows any", nil, "203.0.113.7", true},
+		{"exact address", []string{"10.0.0.5"}, "10.0.0.5", true},
+		{"other address", []string{"10.0.0.5"}, "10.0.0.6", false},
+		{"cidr range", []string{"192.168.10.0/24"}, "192.168.10.42", true},
+		{"outside cidr range", []string{"192.168.10.0/24"}, "192.168.11.1", false},
+		{"ipv6 range", []string{"2001:db8::/32"}, "2001:db8::1", true},
+		{"unparseable client ip", []string{"10.0.0.0/8"}, "unknown", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ipAllowed(tt.allowed, tt.ip))
+		})
+	}
+}
+
+func TestValidateAPIKeyRejectsForeignFormat(t *testing.T) {
+	authenticator := NewAPIKeyAuthenticator(nil, 0)
+
+	_, err := authenticator.ValidateAPIKey(context.Background(), "not-an-api-key", "127.0.0.1")
+	assert.Error(t, err)
+}
@@ -0,0 +1,308 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/common/logger"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/hospital-emr/backend/pkg/email"
+	"github.com/hospital-emr/backend/pkg/encryption"
+	"gorm.io/gorm"
+)
+
+// ChangePasswordRequest represents an authenticated password change
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ReauthenticateRequest confirms the signed-in user is present before a
+// sign-in factor is added to the account. Either field is enough.
+type ReauthenticateRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"` // Current TOTP or recovery code
+}
+
+// ForgotPasswordRequest represents a request for a password reset email
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest represents a password reset using an emailed token
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// TemporaryPasswordResponse carries an admin-issued temporary password
+type TemporaryPasswordResponse struct {
+	TemporaryPassword  string `json:"temporary_password"`
+	MustChangePassword bool   `json:"must_change_password"`
+}
+
+// ChangePassword changes the password of the signed-in user after verifying
+// the current one. Every other session of the user is revoked.
+func (s *Service) ChangePassword(ctx context.Context, userID, sessionID uuid.UUID, req *ChangePasswordRequest, ipAddress, userAgent string) error {
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !encryption.CheckPasswordHash(req.CurrentPassword, user.PasswordHash) {
+		return errors.ErrCurrentPasswordIncorrect()
+	}
+
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return s.passwords.SetPassword(ctx, tx, user, req.NewPassword, false)
+	}); err != nil {
+		return err
+	}
+
+	revoked, _ := s.revokeSessions(ctx, s.db.WithContext(ctx).Where("user_id = ? AND id <> ?", user.ID, sessionID), SessionRevokedPasswordChange)
+
+	s.audit.Record(ctx, &models.AuditLog{
+		UserID:      &user.ID,
+		Action:      models.AuditActionPasswordChange,
+		Resource:    "user",
+		ResourceID:  &user.ID,
+		Description: fmt.Sprintf("Password changed; %d other session(s) revoked", revoked),
+		IPAddress:   ipAddress,
+		UserAgent:   userAgent,
+	})
+
+	return nil
+}
+
+// reauthWindow is how recently users with neither a local password nor MFA
+// must have signed in to add a sign-in factor
+const reauthWindow = 5 * time.Minute
+
+// reauthenticate checks that whoever holds the access token can still sign
+// in as its user, so a stolen token cannot add a passkey or authenticator
+// that outlives it. External users with neither a password nor MFA have
+// nothing to confirm and must have signed in within reauthWindow.
+func (s *Service) reauthenticate(ctx context.Context, user *models.User, sessionID uuid.UUID, req *ReauthenticateRequest) error {
+	switch {
+	case req.Code != "" && user.MFAEnabled:
+		return s.verifyMFACode(ctx, user, req.Code)
+	case req.Password != "":
+		if !encryption.CheckPasswordHash(req.Password, user.PasswordHash) {
+			return errors.ErrCurrentPasswordIncorrect()
+		}
+		return nil
+	case user.PasswordHash == externalPassword && !user.MFAEnabled:
+		// Refreshing rotates the session, so the sign-in is the oldest
+		// session of its family
+		var signedInAt *time.Time
+		if err := s.db.WithContext(ctx).
+			Model(&models.Session{}).
+			Select("MIN(created_at)").
+			Where("user_id = ? AND family_id = (?)", user.ID,
+				s.db.WithContext(ctx).Model(&models.Session{}).Select("family_id").Where("id = ?", sessionID)).
+			Scan(&signedInAt).Error; err != nil {
+			return errors.ErrDatabaseError
+		}
+		if signedInAt != nil && time.Since(*signedInAt) < reauthWindow {
+			return nil
+		}
+	}
+	return errors.ErrReauthenticationRequired()
+}
+
+// ForgotPassword emails a single-use reset link to the account. It behaves the
+// same whether or not the email belongs to an active account so the endpoint
+// cannot be used to discover accounts.
+func (s *Service) ForgotPassword(ctx context.Context, req *ForgotPasswordRequest, ipAddress, userAgent string) error {
+	var user models.User
+	if err := s.db.WithContext(ctx).
+		Where("email = ? AND status = ?", req.Email, models.UserStatusActive).
+		First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		return errors.ErrDatabaseError
+	}
+
+	token, err := encryption.GenerateRandomToken(32)
+	if err != nil {
+		return errors.ErrInternal
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(s.config.GetPasswordResetTokenTTL())
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Only the most recently requested link stays usable
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.PasswordResetToken{
+			UserID:      user.ID,
+			TokenHash:   encryption.HashToken(token),
+			ExpiresAt:   expiresAt,
+			RequestedIP: ipAddress,
+		}).Error
+	})
+	if err != nil {
+		return errors.ErrDatabaseError
+	}
+
+	s.audit.Record(ctx, &models.AuditLog{
+		UserID:      &user.ID,
+		Action:      models.AuditActionPasswordResetRequest,
+		Resource:    "user",
+		ResourceID:  &user.ID,
+		Description: "Password reset requested",
+		IPAddress:   ipAddress,
+		UserAgent:   userAgent,
+	})
+
+	// Send in the background so response time does not reveal whether the account exists
+	msg := s.passwordResetMessage(&user, token, expiresAt)
+	go func() {
+		sendCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		if err := s.mailer.Send(sendCtx, msg); err != nil {
+			logger.WithFields(map[string]interface{}{
+				"user_id": user.ID,
+				"error":   err.Error(),
+			}).Error("Failed to send password reset email")
+		}
+	}()
+
+	return nil
+}
+
+// ResetPassword sets a new password using a reset token. The token is consumed
+// even if a concurrent request presents it, and all sessions are revoked.
+func (s *Service) ResetPassword(ctx context.Context, req *ResetPasswordRequest, ipAddress, userAgent string) error {
+	var resetToken models.PasswordResetToken
+	if err := s.db.WithContext(ctx).
+		Where("token_hash = ?", encryption.HashToken(req.Token)).
+		First(&resetToken).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return errors.ErrTokenInvalid
+		}
+		return errors.ErrDatabaseError
+	}
+
+	if resetToken.UsedAt != nil {
+		return errors.ErrTokenInvalid
+	}
+	if time.Now().After(resetToken.ExpiresAt) {
+		return errors.ErrTokenExpired
+	}
+
+	user, err := s.findUser(ctx, resetToken.UserID)
+	if err != nil {
+		return errors.ErrTokenInvalid
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", resetToken.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return errors.ErrDatabaseError
+		}
+		if result.RowsAffected != 1 {
+			return errors.ErrTokenInvalid
+		}
+
+		return s.passwords.SetPassword(ctx, tx, user, req.NewPassword, false)
+	})
+	if err != nil {
+		return err
+	}
+
+	revoked, _ := s.RevokeAllSessions(ctx, user.ID)
+
+	s.audit.Record(ctx, &models.AuditLog{
+		UserID:      &user.ID,
+		Action:      models.AuditActionPasswordReset,
+		Resource:    "user",
+		ResourceID:  &user.ID,
+		Description: fmt.Sprintf("Password reset with emailed token; %d session(s) revoked", revoked),
+		IPAddress:   ipAddress,
+		UserAgent:   userAgent,
+	})
+
+	return nil
+}
+
+// IssueTemporaryPassword replaces a user's password with a generated one that
+// must be changed at next login and revokes all of the user's sessions
+func (s *Service) IssueTemporaryPassword(ctx context.Context, adminID, userID uuid.UUID, ipAddress, userAgent string) (*TemporaryPasswordResponse, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, "id = ?", userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrUserNotFound(userID.String())
+		}
+		return nil, errors.ErrDatabaseError
+	}
+
+	password, err := s.passwords.GenerateTemporaryPassword()
+	if err != nil {
+		return nil, errors.ErrInternal
+	}
+
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return s.passwords.SetPassword(ctx, tx, &user, password, true)
+	}); err != nil {
+		return nil, err
+	}
+
+	revoked, _ := s.RevokeAllSessions(ctx, user.ID)
+
+	s.audit.Record(ctx, &models.AuditLog{
+		UserID:      &adminID,
+		Action:      models.AuditActionTemporaryPassword,
+		Resource:    "user",
+		ResourceID:  &user.ID,
+		Description: fmt.Sprintf("Temporary password issued for %s; %d session(s) revoked", user.Email, revoked),
+		IPAddress:   ipAddress,
+		UserAgent:   userAgent,
+		Severity:    models.AuditSeverityWarning,
+	})
+
+	return &TemporaryPasswordResponse{
+		TemporaryPassword:  password,
+		MustChangePassword: true,
+	}, nil
+}
+
+// passwordResetMessage builds the reset email containing the reset link
+func (s *Service) passwordResetMessage(user *models.User, token string, expiresAt time.Time) *email.Message {
+	link := s.config.Email.PasswordResetURL
+	separator := "?"
+	if strings.Contains(link, "?") {
+		separator = "&"
+	}
+	link += separator + "token=" + url.QueryEscape(token)
+
+	body := fmt.Sprintf(`Halo %s,
+
+Kami menerima permintaan untuk mengatur ulang kata sandi akun %s Anda.
+Gunakan tautan berikut untuk membuat kata sandi baru:
+
+%s
+
+Tautan ini hanya dapat digunakan satu kali dan berlaku sampai %s.
+Jika Anda tidak meminta pengaturan ulang kata sandi, abaikan email ini.
+`, user.FirstName, s.config.App.Name, link, expiresAt.Format("02 Jan 2006 15:04 MST"))
+
+	return &email.Message{
+		To:      []string{user.Email},
+		Subject: "Atur ulang kata sandi " + s.config.App.Name,
+		Body:    body,
+	}
+}
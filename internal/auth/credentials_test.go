@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/hospital-emr/backend/pkg/encryption"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func TestReauthenticate(t *testing.T) {
+	// Checks that need the database, such as a session's age, fail
+	db, err := gorm.Open(postgres.Open("host=127.0.0.1 port=1 user=emr dbname=emr sslmode=disable connect_timeout=1"), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               gormlogger.Discard,
+	})
+	require.NoError(t, err)
+	s := &Service{db: db}
+
+	hash, err := encryption.HashPassword("correct horse")
+	require.NoError(t, err)
+	local := &models.User{PasswordHash: hash}
+	local.ID = uuid.New()
+	external := &models.User{PasswordHash: externalPassword}
+	external.ID = uuid.New()
+
+	tests := []struct {
+		name      string
+		user      *models.User
+		req       ReauthenticateRequest
+		errorCode string
+	}{
+		{"current password", local, ReauthenticateRequest{Password: "correct horse"}, ""},
+		{"wrong password", local, ReauthenticateRequest{Password: "wrong"}, "CURRENT_PASSWORD_INCORRECT"},
+		{"nothing confirmed", local, ReauthenticateRequest{}, "REAUTHENTICATION_REQUIRED"},
+		{"code without MFA", local, ReauthenticateRequest{Code: "123456"}, "REAUTHENTICATION_REQUIRED"},
+		{"external user checks the sign-in time", external, ReauthenticateRequest{}, "DATABASE_ERROR"},
+		{"password of an external user", external, ReauthenticateRequest{Password: externalPassword}, "CURRENT_PASSWORD_INCORRECT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.reauthenticate(context.Background(), tt.user, uuid.New(), &tt.req)
+			if tt.errorCode == "" {
+				assert.NoError(t, err)
+				return
+			}
+			appErr, ok := err.(*errors.AppError)
+			require.True(t, ok, "expected an AppError, got %v", err)
+			assert.Equal(t, tt.errorCode, appErr.Code)
+		})
+	}
+}
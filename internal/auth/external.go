@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// ExternalIdentity is an account asserted by an external identity provider
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string // Stable ID at the provider (OIDC sub, LDAP DN)
+	Email         string
+	EmailVerified bool // Whether the provider vouches for the email; only verified emails link accounts
+	FirstName     string
+	LastName      string
+	Groups        []string
+	MFA           bool // Whether the provider reports a second factor for this login
+}
+
+// RedirectProvider authenticates users by redirecting them to an identity
+// provider that sends them back with an authorization code (OIDC)
+type RedirectProvider interface {
+	Name() string
+	AuthURL(ctx context.Context, state, nonce, codeVerifier string) (string, error)
+	Callback(ctx context.Context, code, codeVerifier, nonce string) (*ExternalIdentity, error)
+}
+
+// PasswordProvider authenticates users with a username and password checked
+// by an external directory (LDAP)
+type PasswordProvider interface {
+	Name() string
+	Authenticate(ctx context.Context, username, password string) (*ExternalIdentity, error)
+}
+
+// GroupRoleMapper maps provider groups to role codes
+type GroupRoleMapper map[string][]string
+
+// Roles returns the sorted, de-duplicated role codes granted by the given
+// groups. Groups are matched case-insensitively.
+func (m GroupRoleMapper) Roles(groups []string) []string {
+	seen := make(map[string]bool)
+	var roles []string
+	for _, group := range groups {
+		for _, role := range m[strings.ToLower(strings.TrimSpace(group))] {
+			if !seen[role] {
+				seen[role] = true
+				roles = append(roles, role)
+			}
+		}
+	}
+	sort.Strings(roles)
+	return roles
+}
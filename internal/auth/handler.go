@@ -55,6 +55,127 @@ func (h *Handler) Login(c *gin.Context) {
 	c.JSON(http.StatusOK, resp)
 }
 
+// ChangeExpiredPassword godoc
+// @Summary Change expired password
+// @Description Replace an expired or temporary password using the token returned by login, then sign in
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body ChangeExpiredPasswordRequest true "Password change token and new password"
+// @Success 200 {object} LoginResponse
+// @Failure 400 {object} errors.AppError
+// @Failure 401 {object} errors.AppError
+// @Router /api/v1/otentikasi/kata-sandi/kedaluwarsa [post]
+func (h *Handler) ChangeExpiredPassword(c *gin.Context) {
+	var req ChangeExpiredPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails(err.Error()))
+		return
+	}
+
+	resp, err := h.service.ChangeExpiredPassword(c.Request.Context(), &req, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// VerifyMFALogin godoc
+// @Summary Verify MFA login
+// @Description Finish a login answered with an MFA challenge using the MFA token and a TOTP or recovery code
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body MFALoginRequest true "MFA token and code"
+// @Success 200 {object} LoginResponse
+// @Failure 400 {object} errors.AppError
+// @Failure 401 {object} errors.AppError
+// @Router /api/v1/otentikasi/mfa/verifikasi [post]
+func (h *Handler) VerifyMFALogin(c *gin.Context) {
+	var req MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails(err.Error()))
+		return
+	}
+
+	resp, err := h.service.VerifyMFALogin(c.Request.Context(), &req, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ForgotPassword godoc
+// @Summary Request password reset
+// @Description Email a single-use password reset link. Always succeeds so accounts cannot be enumerated.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body ForgotPasswordRequest true "Account email"
+// @Success 202 {object} map[string]string
+// @Failure 400 {object} errors.AppError
+// @Router /api/v1/otentikasi/lupa-kata-sandi [post]
+func (h *Handler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails(err.Error()))
+		return
+	}
+
+	if err := h.service.ForgotPassword(c.Request.Context(), &req, c.ClientIP(), c.Request.UserAgent()); err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the email belongs to an active account, a reset link has been sent"})
+}
+
+// ResetPassword godoc
+// @Summary Reset password
+// @Description Set a new password using an emailed reset token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} errors.AppError
+// @Failure 401 {object} errors.AppError
+// @Router /api/v1/otentikasi/atur-ulang-kata-sandi [post]
+func (h *Handler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails(err.Error()))
+		return
+	}
+
+	if err := h.service.ResetPassword(c.Request.Context(), &req, c.ClientIP(), c.Request.UserAgent()); err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
+
 // Logout godoc
 // @Summary User logout
 // @Description Logout user and invalidate session
@@ -72,12 +193,13 @@ func (h *Handler) Logout(c *gin.Context) {
 		return
 	}
 
-	token := c.GetHeader("Authorization")
-	if len(token) > 7 {
-		token = token[7:] // Remove "Bearer " prefix
+	sessionID, exists := c.Get("session_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, errors.ErrUnauthorized)
+		return
 	}
 
-	if err := h.service.Logout(c.Request.Context(), userID.(uuid.UUID), token); err != nil {
+	if err := h.service.Logout(c.Request.Context(), userID.(uuid.UUID), sessionID.(uuid.UUID)); err != nil {
 		c.JSON(http.StatusInternalServerError, errors.ErrInternal)
 		return
 	}
@@ -85,6 +207,74 @@ func (h *Handler) Logout(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
 
+// ListMySessions godoc
+// @Summary List own sessions
+// @Description List the devices the current user is signed in on
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} errors.AppError
+// @Router /api/v1/otentikasi/sesi [get]
+func (h *Handler) ListMySessions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, errors.ErrUnauthorized)
+		return
+	}
+
+	sessions, err := h.service.ListUserSessions(c.Request.Context(), userID.(uuid.UUID))
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	currentID, _ := c.Get("session_id")
+	c.JSON(http.StatusOK, gin.H{"data": sessions, "current_session_id": currentID})
+}
+
+// LogoutOtherDevices godoc
+// @Summary Log out other devices
+// @Description Revoke every session of the current user except the one making the request
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} errors.AppError
+// @Router /api/v1/otentikasi/keluar-perangkat-lain [post]
+func (h *Handler) LogoutOtherDevices(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, errors.ErrUnauthorized)
+		return
+	}
+
+	sessionID, exists := c.Get("session_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, errors.ErrUnauthorized)
+		return
+	}
+
+	revoked, err := h.service.RevokeOtherSessions(c.Request.Context(), userID.(uuid.UUID), sessionID.(uuid.UUID), c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Signed out of other devices successfully",
+		"revoked": revoked,
+	})
+}
+
 // RefreshToken godoc
 // @Summary Refresh access token
 // @Description Get a new access token using refresh token
@@ -105,7 +295,7 @@ func (h *Handler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.service.RefreshToken(c.Request.Context(), req.RefreshToken)
+	resp, err := h.service.RefreshToken(c.Request.Context(), req.RefreshToken, c.ClientIP(), c.Request.UserAgent())
 	if err != nil {
 		if appErr, ok := err.(*errors.AppError); ok {
 			c.JSON(appErr.StatusCode, appErr)
@@ -146,3 +336,328 @@ func (h *Handler) VerifyToken(c *gin.Context) {
 
 	c.JSON(http.StatusOK, user)
 }
+
+// EnrollMFA godoc
+// @Summary Start MFA enrollment
+// @Description Generate a new TOTP secret and otpauth URI for the current user after confirming the current password or MFA code
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body ReauthenticateRequest true "Current password or MFA code"
+// @Success 200 {object} MFAEnrollmentResponse
+// @Failure 400 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 409 {object} errors.AppError
+// @Router /api/v1/otentikasi/mfa/daftar [post]
+func (h *Handler) EnrollMFA(c *gin.Context) {
+	var req ReauthenticateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails(err.Error()))
+		return
+	}
+
+	userIDValue, _ := c.Get("user_id")
+	userID, _ := userIDValue.(uuid.UUID)
+	sessionIDValue, _ := c.Get("session_id")
+	sessionID, _ := sessionIDValue.(uuid.UUID)
+
+	resp, err := h.service.EnrollMFA(c.Request.Context(), userID, sessionID, &req)
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ConfirmMFA godoc
+// @Summary Confirm MFA enrollment
+// @Description Verify the first TOTP code, enable MFA and return recovery codes
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body MFACodeRequest true "TOTP code"
+// @Success 200 {object} MFARecoveryCodesResponse
+// @Failure 401 {object} errors.AppError
+// @Router /api/v1/otentikasi/mfa/konfirmasi [post]
+func (h *Handler) ConfirmMFA(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails(err.Error()))
+		return
+	}
+
+	userIDValue, _ := c.Get("user_id")
+	userID, _ := userIDValue.(uuid.UUID)
+
+	resp, err := h.service.ConfirmMFA(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary Regenerate MFA recovery codes
+// @Description Invalidate existing recovery codes and issue new ones
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body MFACodeRequest true "TOTP code"
+// @Success 200 {object} MFARecoveryCodesResponse
+// @Failure 401 {object} errors.AppError
+// @Router /api/v1/otentikasi/mfa/kode-pemulihan [post]
+func (h *Handler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails(err.Error()))
+		return
+	}
+
+	userIDValue, _ := c.Get("user_id")
+	userID, _ := userIDValue.(uuid.UUID)
+
+	resp, err := h.service.RegenerateRecoveryCodes(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// DisableMFA godoc
+// @Summary Disable MFA
+// @Description Disable MFA for the current user after verifying a TOTP or recovery code
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body MFACodeRequest true "TOTP or recovery code"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} errors.AppError
+// @Router /api/v1/otentikasi/mfa/nonaktifkan [post]
+func (h *Handler) DisableMFA(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails(err.Error()))
+		return
+	}
+
+	userIDValue, _ := c.Get("user_id")
+	userID, _ := userIDValue.(uuid.UUID)
+
+	if err := h.service.DisableMFA(c.Request.Context(), userID, req.Code); err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "MFA disabled successfully"})
+}
+
+// ListUserSessions godoc
+// @Summary List user sessions
+// @Description List the active sessions of a user (admin only)
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} errors.AppError
+// @Router /api/v1/pengguna/{id}/sesi [get]
+func (h *Handler) ListUserSessions(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails("Invalid user ID"))
+		return
+	}
+
+	sessions, err := h.service.ListUserSessions(c.Request.Context(), userID)
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": sessions})
+}
+
+// RevokeSession godoc
+// @Summary Revoke a user session
+// @Description Revoke a single session of a user (admin only)
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param session_id path string true "Session ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/pengguna/{id}/sesi/{session_id} [delete]
+func (h *Handler) RevokeSession(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails("Invalid user ID"))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails("Invalid session ID"))
+		return
+	}
+
+	if err := h.service.RevokeSession(c.Request.Context(), userID, sessionID); err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
+
+// RevokeAllSessions godoc
+// @Summary Revoke all user sessions
+// @Description Revoke every active session of a user (admin only)
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} errors.AppError
+// @Router /api/v1/pengguna/{id}/sesi [delete]
+func (h *Handler) RevokeAllSessions(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails("Invalid user ID"))
+		return
+	}
+
+	revoked, err := h.service.RevokeAllSessions(c.Request.Context(), userID)
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Sessions revoked successfully",
+		"revoked": revoked,
+	})
+}
+
+// ChangePassword godoc
+// @Summary Change password
+// @Description Change the password of the signed-in user; other sessions are revoked
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} errors.AppError
+// @Failure 401 {object} errors.AppError
+// @Router /api/v1/otentikasi/ganti-kata-sandi [post]
+func (h *Handler) ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails(err.Error()))
+		return
+	}
+
+	userIDValue, _ := c.Get("user_id")
+	userID, _ := userIDValue.(uuid.UUID)
+	sessionIDValue, _ := c.Get("session_id")
+	sessionID, _ := sessionIDValue.(uuid.UUID)
+
+	if err := h.service.ChangePassword(c.Request.Context(), userID, sessionID, &req, c.ClientIP(), c.Request.UserAgent()); err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+}
+
+// IssueTemporaryPassword godoc
+// @Summary Issue temporary password
+// @Description Replace a user's password with a generated one that must be changed at next login (admin only)
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} TemporaryPasswordResponse
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/pengguna/{id}/kata-sandi-sementara [post]
+func (h *Handler) IssueTemporaryPassword(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails("Invalid user ID"))
+		return
+	}
+
+	adminIDValue, _ := c.Get("user_id")
+	adminID, _ := adminIDValue.(uuid.UUID)
+
+	resp, err := h.service.IssueTemporaryPassword(c.Request.Context(), adminID, userID, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, resp)
+}
+
+// JWKS godoc
+// @Summary JSON Web Key Set
+// @Description Public keys for verifying access tokens, selected by the kid header
+// @Tags auth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /.well-known/jwks.json [get]
+func (h *Handler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.service.JWKS())
+}
@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"fmt"
+
+	"github.com/hospital-emr/backend/internal/common/config"
+	"github.com/hospital-emr/backend/pkg/jwt"
+)
+
+// NewKeySet builds the JWT key set from configuration. HS256 uses JWT_SECRET
+// as a single symmetric key; RS256 and EdDSA load every key in JWT_KEYS_DIR so
+// that retiring keys keep validating tokens until they expire.
+func NewKeySet(cfg *config.Config) (*jwt.KeySet, error) {
+	switch cfg.JWT.SigningMethod {
+	case "", jwt.MethodHS256:
+		return jwt.NewKeySet(jwt.NewHMACKey(cfg.JWT.ActiveKeyID, []byte(cfg.JWT.Secret)))
+	case jwt.MethodRS256, jwt.MethodEdDSA:
+		keys, err := jwt.LoadKeySet(cfg.JWT.KeysDir, cfg.JWT.ActiveKeyID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load JWT keys: %w", err)
+		}
+		if alg := keys.ActiveAlgorithm(); alg != cfg.JWT.SigningMethod {
+			return nil, fmt.Errorf("active JWT key %q is %s, expected %s", cfg.JWT.ActiveKeyID, alg, cfg.JWT.SigningMethod)
+		}
+		return keys, nil
+	default:
+		return nil, fmt.Errorf("unsupported JWT signing method: %s", cfg.JWT.SigningMethod)
+	}
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/hospital-emr/backend/pkg/encryption"
+	"gorm.io/gorm"
+)
+
+// dummyPasswordHash is compared against when no usable account exists so that
+// failed logins take the same time whether or not the email is registered
+var dummyPasswordHash, _ = encryption.HashPassword("dummy-password-for-timing")
+
+// isLocked reports whether the account is locked, either permanently or until LockedUntil
+func (s *Service) isLocked(user *models.User, now time.Time) bool {
+	if user.Status == models.UserStatusLocked {
+		return true
+	}
+	return user.LockedUntil != nil && now.Before(*user.LockedUntil)
+}
+
+// registerFailedLogin increments the failure counter of an account and locks
+// it once a threshold is reached. Every threshold crossing extends a temporary
+// lock; the permanent threshold locks the account until an admin unlocks it.
+func (s *Service) registerFailedLogin(ctx context.Context, user *models.User, reason, ipAddress, userAgent string) {
+	s.recordLoginFailure(ctx, &user.ID, user.Email, reason, ipAddress, userAgent)
+
+	var attempts int
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).
+			Where("id = ?", user.ID).
+			Update("failed_login_attempts", gorm.Expr("failed_login_attempts + 1")).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).
+			Where("id = ?", user.ID).
+			Pluck("failed_login_attempts", &attempts).Error
+	})
+	if err != nil {
+		return
+	}
+
+	security := s.config.Security
+	switch {
+	case security.PermanentLockoutThreshold > 0 && attempts >= security.PermanentLockoutThreshold:
+		s.db.WithContext(ctx).
+			Model(&models.User{}).
+			Where("id = ?", user.ID).
+			Update("status", models.UserStatusLocked)
+		s.sessions.InvalidateUser(user.ID)
+		s.recordAccountLocked(ctx, user, attempts, nil, ipAddress, userAgent)
+
+	case security.LockoutThreshold > 0 && attempts >= security.LockoutThreshold:
+		lockedUntil := time.Now().Add(s.config.GetLockoutDuration())
+		s.db.WithContext(ctx).
+			Model(&models.User{}).
+			Where("id = ?", user.ID).
+			Update("locked_until", lockedUntil)
+		s.recordAccountLocked(ctx, user, attempts, &lockedUntil, ipAddress, userAgent)
+	}
+}
+
+// resetFailedLogins clears the failure counter after a successful login
+func (s *Service) resetFailedLogins(ctx context.Context, user *models.User) {
+	if user.FailedLoginAttempts == 0 && user.LockedUntil == nil {
+		return
+	}
+
+	s.db.WithContext(ctx).
+		Model(&models.User{}).
+		Where("id = ?", user.ID).
+		Updates(map[string]interface{}{
+			"failed_login_attempts": 0,
+			"locked_until":          nil,
+		})
+	user.FailedLoginAttempts = 0
+	user.LockedUntil = nil
+}
+
+// recordLoginFailure records a failed login attempt in the audit log
+func (s *Service) recordLoginFailure(ctx context.Context, userID *uuid.UUID, email, reason, ipAddress, userAgent string) {
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"email":  email,
+		"reason": reason,
+	})
+
+	s.audit.Record(ctx, &models.AuditLog{
+		UserID:      userID,
+		Action:      models.AuditActionLoginFailed,
+		Resource:    "user",
+		ResourceID:  userID,
+		Description: "Failed login attempt",
+		IPAddress:   ipAddress,
+		UserAgent:   userAgent,
+		Metadata:    string(metadata),
+		Severity:    models.AuditSeverityWarning,
+	})
+}
+
+// recordAccountLocked records an account lockout in the audit log. A nil
+// lockedUntil means the account was locked permanently.
+func (s *Service) recordAccountLocked(ctx context.Context, user *models.User, attempts int, lockedUntil *time.Time, ipAddress, userAgent string) {
+	severity := models.AuditSeverityWarning
+	description := "Account temporarily locked after repeated failed logins"
+	if lockedUntil == nil {
+		severity = models.AuditSeverityCritical
+		description = "Account locked after repeated failed logins; admin unlock required"
+	}
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"failed_login_attempts": attempts,
+		"locked_until":          lockedUntil,
+	})
+
+	s.audit.Record(ctx, &models.AuditLog{
+		UserID:      &user.ID,
+		Action:      models.AuditActionAccountLocked,
+		Resource:    "user",
+		ResourceID:  &user.ID,
+		Description: description,
+		IPAddress:   ipAddress,
+		UserAgent:   userAgent,
+		Metadata:    string(metadata),
+		Severity:    severity,
+	})
+}
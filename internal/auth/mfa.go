@@ -0,0 +1,291 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/hospital-emr/backend/pkg/encryption"
+	"github.com/hospital-emr/backend/pkg/totp"
+	"gorm.io/gorm"
+)
+
+const recoveryCodeCount = 10
+
+// MFAEnrollmentResponse represents the data needed to register an authenticator app
+type MFAEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// MFACodeRequest represents a request carrying a TOTP or recovery code
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// MFARecoveryCodesResponse represents freshly generated recovery codes.
+// The plaintext codes are only ever returned once.
+type MFARecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// EnrollMFA starts TOTP enrollment by generating a new secret for the user,
+// who must reauthenticate first. MFA is not enabled until the first code is
+// confirmed with ConfirmMFA.
+func (s *Service) EnrollMFA(ctx context.Context, userID, sessionID uuid.UUID, req *ReauthenticateRequest) (*MFAEnrollmentResponse, error) {
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.MFAEnabled {
+		return nil, errors.ErrMFAAlreadyEnabled()
+	}
+	if err := s.reauthenticate(ctx, user, sessionID, req); err != nil {
+		return nil, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate MFA secret: %w", err)
+	}
+
+	encryptedSecret, err := encryption.Encrypt(secret, s.config.Security.EncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt MFA secret: %w", err)
+	}
+
+	if err := s.db.WithContext(ctx).
+		Model(&models.User{}).
+		Where("id = ?", user.ID).
+		Updates(map[string]interface{}{
+			"mfa_secret":         encryptedSecret,
+			"mfa_last_used_step": 0,
+		}).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+
+	return &MFAEnrollmentResponse{
+		Secret:     secret,
+		OTPAuthURI: totp.KeyURI(s.config.Security.MFAIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmMFA verifies the first code from the authenticator app, enables MFA
+// and issues a new set of recovery codes
+func (s *Service) ConfirmMFA(ctx context.Context, userID uuid.UUID, code string) (*MFARecoveryCodesResponse, error) {
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.MFAEnabled {
+		return nil, errors.ErrMFAAlreadyEnabled()
+	}
+	if user.MFASecret == "" {
+		return nil, errors.ErrMFANotEnrolled()
+	}
+
+	if !s.verifyTOTP(ctx, user, code) {
+		return nil, errors.ErrMFAInvalid
+	}
+
+	var codes []string
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).
+			Where("id = ?", user.ID).
+			Update("mfa_enabled", true).Error; err != nil {
+			return err
+		}
+
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+
+	return &MFARecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// RegenerateRecoveryCodes invalidates existing recovery codes and issues new ones
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) (*MFARecoveryCodesResponse, error) {
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.MFAEnabled {
+		return nil, errors.ErrMFANotEnrolled()
+	}
+
+	if !s.verifyTOTP(ctx, user, code) {
+		return nil, errors.ErrMFAInvalid
+	}
+
+	var codes []string
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+
+	return &MFARecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableMFA turns off MFA after verifying a current TOTP or recovery code
+func (s *Service) DisableMFA(ctx context.Context, userID uuid.UUID, code string) error {
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !user.MFAEnabled {
+		return errors.ErrMFANotEnrolled()
+	}
+
+	if err := s.verifyMFACode(ctx, user, code); err != nil {
+		return err
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).
+			Where("id = ?", user.ID).
+			Updates(map[string]interface{}{
+				"mfa_enabled":        false,
+				"mfa_secret":         "",
+				"mfa_last_used_step": 0,
+			}).Error; err != nil {
+			return errors.ErrDatabaseError
+		}
+
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return errors.ErrDatabaseError
+		}
+
+		return nil
+	})
+}
+
+// verifyMFACode accepts either a TOTP code or an unused recovery code
+func (s *Service) verifyMFACode(ctx context.Context, user *models.User, code string) error {
+	if s.verifyTOTP(ctx, user, code) {
+		return nil
+	}
+
+	if s.consumeRecoveryCode(ctx, user.ID, code) {
+		return nil
+	}
+
+	return errors.ErrMFAInvalid
+}
+
+// verifyTOTP validates a TOTP code and records its time step so the same
+// code cannot be replayed within its validity window
+func (s *Service) verifyTOTP(ctx context.Context, user *models.User, code string) bool {
+	if user.MFASecret == "" {
+		return false
+	}
+
+	secret, err := encryption.Decrypt(user.MFASecret, s.config.Security.EncryptionKey)
+	if err != nil {
+		return false
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return false
+	}
+
+	// Only succeeds if no code from this or a later step has been used yet
+	result := s.db.WithContext(ctx).
+		Model(&models.User{}).
+		Where("id = ? AND mfa_last_used_step < ?", user.ID, step).
+		Update("mfa_last_used_step", step)
+	if result.Error != nil || result.RowsAffected != 1 {
+		return false
+	}
+
+	user.MFALastUsedStep = step
+	return true
+}
+
+// consumeRecoveryCode marks a matching recovery code as used
+func (s *Service) consumeRecoveryCode(ctx context.Context, userID uuid.UUID, code string) bool {
+	normalized := normalizeRecoveryCode(code)
+	if normalized == "" {
+		return false
+	}
+
+	result := s.db.WithContext(ctx).
+		Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, encryption.HashToken(normalized)).
+		Update("used_at", time.Now())
+
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// replaceRecoveryCodes deletes all recovery codes of a user and stores new hashed ones
+func replaceRecoveryCodes(tx *gorm.DB, userID uuid.UUID) ([]string, error) {
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	records := make([]models.MFARecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		records[i] = models.MFARecoveryCode{
+			UserID:   userID,
+			CodeHash: encryption.HashToken(normalizeRecoveryCode(code)),
+		}
+	}
+
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// generateRecoveryCode generates a code formatted as xxxxx-xxxxx
+func generateRecoveryCode() (string, error) {
+	raw := make([]byte, 10)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	encoded := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw))
+	return encoded[:5] + "-" + encoded[5:10], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// findUser loads an active user by ID
+func (s *Service) findUser(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).
+		Where("id = ? AND status = ?", userID, models.UserStatusActive).
+		First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrUserNotFound(userID.String())
+		}
+		return nil, errors.ErrDatabaseError
+	}
+	return &user, nil
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"sync"
+
+	"github.com/hospital-emr/backend/internal/common/config"
+	"github.com/hospital-emr/backend/internal/common/logger"
+	"github.com/hospital-emr/backend/pkg/oidc"
+)
+
+// OIDCProvider signs users in through an OpenID Connect provider using the
+// authorization code flow with PKCE. Provider metadata is discovered on first
+// use so the API starts even while the provider is unreachable.
+type OIDCProvider struct {
+	name        string
+	config      oidc.Config
+	groupsClaim string
+	mfaACR      []string
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+// NewOIDCProvider creates an OIDC provider from the SSO configuration
+func NewOIDCProvider(cfg *config.Config) *OIDCProvider {
+	return &OIDCProvider{
+		name: "oidc",
+		config: oidc.Config{
+			IssuerURL:    cfg.SSO.OIDCIssuerURL,
+			ClientID:     cfg.SSO.OIDCClientID,
+			ClientSecret: cfg.SSO.OIDCClientSecret,
+			RedirectURL:  cfg.SSO.OIDCRedirectURL,
+			Scopes:       cfg.SSO.OIDCScopes,
+		},
+		groupsClaim: cfg.SSO.OIDCGroupsClaim,
+		mfaACR:      cfg.SSO.OIDCMFAACRValues,
+	}
+}
+
+// Name returns the provider name used in routes and identity links
+func (p *OIDCProvider) Name() string {
+	return p.name
+}
+
+// AuthURL returns the provider's authorization URL for a new login
+func (p *OIDCProvider) AuthURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return provider.AuthCodeURL(state, nonce, codeVerifier), nil
+}
+
+// Callback redeems the authorization code and verifies the ID token
+func (p *OIDCProvider) Callback(ctx context.Context, code, codeVerifier, nonce string) (*ExternalIdentity, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := provider.Exchange(ctx, code, codeVerifier)
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := provider.VerifyIDToken(ctx, token.IDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	verified, _ := idToken.Claims["email_verified"].(bool)
+	return &ExternalIdentity{
+		Provider:      p.name,
+		Subject:       idToken.Subject,
+		Email:         idToken.String("email"),
+		EmailVerified: verified,
+		FirstName:     idToken.String("given_name"),
+		LastName:      idToken.String("family_name"),
+		Groups:        idToken.Strings(p.groupsClaim),
+		MFA:           p.reportsMFA(idToken),
+	}, nil
+}
+
+// reportsMFA reports whether the ID token shows the provider asked for a
+// second factor: an "mfa" authentication method or a configured acr value
+func (p *OIDCProvider) reportsMFA(idToken *oidc.IDToken) bool {
+	for _, method := range idToken.Strings("amr") {
+		if method == "mfa" {
+			return true
+		}
+	}
+	acr := idToken.String("acr")
+	for _, value := range p.mfaACR {
+		if acr != "" && acr == value {
+			return true
+		}
+	}
+	return false
+}
+
+// discover returns the discovered provider, retrying discovery until it succeeds
+func (p *OIDCProvider) discover(ctx context.Context) (*oidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.provider != nil {
+		return p.provider, nil
+	}
+
+	provider, err := oidc.Discover(ctx, p.config)
+	if err != nil {
+		logger.Errorf("OIDC discovery failed: %v", err)
+		return nil, err
+	}
+	p.provider = provider
+	return provider, nil
+}
@@ -0,0 +1,329 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/hospital-emr/backend/internal/common/config"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/hospital-emr/backend/pkg/encryption"
+	"gorm.io/gorm"
+)
+
+// defaultBlockedPasswords are rejected even when no block-list file is configured
+var defaultBlockedPasswords = []string{
+	"password", "password1", "password123", "passw0rd", "p@ssw0rd", "p@ssword123",
+	"123456", "12345678", "123456789", "1234567890", "qwerty", "qwerty123",
+	"abc123", "letmein", "welcome", "welcome1", "welcome123", "admin", "admin123",
+	"administrator", "iloveyou", "changeme", "secret", "hospital", "hospital123",
+	"rumahsakit", "rumahsakit123", "doctor", "doctor123", "nurse123", "bismillah",
+}
+
+// PasswordPolicy validates new passwords against the configured strength rules
+type PasswordPolicy struct {
+	MinLength    int
+	MinClasses   int
+	HistoryCount int
+	ExpiryDays   int
+	blocklist    map[string]struct{}
+}
+
+// NewPasswordPolicy creates a password policy from configuration, loading the
+// optional block-list file (one password per line, # for comments)
+func NewPasswordPolicy(cfg *config.Config) (*PasswordPolicy, error) {
+	policy := &PasswordPolicy{
+		MinLength:    cfg.Security.PasswordMinLength,
+		MinClasses:   cfg.Security.PasswordMinClasses,
+		HistoryCount: cfg.Security.PasswordHistoryCount,
+		ExpiryDays:   cfg.Security.PasswordExpiryDays,
+		blocklist:    make(map[string]struct{}),
+	}
+
+	for _, password := range defaultBlockedPasswords {
+		policy.blocklist[password] = struct{}{}
+	}
+
+	if path := cfg.Security.PasswordBlocklistFile; path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open password block-list: %w", err)
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			policy.blocklist[strings.ToLower(line)] = struct{}{}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read password block-list: %w", err)
+		}
+	}
+
+	return policy, nil
+}
+
+// Validate checks a candidate password for the given user and returns a
+// PASSWORD_POLICY_VIOLATION error listing every rule it breaks
+func (p *PasswordPolicy) Validate(password string, user *models.User) error {
+	var violations []string
+
+	if len([]rune(password)) < p.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+
+	if classes := characterClasses(password); classes < p.MinClasses {
+		violations = append(violations, fmt.Sprintf("must contain at least %d of: lowercase letters, uppercase letters, digits, symbols", p.MinClasses))
+	}
+
+	lower := strings.ToLower(password)
+	if _, blocked := p.blocklist[lower]; blocked {
+		violations = append(violations, "is too common")
+	}
+
+	if user != nil {
+		for _, personal := range personalTokens(user) {
+			if strings.Contains(lower, personal) {
+				violations = append(violations, "must not contain your name or email")
+				break
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		return errors.ErrPasswordPolicy(violations)
+	}
+	return nil
+}
+
+// ExpiresAt returns when a password set at the given time expires, or nil if
+// passwords do not expire
+func (p *PasswordPolicy) ExpiresAt(changedAt time.Time) *time.Time {
+	if p.ExpiryDays <= 0 {
+		return nil
+	}
+	expiry := changedAt.AddDate(0, 0, p.ExpiryDays)
+	return &expiry
+}
+
+// IsExpired reports whether the user must change their password before a
+// session can be issued
+func (p *PasswordPolicy) IsExpired(user *models.User, now time.Time) bool {
+	if user.MustChangePassword {
+		return true
+	}
+	return user.PasswordExpiry != nil && now.After(*user.PasswordExpiry)
+}
+
+// SetPassword validates a new password against the policy and the user's
+// password history, then stores its hash. mustChange marks the password as
+// temporary so the user has to replace it at next login. Callers should run
+// this inside their transaction so the history stays consistent.
+func (p *PasswordPolicy) SetPassword(ctx context.Context, tx *gorm.DB, user *models.User, password string, mustChange bool) error {
+	if err := p.Validate(password, user); err != nil {
+		return err
+	}
+
+	if err := p.checkHistory(ctx, tx, user, password); err != nil {
+		return err
+	}
+
+	hash, err := encryption.HashPassword(password)
+	if err != nil {
+		return errors.ErrInternal
+	}
+
+	now := time.Now()
+	expiry := p.ExpiresAt(now)
+	if mustChange {
+		expiry = nil
+	}
+
+	if err := tx.WithContext(ctx).
+		Model(&models.User{}).
+		Where("id = ?", user.ID).
+		Updates(map[string]interface{}{
+			"password_hash":         hash,
+			"password_changed_at":   now,
+			"password_expiry":       expiry,
+			"must_change_password":  mustChange,
+			"failed_login_attempts": 0,
+			"locked_until":          nil,
+		}).Error; err != nil {
+		return errors.ErrDatabaseError
+	}
+
+	if err := tx.WithContext(ctx).Create(&models.PasswordHistory{
+		UserID:       user.ID,
+		PasswordHash: hash,
+	}).Error; err != nil {
+		return errors.ErrDatabaseError
+	}
+
+	if err := p.pruneHistory(ctx, tx, user); err != nil {
+		return err
+	}
+
+	user.PasswordHash = hash
+	user.PasswordChangedAt = &now
+	user.PasswordExpiry = expiry
+	user.MustChangePassword = mustChange
+	user.FailedLoginAttempts = 0
+	user.LockedUntil = nil
+
+	return nil
+}
+
+// checkHistory rejects the current password and the last HistoryCount passwords
+func (p *PasswordPolicy) checkHistory(ctx context.Context, tx *gorm.DB, user *models.User, password string) error {
+	if user.PasswordHash != "" && encryption.CheckPasswordHash(password, user.PasswordHash) {
+		return errors.ErrPasswordReused()
+	}
+	if p.HistoryCount <= 0 {
+		return nil
+	}
+
+	var hashes []string
+	if err := tx.WithContext(ctx).
+		Model(&models.PasswordHistory{}).
+		Where("user_id = ?", user.ID).
+		Order("created_at DESC").
+		Limit(p.HistoryCount).
+		Pluck("password_hash", &hashes).Error; err != nil {
+		return errors.ErrDatabaseError
+	}
+
+	for _, hash := range hashes {
+		if encryption.CheckPasswordHash(password, hash) {
+			return errors.ErrPasswordReused()
+		}
+	}
+	return nil
+}
+
+// pruneHistory removes history entries beyond the retained count
+func (p *PasswordPolicy) pruneHistory(ctx context.Context, tx *gorm.DB, user *models.User) error {
+	keep := p.HistoryCount
+	if keep < 1 {
+		keep = 1
+	}
+
+	var stale []string
+	if err := tx.WithContext(ctx).
+		Model(&models.PasswordHistory{}).
+		Where("user_id = ?", user.ID).
+		Order("created_at DESC").
+		Offset(keep).
+		Pluck("id", &stale).Error; err != nil {
+		return errors.ErrDatabaseError
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+
+	if err := tx.WithContext(ctx).
+		Unscoped().
+		Where("id IN ?", stale).
+		Delete(&models.PasswordHistory{}).Error; err != nil {
+		return errors.ErrDatabaseError
+	}
+	return nil
+}
+
+// temporaryPasswordAlphabets are the character classes used for generated
+// passwords; look-alike characters are left out so they can be read out
+var temporaryPasswordAlphabets = []string{
+	"abcdefghijkmnpqrstuvwxyz",
+	"ABCDEFGHJKLMNPQRSTUVWXYZ",
+	"23456789",
+	"!@#$%*-_+=?",
+}
+
+// GenerateTemporaryPassword generates a random password that satisfies the
+// policy, using every character class at least once
+func (p *PasswordPolicy) GenerateTemporaryPassword() (string, error) {
+	length := p.MinLength
+	if length < 16 {
+		length = 16
+	}
+
+	all := strings.Join(temporaryPasswordAlphabets, "")
+	password := make([]byte, length)
+	for i := range password {
+		alphabet := all
+		if i < len(temporaryPasswordAlphabets) {
+			alphabet = temporaryPasswordAlphabets[i]
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return "", err
+		}
+		password[i] = alphabet[n.Int64()]
+	}
+
+	// Shuffle so the guaranteed classes are not always at the front
+	for i := len(password) - 1; i > 0; i-- {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		j := n.Int64()
+		password[i], password[j] = password[j], password[i]
+	}
+
+	return string(password), nil
+}
+
+// characterClasses counts the distinct character classes used in a password
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	count := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			count++
+		}
+	}
+	return count
+}
+
+// personalTokens returns lower-cased parts of the user's identity that a
+// password must not contain. Very short parts are ignored to avoid false hits.
+func personalTokens(user *models.User) []string {
+	var tokens []string
+	candidates := []string{user.FirstName, user.LastName}
+	if at := strings.Index(user.Email, "@"); at > 0 {
+		candidates = append(candidates, user.Email[:at])
+	}
+
+	for _, candidate := range candidates {
+		candidate = strings.ToLower(strings.TrimSpace(candidate))
+		if len(candidate) >= 4 {
+			tokens = append(tokens, candidate)
+		}
+	}
+	return tokens
+}
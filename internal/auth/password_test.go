@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/hospital-emr/backend/internal/common/config"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Security.PasswordMinLength = 12
+	cfg.Security.PasswordMinClasses = 3
+
+	policy, err := NewPasswordPolicy(cfg)
+	require.NoError(t, err)
+
+	user := &models.User{Email: "budi.santoso@hospital-emr.com", FirstName: "Budi", LastName: "Santoso"}
+
+	tests := []struct {
+		name     string
+		password string
+		valid    bool
+	}{
+		{"Strong password", "Kopi-Tubruk-42", true},
+		{"Too short", "Ab1!", false},
+		{"Too few classes", "onlylowercaseletters", false},
+		{"Block-listed", "Rumahsakit123", false},
+		{"Contains name", "Santoso-2024!", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Validate(tt.password, user)
+			if tt.valid {
+				assert.NoError(t, err)
+				return
+			}
+
+			appErr, ok := err.(*errors.AppError)
+			require.True(t, ok)
+			assert.Equal(t, "PASSWORD_POLICY_VIOLATION", appErr.Code)
+		})
+	}
+}
+
+func TestGenerateTemporaryPasswordSatisfiesPolicy(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Security.PasswordMinLength = 12
+	cfg.Security.PasswordMinClasses = 4
+
+	policy, err := NewPasswordPolicy(cfg)
+	require.NoError(t, err)
+
+	for i := 0; i < 20; i++ {
+		password, err := policy.GenerateTemporaryPassword()
+		require.NoError(t, err)
+		assert.Len(t, password, 16)
+		assert.NoError(t, policy.Validate(password, nil))
+	}
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// PermissionCache resolves a user's effective permissions from their active
+// roles and caches them in-process. Role changes made through this instance
+// must call InvalidateUser or InvalidateAll; changes made elsewhere are picked
+// up once the cached entry expires.
+type PermissionCache struct {
+	db      *gorm.DB
+	ttl     time.Duration
+	mu      sync.RWMutex
+	entries map[uuid.UUID]permissionCacheEntry
+}
+
+type permissionCacheEntry struct {
+	permissions map[string]struct{}
+	expiresAt   time.Time
+}
+
+// NewPermissionCache creates a new permission cache
+func NewPermissionCache(db *gorm.DB, ttl time.Duration) *PermissionCache {
+	return &PermissionCache{
+		db:      db,
+		ttl:     ttl,
+		entries: make(map[uuid.UUID]permissionCacheEntry),
+	}
+}
+
+// EffectivePermissions returns the set of permission codes granted to the
+// user through any of their active roles
+func (c *PermissionCache) EffectivePermissions(ctx context.Context, userID uuid.UUID) (map[string]struct{}, error) {
+	now := time.Now()
+
+	c.mu.RLock()
+	entry, ok := c.entries[userID]
+	c.mu.RUnlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.permissions, nil
+	}
+
+	var codes []string
+	if err := c.db.WithContext(ctx).
+		Model(&models.Permission{}).
+		Distinct("permissions.code").
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Joins("JOIN roles ON roles.id = role_permissions.role_id AND roles.is_active = ? AND roles.deleted_at IS NULL", true).
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).
+		Pluck("permissions.code", &codes).Error; err != nil {
+		return nil, err
+	}
+
+	permissions := make(map[string]struct{}, len(codes))
+	for _, code := range codes {
+		permissions[code] = struct{}{}
+	}
+
+	c.mu.Lock()
+	if len(c.entries) >= maxSessionCacheEntries {
+		for id, e := range c.entries {
+			if now.After(e.expiresAt) {
+				delete(c.entries, id)
+			}
+		}
+	}
+	c.entries[userID] = permissionCacheEntry{
+		permissions: permissions,
+		expiresAt:   now.Add(c.ttl),
+	}
+	c.mu.Unlock()
+
+	return permissions, nil
+}
+
+// InvalidateUser drops the cached permissions of the given users, e.g. after
+// their role assignments change
+func (c *PermissionCache) InvalidateUser(userIDs ...uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range userIDs {
+		delete(c.entries, id)
+	}
+}
+
+// InvalidateAll drops every cached entry, e.g. after a role's permissions change
+func (c *PermissionCache) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[uuid.UUID]permissionCacheEntry)
+}
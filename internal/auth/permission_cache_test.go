@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// cachedPermissions returns a cache whose database cannot be reached, so only
+// entries still cached resolve; anything reloaded fails
+func cachedPermissions(t *testing.T, ttl time.Duration, users ...uuid.UUID) *PermissionCache {
+	db, err := gorm.Open(postgres.Open("host=127.0.0.1 port=1 user=emr dbname=emr sslmode=disable connect_timeout=1"), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               gormlogger.Discard,
+	})
+	require.NoError(t, err)
+
+	cache := NewPermissionCache(db, ttl)
+	for _, id := range users {
+		cache.entries[id] = permissionCacheEntry{
+			permissions: map[string]struct{}{models.PermissionViewPatients: {}},
+			expiresAt:   time.Now().Add(ttl),
+		}
+	}
+	return cache
+}
+
+func TestPermissionCacheInvalidation(t *testing.T) {
+	doctorID, nurseID := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name       string
+		invalidate func(c *PermissionCache)
+		reloaded   []uuid.UUID
+		cached     []uuid.UUID
+	}{
+		{"nothing invalidated", func(c *PermissionCache) {}, nil, []uuid.UUID{doctorID, nurseID}},
+		{"role assignment changed", func(c *PermissionCache) { c.InvalidateUser(doctorID) }, []uuid.UUID{doctorID}, []uuid.UUID{nurseID}},
+		{"role permissions changed", func(c *PermissionCache) { c.InvalidateAll() }, []uuid.UUID{doctorID, nurseID}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := cachedPermissions(t, time.Hour, doctorID, nurseID)
+			tt.invalidate(cache)
+
+			for _, id := range tt.cached {
+				permissions, err := cache.EffectivePermissions(context.Background(), id)
+				require.NoError(t, err)
+				assert.Contains(t, permissions, models.PermissionViewPatients)
+			}
+			for _, id := range tt.reloaded {
+				_, err := cache.EffectivePermissions(context.Background(), id)
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestPermissionCacheExpiry(t *testing.T) {
+	userID := uuid.New()
+	cache := cachedPermissions(t, time.Hour, userID)
+	cache.entries[userID] = permissionCacheEntry{expiresAt: time.Now().Add(-time.Second)}
+
+	_, err := cache.EffectivePermissions(context.Background(), userID)
+	assert.Error(t, err)
+}
@@ -2,13 +2,16 @@ package auth
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/audit"
 	"github.com/hospital-emr/backend/internal/common/config"
 	"github.com/hospital-emr/backend/internal/common/errors"
 	"github.com/hospital-emr/backend/internal/models"
+	"github.com/hospital-emr/backend/pkg/email"
 	"github.com/hospital-emr/backend/pkg/encryption"
 	"github.com/hospital-emr/backend/pkg/jwt"
 	"gorm.io/gorm"
@@ -16,15 +19,25 @@ import (
 
 // Service provides authentication services
 type Service struct {
-	db     *gorm.DB
-	config *config.Config
+	db        *gorm.DB
+	config    *config.Config
+	keys      *jwt.KeySet
+	sessions  *SessionCache
+	passwords *PasswordPolicy
+	mailer    email.Sender
+	audit     *audit.Recorder
 }
 
 // NewService creates a new auth service
-func NewService(db *gorm.DB, cfg *config.Config) *Service {
+func NewService(db *gorm.DB, cfg *config.Config, keys *jwt.KeySet, sessions *SessionCache, passwords *PasswordPolicy, mailer email.Sender, auditRecorder *audit.Recorder) *Service {
 	return &Service{
-		db:     db,
-		config: cfg,
+		db:        db,
+		config:    cfg,
+		keys:      keys,
+		sessions:  sessions,
+		passwords: passwords,
+		mailer:    mailer,
+		audit:     auditRecorder,
 	}
 }
 
@@ -37,96 +50,324 @@ type LoginRequest struct {
 
 // LoginResponse represents login response
 type LoginResponse struct {
-	AccessToken  string      `json:"access_token"`
-	RefreshToken string      `json:"refresh_token"`
-	ExpiresIn    int         `json:"expires_in"`
-	User         *models.User `json:"user"`
-	MFARequired  bool        `json:"mfa_required,omitempty"`
+	AccessToken            string       `json:"access_token"`
+	RefreshToken           string       `json:"refresh_token"`
+	ExpiresIn              int          `json:"expires_in"`
+	User                   *models.User `json:"user"`
+	MFARequired            bool         `json:"mfa_required,omitempty"`
+	MFAMethods             []string     `json:"mfa_methods,omitempty"` // totp, webauthn
+	MFAToken               string       `json:"mfa_token,omitempty"`   // Continues the login with a passkey or MFA code
+	PasswordChangeRequired bool         `json:"password_change_required,omitempty"`
+	PasswordChangeToken    string       `json:"password_change_token,omitempty"`
 }
 
-// Login authenticates a user
+// Second factor methods
+const (
+	MFAMethodTOTP     = "totp"
+	MFAMethodWebAuthn = "webauthn"
+)
+
+// passwordChangeTokenTTL bounds how long a user has to replace an expired password after logging in
+const passwordChangeTokenTTL = 10 * time.Minute
+
+// mfaTokenTTL bounds how long a user has to present a second factor after the first
+const mfaTokenTTL = 5 * time.Minute
+
+// Login authenticates a user. Unknown, inactive and locked accounts all fail
+// with the same invalid credentials error so the response does not reveal
+// whether an account exists. Only once the password (and MFA code) is proven
+// does the response disclose that the password has expired.
 func (s *Service) Login(ctx context.Context, req *LoginRequest, ipAddress, userAgent string) (*LoginResponse, error) {
 	// Find user by email
 	var user models.User
 	if err := s.db.WithContext(ctx).
 		Preload("Roles.Permissions").
-		Where("email = ? AND status = ?", req.Email, models.UserStatusActive).
+		Where("email = ?", req.Email).
 		First(&user).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
+			// Spend the same time as a real password check
+			encryption.CheckPasswordHash(req.Password, dummyPasswordHash)
+			s.recordLoginFailure(ctx, nil, req.Email, "unknown account", ipAddress, userAgent)
 			return nil, errors.ErrInvalidCredentials
 		}
 		return nil, errors.ErrDatabaseError
 	}
 
+	now := time.Now()
+	if s.isLocked(&user, now) {
+		encryption.CheckPasswordHash(req.Password, dummyPasswordHash)
+		s.recordLoginFailure(ctx, &user.ID, req.Email, "account locked", ipAddress, userAgent)
+		return nil, errors.ErrInvalidCredentials
+	}
+
+	if user.Status != models.UserStatusActive {
+		encryption.CheckPasswordHash(req.Password, dummyPasswordHash)
+		s.recordLoginFailure(ctx, &user.ID, req.Email, "account "+string(user.Status), ipAddress, userAgent)
+		return nil, errors.ErrInvalidCredentials
+	}
+
 	// Verify password
 	if !encryption.CheckPasswordHash(req.Password, user.PasswordHash) {
+		s.registerFailedLogin(ctx, &user, "invalid password", ipAddress, userAgent)
 		return nil, errors.ErrInvalidCredentials
 	}
 
-	// Check if MFA is enabled
-	if user.MFAEnabled {
+	// Check if a second factor is required
+	methods, err := s.mfaMethods(ctx, &user)
+	if err != nil {
+		return nil, err
+	}
+	if len(methods) > 0 {
 		if req.MFACode == "" {
-			return &LoginResponse{
-				MFARequired: true,
-			}, nil
+			return s.mfaChallenge(&user, methods)
+		}
+
+		if err := s.verifyMFACode(ctx, &user, req.MFACode); err != nil {
+			s.registerFailedLogin(ctx, &user, "invalid MFA code", ipAddress, userAgent)
+			return nil, err
+		}
+	}
+
+	return s.finishLogin(ctx, &user, ipAddress, userAgent)
+}
+
+// mfaMethods lists the second factors a user has enrolled
+func (s *Service) mfaMethods(ctx context.Context, user *models.User) ([]string, error) {
+	var methods []string
+	if user.MFAEnabled {
+		methods = append(methods, MFAMethodTOTP)
+	}
+
+	if s.config.WebAuthn.Enabled {
+		var count int64
+		if err := s.db.WithContext(ctx).
+			Model(&models.WebAuthnCredential{}).
+			Where("user_id = ?", user.ID).
+			Count(&count).Error; err != nil {
+			return nil, errors.ErrDatabaseError
+		}
+		if count > 0 {
+			methods = append(methods, MFAMethodWebAuthn)
+		}
+	}
+
+	return methods, nil
+}
+
+// mfaChallenge asks for a second factor. The response carries a short-lived
+// token that lets the user continue the login with a passkey or MFA code
+// without presenting the first factor again.
+func (s *Service) mfaChallenge(user *models.User, methods []string) (*LoginResponse, error) {
+	token, err := s.keys.GenerateToken(user.ID, user.Email, nil, uuid.New(), jwt.TokenTypeMFA, mfaTokenTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate MFA token: %w", err)
+	}
+
+	return &LoginResponse{
+		MFARequired: true,
+		MFAMethods:  methods,
+		MFAToken:    token,
+	}, nil
+}
+
+// MFALoginRequest continues a login waiting for an MFA code
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"` // TOTP or recovery code
+}
+
+// VerifyMFALogin finishes a login that was answered with an MFA challenge,
+// such as an SSO login that cannot be resubmitted with the code
+func (s *Service) VerifyMFALogin(ctx context.Context, req *MFALoginRequest, ipAddress, userAgent string) (*LoginResponse, error) {
+	claims, err := s.keys.ValidateToken(req.MFAToken, jwt.TokenTypeMFA)
+	if err != nil {
+		return nil, errors.ErrTokenInvalid
+	}
+
+	var user models.User
+	if err := s.db.WithContext(ctx).
+		Preload("Roles.Permissions").
+		Where("id = ?", claims.UserID).
+		First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrTokenInvalid
 		}
+		return nil, errors.ErrDatabaseError
+	}
+
+	if s.isLocked(&user, time.Now()) || user.Status != models.UserStatusActive {
+		s.recordLoginFailure(ctx, &user.ID, user.Email, "account unavailable for MFA login", ipAddress, userAgent)
+		return nil, errors.ErrInvalidCredentials
+	}
+
+	if err := s.verifyMFACode(ctx, &user, req.Code); err != nil {
+		s.registerFailedLogin(ctx, &user, "invalid MFA code", ipAddress, userAgent)
+		return nil, err
+	}
+
+	return s.finishLogin(ctx, &user, ipAddress, userAgent)
+}
+
+// finishLogin signs in a user whose credentials are fully proven, unless the
+// password has expired and must be replaced first
+func (s *Service) finishLogin(ctx context.Context, user *models.User, ipAddress, userAgent string) (*LoginResponse, error) {
+	// Credentials are proven; clear the failure counter
+	s.resetFailedLogins(ctx, user)
+
+	// Expired or temporary passwords must be replaced before a session is issued
+	if s.passwords.IsExpired(user, time.Now()) {
+		token, err := s.keys.GenerateToken(user.ID, user.Email, nil, uuid.New(), jwt.TokenTypePasswordChange, passwordChangeTokenTTL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate password change token: %w", err)
+		}
+
+		return &LoginResponse{
+			PasswordChangeRequired: true,
+			PasswordChangeToken:    token,
+		}, nil
+	}
 
-		// TODO: Verify MFA code
-		// if !verifyMFACode(user.MFASecret, req.MFACode) {
-		// 	return nil, errors.ErrMFAInvalid
-		// }
+	resp, err := s.startSession(ctx, user, ipAddress, userAgent)
+	if err != nil {
+		return nil, err
 	}
 
+	s.recordLogin(ctx, user, ipAddress, userAgent)
+
+	return resp, nil
+}
+
+// ChangeExpiredPasswordRequest represents a request to replace an expired or temporary password
+type ChangeExpiredPasswordRequest struct {
+	PasswordChangeToken string `json:"password_change_token" binding:"required"`
+	NewPassword         string `json:"new_password" binding:"required"`
+}
+
+// ChangeExpiredPassword replaces an expired or temporary password using the
+// short-lived token returned by Login and signs the user in
+func (s *Service) ChangeExpiredPassword(ctx context.Context, req *ChangeExpiredPasswordRequest, ipAddress, userAgent string) (*LoginResponse, error) {
+	claims, err := s.keys.ValidateToken(req.PasswordChangeToken, jwt.TokenTypePasswordChange)
+	if err != nil {
+		return nil, errors.ErrTokenInvalid
+	}
+
+	var user models.User
+	if err := s.db.WithContext(ctx).
+		Preload("Roles.Permissions").
+		Where("id = ? AND status = ?", claims.UserID, models.UserStatusActive).
+		First(&user).Error; err != nil {
+		return nil, errors.ErrTokenInvalid
+	}
+
+	// The token is single-use: once the password changes it is no longer accepted
+	if user.PasswordChangedAt != nil && claims.IssuedAt != nil && claims.IssuedAt.Time.Before(user.PasswordChangedAt.Truncate(time.Second)) {
+		return nil, errors.ErrTokenInvalid
+	}
+
+	var resp *LoginResponse
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := s.passwords.SetPassword(ctx, tx, &user, req.NewPassword, false); err != nil {
+			return err
+		}
+
+		familyID := uuid.New()
+		if err := s.enforceSessionLimit(ctx, tx, &user, familyID, ipAddress, userAgent); err != nil {
+			return err
+		}
+
+		var err error
+		resp, err = s.issueSession(ctx, tx, &user, familyID, time.Now().Add(s.config.GetJWTRefreshExpiration()), ipAddress, userAgent)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(ctx, &models.AuditLog{
+		UserID:      &user.ID,
+		Action:      models.AuditActionPasswordChange,
+		Resource:    "user",
+		ResourceID:  &user.ID,
+		Description: "Expired password changed at login",
+		IPAddress:   ipAddress,
+		UserAgent:   userAgent,
+	})
+	s.recordLogin(ctx, &user, ipAddress, userAgent)
+
+	return resp, nil
+}
+
+// recordLogin updates the last login details of a user
+func (s *Service) recordLogin(ctx context.Context, user *models.User, ipAddress, userAgent string) {
+	now := time.Now()
+	user.LastLoginAt = &now
+	user.LastLoginIP = ipAddress
+	s.db.WithContext(ctx).
+		Model(&models.User{}).
+		Where("id = ?", user.ID).
+		Updates(map[string]interface{}{
+			"last_login_at": now,
+			"last_login_ip": ipAddress,
+		})
+
+	s.audit.Record(ctx, &models.AuditLog{
+		UserID:     &user.ID,
+		Action:     models.AuditActionLogin,
+		Resource:   "user",
+		ResourceID: &user.ID,
+		IPAddress:  ipAddress,
+		UserAgent:  userAgent,
+	})
+}
+
+// issueSession creates a new session in the given token family and returns
+// a signed access token together with an opaque refresh token
+func (s *Service) issueSession(ctx context.Context, tx *gorm.DB, user *models.User, familyID uuid.UUID, refreshExpiresAt time.Time, ipAddress, userAgent string) (*LoginResponse, error) {
 	// Extract roles
 	roles := make([]string, len(user.Roles))
 	for i, role := range user.Roles {
 		roles[i] = role.Code
 	}
 
-	// Generate tokens
-	accessToken, err := jwt.GenerateToken(
+	// Generate tokens bound to a new session
+	sessionID := uuid.New()
+	accessToken, err := s.keys.GenerateToken(
 		user.ID,
 		user.Email,
 		roles,
-		s.config.JWT.Secret,
+		sessionID,
+		jwt.TokenTypeAccess,
 		s.config.GetJWTExpiration(),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
 
-	refreshToken, err := jwt.GenerateToken(
-		user.ID,
-		user.Email,
-		roles,
-		s.config.JWT.Secret,
-		s.config.GetJWTRefreshExpiration(),
-	)
+	refreshToken, err := encryption.GenerateRandomToken(32)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
 	}
 
-	// Create session
+	// Create session; only the hash of the refresh token is stored
+	now := time.Now()
 	session := models.Session{
-		UserID:       user.ID,
-		Token:        accessToken,
-		RefreshToken: refreshToken,
-		ExpiresAt:    time.Now().Add(s.config.GetJWTExpiration()),
-		IPAddress:    ipAddress,
-		UserAgent:    userAgent,
-		IsActive:     true,
+		BaseModel:        models.BaseModel{ID: sessionID},
+		UserID:           user.ID,
+		FamilyID:         familyID,
+		Token:            accessToken,
+		RefreshTokenHash: encryption.HashToken(refreshToken),
+		ExpiresAt:        now.Add(s.config.GetJWTExpiration()),
+		RefreshExpiresAt: &refreshExpiresAt,
+		IPAddress:        ipAddress,
+		UserAgent:        userAgent,
+		LastActivityAt:   &now,
+		IsActive:         true,
 	}
 
-	if err := s.db.WithContext(ctx).Create(&session).Error; err != nil {
+	if err := tx.Create(&session).Error; err != nil {
 		return nil, errors.ErrDatabaseError
 	}
 
-	// Update last login
-	now := time.Now()
-	user.LastLoginAt = &now
-	user.LastLoginIP = ipAddress
-	s.db.WithContext(ctx).Save(&user)
-
 	// Clear sensitive data
 	user.PasswordHash = ""
 	user.MFASecret = ""
@@ -135,93 +376,135 @@ func (s *Service) Login(ctx context.Context, req *LoginRequest, ipAddress, userA
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
 		ExpiresIn:    int(s.config.GetJWTExpiration().Seconds()),
-		User:         &user,
+		User:         user,
 		MFARequired:  false,
 	}, nil
 }
 
-// Logout logs out a user
-func (s *Service) Logout(ctx context.Context, userID uuid.UUID, token string) error {
-	now := time.Now()
-	return s.db.WithContext(ctx).
-		Model(&models.Session{}).
-		Where("user_id = ? AND token = ?", userID, token).
-		Updates(map[string]interface{}{
-			"is_active":  false,
-			"revoked_at": now,
-		}).Error
+// Logout logs out a user by revoking the current session
+func (s *Service) Logout(ctx context.Context, userID, sessionID uuid.UUID) error {
+	_, err := s.revokeSessions(ctx, s.db.WithContext(ctx).Where("user_id = ? AND id = ?", userID, sessionID), SessionRevokedLogout)
+	return err
 }
 
-// RefreshToken refreshes an access token
-func (s *Service) RefreshToken(ctx context.Context, refreshToken string) (*LoginResponse, error) {
-	// Validate refresh token
-	claims, err := jwt.ValidateToken(refreshToken, s.config.JWT.Secret)
-	if err != nil {
-		return nil, errors.ErrTokenInvalid
-	}
-
-	// Check if session exists and is active
+// RefreshToken rotates a refresh token. Each refresh token can be used once;
+// presenting an already rotated token revokes the whole token family.
+func (s *Service) RefreshToken(ctx context.Context, refreshToken, ipAddress, userAgent string) (*LoginResponse, error) {
 	var session models.Session
 	if err := s.db.WithContext(ctx).
-		Where("user_id = ? AND refresh_token = ? AND is_active = ?", claims.UserID, refreshToken, true).
+		Where("refresh_token = ?", encryption.HashToken(refreshToken)).
 		First(&session).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrTokenInvalid
+		}
+		return nil, errors.ErrDatabaseError
+	}
+
+	if session.RotatedAt != nil {
+		s.handleRefreshTokenReuse(ctx, &session, ipAddress, userAgent)
 		return nil, errors.ErrTokenInvalid
 	}
 
+	if !session.IsActive || session.RevokedAt != nil {
+		return nil, errors.ErrTokenInvalid
+	}
+	if session.RefreshExpiresAt == nil || time.Now().After(*session.RefreshExpiresAt) {
+		return nil, errors.ErrTokenExpired
+	}
+	// Refreshing does not keep a session alive once it has gone idle
+	if s.sessionIdle(&session, time.Now()) {
+		s.revokeSessions(ctx, s.db.WithContext(ctx).Where("id = ?", session.ID), SessionRevokedIdleTimeout)
+		return nil, errors.ErrTokenExpired
+	}
+
 	// Get user
 	var user models.User
 	if err := s.db.WithContext(ctx).
 		Preload("Roles.Permissions").
-		Where("id = ? AND status = ?", claims.UserID, models.UserStatusActive).
+		Where("id = ? AND status = ?", session.UserID, models.UserStatusActive).
 		First(&user).Error; err != nil {
-		return nil, errors.ErrUserNotFound(claims.UserID.String())
+		return nil, errors.ErrTokenInvalid
 	}
 
-	// Generate new tokens
-	accessToken, err := jwt.GenerateToken(
-		user.ID,
-		user.Email,
-		claims.Roles,
-		s.config.JWT.Secret,
-		s.config.GetJWTExpiration(),
-	)
-	if err != nil {
-		return nil, err
+	familyID := session.FamilyID
+	if familyID == uuid.Nil {
+		familyID = session.ID
 	}
 
-	newRefreshToken, err := jwt.GenerateToken(
-		user.ID,
-		user.Email,
-		claims.Roles,
-		s.config.JWT.Secret,
-		s.config.GetJWTRefreshExpiration(),
-	)
+	var resp *LoginResponse
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Mark the presented token as rotated; losing this race means the
+		// same token was presented twice concurrently
+		now := time.Now()
+		result := tx.Model(&models.Session{}).
+			Where("id = ? AND rotated_at IS NULL AND is_active = ?", session.ID, true).
+			Updates(map[string]interface{}{
+				"is_active":  false,
+				"rotated_at": now,
+			})
+		if result.Error != nil {
+			return errors.ErrDatabaseError
+		}
+		if result.RowsAffected != 1 {
+			return errors.ErrTokenInvalid
+		}
+
+		var err error
+		resp, err = s.issueSession(ctx, tx, &user, familyID, *session.RefreshExpiresAt, ipAddress, userAgent)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	// Update session
-	session.Token = accessToken
-	session.RefreshToken = newRefreshToken
-	session.ExpiresAt = time.Now().Add(s.config.GetJWTExpiration())
-	s.db.WithContext(ctx).Save(&session)
+	s.sessions.Invalidate(session.ID)
+	return resp, nil
+}
 
-	// Clear sensitive data
-	user.PasswordHash = ""
-	user.MFASecret = ""
+// handleRefreshTokenReuse revokes every session in the token family of a
+// reused refresh token and records a security audit event
+func (s *Service) handleRefreshTokenReuse(ctx context.Context, session *models.Session, ipAddress, userAgent string) {
+	familyID := session.FamilyID
+	if familyID == uuid.Nil {
+		familyID = session.ID
+	}
 
-	return &LoginResponse{
-		AccessToken:  accessToken,
-		RefreshToken: newRefreshToken,
-		ExpiresIn:    int(s.config.GetJWTExpiration().Seconds()),
-		User:         &user,
-	}, nil
+	revoked, _ := s.revokeSessions(ctx, s.db.WithContext(ctx).Where("family_id = ?", familyID), SessionRevokedTokenReuse)
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"family_id":        familyID,
+		"revoked_sessions": revoked,
+	})
+
+	s.audit.Record(ctx, &models.AuditLog{
+		UserID:      &session.UserID,
+		Action:      models.AuditActionTokenReuse,
+		Resource:    "session",
+		ResourceID:  &session.ID,
+		Description: "Rotated refresh token was reused; token family revoked",
+		IPAddress:   ipAddress,
+		UserAgent:   userAgent,
+		Metadata:    string(metadata),
+		Severity:    models.AuditSeverityCritical,
+	})
 }
 
 // VerifyToken verifies if a token is valid
 func (s *Service) VerifyToken(ctx context.Context, token string) (*models.User, error) {
-	claims, err := jwt.ValidateToken(token, s.config.JWT.Secret)
+	claims, err := s.keys.ValidateToken(token, jwt.TokenTypeAccess)
+	if err != nil {
+		return nil, errors.ErrTokenInvalid
+	}
+
+	sessionID, err := claims.SessionID()
+	if err != nil {
+		return nil, errors.ErrTokenInvalid
+	}
+	active, err := s.sessions.IsSessionActive(ctx, sessionID, claims.UserID)
 	if err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+	if !active {
 		return nil, errors.ErrTokenInvalid
 	}
 
@@ -238,3 +521,8 @@ func (s *Service) VerifyToken(ctx context.Context, token string) (*models.User,
 
 	return &user, nil
 }
+
+// JWKS returns the public keys used to sign access tokens
+func (s *Service) JWKS() jwt.JWKS {
+	return s.keys.JWKS()
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// sessionTouchInterval limits how often session activity is written to the database
+const sessionTouchInterval = time.Minute
+
+// SessionCache checks whether sessions are still active, caching the result
+// in-process so the auth middleware does not hit the database on every request.
+// Revocations made through this instance take effect immediately; revocations
+// made elsewhere are picked up once the cached entry expires.
+//
+// Each successful check counts as activity. Sessions left idle for longer than
+// the idle timeout are revoked on their next use.
+type SessionCache struct {
+	db          *gorm.DB
+	ttl         time.Duration
+	idleTimeout time.Duration
+	mu          sync.RWMutex
+	entries     map[uuid.UUID]*sessionCacheEntry
+}
+
+const maxSessionCacheEntries = 10000
+
+type sessionCacheEntry struct {
+	userID       uuid.UUID
+	active       bool
+	expiresAt    time.Time
+	lastActivity time.Time
+	touchedAt    time.Time // When lastActivity was last persisted
+}
+
+// NewSessionCache creates a new session cache. An idleTimeout of zero
+// disables the inactivity check.
+func NewSessionCache(db *gorm.DB, ttl, idleTimeout time.Duration) *SessionCache {
+	return &SessionCache{
+		db:          db,
+		ttl:         ttl,
+		idleTimeout: idleTimeout,
+		entries:     make(map[uuid.UUID]*sessionCacheEntry),
+	}
+}
+
+// IsSessionActive reports whether the session exists, belongs to the user,
+// has not been revoked or left idle and the user account is still active
+func (c *SessionCache) IsSessionActive(ctx context.Context, sessionID, userID uuid.UUID) (bool, error) {
+	now := time.Now()
+
+	c.mu.RLock()
+	entry, ok := c.entries[sessionID]
+	c.mu.RUnlock()
+	if !ok || now.After(entry.expiresAt) {
+		var err error
+		if entry, err = c.load(ctx, sessionID, userID, entry, now); err != nil {
+			return false, err
+		}
+	}
+
+	if !entry.active || entry.userID != userID {
+		return false, nil
+	}
+
+	c.mu.Lock()
+	if c.isIdle(entry.lastActivity, now) {
+		entry.active = false
+		c.mu.Unlock()
+		c.expire(ctx, sessionID, now)
+		return false, nil
+	}
+	entry.lastActivity = now
+	touch := now.Sub(entry.touchedAt) >= sessionTouchInterval
+	if touch {
+		entry.touchedAt = now
+	}
+	c.mu.Unlock()
+
+	if touch {
+		c.db.WithContext(ctx).
+			Model(&models.Session{}).
+			Where("id = ?", sessionID).
+			Update("last_activity_at", now)
+	}
+
+	return true, nil
+}
+
+// Invalidate drops cached entries for the given sessions
+func (c *SessionCache) Invalidate(sessionIDs ...uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range sessionIDs {
+		delete(c.entries, id)
+	}
+}
+
+// InvalidateUser drops all cached entries belonging to a user
+func (c *SessionCache) InvalidateUser(userID uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, entry := range c.entries {
+		if entry.userID == userID {
+			delete(c.entries, id)
+		}
+	}
+}
+
+// IdleTimeout returns the configured inactivity timeout
+func (c *SessionCache) IdleTimeout() time.Duration {
+	return c.idleTimeout
+}
+
+// isIdle reports whether a session last used at lastActivity has timed out
+func (c *SessionCache) isIdle(lastActivity, now time.Time) bool {
+	return c.idleTimeout > 0 && now.Sub(lastActivity) > c.idleTimeout
+}
+
+// load looks up a session and caches the result. Activity seen by a previous
+// entry that was not yet persisted is carried over.
+func (c *SessionCache) load(ctx context.Context, sessionID, userID uuid.UUID, previous *sessionCacheEntry, now time.Time) (*sessionCacheEntry, error) {
+	var rows []struct {
+		LastActivityAt time.Time
+	}
+	if err := c.db.WithContext(ctx).
+		Model(&models.Session{}).
+		Select("COALESCE(sessions.last_activity_at, sessions.created_at) AS last_activity_at").
+		Joins("JOIN users ON users.id = sessions.user_id AND users.deleted_at IS NULL").
+		Where("sessions.id = ? AND sessions.user_id = ? AND sessions.is_active = ? AND sessions.revoked_at IS NULL", sessionID, userID, true).
+		Where("users.status = ?", models.UserStatusActive).
+		Limit(1).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	entry := &sessionCacheEntry{
+		userID:    userID,
+		active:    len(rows) > 0,
+		expiresAt: now.Add(c.ttl),
+	}
+	if entry.active {
+		entry.lastActivity = rows[0].LastActivityAt
+		entry.touchedAt = rows[0].LastActivityAt
+		if previous != nil && previous.userID == userID && previous.lastActivity.After(entry.lastActivity) {
+			entry.lastActivity = previous.lastActivity
+		}
+	}
+
+	c.mu.Lock()
+	if len(c.entries) >= maxSessionCacheEntries {
+		c.sweepLocked(now)
+	}
+	c.entries[sessionID] = entry
+	c.mu.Unlock()
+
+	return entry, nil
+}
+
+// expire revokes a session that timed out through inactivity
+func (c *SessionCache) expire(ctx context.Context, sessionID uuid.UUID, now time.Time) {
+	c.db.WithContext(ctx).
+		Model(&models.Session{}).
+		Where("id = ? AND is_active = ? AND revoked_at IS NULL", sessionID, true).
+		Updates(map[string]interface{}{
+			"is_active":      false,
+			"revoked_at":     now,
+			"revoked_reason": SessionRevokedIdleTimeout,
+		})
+}
+
+// sweepLocked removes expired entries so the cache does not grow unbounded.
+// The caller must hold the write lock.
+func (c *SessionCache) sweepLocked(now time.Time) {
+	for id, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, id)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/config"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Reasons recorded on revoked sessions
+const (
+	SessionRevokedLogout         = "logout"
+	SessionRevokedIdleTimeout    = "idle_timeout"
+	SessionRevokedEvicted        = "evicted"
+	SessionRevokedByAdmin        = "revoked"
+	SessionRevokedPasswordChange = "password_change"
+	SessionRevokedTokenReuse     = "token_reuse"
+)
+
+// ListUserSessions lists the live sessions of a user
+func (s *Service) ListUserSessions(ctx context.Context, userID uuid.UUID) ([]models.Session, error) {
+	var sessions []models.Session
+	if err := s.db.WithContext(ctx).
+		Scopes(s.liveSessions(time.Now())).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&sessions).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession revokes a single session of a user
+func (s *Service) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	revoked, err := s.revokeSessions(ctx, s.db.WithContext(ctx).Where("user_id = ? AND id = ?", userID, sessionID), SessionRevokedByAdmin)
+	if err != nil {
+		return err
+	}
+	if revoked == 0 {
+		return errors.ErrSessionNotFound(sessionID.String())
+	}
+	return nil
+}
+
+// RevokeAllSessions revokes every active session of a user, locking them out immediately
+func (s *Service) RevokeAllSessions(ctx context.Context, userID uuid.UUID) (int64, error) {
+	revoked, err := s.revokeSessions(ctx, s.db.WithContext(ctx).Where("user_id = ?", userID), SessionRevokedByAdmin)
+	if err != nil {
+		return 0, err
+	}
+
+	s.sessions.InvalidateUser(userID)
+	return revoked, nil
+}
+
+// RevokeOtherSessions signs a user out of every device except the current session
+func (s *Service) RevokeOtherSessions(ctx context.Context, userID, sessionID uuid.UUID, ipAddress, userAgent string) (int64, error) {
+	revoked, err := s.revokeSessions(ctx, s.db.WithContext(ctx).Where("user_id = ? AND id <> ?", userID, sessionID), SessionRevokedLogout)
+	if err != nil {
+		return 0, err
+	}
+
+	s.audit.Record(ctx, &models.AuditLog{
+		UserID:      &userID,
+		Action:      models.AuditActionLogout,
+		Resource:    "user",
+		ResourceID:  &userID,
+		Description: fmt.Sprintf("Signed out of %d other session(s)", revoked),
+		IPAddress:   ipAddress,
+		UserAgent:   userAgent,
+	})
+
+	return revoked, nil
+}
+
+// revokeSessions marks all active sessions matching the scope as revoked for
+// the given reason and drops them from the session cache
+func (s *Service) revokeSessions(ctx context.Context, scope *gorm.DB, reason string) (int64, error) {
+	var ids []uuid.UUID
+	if err := scope.
+		Model(&models.Session{}).
+		Where("is_active = ? AND revoked_at IS NULL", true).
+		Pluck("id", &ids).Error; err != nil {
+		return 0, errors.ErrDatabaseError
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	now := time.Now()
+	result := s.db.WithContext(ctx).
+		Model(&models.Session{}).
+		Where("id IN ?", ids).
+		Updates(map[string]interface{}{
+			"is_active":      false,
+			"revoked_at":     now,
+			"revoked_reason": reason,
+		})
+	if result.Error != nil {
+		return 0, errors.ErrDatabaseError
+	}
+
+	s.sessions.Invalidate(ids...)
+	return result.RowsAffected, nil
+}
+
+// liveSessions scopes a query to sessions that can still be used: not
+// revoked, not past their refresh expiry and not idle for too long
+func (s *Service) liveSessions(now time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Where("is_active = ? AND revoked_at IS NULL", true).
+			Where("COALESCE(refresh_expires_at, expires_at) > ?", now)
+		if idle := s.sessions.IdleTimeout(); idle > 0 {
+			db = db.Where("COALESCE(last_activity_at, created_at) > ?", now.Add(-idle))
+		}
+		return db
+	}
+}
+
+// sessionIdle reports whether a session has been unused for longer than the idle timeout
+func (s *Service) sessionIdle(session *models.Session, now time.Time) bool {
+	lastActivity := session.CreatedAt
+	if session.LastActivityAt != nil {
+		lastActivity = *session.LastActivityAt
+	}
+	return s.sessions.isIdle(lastActivity, now)
+}
+
+// startSession signs a user in on a new device, enforcing the concurrent
+// session limit
+func (s *Service) startSession(ctx context.Context, user *models.User, ipAddress, userAgent string) (*LoginResponse, error) {
+	var resp *LoginResponse
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		familyID := uuid.New()
+		if err := s.enforceSessionLimit(ctx, tx, user, familyID, ipAddress, userAgent); err != nil {
+			return err
+		}
+
+		var err error
+		resp, err = s.issueSession(ctx, tx, user, familyID, time.Now().Add(s.config.GetJWTRefreshExpiration()), ipAddress, userAgent)
+		return err
+	})
+	return resp, err
+}
+
+// enforceSessionLimit makes room for a new session in the given token family.
+// Depending on the configured policy the least recently used sessions are
+// evicted or the login is rejected once the user's limit is reached. The user
+// row is locked so concurrent logins cannot both pass the check.
+func (s *Service) enforceSessionLimit(ctx context.Context, tx *gorm.DB, user *models.User, familyID uuid.UUID, ipAddress, userAgent string) error {
+	roles := make([]string, len(user.Roles))
+	for i, role := range user.Roles {
+		roles[i] = role.Code
+	}
+	limit := s.config.GetMaxSessions(roles)
+	if limit <= 0 {
+		return nil
+	}
+
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").
+		Where("id = ?", user.ID).
+		First(&models.User{}).Error; err != nil {
+		return errors.ErrDatabaseError
+	}
+
+	now := time.Now()
+	var live []models.Session
+	if err := tx.Scopes(s.liveSessions(now)).
+		Select("id", "ip_address", "user_agent").
+		Where("user_id = ? AND family_id <> ?", user.ID, familyID).
+		Order("COALESCE(last_activity_at, created_at) ASC").
+		Find(&live).Error; err != nil {
+		return errors.ErrDatabaseError
+	}
+	if len(live) < limit {
+		return nil
+	}
+
+	if s.config.Security.SessionLimitPolicy == config.SessionLimitReject {
+		s.recordLoginFailure(ctx, &user.ID, user.Email, "session limit reached", ipAddress, userAgent)
+		return errors.ErrSessionLimitReached(limit)
+	}
+
+	evicted := live[:len(live)-limit+1]
+	ids := make([]uuid.UUID, len(evicted))
+	for i, session := range evicted {
+		ids[i] = session.ID
+	}
+	if err := tx.Model(&models.Session{}).
+		Where("id IN ?", ids).
+		Updates(map[string]interface{}{
+			"is_active":      false,
+			"revoked_at":     now,
+			"revoked_reason": SessionRevokedEvicted,
+		}).Error; err != nil {
+		return errors.ErrDatabaseError
+	}
+	s.sessions.Invalidate(ids...)
+
+	for _, session := range evicted {
+		sessionID := session.ID
+		s.audit.Record(ctx, &models.AuditLog{
+			UserID:      &user.ID,
+			Action:      models.AuditActionSessionEvicted,
+			Resource:    "session",
+			ResourceID:  &sessionID,
+			Description: fmt.Sprintf("Session from %s signed out: concurrent session limit of %d reached", session.IPAddress, limit),
+			IPAddress:   ipAddress,
+			UserAgent:   userAgent,
+		})
+	}
+
+	return nil
+}
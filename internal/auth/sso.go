@@ -0,0 +1,429 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/config"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/common/logger"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/hospital-emr/backend/pkg/encryption"
+	"github.com/hospital-emr/backend/pkg/oidc"
+	"gorm.io/gorm"
+)
+
+// externalPassword is the password hash of provisioned external users: no
+// password matches it, so they have no local password
+const externalPassword = "!"
+
+// SSO signs users in through external identity providers. A successful
+// external login is resolved to a local user, either through an existing
+// identity link, by linking the user with the same verified email, or by
+// provisioning a new user, and then receives the same tokens as a password
+// login.
+type SSO struct {
+	service     *Service
+	permissions *PermissionCache
+	redirect    map[string]RedirectProvider
+	password    map[string]PasswordProvider
+	roles       GroupRoleMapper
+	jit         bool
+	linkByEmail bool
+	syncRoles   bool
+	stateTTL    time.Duration
+}
+
+// NewSSO creates a new SSO service without providers
+func NewSSO(service *Service, permissions *PermissionCache, cfg *config.Config) *SSO {
+	return &SSO{
+		service:     service,
+		permissions: permissions,
+		redirect:    make(map[string]RedirectProvider),
+		password:    make(map[string]PasswordProvider),
+		roles:       GroupRoleMapper(cfg.GetSSOGroupRoleMap()),
+		jit:         cfg.SSO.JITProvisioning,
+		linkByEmail: cfg.SSO.LinkByEmail,
+		syncRoles:   cfg.SSO.SyncRoles,
+		stateTTL:    cfg.GetSSOLoginStateTTL(),
+	}
+}
+
+// RegisterRedirectProvider enables a redirect-based provider
+func (s *SSO) RegisterRedirectProvider(provider RedirectProvider) {
+	s.redirect[provider.Name()] = provider
+}
+
+// RegisterPasswordProvider enables a password-based provider
+func (s *SSO) RegisterPasswordProvider(provider PasswordProvider) {
+	s.password[provider.Name()] = provider
+}
+
+// SSOProvider describes an enabled identity provider
+type SSOProvider struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // redirect or password
+}
+
+// SSOPasswordLoginRequest represents a login through a password-based provider
+type SSOPasswordLoginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	MFACode  string `json:"mfa_code,omitempty"`
+}
+
+// Providers lists the enabled identity providers
+func (s *SSO) Providers() []SSOProvider {
+	providers := make([]SSOProvider, 0, len(s.redirect)+len(s.password))
+	for name := range s.redirect {
+		providers = append(providers, SSOProvider{Name: name, Type: "redirect"})
+	}
+	for name := range s.password {
+		providers = append(providers, SSOProvider{Name: name, Type: "password"})
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i].Name < providers[j].Name })
+	return providers
+}
+
+// BeginLogin starts a login through a redirect-based provider and returns
+// the URL to send the user agent to
+func (s *SSO) BeginLogin(ctx context.Context, providerName, ipAddress string) (string, error) {
+	provider, ok := s.redirect[providerName]
+	if !ok {
+		return "", errors.ErrSSOProviderNotFound(providerName)
+	}
+
+	state, err := encryption.GenerateRandomToken(32)
+	if err != nil {
+		return "", errors.ErrInternal
+	}
+	nonce, err := encryption.GenerateRandomToken(16)
+	if err != nil {
+		return "", errors.ErrInternal
+	}
+	verifier, err := oidc.GenerateVerifier()
+	if err != nil {
+		return "", errors.ErrInternal
+	}
+
+	authURL, err := provider.AuthURL(ctx, state, nonce, verifier)
+	if err != nil {
+		logger.WithFields(map[string]interface{}{
+			"provider": providerName,
+			"error":    err.Error(),
+		}).Error("Failed to start SSO login")
+		return "", errors.ErrSSOFailed()
+	}
+
+	now := time.Now()
+	db := s.service.db.WithContext(ctx)
+	db.Unscoped().Where("expires_at < ?", now).Delete(&models.SSOLoginState{})
+
+	if err := db.Create(&models.SSOLoginState{
+		StateHash:    encryption.HashToken(state),
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		IPAddress:    ipAddress,
+		ExpiresAt:    now.Add(s.stateTTL),
+	}).Error; err != nil {
+		return "", errors.ErrDatabaseError
+	}
+
+	return authURL, nil
+}
+
+// CompleteLogin finishes a login through a redirect-based provider. Each
+// state completes at most one login.
+func (s *SSO) CompleteLogin(ctx context.Context, providerName, state, code, ipAddress, userAgent string) (*LoginResponse, error) {
+	provider, ok := s.redirect[providerName]
+	if !ok {
+		return nil, errors.ErrSSOProviderNotFound(providerName)
+	}
+	if state == "" || code == "" {
+		return nil, errors.ErrSSOStateInvalid()
+	}
+
+	now := time.Now()
+	hash := encryption.HashToken(state)
+	db := s.service.db.WithContext(ctx)
+
+	// Claim the state before redeeming the code so a replayed callback fails
+	result := db.Model(&models.SSOLoginState{}).
+		Where("state_hash = ? AND provider = ? AND used_at IS NULL AND expires_at > ?", hash, providerName, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, errors.ErrDatabaseError
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.ErrSSOStateInvalid()
+	}
+
+	var loginState models.SSOLoginState
+	if err := db.Where("state_hash = ?", hash).First(&loginState).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+
+	identity, err := provider.Callback(ctx, code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		logger.WithFields(map[string]interface{}{
+			"provider": providerName,
+			"error":    err.Error(),
+		}).Warn("SSO callback rejected")
+		s.service.recordLoginFailure(ctx, nil, "", providerName+" login rejected", ipAddress, userAgent)
+		return nil, errors.ErrSSOFailed()
+	}
+
+	// Users with a local second factor answer the challenge through the MFA
+	// token since the callback cannot carry a code
+	return s.signIn(ctx, identity, "", ipAddress, userAgent)
+}
+
+// PasswordLogin signs a user in through a password-based provider. Users
+// with a local second factor must also present an MFA code or passkey.
+func (s *SSO) PasswordLogin(ctx context.Context, providerName string, req *SSOPasswordLoginRequest, ipAddress, userAgent string) (*LoginResponse, error) {
+	provider, ok := s.password[providerName]
+	if !ok {
+		return nil, errors.ErrSSOProviderNotFound(providerName)
+	}
+
+	identity, err := provider.Authenticate(ctx, req.Username, req.Password)
+	if err != nil {
+		if err == errors.ErrInvalidCredentials {
+			s.service.recordLoginFailure(ctx, nil, req.Username, "invalid "+providerName+" credentials", ipAddress, userAgent)
+			return nil, errors.ErrInvalidCredentials
+		}
+		logger.WithFields(map[string]interface{}{
+			"provider": providerName,
+			"error":    err.Error(),
+		}).Error("SSO directory login failed")
+		return nil, errors.ErrSSOFailed()
+	}
+
+	return s.signIn(ctx, identity, req.MFACode, ipAddress, userAgent)
+}
+
+// signIn resolves an external identity to a local user and issues a session.
+// Users with a local second factor must present it unless the provider
+// reports that it asked for one itself.
+func (s *SSO) signIn(ctx context.Context, identity *ExternalIdentity, mfaCode string, ipAddress, userAgent string) (*LoginResponse, error) {
+	user, err := s.resolveUser(ctx, identity, ipAddress, userAgent)
+	if err != nil {
+		if err != errors.ErrDatabaseError {
+			s.service.recordLoginFailure(ctx, nil, identity.Email, identity.Provider+" identity not provisioned", ipAddress, userAgent)
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if s.service.isLocked(user, now) || user.Status != models.UserStatusActive {
+		s.service.recordLoginFailure(ctx, &user.ID, user.Email, "account "+string(user.Status)+" at "+identity.Provider+" login", ipAddress, userAgent)
+		return nil, errors.ErrInvalidCredentials
+	}
+
+	if s.syncRoles && len(s.roles) > 0 {
+		if err := s.syncUserRoles(ctx, user, identity, ipAddress, userAgent); err != nil {
+			return nil, err
+		}
+	}
+
+	if !identity.MFA {
+		methods, err := s.service.mfaMethods(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		if len(methods) > 0 {
+			if mfaCode == "" {
+				return s.service.mfaChallenge(user, methods)
+			}
+			if err := s.service.verifyMFACode(ctx, user, mfaCode); err != nil {
+				s.service.registerFailedLogin(ctx, user, "invalid MFA code", ipAddress, userAgent)
+				return nil, err
+			}
+		}
+	}
+	s.service.resetFailedLogins(ctx, user)
+
+	resp, err := s.service.startSession(ctx, user, ipAddress, userAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	s.service.db.WithContext(ctx).
+		Model(&models.UserIdentity{}).
+		Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).
+		Update("last_login_at", now)
+	s.service.recordLogin(ctx, user, ipAddress, userAgent)
+
+	return resp, nil
+}
+
+// resolveUser finds the local user of an external identity, linking or
+// provisioning one when allowed
+func (s *SSO) resolveUser(ctx context.Context, identity *ExternalIdentity, ipAddress, userAgent string) (*models.User, error) {
+	db := s.service.db.WithContext(ctx)
+
+	var link models.UserIdentity
+	err := db.Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).First(&link).Error
+	if err == nil {
+		return s.loadUser(ctx, link.UserID)
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, errors.ErrDatabaseError
+	}
+
+	email := strings.TrimSpace(identity.Email)
+	if email != "" && identity.EmailVerified {
+		var user models.User
+		err := db.Preload("Roles.Permissions").Where("LOWER(email) = LOWER(?)", email).First(&user).Error
+		switch {
+		case err == nil:
+			if !s.linkByEmail {
+				return nil, errors.ErrSSONotProvisioned()
+			}
+			if err := s.link(ctx, db, &user, identity); err != nil {
+				return nil, err
+			}
+			s.record(ctx, &user, models.AuditActionIdentityLink,
+				fmt.Sprintf("Linked %s identity %s to user %s", identity.Provider, identity.Subject, user.Email),
+				identity, ipAddress, userAgent)
+			return &user, nil
+		case err != gorm.ErrRecordNotFound:
+			return nil, errors.ErrDatabaseError
+		}
+	}
+
+	if !s.jit || email == "" {
+		return nil, errors.ErrSSONotProvisioned()
+	}
+	return s.provision(ctx, identity, ipAddress, userAgent)
+}
+
+// provision creates a user for an external identity. Users are only created
+// when their groups map to at least one role. Clinical profile details such
+// as license numbers are completed by an administrator afterwards.
+func (s *SSO) provision(ctx context.Context, identity *ExternalIdentity, ipAddress, userAgent string) (*models.User, error) {
+	codes := s.roles.Roles(identity.Groups)
+	if len(codes) == 0 {
+		return nil, errors.ErrSSONotProvisioned()
+	}
+
+	db := s.service.db.WithContext(ctx)
+
+	var roles []models.Role
+	if err := db.Where("code IN ? AND is_active = ?", codes, true).Find(&roles).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+	if len(roles) == 0 {
+		return nil, errors.ErrSSONotProvisioned()
+	}
+
+	user := &models.User{
+		Email:        strings.TrimSpace(identity.Email),
+		PasswordHash: externalPassword,
+		FirstName:    identity.FirstName,
+		LastName:     identity.LastName,
+		Status:       models.UserStatusActive,
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Roles").Create(user).Error; err != nil {
+			return errors.ErrDatabaseError
+		}
+		if err := tx.Model(user).Association("Roles").Append(roles); err != nil {
+			return errors.ErrDatabaseError
+		}
+		return s.link(ctx, tx, user, identity)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.record(ctx, user, models.AuditActionCreate,
+		fmt.Sprintf("Provisioned user %s from %s with roles %s", user.Email, identity.Provider, strings.Join(codes, ", ")),
+		identity, ipAddress, userAgent)
+
+	return s.loadUser(ctx, user.ID)
+}
+
+// syncUserRoles replaces a user's roles with those mapped from the identity's groups
+func (s *SSO) syncUserRoles(ctx context.Context, user *models.User, identity *ExternalIdentity, ipAddress, userAgent string) error {
+	codes := s.roles.Roles(identity.Groups)
+
+	current := make([]string, len(user.Roles))
+	for i, role := range user.Roles {
+		current[i] = role.Code
+	}
+	sort.Strings(current)
+	if strings.Join(current, ",") == strings.Join(codes, ",") {
+		return nil
+	}
+
+	db := s.service.db.WithContext(ctx)
+	roles := []models.Role{}
+	if len(codes) > 0 {
+		if err := db.Preload("Permissions").Where("code IN ?", codes).Find(&roles).Error; err != nil {
+			return errors.ErrDatabaseError
+		}
+	}
+	if err := db.Model(user).Association("Roles").Replace(roles); err != nil {
+		return errors.ErrDatabaseError
+	}
+	user.Roles = roles
+	s.permissions.InvalidateUser(user.ID)
+
+	s.record(ctx, user, models.AuditActionRoleAssign,
+		fmt.Sprintf("Synchronised roles of %s from %s groups: [%s] to [%s]",
+			user.Email, identity.Provider, strings.Join(current, ", "), strings.Join(codes, ", ")),
+		identity, ipAddress, userAgent)
+
+	return nil
+}
+
+// link records that an external identity belongs to a user
+func (s *SSO) link(ctx context.Context, tx *gorm.DB, user *models.User, identity *ExternalIdentity) error {
+	if err := tx.Create(&models.UserIdentity{
+		UserID:   user.ID,
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}).Error; err != nil {
+		return errors.ErrDatabaseError
+	}
+	return nil
+}
+
+// loadUser loads a user with roles and permissions
+func (s *SSO) loadUser(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+	var user models.User
+	if err := s.service.db.WithContext(ctx).Preload("Roles.Permissions").First(&user, "id = ?", userID).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+	return &user, nil
+}
+
+// record writes an SSO account change to the audit log
+func (s *SSO) record(ctx context.Context, user *models.User, action, description string, identity *ExternalIdentity, ipAddress, userAgent string) {
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"provider": identity.Provider,
+		"subject":  identity.Subject,
+		"groups":   identity.Groups,
+	})
+
+	s.service.audit.Record(ctx, &models.AuditLog{
+		UserID:      &user.ID,
+		Action:      action,
+		Resource:    "user",
+		ResourceID:  &user.ID,
+		Description: description,
+		IPAddress:   ipAddress,
+		UserAgent:   userAgent,
+		Metadata:    string(metadata),
+		Severity:    models.AuditSeverityWarning,
+	})
+}
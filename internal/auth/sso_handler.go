@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hospital-emr/backend/internal/common/errors"
+)
+
+// SSOHandler handles single sign-on HTTP requests
+type SSOHandler struct {
+	sso *SSO
+}
+
+// NewSSOHandler creates a new SSO handler
+func NewSSOHandler(sso *SSO) *SSOHandler {
+	return &SSOHandler{sso: sso}
+}
+
+// ListProviders godoc
+// @Summary List identity providers
+// @Description List the external identity providers users can sign in with
+// @Tags auth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/otentikasi/sso [get]
+func (h *SSOHandler) ListProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": h.sso.Providers()})
+}
+
+// BeginLogin godoc
+// @Summary Start SSO login
+// @Description Redirect to an OpenID Connect provider to sign in
+// @Tags auth
+// @Param provider path string true "Provider name"
+// @Success 302
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/otentikasi/sso/{provider} [get]
+func (h *SSOHandler) BeginLogin(c *gin.Context) {
+	authURL, err := h.sso.BeginLogin(c.Request.Context(), c.Param("provider"), c.ClientIP())
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback godoc
+// @Summary Complete SSO login
+// @Description Redeem the authorization code returned by an OpenID Connect provider and sign in. Users with a local second factor get an MFA challenge unless the provider reports one in the amr or acr claim.
+// @Tags auth
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param code query string true "Authorization code"
+// @Param state query string true "Login state"
+// @Success 200 {object} LoginResponse
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Router /api/v1/otentikasi/sso/{provider}/callback [get]
+func (h *SSOHandler) Callback(c *gin.Context) {
+	if providerErr := c.Query("error"); providerErr != "" {
+		c.JSON(http.StatusUnauthorized, errors.ErrSSOFailed().WithDetails(providerErr))
+		return
+	}
+
+	resp, err := h.sso.CompleteLogin(
+		c.Request.Context(),
+		c.Param("provider"),
+		c.Query("state"),
+		c.Query("code"),
+		c.ClientIP(),
+		c.Request.UserAgent(),
+	)
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// PasswordLogin godoc
+// @Summary Directory login
+// @Description Sign in with directory (LDAP) credentials
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param request body SSOPasswordLoginRequest true "Directory credentials"
+// @Success 200 {object} LoginResponse
+// @Failure 400 {object} errors.AppError
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Router /api/v1/otentikasi/sso/{provider}/masuk [post]
+func (h *SSOHandler) PasswordLogin(c *gin.Context) {
+	var req SSOPasswordLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails(err.Error()))
+		return
+	}
+
+	resp, err := h.sso.PasswordLogin(c.Request.Context(), c.Param("provider"), &req, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
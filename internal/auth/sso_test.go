@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/hospital-emr/backend/internal/common/config"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/pkg/ldap/ldaptest"
+	"github.com/hospital-emr/backend/pkg/oidc"
+	"github.com/hospital-emr/backend/pkg/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupRoleMapper(t *testing.T) {
+	mapper := GroupRoleMapper{
+		"cn=doctors,ou=groups,dc=hospital,dc=local": {"doctor"},
+		"emr-staff":  {"nurse", "doctor"},
+		"emr-admins": {"admin"},
+	}
+
+	roles := mapper.Roles([]string{"CN=Doctors,OU=Groups,DC=hospital,DC=local", "emr-staff", "unmapped"})
+	assert.Equal(t, []string{"doctor", "nurse"}, roles)
+	assert.Empty(t, mapper.Roles(nil))
+}
+
+func TestOIDCProviderCallback(t *testing.T) {
+	server, err := oidctest.NewServer("emr", "client-secret")
+	require.NoError(t, err)
+	defer server.Close()
+
+	server.SetUser(map[string]interface{}{
+		"sub":            "a1b2c3",
+		"email":          "siti@hospital.local",
+		"email_verified": true,
+		"given_name":     "Siti",
+		"family_name":    "Rahayu",
+		"roles":          []string{"emr-doctors"},
+	})
+
+	provider := NewOIDCProvider(&config.Config{SSO: config.SSOConfig{
+		OIDCIssuerURL:    server.Issuer(),
+		OIDCClientID:     "emr",
+		OIDCClientSecret: "client-secret",
+		OIDCRedirectURL:  "http://localhost:8080/api/v1/otentikasi/sso/oidc/callback",
+		OIDCGroupsClaim:  "roles",
+	}})
+
+	ctx := context.Background()
+	authURL, err := provider.AuthURL(ctx, "state", "nonce", "verifier-verifier-verifier-verifier-verifier")
+	require.NoError(t, err)
+
+	redirect, err := server.Login(authURL)
+	require.NoError(t, err)
+	assert.Equal(t, "state", redirect.Query().Get("state"))
+
+	identity, err := provider.Callback(ctx, redirect.Query().Get("code"), "verifier-verifier-verifier-verifier-verifier", "nonce")
+	require.NoError(t, err)
+	assert.Equal(t, "oidc", identity.Provider)
+	assert.Equal(t, "a1b2c3", identity.Subject)
+	assert.Equal(t, "siti@hospital.local", identity.Email)
+	assert.True(t, identity.EmailVerified)
+	assert.Equal(t, "Siti", identity.FirstName)
+	assert.Equal(t, "Rahayu", identity.LastName)
+	assert.Equal(t, []string{"emr-doctors"}, identity.Groups)
+	assert.False(t, identity.MFA)
+
+	// Codes are single-use
+	_, err = provider.Callback(ctx, redirect.Query().Get("code"), "verifier-verifier-verifier-verifier-verifier", "nonce")
+	assert.Error(t, err)
+}
+
+func TestOIDCProviderReportsMFA(t *testing.T) {
+	provider := NewOIDCProvider(&config.Config{SSO: config.SSOConfig{OIDCMFAACRValues: []string{"urn:hospital:loa:2"}}})
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		mfa    bool
+	}{
+		{"no claims", jwt.MapClaims{}, false},
+		{"password only", jwt.MapClaims{"amr": []interface{}{"pwd"}}, false},
+		{"mfa method", jwt.MapClaims{"amr": []interface{}{"pwd", "mfa"}}, true},
+		{"single amr value", jwt.MapClaims{"amr": "mfa"}, true},
+		{"configured acr", jwt.MapClaims{"acr": "urn:hospital:loa:2"}, true},
+		{"other acr", jwt.MapClaims{"acr": "urn:hospital:loa:1"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.mfa, provider.reportsMFA(&oidc.IDToken{Claims: tt.claims}))
+		})
+	}
+}
+
+func TestOIDCProviderDiscoveryFailure(t *testing.T) {
+	provider := NewOIDCProvider(&config.Config{SSO: config.SSOConfig{OIDCIssuerURL: "http://127.0.0.1:1", OIDCClientID: "emr"}})
+
+	_, err := provider.AuthURL(context.Background(), "state", "nonce", "verifier")
+	assert.Error(t, err)
+}
+
+func TestLDAPProviderAuthenticate(t *testing.T) {
+	server, err := ldaptest.NewServer()
+	require.NoError(t, err)
+	defer server.Close()
+
+	server.AddEntry("cn=emr-reader,ou=services,dc=hospital,dc=local", "reader-secret", nil)
+	server.AddEntry("uid=budi,ou=people,dc=hospital,dc=local", "budi-secret", map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"budi"},
+		"mail":        {"budi@hospital.local"},
+		"givenName":   {"Budi"},
+		"sn":          {"Santoso"},
+		"memberOf":    {"cn=nurses,ou=groups,dc=hospital,dc=local"},
+	})
+	// Two entries matching the same login must never authenticate either
+	server.AddEntry("uid=dup,ou=people,dc=hospital,dc=local", "dup-secret", map[string][]string{"objectClass": {"person"}, "uid": {"twin"}})
+	server.AddEntry("uid=dup2,ou=people,dc=hospital,dc=local", "dup-secret", map[string][]string{"objectClass": {"person"}, "uid": {"twin"}})
+
+	provider := NewLDAPProvider(&config.Config{SSO: config.SSOConfig{
+		LDAPURL:                server.URL(),
+		LDAPBindDN:             "cn=emr-reader,ou=services,dc=hospital,dc=local",
+		LDAPBindPassword:       "reader-secret",
+		LDAPBaseDN:             "ou=people,dc=hospital,dc=local",
+		LDAPUserFilter:         "(&(objectClass=person)(uid={username}))",
+		LDAPGroupAttribute:     "memberOf",
+		LDAPEmailAttribute:     "mail",
+		LDAPFirstNameAttribute: "givenName",
+		LDAPLastNameAttribute:  "sn",
+	}})
+	ctx := context.Background()
+
+	identity, err := provider.Authenticate(ctx, "budi", "budi-secret")
+	require.NoError(t, err)
+	assert.Equal(t, "ldap", identity.Provider)
+	assert.Equal(t, "uid=budi,ou=people,dc=hospital,dc=local", identity.Subject)
+	assert.Equal(t, "budi@hospital.local", identity.Email)
+	assert.Equal(t, "Budi", identity.FirstName)
+	assert.Equal(t, "Santoso", identity.LastName)
+	assert.Equal(t, []string{"cn=nurses,ou=groups,dc=hospital,dc=local"}, identity.Groups)
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+	}{
+		{"wrong password", "budi", "wrong"},
+		{"empty password", "budi", ""},
+		{"unknown user", "nobody", "secret"},
+		{"ambiguous user", "twin", "dup-secret"},
+		{"filter injection", "*)(uid=budi", "budi-secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := provider.Authenticate(ctx, tt.username, tt.password)
+			assert.Equal(t, errors.ErrInvalidCredentials, err)
+		})
+	}
+}
@@ -0,0 +1,512 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/config"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/common/logger"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/hospital-emr/backend/pkg/jwt"
+	"github.com/hospital-emr/backend/pkg/webauthn"
+	"gorm.io/gorm"
+)
+
+// WebAuthn registers FIDO2 passkeys and signs users in with them, either as
+// a second factor after the password or, for passkeys that verified the
+// user, on their own
+type WebAuthn struct {
+	service      *Service
+	config       *config.Config
+	rp           *webauthn.RelyingParty
+	timeout      time.Duration
+	passwordless bool
+}
+
+// NewWebAuthn creates the WebAuthn service from configuration
+func NewWebAuthn(service *Service, cfg *config.Config) (*WebAuthn, error) {
+	rp := &webauthn.RelyingParty{
+		ID:      cfg.WebAuthn.RPID,
+		Name:    cfg.WebAuthn.RPName,
+		Origins: cfg.WebAuthn.Origins,
+	}
+
+	if cfg.WebAuthn.AttestationRootsFile != "" {
+		pem, err := os.ReadFile(cfg.WebAuthn.AttestationRootsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read WebAuthn attestation roots: %w", err)
+		}
+		rp.AttestationRoots = x509.NewCertPool()
+		if !rp.AttestationRoots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.WebAuthn.AttestationRootsFile)
+		}
+	}
+
+	return &WebAuthn{
+		service:      service,
+		config:       cfg,
+		rp:           rp,
+		timeout:      cfg.GetWebAuthnTimeout(),
+		passwordless: cfg.WebAuthn.PasswordlessEnabled,
+	}, nil
+}
+
+// WebAuthnRegistrationOptions starts a passkey registration
+type WebAuthnRegistrationOptions struct {
+	CeremonyID uuid.UUID                 `json:"ceremony_id"`
+	PublicKey  *webauthn.CreationOptions `json:"public_key"`
+}
+
+// WebAuthnRegistrationRequest completes a passkey registration
+type WebAuthnRegistrationRequest struct {
+	CeremonyID uuid.UUID                           `json:"ceremony_id" binding:"required"`
+	Name       string                              `json:"name" binding:"max=100"`
+	Credential webauthn.CredentialCreationResponse `json:"credential" binding:"required"`
+}
+
+// WebAuthnLoginOptions starts a passkey login
+type WebAuthnLoginOptions struct {
+	CeremonyID uuid.UUID                `json:"ceremony_id"`
+	PublicKey  *webauthn.RequestOptions `json:"public_key"`
+}
+
+// WebAuthnSecondFactorBeginRequest starts a passkey login after the password
+type WebAuthnSecondFactorBeginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+// WebAuthnLoginRequest completes a passkey login. The MFA token is required
+// when the passkey is the second factor.
+type WebAuthnLoginRequest struct {
+	MFAToken   string                               `json:"mfa_token,omitempty"`
+	CeremonyID uuid.UUID                            `json:"ceremony_id" binding:"required"`
+	Credential webauthn.CredentialAssertionResponse `json:"credential" binding:"required"`
+}
+
+// BeginRegistration issues the options for registering a new passkey once
+// the user has reauthenticated. The attestation requested depends on the
+// user's roles.
+func (w *WebAuthn) BeginRegistration(ctx context.Context, userID, sessionID uuid.UUID, req *ReauthenticateRequest) (*WebAuthnRegistrationOptions, error) {
+	var user models.User
+	if err := w.service.db.WithContext(ctx).
+		Preload("Roles").
+		Where("id = ? AND status = ?", userID, models.UserStatusActive).
+		First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrUserNotFound(userID.String())
+		}
+		return nil, errors.ErrDatabaseError
+	}
+	if err := w.service.reauthenticate(ctx, &user, sessionID, req); err != nil {
+		return nil, err
+	}
+
+	existing, err := w.credentials(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make([]string, len(user.Roles))
+	for i, role := range user.Roles {
+		roles[i] = role.Code
+	}
+	attestation := w.config.GetWebAuthnAttestation(roles)
+	userVerification := w.config.WebAuthn.UserVerification
+
+	challenge, err := w.createChallenge(ctx, &user.ID, models.WebAuthnCeremonyRegistration, userVerification, attestation)
+	if err != nil {
+		return nil, err
+	}
+
+	params := make([]webauthn.CredentialParameter, len(webauthn.SupportedAlgorithms))
+	for i, alg := range webauthn.SupportedAlgorithms {
+		params[i] = webauthn.CredentialParameter{Type: "public-key", Alg: alg}
+	}
+
+	return &WebAuthnRegistrationOptions{
+		CeremonyID: challenge.ID,
+		PublicKey: &webauthn.CreationOptions{
+			RP: webauthn.RelyingPartyEntity{ID: w.rp.ID, Name: w.rp.Name},
+			User: webauthn.UserEntity{
+				ID:          user.ID[:],
+				Name:        user.Email,
+				DisplayName: strings.TrimSpace(user.FirstName + " " + user.LastName),
+			},
+			Challenge:          challenge.Challenge,
+			PubKeyCredParams:   params,
+			Timeout:            w.timeout.Milliseconds(),
+			ExcludeCredentials: descriptors(existing),
+			AuthenticatorSelection: webauthn.AuthenticatorSelection{
+				ResidentKey:      "preferred",
+				UserVerification: userVerification,
+			},
+			Attestation: attestation,
+		},
+	}, nil
+}
+
+// FinishRegistration verifies the authenticator's response and stores the new passkey
+func (w *WebAuthn) FinishRegistration(ctx context.Context, userID uuid.UUID, req *WebAuthnRegistrationRequest, ipAddress, userAgent string) (*models.WebAuthnCredential, error) {
+	challenge, err := w.claimChallenge(ctx, req.CeremonyID, models.WebAuthnCeremonyRegistration, &userID)
+	if err != nil {
+		return nil, err
+	}
+
+	verified, err := w.rp.VerifyRegistration(&req.Credential, challenge.Challenge, webauthn.RegistrationPolicy{
+		UserVerification: challenge.UserVerification,
+		Attestation:      challenge.Attestation,
+	})
+	if err != nil {
+		return nil, errors.ErrWebAuthnRegistrationFailed().WithDetails(err.Error())
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+	credential := models.WebAuthnCredential{
+		UserID:            userID,
+		Name:              name,
+		CredentialID:      verified.ID,
+		PublicKey:         verified.PublicKey,
+		Algorithm:         verified.Algorithm,
+		SignCount:         int64(verified.SignCount),
+		AAGUID:            formatAAGUID(verified.AAGUID),
+		AttestationFormat: verified.AttestationFormat,
+		AttestationType:   verified.AttestationType,
+		Transports:        models.StringList(verified.Transports),
+		UserVerified:      verified.UserVerified,
+		BackupEligible:    verified.BackupEligible,
+	}
+
+	var count int64
+	if err := w.service.db.WithContext(ctx).
+		Model(&models.WebAuthnCredential{}).
+		Where("credential_id = ?", verified.ID).
+		Count(&count).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+	if count > 0 {
+		return nil, errors.ErrWebAuthnRegistrationFailed().WithDetails("Passkey is already registered")
+	}
+	if err := w.service.db.WithContext(ctx).Create(&credential).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"aaguid":           credential.AAGUID,
+		"attestation_type": credential.AttestationType,
+		"user_verified":    credential.UserVerified,
+	})
+	w.service.audit.Record(ctx, &models.AuditLog{
+		UserID:      &userID,
+		Action:      models.AuditActionWebAuthnRegister,
+		Resource:    "webauthn_credential",
+		ResourceID:  &credential.ID,
+		Description: fmt.Sprintf("Passkey %q registered", credential.Name),
+		IPAddress:   ipAddress,
+		UserAgent:   userAgent,
+		Metadata:    string(metadata),
+	})
+
+	return &credential, nil
+}
+
+// ListCredentials lists the passkeys of a user
+func (w *WebAuthn) ListCredentials(ctx context.Context, userID uuid.UUID) ([]models.WebAuthnCredential, error) {
+	return w.credentials(ctx, userID)
+}
+
+// DeleteCredential removes a passkey of a user
+func (w *WebAuthn) DeleteCredential(ctx context.Context, userID, credentialID uuid.UUID, ipAddress, userAgent string) error {
+	result := w.service.db.WithContext(ctx).
+		Where("id = ? AND user_id = ?", credentialID, userID).
+		Delete(&models.WebAuthnCredential{})
+	if result.Error != nil {
+		return errors.ErrDatabaseError
+	}
+	if result.RowsAffected == 0 {
+		return errors.ErrWebAuthnCredentialNotFound(credentialID.String())
+	}
+
+	w.service.audit.Record(ctx, &models.AuditLog{
+		UserID:      &userID,
+		Action:      models.AuditActionWebAuthnRemove,
+		Resource:    "webauthn_credential",
+		ResourceID:  &credentialID,
+		Description: "Passkey removed",
+		IPAddress:   ipAddress,
+		UserAgent:   userAgent,
+	})
+	return nil
+}
+
+// BeginSecondFactor issues the options for presenting a passkey after the
+// password was accepted by Login
+func (w *WebAuthn) BeginSecondFactor(ctx context.Context, mfaToken string) (*WebAuthnLoginOptions, error) {
+	claims, err := w.service.keys.ValidateToken(mfaToken, jwt.TokenTypeMFA)
+	if err != nil {
+		return nil, errors.ErrTokenInvalid
+	}
+
+	existing, err := w.credentials(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) == 0 {
+		return nil, errors.ErrTokenInvalid
+	}
+
+	return w.beginLogin(ctx, &claims.UserID, models.WebAuthnCeremonySecondFactor, w.config.WebAuthn.UserVerification, descriptors(existing))
+}
+
+// FinishSecondFactor verifies the passkey presented after the password and
+// signs the user in
+func (w *WebAuthn) FinishSecondFactor(ctx context.Context, req *WebAuthnLoginRequest, ipAddress, userAgent string) (*LoginResponse, error) {
+	claims, err := w.service.keys.ValidateToken(req.MFAToken, jwt.TokenTypeMFA)
+	if err != nil {
+		return nil, errors.ErrTokenInvalid
+	}
+
+	challenge, err := w.claimChallenge(ctx, req.CeremonyID, models.WebAuthnCeremonySecondFactor, &claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := w.loginUser(ctx, claims.UserID, ipAddress, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.verifyAssertion(ctx, user, &req.Credential, challenge, ipAddress, userAgent); err != nil {
+		return nil, err
+	}
+
+	return w.service.finishLogin(ctx, user, ipAddress, userAgent)
+}
+
+// BeginPasswordless issues the options for signing in with a passkey alone.
+// Any discoverable passkey registered for this relying party may answer.
+func (w *WebAuthn) BeginPasswordless(ctx context.Context) (*WebAuthnLoginOptions, error) {
+	if !w.passwordless {
+		return nil, errors.ErrWebAuthnDisabled()
+	}
+	return w.beginLogin(ctx, nil, models.WebAuthnCeremonyPasswordless, webauthn.UserVerificationRequired, nil)
+}
+
+// FinishPasswordless verifies a passkey login. The passkey must verify the
+// user (PIN or biometric) since it is the only factor; a password that has
+// expired does not block it because no password is used.
+func (w *WebAuthn) FinishPasswordless(ctx context.Context, req *WebAuthnLoginRequest, ipAddress, userAgent string) (*LoginResponse, error) {
+	if !w.passwordless {
+		return nil, errors.ErrWebAuthnDisabled()
+	}
+
+	challenge, err := w.claimChallenge(ctx, req.CeremonyID, models.WebAuthnCeremonyPasswordless, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var credential models.WebAuthnCredential
+	if err := w.service.db.WithContext(ctx).
+		Where("credential_id = ?", []byte(req.Credential.RawID)).
+		First(&credential).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrWebAuthnVerificationFailed()
+		}
+		return nil, errors.ErrDatabaseError
+	}
+
+	// A discoverable credential names its account; it must be the one the passkey was registered to
+	if len(req.Credential.Response.UserHandle) > 0 && string(req.Credential.Response.UserHandle) != string(credential.UserID[:]) {
+		return nil, errors.ErrWebAuthnVerificationFailed()
+	}
+
+	user, err := w.loginUser(ctx, credential.UserID, ipAddress, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.verifyAssertion(ctx, user, &req.Credential, challenge, ipAddress, userAgent); err != nil {
+		return nil, err
+	}
+
+	w.service.resetFailedLogins(ctx, user)
+	resp, err := w.service.startSession(ctx, user, ipAddress, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	w.service.recordLogin(ctx, user, ipAddress, userAgent)
+
+	return resp, nil
+}
+
+// beginLogin stores a login challenge and returns its request options
+func (w *WebAuthn) beginLogin(ctx context.Context, userID *uuid.UUID, ceremony, userVerification string, allowed []webauthn.CredentialDescriptor) (*WebAuthnLoginOptions, error) {
+	challenge, err := w.createChallenge(ctx, userID, ceremony, userVerification, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebAuthnLoginOptions{
+		CeremonyID: challenge.ID,
+		PublicKey: &webauthn.RequestOptions{
+			Challenge:        challenge.Challenge,
+			Timeout:          w.timeout.Milliseconds(),
+			RPID:             w.rp.ID,
+			AllowCredentials: allowed,
+			UserVerification: userVerification,
+		},
+	}, nil
+}
+
+// loginUser loads a user signing in with a passkey. Locked and inactive
+// accounts are refused like in a password login.
+func (w *WebAuthn) loginUser(ctx context.Context, userID uuid.UUID, ipAddress, userAgent string) (*models.User, error) {
+	var user models.User
+	if err := w.service.db.WithContext(ctx).
+		Preload("Roles.Permissions").
+		Where("id = ?", userID).
+		First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrWebAuthnVerificationFailed()
+		}
+		return nil, errors.ErrDatabaseError
+	}
+
+	if w.service.isLocked(&user, time.Now()) || user.Status != models.UserStatusActive {
+		w.service.recordLoginFailure(ctx, &user.ID, user.Email, "account unavailable for passkey login", ipAddress, userAgent)
+		return nil, errors.ErrInvalidCredentials
+	}
+	return &user, nil
+}
+
+// verifyAssertion checks a passkey assertion against the user's registered
+// credential and advances its signature counter. Failures count towards the
+// account lockout like wrong passwords.
+func (w *WebAuthn) verifyAssertion(ctx context.Context, user *models.User, resp *webauthn.CredentialAssertionResponse, challenge *models.WebAuthnChallenge, ipAddress, userAgent string) error {
+	var credential models.WebAuthnCredential
+	if err := w.service.db.WithContext(ctx).
+		Where("credential_id = ? AND user_id = ?", []byte(resp.RawID), user.ID).
+		First(&credential).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			w.service.registerFailedLogin(ctx, user, "unknown passkey", ipAddress, userAgent)
+			return errors.ErrWebAuthnVerificationFailed()
+		}
+		return errors.ErrDatabaseError
+	}
+
+	assertion, err := w.rp.VerifyAssertion(resp, challenge.Challenge, credential.PublicKey, uint32(credential.SignCount), challenge.UserVerification)
+	if err != nil {
+		reason := "invalid passkey assertion"
+		if err == webauthn.ErrSignCount {
+			reason = "passkey signature counter did not increase; the authenticator may be cloned"
+			logger.WithFields(map[string]interface{}{
+				"user_id":       user.ID,
+				"credential_id": credential.ID,
+			}).Warn("Possible cloned WebAuthn authenticator")
+		}
+		w.service.registerFailedLogin(ctx, user, reason, ipAddress, userAgent)
+		return errors.ErrWebAuthnVerificationFailed()
+	}
+
+	now := time.Now()
+	w.service.db.WithContext(ctx).
+		Model(&models.WebAuthnCredential{}).
+		Where("id = ?", credential.ID).
+		Updates(map[string]interface{}{
+			"sign_count":   int64(assertion.SignCount),
+			"last_used_at": now,
+		})
+	return nil
+}
+
+// createChallenge stores a new single-use ceremony challenge
+func (w *WebAuthn) createChallenge(ctx context.Context, userID *uuid.UUID, ceremony, userVerification, attestation string) (*models.WebAuthnChallenge, error) {
+	random, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, errors.ErrInternal
+	}
+
+	now := time.Now()
+	db := w.service.db.WithContext(ctx)
+	db.Unscoped().Where("expires_at < ?", now).Delete(&models.WebAuthnChallenge{})
+
+	challenge := models.WebAuthnChallenge{
+		UserID:           userID,
+		Ceremony:         ceremony,
+		Challenge:        random,
+		UserVerification: userVerification,
+		Attestation:      attestation,
+		ExpiresAt:        now.Add(w.timeout),
+	}
+	if err := db.Create(&challenge).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+	return &challenge, nil
+}
+
+// claimChallenge marks a ceremony challenge as used and returns it. Each
+// challenge can be claimed once, by the user it was issued to.
+func (w *WebAuthn) claimChallenge(ctx context.Context, id uuid.UUID, ceremony string, userID *uuid.UUID) (*models.WebAuthnChallenge, error) {
+	now := time.Now()
+	db := w.service.db.WithContext(ctx)
+
+	query := db.Model(&models.WebAuthnChallenge{}).
+		Where("id = ? AND ceremony = ? AND used_at IS NULL AND expires_at > ?", id, ceremony, now)
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	}
+	result := query.Update("used_at", now)
+	if result.Error != nil {
+		return nil, errors.ErrDatabaseError
+	}
+	if result.RowsAffected != 1 {
+		return nil, errors.ErrWebAuthnCeremonyInvalid()
+	}
+
+	var challenge models.WebAuthnChallenge
+	if err := db.Where("id = ?", id).First(&challenge).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+	return &challenge, nil
+}
+
+// credentials lists the passkeys of a user, most recently used first
+func (w *WebAuthn) credentials(ctx context.Context, userID uuid.UUID) ([]models.WebAuthnCredential, error) {
+	var credentials []models.WebAuthnCredential
+	if err := w.service.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("last_used_at DESC NULLS LAST, created_at DESC").
+		Find(&credentials).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+	return credentials, nil
+}
+
+// descriptors lists registered credentials for allow and exclude lists
+func descriptors(credentials []models.WebAuthnCredential) []webauthn.CredentialDescriptor {
+	list := make([]webauthn.CredentialDescriptor, len(credentials))
+	for i, credential := range credentials {
+		list[i] = webauthn.CredentialDescriptor{
+			Type:       "public-key",
+			ID:         credential.CredentialID,
+			Transports: credential.Transports,
+		}
+	}
+	return list
+}
+
+// formatAAGUID renders an authenticator model ID in UUID form
+func formatAAGUID(aaguid []byte) string {
+	id, err := uuid.FromBytes(aaguid)
+	if err != nil {
+		return ""
+	}
+	return id.String()
+}
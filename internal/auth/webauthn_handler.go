@@ -0,0 +1,291 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/errors"
+)
+
+// WebAuthnHandler handles passkey HTTP requests. A nil WebAuthn service
+// means passkeys are disabled and every endpoint reports so.
+type WebAuthnHandler struct {
+	webauthn *WebAuthn
+}
+
+// NewWebAuthnHandler creates a new WebAuthn handler
+func NewWebAuthnHandler(webauthn *WebAuthn) *WebAuthnHandler {
+	return &WebAuthnHandler{webauthn: webauthn}
+}
+
+// enabled reports the disabled error when passkeys are turned off
+func (h *WebAuthnHandler) enabled(c *gin.Context) bool {
+	if h.webauthn == nil {
+		appErr := errors.ErrWebAuthnDisabled()
+		c.JSON(appErr.StatusCode, appErr)
+		return false
+	}
+	return true
+}
+
+// BeginRegistration godoc
+// @Summary Start passkey registration
+// @Description Issue the options for registering a new passkey with navigator.credentials.create() after confirming the current password or MFA code
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body ReauthenticateRequest true "Current password or MFA code"
+// @Success 200 {object} WebAuthnRegistrationOptions
+// @Failure 400 {object} errors.AppError
+// @Failure 401 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Router /api/v1/otentikasi/webauthn/daftar/mulai [post]
+func (h *WebAuthnHandler) BeginRegistration(c *gin.Context) {
+	if !h.enabled(c) {
+		return
+	}
+	var req ReauthenticateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails(err.Error()))
+		return
+	}
+	userIDValue, _ := c.Get("user_id")
+	sessionIDValue, _ := c.Get("session_id")
+	sessionID, _ := sessionIDValue.(uuid.UUID)
+
+	options, err := h.webauthn.BeginRegistration(c.Request.Context(), userIDValue.(uuid.UUID), sessionID, &req)
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, options)
+}
+
+// FinishRegistration godoc
+// @Summary Register passkey
+// @Description Verify the authenticator's response and store the new passkey
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body WebAuthnRegistrationRequest true "Ceremony ID and credential"
+// @Success 201 {object} models.WebAuthnCredential
+// @Failure 400 {object} errors.AppError
+// @Failure 401 {object} errors.AppError
+// @Router /api/v1/otentikasi/webauthn/daftar [post]
+func (h *WebAuthnHandler) FinishRegistration(c *gin.Context) {
+	if !h.enabled(c) {
+		return
+	}
+	var req WebAuthnRegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails(err.Error()))
+		return
+	}
+	userIDValue, _ := c.Get("user_id")
+
+	credential, err := h.webauthn.FinishRegistration(c.Request.Context(), userIDValue.(uuid.UUID), &req, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, credential)
+}
+
+// ListCredentials godoc
+// @Summary List passkeys
+// @Description List the passkeys registered by the current user
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} errors.AppError
+// @Router /api/v1/otentikasi/webauthn/kredensial [get]
+func (h *WebAuthnHandler) ListCredentials(c *gin.Context) {
+	if !h.enabled(c) {
+		return
+	}
+	userIDValue, _ := c.Get("user_id")
+
+	credentials, err := h.webauthn.ListCredentials(c.Request.Context(), userIDValue.(uuid.UUID))
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": credentials})
+}
+
+// DeleteCredential godoc
+// @Summary Remove passkey
+// @Description Remove a passkey of the current user
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Passkey ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/otentikasi/webauthn/kredensial/{id} [delete]
+func (h *WebAuthnHandler) DeleteCredential(c *gin.Context) {
+	if !h.enabled(c) {
+		return
+	}
+	credentialID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails("Invalid passkey ID"))
+		return
+	}
+	userIDValue, _ := c.Get("user_id")
+
+	if err := h.webauthn.DeleteCredential(c.Request.Context(), userIDValue.(uuid.UUID), credentialID, c.ClientIP(), c.Request.UserAgent()); err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Passkey removed successfully"})
+}
+
+// BeginSecondFactor godoc
+// @Summary Start passkey verification
+// @Description Issue the options for presenting a passkey after the password, using the MFA token returned by login
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body WebAuthnSecondFactorBeginRequest true "MFA token"
+// @Success 200 {object} WebAuthnLoginOptions
+// @Failure 401 {object} errors.AppError
+// @Router /api/v1/otentikasi/webauthn/verifikasi/mulai [post]
+func (h *WebAuthnHandler) BeginSecondFactor(c *gin.Context) {
+	if !h.enabled(c) {
+		return
+	}
+	var req WebAuthnSecondFactorBeginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails(err.Error()))
+		return
+	}
+
+	options, err := h.webauthn.BeginSecondFactor(c.Request.Context(), req.MFAToken)
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, options)
+}
+
+// FinishSecondFactor godoc
+// @Summary Verify passkey
+// @Description Verify the passkey presented after the password and sign in
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body WebAuthnLoginRequest true "MFA token, ceremony ID and credential"
+// @Success 200 {object} LoginResponse
+// @Failure 401 {object} errors.AppError
+// @Router /api/v1/otentikasi/webauthn/verifikasi [post]
+func (h *WebAuthnHandler) FinishSecondFactor(c *gin.Context) {
+	if !h.enabled(c) {
+		return
+	}
+	var req WebAuthnLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails(err.Error()))
+		return
+	}
+
+	resp, err := h.webauthn.FinishSecondFactor(c.Request.Context(), &req, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// BeginPasswordless godoc
+// @Summary Start passkey login
+// @Description Issue the options for signing in with a passkey alone
+// @Tags auth
+// @Produce json
+// @Success 200 {object} WebAuthnLoginOptions
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/otentikasi/webauthn/masuk/mulai [post]
+func (h *WebAuthnHandler) BeginPasswordless(c *gin.Context) {
+	if !h.enabled(c) {
+		return
+	}
+
+	options, err := h.webauthn.BeginPasswordless(c.Request.Context())
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, options)
+}
+
+// FinishPasswordless godoc
+// @Summary Passkey login
+// @Description Verify a passkey and sign in without a password
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body WebAuthnLoginRequest true "Ceremony ID and credential"
+// @Success 200 {object} LoginResponse
+// @Failure 401 {object} errors.AppError
+// @Router /api/v1/otentikasi/webauthn/masuk [post]
+func (h *WebAuthnHandler) FinishPasswordless(c *gin.Context) {
+	if !h.enabled(c) {
+		return
+	}
+	var req WebAuthnLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails(err.Error()))
+		return
+	}
+
+	resp, err := h.webauthn.FinishPasswordless(c.Request.Context(), &req, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -4,24 +4,42 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// Session limit policies applied when a login would exceed the concurrent session limit
+const (
+	SessionLimitEvictOldest = "evict_oldest"
+	SessionLimitReject      = "reject"
+)
+
+// MinAuditLogRetentionYears is the retention PMK 24/2022 requires for medical
+// records, which the audit trail of those records follows
+const MinAuditLogRetentionYears = 25
+
 // Config holds all application configuration
 type Config struct {
-	App      AppConfig
-	Database DatabaseConfig
-	JWT      JWTConfig
-	Redis    RedisConfig
-	NATS     NATSConfig
-	CORS     CORSConfig
-	Security SecurityConfig
-	Upload   UploadConfig
-	Email    EmailConfig
-	External ExternalConfig
-	FHIR     FHIRConfig
+	App       AppConfig
+	Database  DatabaseConfig
+	JWT       JWTConfig
+	Redis     RedisConfig
+	NATS      NATSConfig
+	CORS      CORSConfig
+	Security  SecurityConfig
+	Keys      KeyConfig
+	SSO       SSOConfig
+	WebAuthn  WebAuthnConfig
+	Audit     AuditConfig
+	Detector  DetectorConfig
+	MPI       MPIConfig
+	Numbering NumberingConfig
+	Upload    UploadConfig
+	Email     EmailConfig
+	External  ExternalConfig
+	FHIR      FHIRConfig
 }
 
 // AppConfig holds application-level configuration
@@ -52,6 +70,9 @@ type JWTConfig struct {
 	Secret                string
 	ExpirationHours       int
 	RefreshExpirationHours int
+	SigningMethod          string // HS256, RS256 or EdDSA
+	KeysDir                string // Directory of <kid>.pem files for RS256/EdDSA
+	ActiveKeyID            string
 }
 
 // RedisConfig holds Redis configuration
@@ -77,12 +98,156 @@ type CORSConfig struct {
 
 // SecurityConfig holds security configuration
 type SecurityConfig struct {
-	EncryptionKey          string
-	MFAIssuer              string
-	SessionTimeoutMinutes  int
-	DataEncryptionEnabled  bool
-	AuditLogRetentionYears int
-	RateLimitPerMinute     int
+	EncryptionKey             string
+	BlindIndexKey             string // HMAC key of patient lookup indexes; derived from EncryptionKey when empty
+	MFAIssuer                 string
+	SessionTimeoutMinutes     int      // Inactivity after which a session is signed out; 0 disables the timeout
+	MaxConcurrentSessions     int      // Live sessions per user; 0 means unlimited
+	RoleMaxSessions           []string // role=limit overrides of MaxConcurrentSessions
+	SessionLimitPolicy        string   // evict_oldest or reject when a login would exceed the limit
+	SessionCacheTTLSeconds    int
+	PermissionCacheTTLSeconds int
+	LockoutThreshold          int // Failed logins before a temporary lockout
+	LockoutDurationMinutes    int
+	PermanentLockoutThreshold int // Failed logins before the account is locked until an admin unlocks it
+	PasswordMinLength         int
+	PasswordMinClasses        int // Distinct character classes (lower, upper, digit, symbol)
+	PasswordHistoryCount      int
+	PasswordExpiryDays        int
+	PasswordBlocklistFile     string
+	PasswordResetTokenMinutes int
+	CareRelationshipRoles     []string // Roles that may only open records of patients in their care
+	CareAccessExemptRoles     []string // Roles never restricted by care relationships
+	CareAppointmentWindowDays int      // How far ahead an appointment grants access
+	BreakGlassDurationMinutes int      // How long an emergency override stays open
+	APIKeyDefaultExpiryDays   int      // Expiry of new API keys when none is given; 0 means no expiry
+	DataEncryptionEnabled     bool
+	AuditLogRetentionYears    int
+	RateLimitPerMinute        int
+}
+
+// Key-encryption key providers
+const (
+	KeyProviderEnv  = "env"  // KEKs in ENCRYPTION_KEK_<ID> variables
+	KeyProviderFile = "file" // KEKs in <id>.key files under KEY_FILE_DIR
+)
+
+// KeyConfig holds envelope encryption configuration. Patient data is
+// encrypted with data keys stored in data_keys, wrapped by a key-encryption
+// key (KEK). ENCRYPTION_KEY is always available as the KEK "default".
+type KeyConfig struct {
+	Provider                 string
+	ActiveKEK                string // KEK new and rewrapped data keys are wrapped with
+	FileDir                  string
+	ReencryptEnabled         bool // Roll data to the latest data key and KEK in the background
+	ReencryptIntervalMinutes int
+	ReencryptBatchSize       int
+	RefreshSeconds           int // How long an instance keeps using its active data key version before reloading
+}
+
+// SSOConfig holds external identity provider configuration
+type SSOConfig struct {
+	OIDCEnabled            bool
+	OIDCIssuerURL          string
+	OIDCClientID           string
+	OIDCClientSecret       string
+	OIDCRedirectURL        string
+	OIDCScopes             []string
+	OIDCGroupsClaim        string   // ID token claim listing the user's groups
+	OIDCMFAACRValues       []string // acr values that mean the provider asked for a second factor
+	LDAPEnabled            bool
+	LDAPURL                string // ldap:// or ldaps://
+	LDAPBindDN             string // Service account used to look users up; empty for anonymous search
+	LDAPBindPassword       string
+	LDAPBaseDN             string
+	LDAPUserFilter         string // {username} is replaced by the escaped login name
+	LDAPGroupAttribute     string
+	LDAPEmailAttribute     string
+	LDAPFirstNameAttribute string
+	LDAPLastNameAttribute  string
+	JITProvisioning        bool   // Create unknown users on first login
+	LinkByEmail            bool   // Link a first login to the existing user with the same verified email
+	SyncRoles              bool   // Replace roles with the mapped groups on every login
+	GroupRoleMap           string // group=role pairs separated by ';'
+	LoginStateMinutes      int    // How long an OIDC login may take
+}
+
+// WebAuthnConfig holds FIDO2/WebAuthn passkey configuration
+type WebAuthnConfig struct {
+	Enabled              bool
+	RPID                 string   // Domain passkeys are bound to, e.g. emr.hospital.example
+	RPName               string   // Name shown by the authenticator
+	Origins              []string // Web origins allowed to use passkeys
+	TimeoutSeconds       int      // How long a registration or login ceremony may take
+	UserVerification     string   // required, preferred or discouraged when used as a second factor
+	Attestation          string   // Default attestation conveyance: none, indirect or direct
+	RoleAttestation      []string // role=conveyance overrides; the strictest applicable role wins
+	AttestationRootsFile string   // PEM bundle of trusted attestation roots; empty trusts any certificate
+	PasswordlessEnabled  bool     // Allow signing in with a passkey alone
+}
+
+// AuditConfig holds audit trail writer configuration
+type AuditConfig struct {
+	QueueSize       int    // Entries buffered in memory; overflow spills to disk
+	BatchSize       int    // Entries written per insert
+	FlushIntervalMs int    // Longest an entry waits in the queue before being written
+	SpillDir        string // Holds entries while the database is unavailable
+	RetrySeconds    int    // How often spilled entries are retried
+	ChainEnabled    bool   // Seal entries into an HMAC hash chain
+	HMACKey         string // Dedicated key for the hash chain and its checkpoints
+
+	RetentionEnabled       bool   // Run the partition and archival job in the API
+	RetentionIntervalHours int    // How often the job runs
+	OnlineMonths           int    // Months kept in the database before a partition is archived
+	PartitionMonthsAhead   int    // Monthly partitions created ahead of time
+	ArchiveDir             string // Compressed, checksummed archives of old partitions
+}
+
+// Suspicious access detector modes
+const (
+	DetectorModeOff       = "off"
+	DetectorModeInProcess = "inprocess" // The API watches its own audit entries
+	DetectorModeNATS      = "nats"      // The API publishes audit entries for cmd/auditdetector
+)
+
+// DetectorConfig holds suspicious access detection configuration
+type DetectorConfig struct {
+	Mode                 string
+	Rules                []string // bulk_read, off_shift, department, family_record, failed_logins
+	QueueSize            int      // Entries buffered for evaluation; overflow is dropped with a warning
+	BulkReadPatients     int      // Distinct patients read within BulkReadMinutes that raise an alert
+	BulkReadMinutes      int
+	FailedLogins         int // Failed logins for one account or address within FailedLoginMinutes that raise an alert
+	FailedLoginMinutes   int
+	ShiftTimezone        string   // Time zone of users' shift hours
+	DefaultShiftStart    string   // HH:MM applied to users without a shift; empty to skip them
+	DefaultShiftEnd      string   // HH:MM
+	ExemptRoles          []string // Roles never flagged for shift or department
+	AlertCooldownMinutes int      // Quiet period before the same rule alerts on the same user again
+}
+
+// MPIConfig holds master patient index duplicate detection configuration.
+// Each field compared contributes its weight times its similarity; the score
+// is that sum over the weights of the fields present on both records.
+type MPIConfig struct {
+	Enabled           bool // Warn before creating a patient that matches an existing record
+	WeightName        float64
+	WeightDateOfBirth float64
+	WeightGender      float64
+	WeightNationalID  float64 // SSN / NIK
+	WeightPhone       float64
+	WeightAddress     float64
+	ReviewThreshold   float64 // Score from which two records are a possible duplicate
+	ProbableThreshold float64 // Score from which they are a probable duplicate
+	MaxCandidates     int     // Existing records scored against each patient
+	UnmergeGraceDays  int     // Days during which a patient merge can be undone
+}
+
+// NumberingConfig holds MRN and document number generation configuration.
+// Formats are stored per facility and year in number_formats.
+type NumberingConfig struct {
+	Facility string // Facility code whose formats this instance uses
+	Timezone string // Time zone of the date segment and of the year a format applies to
 }
 
 // UploadConfig holds file upload configuration
@@ -93,11 +258,12 @@ type UploadConfig struct {
 
 // EmailConfig holds email configuration
 type EmailConfig struct {
-	SMTPHost     string
-	SMTPPort     string
-	SMTPUser     string
-	SMTPPassword string
-	EmailFrom    string
+	SMTPHost         string
+	SMTPPort         string
+	SMTPUser         string
+	SMTPPassword     string
+	EmailFrom        string
+	PasswordResetURL string // Link sent in reset emails; the token is appended as ?token=
 }
 
 // ExternalConfig holds external system configuration
@@ -144,6 +310,9 @@ func Load() (*Config, error) {
 			Secret:                 getEnv("JWT_SECRET", "your_jwt_secret_key"),
 			ExpirationHours:        getEnvAsInt("JWT_EXPIRATION_HOURS", 24),
 			RefreshExpirationHours: getEnvAsInt("JWT_REFRESH_EXPIRATION_HOURS", 168),
+			SigningMethod:          getEnv("JWT_SIGNING_METHOD", "HS256"),
+			KeysDir:                getEnv("JWT_KEYS_DIR", "./keys/jwt"),
+			ActiveKeyID:            getEnv("JWT_ACTIVE_KEY_ID", "default"),
 		},
 		Redis: RedisConfig{
 			Host:     getEnv("REDIS_HOST", "localhost"),
@@ -161,23 +330,136 @@ func Load() (*Config, error) {
 			AllowedHeaders: getEnvAsSlice("CORS_ALLOWED_HEADERS", []string{"Origin", "Content-Type", "Accept", "Authorization"}),
 		},
 		Security: SecurityConfig{
-			EncryptionKey:          getEnv("ENCRYPTION_KEY", ""),
-			MFAIssuer:              getEnv("MFA_ISSUER", "Hospital-EMR"),
-			SessionTimeoutMinutes:  getEnvAsInt("SESSION_TIMEOUT_MINUTES", 30),
-			DataEncryptionEnabled:  getEnvAsBool("DATA_ENCRYPTION_ENABLED", true),
-			AuditLogRetentionYears: getEnvAsInt("AUDIT_LOG_RETENTION_YEARS", 25),
-			RateLimitPerMinute:     getEnvAsInt("RATE_LIMIT_REQUESTS_PER_MINUTE", 100),
+			EncryptionKey:             getEnv("ENCRYPTION_KEY", ""),
+			BlindIndexKey:             getEnv("BLIND_INDEX_KEY", ""),
+			MFAIssuer:                 getEnv("MFA_ISSUER", "Hospital-EMR"),
+			SessionTimeoutMinutes:     getEnvAsInt("SESSION_TIMEOUT_MINUTES", 30),
+			MaxConcurrentSessions:     getEnvAsInt("MAX_CONCURRENT_SESSIONS", 5),
+			RoleMaxSessions:           getEnvAsSlice("ROLE_MAX_CONCURRENT_SESSIONS", nil),
+			SessionLimitPolicy:        getEnv("SESSION_LIMIT_POLICY", SessionLimitEvictOldest),
+			SessionCacheTTLSeconds:    getEnvAsInt("SESSION_CACHE_TTL_SECONDS", 30),
+			PermissionCacheTTLSeconds: getEnvAsInt("PERMISSION_CACHE_TTL_SECONDS", 60),
+			LockoutThreshold:          getEnvAsInt("LOCKOUT_THRESHOLD", 5),
+			LockoutDurationMinutes:    getEnvAsInt("LOCKOUT_DURATION_MINUTES", 15),
+			PermanentLockoutThreshold: getEnvAsInt("LOCKOUT_PERMANENT_THRESHOLD", 15),
+			PasswordMinLength:         getEnvAsInt("PASSWORD_MIN_LENGTH", 12),
+			PasswordMinClasses:        getEnvAsInt("PASSWORD_MIN_CLASSES", 3),
+			PasswordHistoryCount:      getEnvAsInt("PASSWORD_HISTORY_COUNT", 5),
+			PasswordExpiryDays:        getEnvAsInt("PASSWORD_EXPIRY_DAYS", 90),
+			PasswordBlocklistFile:     getEnv("PASSWORD_BLOCKLIST_FILE", ""),
+			PasswordResetTokenMinutes: getEnvAsInt("PASSWORD_RESET_TOKEN_MINUTES", 30),
+			CareRelationshipRoles:     getEnvAsSlice("CARE_RELATIONSHIP_ROLES", []string{"doctor", "nurse"}),
+			CareAccessExemptRoles:     getEnvAsSlice("CARE_ACCESS_EXEMPT_ROLES", []string{"admin"}),
+			CareAppointmentWindowDays: getEnvAsInt("CARE_APPOINTMENT_WINDOW_DAYS", 30),
+			BreakGlassDurationMinutes: getEnvAsInt("BREAK_GLASS_DURATION_MINUTES", 60),
+			APIKeyDefaultExpiryDays:   getEnvAsInt("API_KEY_DEFAULT_EXPIRY_DAYS", 365),
+			DataEncryptionEnabled:     getEnvAsBool("DATA_ENCRYPTION_ENABLED", true),
+			AuditLogRetentionYears:    getEnvAsInt("AUDIT_LOG_RETENTION_YEARS", 25),
+			RateLimitPerMinute:        getEnvAsInt("RATE_LIMIT_REQUESTS_PER_MINUTE", 100),
+		},
+		Keys: KeyConfig{
+			Provider:                 getEnv("KEY_PROVIDER", KeyProviderEnv),
+			ActiveKEK:                getEnv("KEY_ACTIVE_KEK", "default"),
+			FileDir:                  getEnv("KEY_FILE_DIR", "./keys"),
+			ReencryptEnabled:         getEnvAsBool("KEY_REENCRYPT_ENABLED", true),
+			ReencryptIntervalMinutes: getEnvAsInt("KEY_REENCRYPT_INTERVAL_MINUTES", 60),
+			ReencryptBatchSize:       getEnvAsInt("KEY_REENCRYPT_BATCH_SIZE", 500),
+			RefreshSeconds:           getEnvAsInt("KEY_REFRESH_SECONDS", 60),
+		},
+		SSO: SSOConfig{
+			OIDCEnabled:            getEnvAsBool("OIDC_ENABLED", false),
+			OIDCIssuerURL:          getEnv("OIDC_ISSUER_URL", ""),
+			OIDCClientID:           getEnv("OIDC_CLIENT_ID", ""),
+			OIDCClientSecret:       getEnv("OIDC_CLIENT_SECRET", ""),
+			OIDCRedirectURL:        getEnv("OIDC_REDIRECT_URL", ""),
+			OIDCScopes:             getEnvAsSlice("OIDC_SCOPES", []string{"openid", "profile", "email"}),
+			OIDCGroupsClaim:        getEnv("OIDC_GROUPS_CLAIM", "groups"),
+			OIDCMFAACRValues:       getEnvAsSlice("OIDC_MFA_ACR_VALUES", nil),
+			LDAPEnabled:            getEnvAsBool("LDAP_ENABLED", false),
+			LDAPURL:                getEnv("LDAP_URL", ""),
+			LDAPBindDN:             getEnv("LDAP_BIND_DN", ""),
+			LDAPBindPassword:       getEnv("LDAP_BIND_PASSWORD", ""),
+			LDAPBaseDN:             getEnv("LDAP_BASE_DN", ""),
+			LDAPUserFilter:         getEnv("LDAP_USER_FILTER", "(&(objectClass=person)(uid={username}))"),
+			LDAPGroupAttribute:     getEnv("LDAP_GROUP_ATTRIBUTE", "memberOf"),
+			LDAPEmailAttribute:     getEnv("LDAP_EMAIL_ATTRIBUTE", "mail"),
+			LDAPFirstNameAttribute: getEnv("LDAP_FIRST_NAME_ATTRIBUTE", "givenName"),
+			LDAPLastNameAttribute:  getEnv("LDAP_LAST_NAME_ATTRIBUTE", "sn"),
+			JITProvisioning:        getEnvAsBool("SSO_JIT_PROVISIONING", false),
+			LinkByEmail:            getEnvAsBool("SSO_LINK_BY_EMAIL", true),
+			SyncRoles:              getEnvAsBool("SSO_SYNC_ROLES", false),
+			GroupRoleMap:           getEnv("SSO_GROUP_ROLE_MAP", ""),
+			LoginStateMinutes:      getEnvAsInt("SSO_LOGIN_STATE_MINUTES", 10),
+		},
+		WebAuthn: WebAuthnConfig{
+			Enabled:              getEnvAsBool("WEBAUTHN_ENABLED", false),
+			RPID:                 getEnv("WEBAUTHN_RP_ID", "localhost"),
+			RPName:               getEnv("WEBAUTHN_RP_NAME", "Hospital EMR"),
+			Origins:              getEnvAsSlice("WEBAUTHN_ORIGINS", []string{"http://localhost:3000"}),
+			TimeoutSeconds:       getEnvAsInt("WEBAUTHN_TIMEOUT_SECONDS", 120),
+			UserVerification:     getEnv("WEBAUTHN_USER_VERIFICATION", "preferred"),
+			Attestation:          getEnv("WEBAUTHN_ATTESTATION", "none"),
+			RoleAttestation:      getEnvAsSlice("WEBAUTHN_ROLE_ATTESTATION", nil),
+			AttestationRootsFile: getEnv("WEBAUTHN_ATTESTATION_ROOTS_FILE", ""),
+			PasswordlessEnabled:  getEnvAsBool("WEBAUTHN_PASSWORDLESS_ENABLED", true),
+		},
+		Audit: AuditConfig{
+			QueueSize:       getEnvAsInt("AUDIT_QUEUE_SIZE", 10000),
+			BatchSize:       getEnvAsInt("AUDIT_BATCH_SIZE", 200),
+			FlushIntervalMs: getEnvAsInt("AUDIT_FLUSH_INTERVAL_MS", 1000),
+			SpillDir:        getEnv("AUDIT_SPILL_DIR", "./data/audit-spill"),
+			RetrySeconds:    getEnvAsInt("AUDIT_RETRY_SECONDS", 30),
+			ChainEnabled:    getEnvAsBool("AUDIT_CHAIN_ENABLED", false),
+			HMACKey:         getEnv("AUDIT_HMAC_KEY", ""),
+
+			RetentionEnabled:       getEnvAsBool("AUDIT_RETENTION_ENABLED", false),
+			RetentionIntervalHours: getEnvAsInt("AUDIT_RETENTION_INTERVAL_HOURS", 24),
+			OnlineMonths:           getEnvAsInt("AUDIT_ONLINE_MONTHS", 24),
+			PartitionMonthsAhead:   getEnvAsInt("AUDIT_PARTITION_MONTHS_AHEAD", 3),
+			ArchiveDir:             getEnv("AUDIT_ARCHIVE_DIR", "./data/audit-archive"),
+		},
+		Detector: DetectorConfig{
+			Mode:                 getEnv("DETECTOR_MODE", DetectorModeInProcess),
+			Rules:                getEnvAsSlice("DETECTOR_RULES", []string{"bulk_read", "off_shift", "department", "family_record", "failed_logins"}),
+			QueueSize:            getEnvAsInt("DETECTOR_QUEUE_SIZE", 10000),
+			BulkReadPatients:     getEnvAsInt("DETECTOR_BULK_READ_PATIENTS", 30),
+			BulkReadMinutes:      getEnvAsInt("DETECTOR_BULK_READ_MINUTES", 10),
+			FailedLogins:         getEnvAsInt("DETECTOR_FAILED_LOGINS", 10),
+			FailedLoginMinutes:   getEnvAsInt("DETECTOR_FAILED_LOGIN_MINUTES", 15),
+			ShiftTimezone:        getEnv("DETECTOR_SHIFT_TIMEZONE", "Asia/Jakarta"),
+			DefaultShiftStart:    getEnv("DETECTOR_DEFAULT_SHIFT_START", ""),
+			DefaultShiftEnd:      getEnv("DETECTOR_DEFAULT_SHIFT_END", ""),
+			ExemptRoles:          getEnvAsSlice("DETECTOR_EXEMPT_ROLES", nil),
+			AlertCooldownMinutes: getEnvAsInt("DETECTOR_ALERT_COOLDOWN_MINUTES", 60),
+		},
+		MPI: MPIConfig{
+			Enabled:           getEnvAsBool("MPI_ENABLED", true),
+			WeightName:        getEnvAsFloat("MPI_WEIGHT_NAME", 0.30),
+			WeightDateOfBirth: getEnvAsFloat("MPI_WEIGHT_DATE_OF_BIRTH", 0.20),
+			WeightGender:      getEnvAsFloat("MPI_WEIGHT_GENDER", 0.05),
+			WeightNationalID:  getEnvAsFloat("MPI_WEIGHT_NATIONAL_ID", 0.25),
+			WeightPhone:       getEnvAsFloat("MPI_WEIGHT_PHONE", 0.10),
+			WeightAddress:     getEnvAsFloat("MPI_WEIGHT_ADDRESS", 0.10),
+			ReviewThreshold:   getEnvAsFloat("MPI_REVIEW_THRESHOLD", 0.75),
+			ProbableThreshold: getEnvAsFloat("MPI_PROBABLE_THRESHOLD", 0.90),
+			MaxCandidates:     getEnvAsInt("MPI_MAX_CANDIDATES", 200),
+			UnmergeGraceDays:  getEnvAsInt("MPI_UNMERGE_GRACE_DAYS", 30),
+		},
+		Numbering: NumberingConfig{
+			Facility: getEnv("NUMBERING_FACILITY", ""),
+			Timezone: getEnv("NUMBERING_TIMEZONE", "Asia/Jakarta"),
 		},
 		Upload: UploadConfig{
 			MaxSizeMB:  getEnvAsInt("MAX_UPLOAD_SIZE_MB", 50),
 			UploadPath: getEnv("UPLOAD_PATH", "./uploads"),
 		},
 		Email: EmailConfig{
-			SMTPHost:     getEnv("SMTP_HOST", "smtp.gmail.com"),
-			SMTPPort:     getEnv("SMTP_PORT", "587"),
-			SMTPUser:     getEnv("SMTP_USER", ""),
-			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
-			EmailFrom:    getEnv("EMAIL_FROM", "noreply@hospital-emr.com"),
+			SMTPHost:         getEnv("SMTP_HOST", "smtp.gmail.com"),
+			SMTPPort:         getEnv("SMTP_PORT", "587"),
+			SMTPUser:         getEnv("SMTP_USER", ""),
+			SMTPPassword:     getEnv("SMTP_PASSWORD", ""),
+			EmailFrom:        getEnv("EMAIL_FROM", "noreply@hospital-emr.com"),
+			PasswordResetURL: getEnv("PASSWORD_RESET_URL", "http://localhost:3000/atur-ulang-kata-sandi"),
 		},
 		External: ExternalConfig{
 			ERPAPIUrl: getEnv("ERP_API_URL", ""),
@@ -206,13 +488,114 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("DB_PASSWORD is required when DATABASE_URL is not set")
 	}
 
-	if c.JWT.Secret == "" || c.JWT.Secret == "your_jwt_secret_key" {
-		return fmt.Errorf("JWT_SECRET must be set to a secure value")
+	switch c.JWT.SigningMethod {
+	case "", "HS256":
+		if c.JWT.Secret == "" || c.JWT.Secret == "your_jwt_secret_key" {
+			return fmt.Errorf("JWT_SECRET must be set to a secure value")
+		}
+	case "RS256", "EdDSA":
+		if c.JWT.KeysDir == "" || c.JWT.ActiveKeyID == "" {
+			return fmt.Errorf("JWT_KEYS_DIR and JWT_ACTIVE_KEY_ID are required for %s signing", c.JWT.SigningMethod)
+		}
+	default:
+		return fmt.Errorf("unsupported JWT_SIGNING_METHOD: %s", c.JWT.SigningMethod)
 	}
 
 	if c.Security.EncryptionKey == "" && c.Security.DataEncryptionEnabled {
 		return fmt.Errorf("ENCRYPTION_KEY is required when data encryption is enabled")
 	}
+	if c.Security.DataEncryptionEnabled {
+		if len(c.Security.EncryptionKey) != 32 {
+			return fmt.Errorf("ENCRYPTION_KEY must be 32 bytes when data encryption is enabled")
+		}
+		if c.Security.BlindIndexKey != "" && len(c.Security.BlindIndexKey) < 32 {
+			return fmt.Errorf("BLIND_INDEX_KEY must be at least 32 bytes")
+		}
+		switch c.Keys.Provider {
+		case KeyProviderEnv, KeyProviderFile:
+		default:
+			return fmt.Errorf("unsupported KEY_PROVIDER: %s", c.Keys.Provider)
+		}
+		if c.Keys.ActiveKEK == "" {
+			return fmt.Errorf("KEY_ACTIVE_KEK is required when data encryption is enabled")
+		}
+		if c.Keys.ReencryptEnabled && (c.Keys.ReencryptIntervalMinutes < 1 || c.Keys.ReencryptBatchSize < 1) {
+			return fmt.Errorf("KEY_REENCRYPT_INTERVAL_MINUTES and KEY_REENCRYPT_BATCH_SIZE must be positive")
+		}
+		if c.Keys.RefreshSeconds < 1 {
+			return fmt.Errorf("KEY_REFRESH_SECONDS must be positive")
+		}
+	}
+
+	switch c.Security.SessionLimitPolicy {
+	case "", SessionLimitEvictOldest, SessionLimitReject:
+	default:
+		return fmt.Errorf("unsupported SESSION_LIMIT_POLICY: %s", c.Security.SessionLimitPolicy)
+	}
+
+	if c.SSO.OIDCEnabled && (c.SSO.OIDCIssuerURL == "" || c.SSO.OIDCClientID == "" || c.SSO.OIDCRedirectURL == "") {
+		return fmt.Errorf("OIDC_ISSUER_URL, OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required when OIDC is enabled")
+	}
+	if c.SSO.LDAPEnabled && (c.SSO.LDAPURL == "" || c.SSO.LDAPBaseDN == "") {
+		return fmt.Errorf("LDAP_URL and LDAP_BASE_DN are required when LDAP is enabled")
+	}
+
+	if c.Audit.ChainEnabled && len(c.Audit.HMACKey) < 32 {
+		return fmt.Errorf("AUDIT_HMAC_KEY of at least 32 characters is required when the audit hash chain is enabled")
+	}
+	switch c.Detector.Mode {
+	case "", DetectorModeOff:
+	case DetectorModeInProcess, DetectorModeNATS:
+		if _, err := time.LoadLocation(c.Detector.ShiftTimezone); err != nil {
+			return fmt.Errorf("invalid DETECTOR_SHIFT_TIMEZONE: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported DETECTOR_MODE: %s", c.Detector.Mode)
+	}
+	if c.MPI.Enabled {
+		weights := []float64{c.MPI.WeightName, c.MPI.WeightDateOfBirth, c.MPI.WeightGender, c.MPI.WeightNationalID, c.MPI.WeightPhone, c.MPI.WeightAddress}
+		total := 0.0
+		for _, weight := range weights {
+			if weight < 0 {
+				return fmt.Errorf("MPI_WEIGHT_* must not be negative")
+			}
+			total += weight
+		}
+		if total == 0 {
+			return fmt.Errorf("at least one MPI_WEIGHT_* must be positive when MPI matching is enabled")
+		}
+		if c.MPI.ReviewThreshold <= 0 || c.MPI.ReviewThreshold > c.MPI.ProbableThreshold || c.MPI.ProbableThreshold > 1 {
+			return fmt.Errorf("MPI thresholds must satisfy 0 < MPI_REVIEW_THRESHOLD <= MPI_PROBABLE_THRESHOLD <= 1")
+		}
+	}
+	if _, err := time.LoadLocation(c.Numbering.Timezone); err != nil {
+		return fmt.Errorf("invalid NUMBERING_TIMEZONE: %w", err)
+	}
+	if c.Audit.RetentionEnabled {
+		if c.Security.AuditLogRetentionYears < MinAuditLogRetentionYears {
+			return fmt.Errorf("AUDIT_LOG_RETENTION_YEARS must be at least %d (PMK 24/2022)", MinAuditLogRetentionYears)
+		}
+		if c.Audit.OnlineMonths < 1 || c.Audit.ArchiveDir == "" {
+			return fmt.Errorf("AUDIT_ONLINE_MONTHS and AUDIT_ARCHIVE_DIR are required when audit retention is enabled")
+		}
+	}
+
+	if c.WebAuthn.Enabled {
+		if c.WebAuthn.RPID == "" || len(c.WebAuthn.Origins) == 0 {
+			return fmt.Errorf("WEBAUTHN_RP_ID and WEBAUTHN_ORIGINS are required when WebAuthn is enabled")
+		}
+		switch c.WebAuthn.UserVerification {
+		case "required", "preferred", "discouraged":
+		default:
+			return fmt.Errorf("unsupported WEBAUTHN_USER_VERIFICATION: %s", c.WebAuthn.UserVerification)
+		}
+		for _, entry := range append([]string{c.WebAuthn.Attestation}, c.WebAuthn.RoleAttestation...) {
+			conveyance := entry[strings.LastIndex(entry, "=")+1:]
+			if _, ok := attestationStrength[strings.TrimSpace(conveyance)]; !ok {
+				return fmt.Errorf("unsupported WebAuthn attestation conveyance: %s", entry)
+			}
+		}
+	}
 
 	return nil
 }
@@ -247,6 +630,160 @@ func (c *Config) GetJWTRefreshExpiration() time.Duration {
 	return time.Duration(c.JWT.RefreshExpirationHours) * time.Hour
 }
 
+// GetSessionCacheTTL returns how long session lookups are cached in-process
+func (c *Config) GetSessionCacheTTL() time.Duration {
+	return time.Duration(c.Security.SessionCacheTTLSeconds) * time.Second
+}
+
+// GetPermissionCacheTTL returns how long resolved role permissions are cached in-process
+func (c *Config) GetPermissionCacheTTL() time.Duration {
+	return time.Duration(c.Security.PermissionCacheTTLSeconds) * time.Second
+}
+
+// GetLockoutDuration returns how long an account stays locked after too many failed logins
+func (c *Config) GetLockoutDuration() time.Duration {
+	return time.Duration(c.Security.LockoutDurationMinutes) * time.Minute
+}
+
+// GetPasswordResetTokenTTL returns how long a password reset token stays valid
+func (c *Config) GetPasswordResetTokenTTL() time.Duration {
+	return time.Duration(c.Security.PasswordResetTokenMinutes) * time.Minute
+}
+
+// GetBreakGlassDuration returns how long an emergency access override lasts
+func (c *Config) GetBreakGlassDuration() time.Duration {
+	return time.Duration(c.Security.BreakGlassDurationMinutes) * time.Minute
+}
+
+// GetSessionIdleTimeout returns how long a session may stay inactive; zero disables the timeout
+func (c *Config) GetSessionIdleTimeout() time.Duration {
+	return time.Duration(c.Security.SessionTimeoutMinutes) * time.Minute
+}
+
+// GetMaxSessions returns how many live sessions a user holding the given
+// roles may have; 0 means unlimited. Role overrides take precedence over
+// MAX_CONCURRENT_SESSIONS, and the most restrictive applicable role wins.
+func (c *Config) GetMaxSessions(roleCodes []string) int {
+	limits := make(map[string]int)
+	for _, entry := range c.Security.RoleMaxSessions {
+		i := strings.LastIndex(entry, "=")
+		if i <= 0 {
+			continue
+		}
+		if limit, err := strconv.Atoi(strings.TrimSpace(entry[i+1:])); err == nil && limit > 0 {
+			limits[strings.TrimSpace(entry[:i])] = limit
+		}
+	}
+
+	max, overridden := 0, false
+	for _, code := range roleCodes {
+		limit, ok := limits[code]
+		if !ok {
+			continue
+		}
+		if !overridden || limit < max {
+			max, overridden = limit, true
+		}
+	}
+	if overridden {
+		return max
+	}
+	return c.Security.MaxConcurrentSessions
+}
+
+// GetSSOLoginStateTTL returns how long an OIDC login may take before its state expires
+func (c *Config) GetSSOLoginStateTTL() time.Duration {
+	return time.Duration(c.SSO.LoginStateMinutes) * time.Minute
+}
+
+// GetSSOGroupRoleMap parses SSO_GROUP_ROLE_MAP into role codes keyed by
+// lower-cased group. Pairs are split on the last '=' because group DNs
+// contain '=' themselves; a group may map to several roles.
+func (c *Config) GetSSOGroupRoleMap() map[string][]string {
+	mapping := make(map[string][]string)
+	for _, pair := range strings.Split(c.SSO.GroupRoleMap, ";") {
+		i := strings.LastIndex(pair, "=")
+		if i <= 0 {
+			continue
+		}
+		group := strings.ToLower(strings.TrimSpace(pair[:i]))
+		role := strings.TrimSpace(pair[i+1:])
+		if group == "" || role == "" {
+			continue
+		}
+		mapping[group] = append(mapping[group], role)
+	}
+	return mapping
+}
+
+// GetWebAuthnTimeout returns how long a WebAuthn ceremony may take
+func (c *Config) GetWebAuthnTimeout() time.Duration {
+	return time.Duration(c.WebAuthn.TimeoutSeconds) * time.Second
+}
+
+// attestationStrength orders WebAuthn attestation conveyance preferences
+var attestationStrength = map[string]int{"none": 0, "indirect": 1, "direct": 2}
+
+// GetWebAuthnAttestation returns the attestation conveyance required when a
+// user holding the given roles registers a passkey. Role overrides take
+// precedence over WEBAUTHN_ATTESTATION, and the strictest applicable role wins.
+func (c *Config) GetWebAuthnAttestation(roleCodes []string) string {
+	overrides := make(map[string]string)
+	for _, entry := range c.WebAuthn.RoleAttestation {
+		i := strings.LastIndex(entry, "=")
+		if i <= 0 {
+			continue
+		}
+		overrides[strings.TrimSpace(entry[:i])] = strings.TrimSpace(entry[i+1:])
+	}
+
+	conveyance := ""
+	for _, code := range roleCodes {
+		override, ok := overrides[code]
+		if !ok {
+			continue
+		}
+		if conveyance == "" || attestationStrength[override] > attestationStrength[conveyance] {
+			conveyance = override
+		}
+	}
+	if conveyance != "" {
+		return conveyance
+	}
+	return c.WebAuthn.Attestation
+}
+
+// GetAuditFlushInterval returns the longest an audit entry waits before being written
+func (c *Config) GetAuditFlushInterval() time.Duration {
+	return time.Duration(c.Audit.FlushIntervalMs) * time.Millisecond
+}
+
+// GetAuditRetentionInterval returns how often the audit retention job runs
+func (c *Config) GetAuditRetentionInterval() time.Duration {
+	return time.Duration(c.Audit.RetentionIntervalHours) * time.Hour
+}
+
+// GetAuditRetryInterval returns how often spilled audit entries are retried
+func (c *Config) GetAuditRetryInterval() time.Duration {
+	return time.Duration(c.Audit.RetrySeconds) * time.Second
+}
+
+// GetUnmergeGracePeriod returns how long after a patient merge it can be undone
+func (c *Config) GetUnmergeGracePeriod() time.Duration {
+	return time.Duration(c.MPI.UnmergeGraceDays) * 24 * time.Hour
+}
+
+// GetReencryptInterval returns how often data is rolled to the latest keys
+func (c *Config) GetReencryptInterval() time.Duration {
+	return time.Duration(c.Keys.ReencryptIntervalMinutes) * time.Minute
+}
+
+// GetKeyRefreshInterval returns how often data keys are reloaded to pick up
+// versions rotated by other instances
+func (c *Config) GetKeyRefreshInterval() time.Duration {
+	return time.Duration(c.Keys.RefreshSeconds) * time.Second
+}
+
 // IsProduction returns true if running in production
 func (c *Config) IsProduction() bool {
 	return c.App.Environment == "production"
@@ -275,6 +812,15 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatVal
+		}
+	}
+	return defaultValue
+}
+
 func getEnvAsBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolVal, err := strconv.ParseBool(value); err == nil {
@@ -72,6 +72,37 @@ func TestValidate(t *testing.T) {
 		}
 	})
 
+	t.Run("Asymmetric signing without secret", func(t *testing.T) {
+		cfg := &Config{
+			Database: DatabaseConfig{
+				Password: "password",
+			},
+			JWT: JWTConfig{
+				SigningMethod: "RS256",
+				KeysDir:       "./keys/jwt",
+				ActiveKeyID:   "2025-01",
+			},
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("Unsupported signing method", func(t *testing.T) {
+		cfg := &Config{
+			Database: DatabaseConfig{
+				Password: "password",
+			},
+			JWT: JWTConfig{
+				Secret:        "secure_secret",
+				SigningMethod: "none",
+			},
+		}
+		if err := cfg.Validate(); err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+
 	t.Run("Invalid without URL or Password", func(t *testing.T) {
 		cfg := &Config{
 			Database: DatabaseConfig{},
@@ -83,4 +114,152 @@ func TestValidate(t *testing.T) {
 			t.Error("expected error, got nil")
 		}
 	})
+
+	t.Run("OIDC enabled without client", func(t *testing.T) {
+		cfg := &Config{
+			Database: DatabaseConfig{
+				Password: "password",
+			},
+			JWT: JWTConfig{
+				Secret: "secure_secret",
+			},
+			SSO: SSOConfig{
+				OIDCEnabled:   true,
+				OIDCIssuerURL: "https://idp.example",
+			},
+		}
+		if err := cfg.Validate(); err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+
+	t.Run("Audit retention below the legal minimum", func(t *testing.T) {
+		cfg := &Config{
+			Database: DatabaseConfig{
+				Password: "password",
+			},
+			JWT: JWTConfig{
+				Secret: "secure_secret",
+			},
+			Security: SecurityConfig{
+				AuditLogRetentionYears: 10,
+			},
+			Audit: AuditConfig{
+				RetentionEnabled: true,
+				OnlineMonths:     24,
+				ArchiveDir:       "./data/audit-archive",
+			},
+		}
+		if err := cfg.Validate(); err == nil {
+			t.Error("expected error, got nil")
+		}
+
+		cfg.Security.AuditLogRetentionYears = MinAuditLogRetentionYears
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("MPI review threshold above probable threshold", func(t *testing.T) {
+		cfg := &Config{
+			Database: DatabaseConfig{
+				Password: "password",
+			},
+			JWT: JWTConfig{
+				Secret: "secure_secret",
+			},
+			MPI: MPIConfig{
+				Enabled:           true,
+				WeightName:        1,
+				ReviewThreshold:   0.95,
+				ProbableThreshold: 0.9,
+			},
+		}
+		if err := cfg.Validate(); err == nil {
+			t.Error("expected error, got nil")
+		}
+
+		cfg.MPI.ReviewThreshold = 0.75
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+}
+
+func TestGetSSOGroupRoleMap(t *testing.T) {
+	cfg := &Config{
+		SSO: SSOConfig{
+			GroupRoleMap: "cn=Doctors,ou=groups,dc=hospital,dc=local=doctor; emr-nurses=nurse;emr-nurses=lab_technician;invalid;=admin",
+		},
+	}
+
+	mapping := cfg.GetSSOGroupRoleMap()
+	if roles := mapping["cn=doctors,ou=groups,dc=hospital,dc=local"]; len(roles) != 1 || roles[0] != "doctor" {
+		t.Errorf("expected DN group to map to doctor, got %v", roles)
+	}
+	if roles := mapping["emr-nurses"]; len(roles) != 2 {
+		t.Errorf("expected emr-nurses to map to two roles, got %v", roles)
+	}
+	if len(mapping) != 2 {
+		t.Errorf("expected invalid pairs to be skipped, got %v", mapping)
+	}
+}
+
+func TestGetMaxSessions(t *testing.T) {
+	cfg := &Config{
+		Security: SecurityConfig{
+			MaxConcurrentSessions: 5,
+			RoleMaxSessions:       []string{"admin=1", "doctor=3", "nurse=invalid"},
+		},
+	}
+
+	tests := []struct {
+		roles []string
+		want  int
+	}{
+		{nil, 5},
+		{[]string{"nurse"}, 5},
+		{[]string{"doctor"}, 3},
+		{[]string{"doctor", "admin"}, 1},
+	}
+	for _, tt := range tests {
+		if got := cfg.GetMaxSessions(tt.roles); got != tt.want {
+			t.Errorf("roles %v: expected %d, got %d", tt.roles, tt.want, got)
+		}
+	}
+}
+
+func TestGetWebAuthnAttestation(t *testing.T) {
+	cfg := &Config{
+		WebAuthn: WebAuthnConfig{
+			Attestation:     "none",
+			RoleAttestation: []string{"admin=direct", "pharmacist=indirect"},
+		},
+	}
+
+	tests := []struct {
+		roles []string
+		want  string
+	}{
+		{nil, "none"},
+		{[]string{"doctor"}, "none"},
+		{[]string{"pharmacist"}, "indirect"},
+		{[]string{"pharmacist", "admin"}, "direct"},
+	}
+	for _, tt := range tests {
+		if got := cfg.GetWebAuthnAttestation(tt.roles); got != tt.want {
+			t.Errorf("roles %v: expected %q, got %q", tt.roles, tt.want, got)
+		}
+	}
+
+	cfg.WebAuthn.Enabled = true
+	cfg.WebAuthn.RPID = "emr.hospital.test"
+	cfg.WebAuthn.Origins = []string{"https://emr.hospital.test"}
+	cfg.WebAuthn.UserVerification = "preferred"
+	cfg.WebAuthn.RoleAttestation = []string{"admin=enterprise"}
+	cfg.Database.Password = "secret"
+	cfg.JWT.Secret = "a-secure-secret"
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected unsupported attestation conveyance to fail validation")
+	}
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/hospital-emr/backend/internal/common/config"
 	"github.com/hospital-emr/backend/internal/common/logger"
+	"github.com/hospital-emr/backend/internal/models"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	gormlogger "gorm.io/gorm/logger"
@@ -62,6 +63,15 @@ func New(cfg *config.Config) (*DB, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
+	// Patient fields are encrypted by their column types once a cipher is set
+	if cfg.Security.DataEncryptionEnabled {
+		cipher, err := newPatientCipher(db, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up field encryption: %w", err)
+		}
+		models.SetFieldCipher(cipher)
+	}
+
 	logger.Info("Successfully connected to database")
 
 	return &DB{db}, nil
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hospital-emr/backend/internal/common/config"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/hospital-emr/backend/pkg/encryption"
+	"gorm.io/gorm"
+)
+
+// defaultKEK is the ID ENCRYPTION_KEY is available under as a KEK
+const defaultKEK = "default"
+
+// keyStore keeps the wrapped data keys in data_keys
+type keyStore struct {
+	db *gorm.DB
+}
+
+// DataKeys implements encryption.KeyStore
+func (s *keyStore) DataKeys(ctx context.Context, scope string) ([]encryption.DataKey, error) {
+	var rows []models.DataKey
+	if err := s.db.WithContext(ctx).Where("scope = ?", scope).Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	keys := make([]encryption.DataKey, len(rows))
+	for i, row := range rows {
+		keys[i] = encryption.DataKey{Scope: row.Scope, Version: row.Version, KEKID: row.KEKID, WrappedKey: row.WrappedKey}
+	}
+	return keys, nil
+}
+
+// CreateDataKey implements encryption.KeyStore
+func (s *keyStore) CreateDataKey(ctx context.Context, key *encryption.DataKey) error {
+	return s.db.WithContext(ctx).Create(&models.DataKey{
+		Scope:      key.Scope,
+		Version:    key.Version,
+		KEKID:      key.KEKID,
+		WrappedKey: key.WrappedKey,
+	}).Error
+}
+
+// UpdateDataKey implements encryption.KeyStore
+func (s *keyStore) UpdateDataKey(ctx context.Context, key *encryption.DataKey) error {
+	return s.db.WithContext(ctx).Model(&models.DataKey{}).
+		Where("scope = ? AND version = ?", key.Scope, key.Version).
+		Updates(map[string]interface{}{"kek_id": key.KEKID, "wrapped_key": key.WrappedKey}).Error
+}
+
+// keyProvider loads the KEKs of the configured provider
+func keyProvider(cfg *config.Config) (encryption.KeyProvider, error) {
+	var keys map[string][]byte
+	switch cfg.Keys.Provider {
+	case config.KeyProviderFile:
+		var err error
+		if keys, err = encryption.ReadKeyFiles(cfg.Keys.FileDir); err != nil {
+			return nil, fmt.Errorf("failed to read key files: %w", err)
+		}
+	default:
+		keys = encryption.ReadEnvKeys("ENCRYPTION_KEK_")
+	}
+	if _, ok := keys[defaultKEK]; !ok {
+		keys[defaultKEK] = []byte(cfg.Security.EncryptionKey)
+	}
+	return encryption.NewLocalKeyProvider(keys, cfg.Keys.ActiveKEK)
+}
+
+// newPatientCipher sets up envelope encryption of the patients table. v1
+// values written with ENCRYPTION_KEY before data keys were introduced stay
+// readable.
+func newPatientCipher(db *gorm.DB, cfg *config.Config) (*encryption.FieldCipher, error) {
+	provider, err := keyProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := encryption.NewKeyring(models.Patient{}.TableName(), provider, &keyStore{db: db}, cfg.Security.EncryptionKey, cfg.GetKeyRefreshInterval())
+	if err != nil {
+		return nil, err
+	}
+	return encryption.NewFieldCipher(keys, cfg.Security.BlindIndexKey)
+}
@@ -164,6 +164,86 @@ func ErrPatientAlreadyExists(mrn string) *AppError {
 	)
 }
 
+func ErrPossibleDuplicatePatient(candidates any) *AppError {
+	return NewAppError(
+		"POSSIBLE_DUPLICATE_PATIENT",
+		"The patient may already be registered; confirm to create a new record anyway",
+		http.StatusConflict,
+	).WithDetails(candidates)
+}
+
+func ErrDuplicateNotFound(id string) *AppError {
+	return NewAppError(
+		"DUPLICATE_NOT_FOUND",
+		fmt.Sprintf("Suspected duplicate with ID %s not found", id),
+		http.StatusNotFound,
+	)
+}
+
+func ErrDuplicateReviewed(id string) *AppError {
+	return NewAppError(
+		"DUPLICATE_ALREADY_REVIEWED",
+		fmt.Sprintf("Suspected duplicate %s has already been reviewed", id),
+		http.StatusConflict,
+	)
+}
+
+func ErrPatientMerged(id string) *AppError {
+	return NewAppError(
+		"PATIENT_MERGED",
+		fmt.Sprintf("Patient %s has been merged into another record", id),
+		http.StatusConflict,
+	)
+}
+
+func ErrPatientMergeNotFound(id string) *AppError {
+	return NewAppError(
+		"PATIENT_MERGE_NOT_FOUND",
+		fmt.Sprintf("Patient merge with ID %s not found", id),
+		http.StatusNotFound,
+	)
+}
+
+func ErrUnmergeNotAllowed(reason string) *AppError {
+	return NewAppError(
+		"UNMERGE_NOT_ALLOWED",
+		reason,
+		http.StatusConflict,
+	)
+}
+
+func ErrPatientAccessDenied(id string) *AppError {
+	return NewAppError(
+		"PATIENT_ACCESS_DENIED",
+		fmt.Sprintf("You have no active care relationship with patient %s", id),
+		http.StatusForbidden,
+	)
+}
+
+func ErrCareTeamAssignmentNotFound(id string) *AppError {
+	return NewAppError(
+		"CARE_TEAM_ASSIGNMENT_NOT_FOUND",
+		fmt.Sprintf("Care team assignment with ID %s not found", id),
+		http.StatusNotFound,
+	)
+}
+
+func ErrEmergencyAccessNotFound(id string) *AppError {
+	return NewAppError(
+		"EMERGENCY_ACCESS_NOT_FOUND",
+		fmt.Sprintf("Emergency access with ID %s not found", id),
+		http.StatusNotFound,
+	)
+}
+
+func ErrEmergencyAccessReviewed(id string) *AppError {
+	return NewAppError(
+		"EMERGENCY_ACCESS_ALREADY_REVIEWED",
+		fmt.Sprintf("Emergency access %s has already been reviewed", id),
+		http.StatusConflict,
+	)
+}
+
 // Encounter errors
 func ErrEncounterNotFound(id string) *AppError {
 	return NewAppError(
@@ -190,6 +270,15 @@ func ErrAppointmentConflict() *AppError {
 	)
 }
 
+// Numbering errors
+func ErrInvalidNumber(number string) *AppError {
+	return NewAppError(
+		"INVALID_NUMBER",
+		fmt.Sprintf("%s is not a valid number; check for a mistyped digit", number),
+		http.StatusBadRequest,
+	)
+}
+
 // User errors
 func ErrUserNotFound(id string) *AppError {
 	return NewAppError(
@@ -207,6 +296,245 @@ func ErrUserAlreadyExists(email string) *AppError {
 	)
 }
 
+func ErrClinicalProfileIncomplete(violations []string) *AppError {
+	return NewAppError(
+		"CLINICAL_PROFILE_INCOMPLETE",
+		"Clinical roles require a complete professional profile",
+		http.StatusBadRequest,
+	).WithDetails(violations)
+}
+
+// Role errors
+func ErrRoleNotFound(id string) *AppError {
+	return NewAppError(
+		"ROLE_NOT_FOUND",
+		fmt.Sprintf("Role %s not found", id),
+		http.StatusNotFound,
+	)
+}
+
+func ErrRoleAlreadyExists(code string) *AppError {
+	return NewAppError(
+		"ROLE_ALREADY_EXISTS",
+		fmt.Sprintf("Role with code or name %s already exists", code),
+		http.StatusConflict,
+	)
+}
+
+func ErrRoleInUse(code string) *AppError {
+	return NewAppError(
+		"ROLE_IN_USE",
+		fmt.Sprintf("Role %s is still assigned to users", code),
+		http.StatusConflict,
+	)
+}
+
+func ErrPermissionNotFound(codes []string) *AppError {
+	return NewAppError(
+		"PERMISSION_NOT_FOUND",
+		"One or more permissions do not exist",
+		http.StatusBadRequest,
+	).WithDetails(codes)
+}
+
+// Password errors
+func ErrPasswordPolicy(violations []string) *AppError {
+	return NewAppError(
+		"PASSWORD_POLICY_VIOLATION",
+		"Password does not meet the password policy",
+		http.StatusBadRequest,
+	).WithDetails(violations)
+}
+
+func ErrPasswordReused() *AppError {
+	return NewAppError(
+		"PASSWORD_REUSED",
+		"Password was used recently and cannot be reused",
+		http.StatusBadRequest,
+	)
+}
+
+func ErrCurrentPasswordIncorrect() *AppError {
+	return NewAppError(
+		"CURRENT_PASSWORD_INCORRECT",
+		"Current password is incorrect",
+		http.StatusBadRequest,
+	)
+}
+
+func ErrReauthenticationRequired() *AppError {
+	return NewAppError(
+		"REAUTHENTICATION_REQUIRED",
+		"Confirm your password or a current MFA code, or sign in again, to continue",
+		http.StatusForbidden,
+	)
+}
+
+// Service account errors
+func ErrServiceAccountNotFound(id string) *AppError {
+	return NewAppError(
+		"SERVICE_ACCOUNT_NOT_FOUND",
+		fmt.Sprintf("Service account with ID %s not found", id),
+		http.StatusNotFound,
+	)
+}
+
+func ErrServiceAccountAlreadyExists(name string) *AppError {
+	return NewAppError(
+		"SERVICE_ACCOUNT_ALREADY_EXISTS",
+		fmt.Sprintf("Service account %s already exists", name),
+		http.StatusConflict,
+	)
+}
+
+func ErrAPIKeyNotFound(id string) *AppError {
+	return NewAppError(
+		"API_KEY_NOT_FOUND",
+		fmt.Sprintf("API key with ID %s not found", id),
+		http.StatusNotFound,
+	)
+}
+
+func ErrAPIKeyInvalid() *AppError {
+	return NewAppError(
+		"API_KEY_INVALID",
+		"API key is invalid, expired or revoked",
+		http.StatusUnauthorized,
+	)
+}
+
+func ErrAPIKeyIPNotAllowed() *AppError {
+	return NewAppError(
+		"API_KEY_IP_NOT_ALLOWED",
+		"API key may not be used from this address",
+		http.StatusForbidden,
+	)
+}
+
+func ErrAPIKeyScopeNotAllowed(codes []string) *AppError {
+	return NewAppError(
+		"API_KEY_SCOPE_NOT_ALLOWED",
+		"API keys cannot be granted administrative permissions",
+		http.StatusBadRequest,
+	).WithDetails(codes)
+}
+
+func ErrAPIKeyScopeNotHeld(codes []string) *AppError {
+	return NewAppError(
+		"API_KEY_SCOPE_NOT_HELD",
+		"You cannot grant an API key permissions you do not hold",
+		http.StatusForbidden,
+	).WithDetails(codes)
+}
+
+// Single sign-on errors
+func ErrSSOProviderNotFound(name string) *AppError {
+	return NewAppError(
+		"SSO_PROVIDER_NOT_FOUND",
+		fmt.Sprintf("Identity provider %s is not configured", name),
+		http.StatusNotFound,
+	)
+}
+
+func ErrSSOStateInvalid() *AppError {
+	return NewAppError(
+		"SSO_STATE_INVALID",
+		"Login request is invalid, expired or already used",
+		http.StatusUnauthorized,
+	)
+}
+
+func ErrSSOFailed() *AppError {
+	return NewAppError(
+		"SSO_FAILED",
+		"External authentication failed",
+		http.StatusUnauthorized,
+	)
+}
+
+func ErrSSONotProvisioned() *AppError {
+	return NewAppError(
+		"SSO_NOT_PROVISIONED",
+		"No account is provisioned for this identity",
+		http.StatusForbidden,
+	)
+}
+
+// WebAuthn errors
+func ErrWebAuthnDisabled() *AppError {
+	return NewAppError(
+		"WEBAUTHN_DISABLED",
+		"Passkey authentication is not enabled",
+		http.StatusNotFound,
+	)
+}
+
+func ErrWebAuthnCeremonyInvalid() *AppError {
+	return NewAppError(
+		"WEBAUTHN_CEREMONY_INVALID",
+		"Passkey request is invalid, expired or already used",
+		http.StatusUnauthorized,
+	)
+}
+
+func ErrWebAuthnRegistrationFailed() *AppError {
+	return NewAppError(
+		"WEBAUTHN_REGISTRATION_FAILED",
+		"Passkey could not be registered",
+		http.StatusBadRequest,
+	)
+}
+
+func ErrWebAuthnVerificationFailed() *AppError {
+	return NewAppError(
+		"WEBAUTHN_VERIFICATION_FAILED",
+		"Passkey verification failed",
+		http.StatusUnauthorized,
+	)
+}
+
+func ErrWebAuthnCredentialNotFound(id string) *AppError {
+	return NewAppError(
+		"WEBAUTHN_CREDENTIAL_NOT_FOUND",
+		fmt.Sprintf("Passkey with ID %s not found", id),
+		http.StatusNotFound,
+	)
+}
+
+// Session errors
+func ErrSessionNotFound(id string) *AppError {
+	return NewAppError(
+		"SESSION_NOT_FOUND",
+		fmt.Sprintf("Session with ID %s not found", id),
+		http.StatusNotFound,
+	)
+}
+
+func ErrSessionLimitReached(limit int) *AppError {
+	return NewAppError(
+		"SESSION_LIMIT_REACHED",
+		fmt.Sprintf("At most %d concurrent sessions are allowed; sign out on another device first", limit),
+		http.StatusConflict,
+	)
+}
+
+// MFA errors
+func ErrMFANotEnrolled() *AppError {
+	return NewAppError(
+		"MFA_NOT_ENROLLED",
+		"Multi-factor authentication enrollment has not been started",
+		http.StatusBadRequest,
+	)
+}
+
+func ErrMFAAlreadyEnabled() *AppError {
+	return NewAppError(
+		"MFA_ALREADY_ENABLED",
+		"Multi-factor authentication is already enabled",
+		http.StatusConflict,
+	)
+}
+
 // Permission errors
 func ErrInsufficientPermissions() *AppError {
 	return NewAppError(
@@ -1,14 +1,18 @@
 package middleware
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/audit"
 	"github.com/hospital-emr/backend/internal/common/errors"
 	"github.com/hospital-emr/backend/internal/common/logger"
+	"github.com/hospital-emr/backend/internal/models"
 	"github.com/hospital-emr/backend/pkg/jwt"
 )
 
@@ -89,9 +93,34 @@ func Recovery() gin.HandlerFunc {
 	}
 }
 
-// AuthMiddleware validates JWT token
-func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
+// SessionValidator checks whether the server-side session behind a token is still active
+type SessionValidator interface {
+	IsSessionActive(ctx context.Context, sessionID, userID uuid.UUID) (bool, error)
+}
+
+// ServicePrincipal is a service account authenticated with an API key
+type ServicePrincipal struct {
+	ServiceAccountID uuid.UUID
+	Name             string
+	KeyID            uuid.UUID
+	Scopes           []string // Permission codes granted to the key
+}
+
+// APIKeyValidator authenticates service account API keys
+type APIKeyValidator interface {
+	ValidateAPIKey(ctx context.Context, key, clientIP string) (*ServicePrincipal, error)
+}
+
+// AuthMiddleware validates JWT token and its session. Service accounts may
+// authenticate with an API key instead, sent as "Authorization: ApiKey <key>"
+// or in the X-API-Key header.
+func AuthMiddleware(keys *jwt.KeySet, sessions SessionValidator, apiKeys APIKeyValidator) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+			authenticateAPIKey(c, apiKeys, apiKey)
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, errors.ErrUnauthorized)
@@ -99,8 +128,12 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 			return
 		}
 
-		// Extract token from "Bearer <token>"
+		// Extract token from "Bearer <token>" or key from "ApiKey <key>"
 		parts := strings.SplitN(authHeader, " ", 2)
+		if len(parts) == 2 && parts[0] == "ApiKey" {
+			authenticateAPIKey(c, apiKeys, parts[1])
+			return
+		}
 		if len(parts) != 2 || parts[0] != "Bearer" {
 			c.JSON(http.StatusUnauthorized, errors.ErrUnauthorized)
 			c.Abort()
@@ -110,15 +143,36 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 		tokenString := parts[1]
 
 		// Validate token
-		claims, err := jwt.ValidateToken(tokenString, jwtSecret)
+		claims, err := keys.ValidateToken(tokenString, jwt.TokenTypeAccess)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, errors.ErrTokenInvalid)
 			c.Abort()
 			return
 		}
 
+		// Reject tokens whose session was logged out or revoked
+		sessionID, err := claims.SessionID()
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, errors.ErrTokenInvalid)
+			c.Abort()
+			return
+		}
+
+		active, err := sessions.IsSessionActive(c.Request.Context(), sessionID, claims.UserID)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, errors.ErrServiceUnavailable)
+			c.Abort()
+			return
+		}
+		if !active {
+			c.JSON(http.StatusUnauthorized, errors.ErrTokenInvalid)
+			c.Abort()
+			return
+		}
+
 		// Set user info in context
 		c.Set("user_id", claims.UserID)
+		c.Set("session_id", sessionID)
 		c.Set("email", claims.Email)
 		c.Set("roles", claims.Roles)
 
@@ -126,6 +180,46 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 	}
 }
 
+// authenticateAPIKey authenticates a service account. The account's ID takes
+// the place of the user ID so handlers work unchanged; its key scopes replace
+// role permissions, and the audit trail attributes entries to the account.
+func authenticateAPIKey(c *gin.Context, apiKeys APIKeyValidator, key string) {
+	if apiKeys == nil {
+		c.JSON(http.StatusUnauthorized, errors.ErrUnauthorized)
+		c.Abort()
+		return
+	}
+
+	principal, err := apiKeys.ValidateAPIKey(c.Request.Context(), key, c.ClientIP())
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusServiceUnavailable, errors.ErrServiceUnavailable)
+		}
+		c.Abort()
+		return
+	}
+
+	scopes := make(map[string]struct{}, len(principal.Scopes))
+	for _, scope := range principal.Scopes {
+		scopes[scope] = struct{}{}
+	}
+
+	c.Set("user_id", principal.ServiceAccountID)
+	c.Set("service_account_id", principal.ServiceAccountID)
+	c.Set("api_key_id", principal.KeyID)
+	c.Set("roles", []string{})
+	c.Set("scopes", scopes)
+
+	c.Request = c.Request.WithContext(audit.WithServiceAccount(c.Request.Context(), &audit.ServiceAccount{
+		ID:   principal.ServiceAccountID,
+		Name: principal.Name,
+	}))
+
+	c.Next()
+}
+
 // RequireRole middleware checks if user has required role
 func RequireRole(roles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -167,6 +261,61 @@ func RequireRole(roles ...string) gin.HandlerFunc {
 	}
 }
 
+// PermissionResolver resolves the effective permissions of a user
+type PermissionResolver interface {
+	EffectivePermissions(ctx context.Context, userID uuid.UUID) (map[string]struct{}, error)
+}
+
+// RequirePermission middleware checks that the user holds every listed
+// permission through their roles
+func RequirePermission(resolver PermissionResolver, permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDValue, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusForbidden, errors.ErrForbidden)
+			c.Abort()
+			return
+		}
+
+		userID, ok := userIDValue.(uuid.UUID)
+		if !ok {
+			c.JSON(http.StatusForbidden, errors.ErrForbidden)
+			c.Abort()
+			return
+		}
+
+		// Service accounts are limited to the scopes of their API key
+		var granted map[string]struct{}
+		if scopes, ok := c.Get("scopes"); ok {
+			granted, _ = scopes.(map[string]struct{})
+		} else {
+			var err error
+			granted, err = resolver.EffectivePermissions(c.Request.Context(), userID)
+			if err != nil {
+				c.JSON(http.StatusServiceUnavailable, errors.ErrServiceUnavailable)
+				c.Abort()
+				return
+			}
+		}
+
+		var missing []string
+		for _, permission := range permissions {
+			if _, ok := granted[permission]; !ok {
+				missing = append(missing, permission)
+			}
+		}
+
+		if len(missing) > 0 {
+			c.JSON(http.StatusForbidden, errors.ErrInsufficientPermissions().WithDetails(gin.H{"required_permissions": missing}))
+			c.Abort()
+			return
+		}
+
+		c.Set("permissions", granted)
+		c.Next()
+	}
+}
+
 // RequestID middleware adds unique request ID
 func RequestID() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -189,29 +338,133 @@ func RateLimiter(requestsPerMinute int) gin.HandlerFunc {
 	}
 }
 
-// AuditLog middleware logs all requests to audit trail
-func AuditLog() gin.HandlerFunc {
+// AuditLog middleware records audited requests in the audit trail. Entries
+// are handed to the recorder after the handler has run, so they carry the
+// response status; with an asynchronous recorder the request never waits on
+// the audit table.
+func AuditLog(recorder *audit.Recorder) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Store start time
 		start := time.Now()
 
+		// Entries recorded while handling the request, such as field-level
+		// changes, are attributed to it
+		actor := &audit.Actor{
+			Username:  c.GetString("email"),
+			RequestID: c.GetString("request_id"),
+			IPAddress: c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+		}
+		if userID, ok := c.Get("user_id"); ok {
+			if id, ok := userID.(uuid.UUID); ok {
+				actor.UserID = &id
+			}
+		}
+		c.Request = c.Request.WithContext(audit.WithActor(c.Request.Context(), actor))
+
 		// Process request
 		c.Next()
 
-		// Log audit trail for sensitive operations
-		if shouldAudit(c.Request.Method, c.Request.URL.Path) {
-			userID, _ := c.Get("user_id")
-			
-			logger.WithFields(map[string]interface{}{
-				"user_id":       userID,
-				"method":        c.Request.Method,
-				"path":          c.Request.URL.Path,
-				"status_code":   c.Writer.Status(),
-				"ip_address":    c.ClientIP(),
-				"user_agent":    c.Request.UserAgent(),
-				"duration":      time.Since(start),
-			}).Info("Audit Log")
+		// Record audit trail for sensitive operations
+		if !shouldAudit(c.Request.Method, c.Request.URL.Path) {
+			return
+		}
+
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+
+		entry := &models.AuditLog{
+			Action:        auditAction(c.Request.Method),
+			Resource:      auditResource(route),
+			Description:   c.Request.Method + " " + route,
+			RequestMethod: c.Request.Method,
+			RequestPath:   c.Request.URL.Path,
+			StatusCode:    c.Writer.Status(),
+			Severity:      auditSeverity(c.Writer.Status()),
+		}
+		// Lookups by MRN or number name the record they resolved to
+		if id, ok := c.Get("audit_resource_id"); ok {
+			if id, ok := id.(uuid.UUID); ok {
+				entry.ResourceID = &id
+			}
+		} else if id, err := uuid.Parse(c.Param("id")); err == nil {
+			entry.ResourceID = &id
+		}
+
+		// Nested resources (care team assignments, API keys, ...) keep their IDs
+		params := make(map[string]string)
+		for _, param := range c.Params {
+			if param.Key != "id" {
+				params[param.Key] = param.Value
+			}
+		}
+		metadata := map[string]interface{}{
+			"route":       route,
+			"duration_ms": time.Since(start).Milliseconds(),
 		}
+		if len(params) > 0 {
+			metadata["params"] = params
+		}
+		if encoded, err := json.Marshal(metadata); err == nil {
+			entry.Metadata = string(encoded)
+		}
+
+		recorder.Record(c.Request.Context(), entry)
+	}
+}
+
+// auditResources maps API route collections to audit resource types
+var auditResources = map[string]string{
+	"pasien":        "patient",
+	"kunjungan":     "encounter",
+	"janji-temu":    "appointment",
+	"pengguna":      "user",
+	"peran":         "role",
+	"izin":          "permission",
+	"akun-layanan":  "service_account",
+	"akses-darurat": "emergency_access",
+	"otentikasi":    "auth",
+	"audit":         "audit_log",
+}
+
+// auditResource returns the resource type a route operates on, taken from
+// the collection that follows the API version
+func auditResource(route string) string {
+	segments := strings.Split(strings.Trim(route, "/"), "/")
+	if len(segments) >= 3 && segments[0] == "api" {
+		segments = segments[2:]
+	}
+	if resource, ok := auditResources[segments[0]]; ok {
+		return resource
+	}
+	return segments[0]
+}
+
+// auditAction maps an HTTP method to an audit action
+func auditAction(method string) string {
+	switch method {
+	case http.MethodPost:
+		return models.AuditActionCreate
+	case http.MethodPut, http.MethodPatch:
+		return models.AuditActionUpdate
+	case http.MethodDelete:
+		return models.AuditActionDelete
+	default:
+		return models.AuditActionRead
+	}
+}
+
+// auditSeverity flags denied and failed requests
+func auditSeverity(status int) models.AuditSeverity {
+	switch {
+	case status >= http.StatusInternalServerError:
+		return models.AuditSeverityError
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return models.AuditSeverityWarning
+	default:
+		return models.AuditSeverityInfo
 	}
 }
 
@@ -224,10 +477,12 @@ func shouldAudit(method, path string) bool {
 	
 	// Audit sensitive endpoints
 	sensitiveEndpoints := []string{
-		"/api/v1/patients",
-		"/api/v1/encounters",
-		"/api/v1/orders",
-		"/api/v1/users",
+		"/api/v1/pasien",
+		"/api/v1/kunjungan",
+		"/api/v1/janji-temu",
+		"/api/v1/pengguna",
+		"/api/v1/akses-darurat",
+		"/api/v1/audit",
 	}
 	
 	for _, endpoint := range sensitiveEndpoints {
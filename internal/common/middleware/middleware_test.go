@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/hospital-emr/backend/pkg/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSessions is a SessionValidator over an in-memory set of active sessions
+type fakeSessions struct {
+	active map[uuid.UUID]uuid.UUID // Session ID to user ID
+	err    error
+}
+
+func (f *fakeSessions) IsSessionActive(ctx context.Context, sessionID, userID uuid.UUID) (bool, error) {
+	if f.err != nil {
+		return false, f.err
+	}
+	owner, ok := f.active[sessionID]
+	return ok && owner == userID, nil
+}
+
+func testKeySet(t *testing.T) *jwt.KeySet {
+	keys, err := jwt.NewKeySet(jwt.NewHMACKey("test", []byte("0123456789abcdef0123456789abcdef")))
+	require.NoError(t, err)
+	return keys
+}
+
+// serve runs a request carrying the bearer token through the handlers
+func serve(token string, handlers ...gin.HandlerFunc) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/", append(handlers, func(c *gin.Context) { c.Status(http.StatusOK) })...)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuditResource(t *testing.T) {
+	tests := []struct {
+		route string
+		want  string
+	}{
+		{"/api/v1/pasien/:id", "patient"},
+		{"/api/v1/pasien/:id/tim-perawatan/:assignment_id", "patient"},
+		{"/api/v1/kunjungan/:id/tanda-vital", "encounter"},
+		{"/api/v1/janji-temu", "appointment"},
+		{"/api/v1/akun-layanan/:id/kunci", "service_account"},
+		{"/api/v1/laporan", "laporan"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.route, func(t *testing.T) {
+			assert.Equal(t, tt.want, auditResource(tt.route))
+		})
+	}
+}
+
+func TestShouldAudit(t *testing.T) {
+	assert.True(t, shouldAudit("GET", "/api/v1/pasien/123"))
+	assert.True(t, shouldAudit("POST", "/api/v1/otentikasi/keluar"))
+	assert.False(t, shouldAudit("GET", "/api/v1/otentikasi/verifikasi"))
+
+	assert.Equal(t, models.AuditActionUpdate, auditAction("PATCH"))
+	assert.Equal(t, models.AuditSeverityWarning, auditSeverity(403))
+}
+
+func TestAuthMiddlewareSessions(t *testing.T) {
+	keys := testKeySet(t)
+	userID, sessionID := uuid.New(), uuid.New()
+	token, err := keys.GenerateToken(userID, "doctor@hospital-emr.com", []string{"doctor"}, sessionID, jwt.TokenTypeAccess, time.Hour)
+	require.NoError(t, err)
+	passwordChange, err := keys.GenerateToken(userID, "doctor@hospital-emr.com", nil, sessionID, jwt.TokenTypePasswordChange, time.Hour)
+	require.NoError(t, err)
+
+	sessions := &fakeSessions{active: map[uuid.UUID]uuid.UUID{sessionID: userID}}
+	auth := AuthMiddleware(keys, sessions, nil)
+
+	assert.Equal(t, http.StatusOK, serve(token, auth).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve("", auth).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(passwordChange, auth).Code)
+
+	// The token outlives its session once it is logged out or revoked
+	delete(sessions.active, sessionID)
+	assert.Equal(t, http.StatusUnauthorized, serve(token, auth).Code)
+
+	// A session belonging to another user does not count
+	sessions.active[sessionID] = uuid.New()
+	assert.Equal(t, http.StatusUnauthorized, serve(token, auth).Code)
+
+	// Sessions that cannot be checked fail closed
+	sessions.err = errors.New("database unavailable")
+	assert.Equal(t, http.StatusServiceUnavailable, serve(token, auth).Code)
+}
+
+// fakePermissions is a PermissionResolver over fixed permissions per user
+type fakePermissions struct {
+	granted map[uuid.UUID][]string
+	err     error
+}
+
+func (f *fakePermissions) EffectivePermissions(ctx context.Context, userID uuid.UUID) (map[string]struct{}, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	permissions := make(map[string]struct{})
+	for _, code := range f.granted[userID] {
+		permissions[code] = struct{}{}
+	}
+	return permissions, nil
+}
+
+func TestRequirePermission(t *testing.T) {
+	doctorID := uuid.New()
+	resolver := &fakePermissions{granted: map[uuid.UUID][]string{
+		doctorID: {models.PermissionViewPatients, models.PermissionCreateEncounters},
+	}}
+	asUser := func(id uuid.UUID) gin.HandlerFunc {
+		return func(c *gin.Context) { c.Set("user_id", id) }
+	}
+	withScopes := func(scopes ...string) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			granted := make(map[string]struct{})
+			for _, scope := range scopes {
+				granted[scope] = struct{}{}
+			}
+			c.Set("user_id", uuid.New())
+			c.Set("scopes", granted)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		principal   gin.HandlerFunc
+		permissions []string
+		want        int
+	}{
+		{"single permission granted", asUser(doctorID), []string{models.PermissionViewPatients}, http.StatusOK},
+		{"every permission granted", asUser(doctorID), []string{models.PermissionViewPatients, models.PermissionCreateEncounters}, http.StatusOK},
+		{"permission missing", asUser(doctorID), []string{models.PermissionManageUsers}, http.StatusForbidden},
+		{"one of several missing", asUser(doctorID), []string{models.PermissionViewPatients, models.PermissionDeletePatients}, http.StatusForbidden},
+		{"user without roles", asUser(uuid.New()), []string{models.PermissionViewPatients}, http.StatusForbidden},
+		{"unauthenticated", func(c *gin.Context) {}, []string{models.PermissionViewPatients}, http.StatusForbidden},
+		{"api key scope granted", withScopes(models.PermissionViewPatients), []string{models.PermissionViewPatients}, http.StatusOK},
+		{"api key scope missing", withScopes(models.PermissionViewPatients), []string{models.PermissionCreateEncounters}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve("", tt.principal, RequirePermission(resolver, tt.permissions...))
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+
+	t.Run("missing permissions are reported", func(t *testing.T) {
+		w := serve("", asUser(doctorID), RequirePermission(resolver, models.PermissionViewPatients, models.PermissionManageUsers))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), `"required_permissions":["`+models.PermissionManageUsers+`"]`)
+	})
+
+	t.Run("resolver failure fails closed", func(t *testing.T) {
+		failing := &fakePermissions{err: errors.New("database unavailable")}
+		w := serve("", asUser(doctorID), RequirePermission(failing, models.PermissionViewPatients))
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	})
+}
@@ -0,0 +1,292 @@
+// Package detector watches the audit stream for suspicious access to patient
+// records, such as bulk reads, access outside a user's shift or department,
+// users opening their own or a relative's record, and repeated failed logins.
+// Alerts are recorded as critical audit entries and published on NATS.
+package detector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/audit"
+	"github.com/hospital-emr/backend/internal/common/config"
+	"github.com/hospital-emr/backend/internal/common/logger"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/hospital-emr/backend/pkg/messaging"
+	"github.com/nats-io/nats.go"
+	"gorm.io/gorm"
+)
+
+// QueueGroup is the NATS queue group detectors subscribe to the audit stream
+// in, so each entry is evaluated once however many detectors run
+const QueueGroup = "audit-detector"
+
+// sweepInterval is how often expired rule state and cached profiles are
+// dropped
+const sweepInterval = time.Minute
+
+// Alert describes suspicious access found by a rule
+type Alert struct {
+	ID          uuid.UUID              `json:"id"`
+	Rule        string                 `json:"rule"`
+	UserID      *uuid.UUID             `json:"user_id,omitempty"`
+	Username    string                 `json:"username,omitempty"`
+	PatientID   *uuid.UUID             `json:"patient_id,omitempty"`
+	IPAddress   string                 `json:"ip_address,omitempty"`
+	Description string                 `json:"description"`
+	Details     map[string]interface{} `json:"details,omitempty"`
+	EntryID     uuid.UUID              `json:"entry_id"` // The audit entry that raised the alert
+	DetectedAt  time.Time              `json:"detected_at"`
+
+	key string // Identifies repeats of the same alert for the cooldown
+}
+
+// Detector evaluates audit entries against the configured rules on its own
+// goroutine. Entries are queued without blocking; when the queue is full they
+// are dropped with a warning rather than holding up requests.
+type Detector struct {
+	profiles   profileSource
+	recorder   *audit.Recorder
+	natsClient *messaging.NATSClient
+	rules      []rule
+	cooldown   time.Duration
+	queue      chan models.AuditLog
+	dropped    atomic.Int64
+	stop       chan struct{}
+	done       chan struct{}
+	mu         sync.RWMutex
+	closed     bool
+
+	// Owned by the run loop
+	alerted map[string]time.Time
+}
+
+// New creates a detector for the rules enabled in cfg and starts its
+// background loop. Alerts are written through recorder and published on
+// natsClient when it is connected.
+func New(db *gorm.DB, recorder *audit.Recorder, natsClient *messaging.NATSClient, cfg *config.Config) (*Detector, error) {
+	rules, err := buildRules(&cfg.Detector)
+	if err != nil {
+		return nil, err
+	}
+	return newDetector(newDBProfiles(db), recorder, natsClient, rules, cfg.Detector), nil
+}
+
+func newDetector(profiles profileSource, recorder *audit.Recorder, natsClient *messaging.NATSClient, rules []rule, cfg config.DetectorConfig) *Detector {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 10000
+	}
+
+	d := &Detector{
+		profiles:   profiles,
+		recorder:   recorder,
+		natsClient: natsClient,
+		rules:      rules,
+		cooldown:   time.Duration(cfg.AlertCooldownMinutes) * time.Minute,
+		queue:      make(chan models.AuditLog, cfg.QueueSize),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+		alerted:    make(map[string]time.Time),
+	}
+	go d.run()
+	return d
+}
+
+// buildRules creates the rules listed in cfg
+func buildRules(cfg *config.DetectorConfig) ([]rule, error) {
+	location, err := time.LoadLocation(cfg.ShiftTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid shift time zone: %w", err)
+	}
+	exempt := make(map[string]bool, len(cfg.ExemptRoles))
+	for _, role := range cfg.ExemptRoles {
+		exempt[role] = true
+	}
+
+	var rules []rule
+	for _, name := range cfg.Rules {
+		switch name {
+		case RuleBulkRead:
+			rules = append(rules, newBulkReadRule(cfg.BulkReadPatients, time.Duration(cfg.BulkReadMinutes)*time.Minute))
+		case RuleOffShift:
+			rules = append(rules, &shiftRule{location: location, defaultStart: cfg.DefaultShiftStart, defaultEnd: cfg.DefaultShiftEnd, exempt: exempt})
+		case RuleDepartment:
+			rules = append(rules, &departmentRule{exempt: exempt})
+		case RuleFamilyRecord:
+			rules = append(rules, familyRule{})
+		case RuleFailedLogins:
+			rules = append(rules, newFailedLoginRule(cfg.FailedLogins, time.Duration(cfg.FailedLoginMinutes)*time.Minute))
+		default:
+			return nil, fmt.Errorf("unknown detector rule: %s", name)
+		}
+	}
+	return rules, nil
+}
+
+// Observe queues an audit entry for evaluation without blocking. It is meant
+// to be registered with audit.Recorder.Observe.
+func (d *Detector) Observe(entry models.AuditLog) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.closed {
+		return
+	}
+	select {
+	case d.queue <- entry:
+	default:
+		d.dropped.Add(1)
+	}
+}
+
+// Subscribe feeds the detector from audit entries published on NATS by
+// Publish
+func (d *Detector) Subscribe(natsClient *messaging.NATSClient) (*nats.Subscription, error) {
+	return natsClient.QueueSubscribe(messaging.SubjectAuditEvent, QueueGroup, func(data []byte) {
+		var entry models.AuditLog
+		if err := json.Unmarshal(data, &entry); err != nil {
+			logger.Warnf("Failed to decode audit event: %v", err)
+			return
+		}
+		d.Observe(entry)
+	})
+}
+
+// Publish returns an audit observer that forwards entries to a detector in
+// another process over NATS
+func Publish(natsClient *messaging.NATSClient) func(models.AuditLog) {
+	return func(entry models.AuditLog) {
+		if err := natsClient.Publish(messaging.SubjectAuditEvent, entry); err != nil {
+			logger.Warnf("Failed to publish audit event: %v", err)
+		}
+	}
+}
+
+// Close stops accepting entries and evaluates everything already queued, or
+// gives up when ctx ends
+func (d *Detector) Close(ctx context.Context) error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	d.mu.Unlock()
+
+	close(d.stop)
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *Detector) run() {
+	defer close(d.done)
+
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case entry := <-d.queue:
+			d.evaluate(&entry)
+		case now := <-ticker.C:
+			d.sweep(now)
+		case <-d.stop:
+			for {
+				select {
+				case entry := <-d.queue:
+					d.evaluate(&entry)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// evaluate runs one entry through every rule and raises what they find
+func (d *Detector) evaluate(entry *models.AuditLog) {
+	// Alerts are audit entries themselves
+	if entry.Action == models.AuditActionSuspiciousAccess {
+		return
+	}
+	for _, alert := range d.check(entry) {
+		d.raise(alert)
+	}
+}
+
+func (d *Detector) check(entry *models.AuditLog) []Alert {
+	ev := &event{entry: entry}
+	if isRecordAccess(entry) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		var err error
+		if ev.user, err = d.profiles.user(ctx, *entry.UserID); err != nil {
+			logger.Warnf("Failed to load user %s for access detection: %v", entry.UserID, err)
+		}
+		if ev.record, err = d.profiles.record(ctx, entry.Resource, *entry.ResourceID); err != nil {
+			logger.Warnf("Failed to load %s %s for access detection: %v", entry.Resource, entry.ResourceID, err)
+		}
+	}
+
+	var alerts []Alert
+	for _, r := range d.rules {
+		alerts = append(alerts, r.evaluate(ev)...)
+	}
+	return alerts
+}
+
+// raise records and publishes an alert unless the same alert was raised
+// within the cooldown
+func (d *Detector) raise(alert Alert) {
+	if last, ok := d.alerted[alert.key]; ok && alert.DetectedAt.Sub(last) < d.cooldown {
+		return
+	}
+	d.alerted[alert.key] = alert.DetectedAt
+
+	metadata, _ := json.Marshal(alert)
+	d.recorder.Record(context.Background(), &models.AuditLog{
+		Username:    "access-monitor",
+		Action:      models.AuditActionSuspiciousAccess,
+		Resource:    "user",
+		ResourceID:  alert.UserID,
+		Description: alert.Description,
+		IPAddress:   alert.IPAddress,
+		Metadata:    string(metadata),
+		Severity:    models.AuditSeverityCritical,
+	})
+
+	if err := d.natsClient.Publish(messaging.SubjectSuspiciousAccess, alert); err != nil {
+		logger.Errorf("Failed to publish suspicious access alert: %v", err)
+	}
+
+	logger.WithFields(map[string]interface{}{
+		"rule":     alert.Rule,
+		"user_id":  alert.UserID,
+		"entry_id": alert.EntryID,
+	}).Warn(alert.Description)
+}
+
+func (d *Detector) sweep(now time.Time) {
+	for _, r := range d.rules {
+		r.sweep(now)
+	}
+	d.profiles.sweep(now)
+	for key, at := range d.alerted {
+		if now.Sub(at) >= d.cooldown {
+			delete(d.alerted, key)
+		}
+	}
+	if dropped := d.dropped.Swap(0); dropped > 0 {
+		logger.Warnf("Access detector queue full; %d audit entries were not evaluated", dropped)
+	}
+}
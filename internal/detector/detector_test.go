@@ -0,0 +1,212 @@
+package detector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/config"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubProfiles struct {
+	users   map[uuid.UUID]*userProfile
+	records map[uuid.UUID]*recordProfile
+	lookups int
+}
+
+func (s *stubProfiles) user(_ context.Context, id uuid.UUID) (*userProfile, error) {
+	s.lookups++
+	return s.users[id], nil
+}
+
+func (s *stubProfiles) record(_ context.Context, _ string, id uuid.UUID) (*recordProfile, error) {
+	s.lookups++
+	return s.records[id], nil
+}
+
+func (s *stubProfiles) sweep(time.Time) {}
+
+func accessEntry(userID uuid.UUID, resource string, resourceID uuid.UUID, at time.Time) *models.AuditLog {
+	return &models.AuditLog{
+		ID:            uuid.New(),
+		Timestamp:     at,
+		UserID:        &userID,
+		Action:        models.AuditActionRead,
+		Resource:      resource,
+		ResourceID:    &resourceID,
+		RequestMethod: "GET",
+		StatusCode:    200,
+	}
+}
+
+func accessEvent(user *userProfile, record *recordProfile, at time.Time) *event {
+	return &event{
+		entry:  accessEntry(user.ID, "patient", record.PatientID, at),
+		user:   user,
+		record: record,
+	}
+}
+
+func TestWithinShift(t *testing.T) {
+	day, _ := minuteOfDay("07:00")
+	evening, _ := minuteOfDay("19:00")
+
+	assert.True(t, withinShift(8*60, day, evening))
+	assert.False(t, withinShift(19*60, day, evening))
+	assert.False(t, withinShift(2*60, day, evening))
+
+	// Overnight shift
+	assert.True(t, withinShift(23*60, evening, day))
+	assert.True(t, withinShift(2*60, evening, day))
+	assert.False(t, withinShift(12*60, evening, day))
+}
+
+func TestBulkReadRule(t *testing.T) {
+	r := newBulkReadRule(3, 10*time.Minute)
+	user := &userProfile{ID: uuid.New()}
+	start := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	first := &recordProfile{PatientID: uuid.New()}
+	assert.Empty(t, r.evaluate(accessEvent(user, first, start)))
+	assert.Empty(t, r.evaluate(accessEvent(user, first, start.Add(time.Minute))), "the same patient counts once")
+	assert.Empty(t, r.evaluate(accessEvent(user, &recordProfile{PatientID: uuid.New()}, start.Add(2*time.Minute))))
+
+	alerts := r.evaluate(accessEvent(user, &recordProfile{PatientID: uuid.New()}, start.Add(3*time.Minute)))
+	require.Len(t, alerts, 1)
+	assert.Equal(t, RuleBulkRead, alerts[0].Rule)
+	assert.Equal(t, 3, alerts[0].Details["patients"])
+
+	// Reads fall out of the window
+	r = newBulkReadRule(3, 10*time.Minute)
+	r.evaluate(accessEvent(user, &recordProfile{PatientID: uuid.New()}, start))
+	r.evaluate(accessEvent(user, &recordProfile{PatientID: uuid.New()}, start.Add(5*time.Minute)))
+	assert.Empty(t, r.evaluate(accessEvent(user, &recordProfile{PatientID: uuid.New()}, start.Add(11*time.Minute))))
+
+	r.sweep(start.Add(time.Hour))
+	assert.Empty(t, r.reads)
+}
+
+func TestFailedLoginRule(t *testing.T) {
+	r := newFailedLoginRule(3, 15*time.Minute)
+	start := time.Now()
+
+	attempt := func(email, ip string, at time.Time) []Alert {
+		return r.evaluate(&event{entry: &models.AuditLog{
+			ID:        uuid.New(),
+			Timestamp: at,
+			Action:    models.AuditActionLoginFailed,
+			IPAddress: ip,
+			Metadata:  `{"email":"` + email + `","reason":"invalid credentials"}`,
+		}})
+	}
+
+	assert.Empty(t, attempt("dr.budi@example.com", "10.0.0.1", start))
+	assert.Empty(t, attempt("DR.BUDI@example.com", "10.0.0.2", start.Add(time.Minute)))
+
+	alerts := attempt("dr.budi@example.com", "10.0.0.3", start.Add(2*time.Minute))
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "dr.budi@example.com", alerts[0].Details["account"])
+
+	// Many accounts tried from one address
+	assert.Empty(t, attempt("a@example.com", "10.0.0.9", start))
+	assert.Empty(t, attempt("b@example.com", "10.0.0.9", start))
+	alerts = attempt("c@example.com", "10.0.0.9", start)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "10.0.0.9", alerts[0].Details["ip"])
+}
+
+func TestShiftRule(t *testing.T) {
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	require.NoError(t, err)
+	r := &shiftRule{location: jakarta, exempt: map[string]bool{"admin": true}}
+
+	nurse := &userProfile{ID: uuid.New(), ShiftStart: "07:00", ShiftEnd: "15:00", Roles: []string{"nurse"}}
+	record := &recordProfile{PatientID: uuid.New()}
+
+	// 09:00 and 22:00 in Jakarta
+	assert.Empty(t, r.evaluate(accessEvent(nurse, record, time.Date(2024, 3, 1, 2, 0, 0, 0, time.UTC))))
+	alerts := r.evaluate(accessEvent(nurse, record, time.Date(2024, 3, 1, 15, 0, 0, 0, time.UTC)))
+	require.Len(t, alerts, 1)
+	assert.Equal(t, RuleOffShift, alerts[0].Rule)
+
+	admin := &userProfile{ID: uuid.New(), ShiftStart: "07:00", ShiftEnd: "15:00", Roles: []string{"admin"}}
+	assert.Empty(t, r.evaluate(accessEvent(admin, record, time.Date(2024, 3, 1, 15, 0, 0, 0, time.UTC))))
+
+	// Users without a shift are only checked against a configured default
+	noShift := &userProfile{ID: uuid.New()}
+	assert.Empty(t, r.evaluate(accessEvent(noShift, record, time.Date(2024, 3, 1, 15, 0, 0, 0, time.UTC))))
+	r.defaultStart, r.defaultEnd = "06:00", "18:00"
+	assert.Len(t, r.evaluate(accessEvent(noShift, record, time.Date(2024, 3, 1, 15, 0, 0, 0, time.UTC))), 1)
+}
+
+func TestDepartmentRule(t *testing.T) {
+	r := &departmentRule{}
+	user := &userProfile{ID: uuid.New(), Department: "Cardiology"}
+
+	assert.Empty(t, r.evaluate(accessEvent(user, &recordProfile{PatientID: uuid.New(), Department: "cardiology"}, time.Now())))
+	assert.Empty(t, r.evaluate(accessEvent(user, &recordProfile{PatientID: uuid.New()}, time.Now())), "patients have no department")
+
+	alerts := r.evaluate(accessEvent(user, &recordProfile{PatientID: uuid.New(), Department: "Psychiatry"}, time.Now()))
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "Psychiatry", alerts[0].Details["record_department"])
+}
+
+func TestFamilyRule(t *testing.T) {
+	user := &userProfile{ID: uuid.New(), FirstName: "Siti", LastName: "Rahayu", Address: "Jl. Merdeka No. 10, Bandung"}
+
+	own := &recordProfile{PatientID: uuid.New(), FirstName: "siti", LastName: "Rahayu", Address: "jl. merdeka  no. 10, bandung"}
+	alerts := familyRule{}.evaluate(accessEvent(user, own, time.Now()))
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "own", alerts[0].Details["relation"])
+
+	relative := &recordProfile{PatientID: uuid.New(), FirstName: "Ahmad", LastName: "Rahayu", Address: "Jl. Merdeka No. 10, Bandung"}
+	alerts = familyRule{}.evaluate(accessEvent(user, relative, time.Now()))
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "family", alerts[0].Details["relation"])
+
+	namesake := &recordProfile{PatientID: uuid.New(), FirstName: "Ahmad", LastName: "Rahayu", Address: "Jl. Sudirman No. 5, Jakarta"}
+	assert.Empty(t, familyRule{}.evaluate(accessEvent(user, namesake, time.Now())))
+
+	assert.Empty(t, familyRule{}.evaluate(accessEvent(&userProfile{ID: uuid.New(), LastName: "Rahayu"}, &recordProfile{LastName: "Rahayu"}, time.Now())), "unknown addresses never match")
+}
+
+func TestBuildRules(t *testing.T) {
+	cfg := config.DetectorConfig{ShiftTimezone: "Asia/Jakarta", Rules: []string{RuleBulkRead, RuleFamilyRecord}}
+	rules, err := buildRules(&cfg)
+	require.NoError(t, err)
+	assert.Len(t, rules, 2)
+
+	cfg.Rules = []string{"bulk_reads"}
+	_, err = buildRules(&cfg)
+	assert.Error(t, err)
+}
+
+func TestCheckOnlyResolvesRecordAccess(t *testing.T) {
+	user := &userProfile{ID: uuid.New(), Department: "Cardiology"}
+	encounterID := uuid.New()
+	profiles := &stubProfiles{
+		users:   map[uuid.UUID]*userProfile{user.ID: user},
+		records: map[uuid.UUID]*recordProfile{encounterID: {PatientID: uuid.New(), Department: "Psychiatry"}},
+	}
+	d := &Detector{profiles: profiles, rules: []rule{&departmentRule{}}}
+
+	entry := accessEntry(user.ID, "encounter", encounterID, time.Now())
+	alerts := d.check(entry)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, profiles.records[encounterID].PatientID, *alerts[0].PatientID)
+	assert.Equal(t, entry.ID, alerts[0].EntryID)
+
+	// Change-tracking entries repeat the request and denied requests read nothing
+	profiles.lookups = 0
+	tracked := accessEntry(user.ID, "encounter", encounterID, time.Now())
+	tracked.RequestMethod = ""
+	denied := accessEntry(user.ID, "encounter", encounterID, time.Now())
+	denied.StatusCode = 403
+	assert.Empty(t, d.check(tracked))
+	assert.Empty(t, d.check(denied))
+	assert.Zero(t, profiles.lookups)
+}
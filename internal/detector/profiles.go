@@ -0,0 +1,155 @@
+package detector
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// profileTTL is how long user and record details are cached. Changes to a
+// user's shift or department are picked up within this time.
+const profileTTL = 5 * time.Minute
+
+// userProfile holds the details of a user the rules look at
+type userProfile struct {
+	ID         uuid.UUID
+	FirstName  string
+	LastName   string
+	Address    string
+	Department string
+	ShiftStart string
+	ShiftEnd   string
+	Roles      []string
+}
+
+// recordProfile describes the patient record an entry accessed
+type recordProfile struct {
+	PatientID  uuid.UUID
+	FirstName  string
+	LastName   string
+	Address    string
+	Department string // Of the encounter or appointment; empty for the patient itself
+}
+
+// profileSource resolves the users and records audit entries refer to
+type profileSource interface {
+	user(ctx context.Context, id uuid.UUID) (*userProfile, error)
+	record(ctx context.Context, resource string, id uuid.UUID) (*recordProfile, error)
+	sweep(now time.Time)
+}
+
+type cachedUser struct {
+	profile *userProfile
+	expires time.Time
+}
+
+type cachedRecord struct {
+	profile *recordProfile
+	expires time.Time
+}
+
+// dbProfiles loads profiles from the database and caches them. It is only
+// used from the detector's own goroutine.
+type dbProfiles struct {
+	db      *gorm.DB
+	users   map[uuid.UUID]cachedUser
+	records map[string]cachedRecord
+}
+
+func newDBProfiles(db *gorm.DB) *dbProfiles {
+	return &dbProfiles{
+		db:      db,
+		users:   make(map[uuid.UUID]cachedUser),
+		records: make(map[string]cachedRecord),
+	}
+}
+
+func (p *dbProfiles) user(ctx context.Context, id uuid.UUID) (*userProfile, error) {
+	if cached, ok := p.users[id]; ok && time.Now().Before(cached.expires) {
+		return cached.profile, nil
+	}
+
+	var user models.User
+	err := p.db.WithContext(ctx).Unscoped().Preload("Roles").Where("id = ?", id).First(&user).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	var profile *userProfile
+	if err == nil {
+		profile = &userProfile{
+			ID:         user.ID,
+			FirstName:  user.FirstName,
+			LastName:   user.LastName,
+			Address:    user.Address,
+			Department: user.Department,
+			ShiftStart: user.ShiftStart,
+			ShiftEnd:   user.ShiftEnd,
+		}
+		for _, role := range user.Roles {
+			profile.Roles = append(profile.Roles, role.Code)
+		}
+	}
+	p.users[id] = cachedUser{profile: profile, expires: time.Now().Add(profileTTL)}
+	return profile, nil
+}
+
+func (p *dbProfiles) record(ctx context.Context, resource string, id uuid.UUID) (*recordProfile, error) {
+	key := resource + ":" + id.String()
+	if cached, ok := p.records[key]; ok && time.Now().Before(cached.expires) {
+		return cached.profile, nil
+	}
+
+	var row struct {
+		PatientID  uuid.UUID
+		Department string
+	}
+	var err error
+	switch resource {
+	case "patient":
+		row.PatientID = id
+	case "encounter":
+		err = p.db.WithContext(ctx).Unscoped().Model(&models.Encounter{}).Select("patient_id", "department").Where("id = ?", id).Take(&row).Error
+	case "appointment":
+		err = p.db.WithContext(ctx).Unscoped().Model(&models.Appointment{}).Select("patient_id", "department").Where("id = ?", id).Take(&row).Error
+	default:
+		return nil, nil
+	}
+
+	var patient models.Patient
+	if err == nil {
+		err = p.db.WithContext(ctx).Unscoped().Select("id", "first_name", "last_name", "address").Where("id = ?", row.PatientID).Take(&patient).Error
+	}
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	var profile *recordProfile
+	if err == nil {
+		profile = &recordProfile{
+			PatientID:  patient.ID,
+			FirstName:  patient.FirstName,
+			LastName:   patient.LastName,
+			Address:    string(patient.Address),
+			Department: row.Department,
+		}
+	}
+	p.records[key] = cachedRecord{profile: profile, expires: time.Now().Add(profileTTL)}
+	return profile, nil
+}
+
+func (p *dbProfiles) sweep(now time.Time) {
+	for id, cached := range p.users {
+		if now.After(cached.expires) {
+			delete(p.users, id)
+		}
+	}
+	for key, cached := range p.records {
+		if now.After(cached.expires) {
+			delete(p.records, key)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package detector
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/models"
+)
+
+// Rule names, as listed in DETECTOR_RULES
+const (
+	RuleBulkRead     = "bulk_read"
+	RuleOffShift     = "off_shift"
+	RuleDepartment   = "department"
+	RuleFamilyRecord = "family_record"
+	RuleFailedLogins = "failed_logins"
+)
+
+// event is an audit entry with the user and patient record it concerns
+// resolved
+type event struct {
+	entry  *models.AuditLog
+	user   *userProfile   // The acting user; nil for service accounts and unknown users
+	record *recordProfile // Nil unless the entry is a request that accessed a patient record
+}
+
+// rule looks at one event at a time, in order, and returns any alerts it
+// raises. Rules keep their own state and are only called from the detector's
+// goroutine.
+type rule interface {
+	evaluate(ev *event) []Alert
+	sweep(now time.Time)
+}
+
+// isRecordAccess reports whether an entry is a successful request that read
+// or changed a patient, encounter or appointment. Change-tracking entries
+// describe the same request again and carry no request method.
+func isRecordAccess(entry *models.AuditLog) bool {
+	if entry.RequestMethod == "" || entry.UserID == nil || entry.ResourceID == nil {
+		return false
+	}
+	if entry.StatusCode <= 0 || entry.StatusCode >= 400 {
+		return false
+	}
+	switch entry.Resource {
+	case "patient", "encounter", "appointment":
+		return true
+	}
+	return false
+}
+
+// newAlert builds an alert for a rule raised by an event
+func newAlert(rule, key string, ev *event, description string, details map[string]interface{}) Alert {
+	alert := Alert{
+		ID:          uuid.New(),
+		Rule:        rule,
+		UserID:      ev.entry.UserID,
+		Username:    ev.entry.Username,
+		IPAddress:   ev.entry.IPAddress,
+		Description: description,
+		Details:     details,
+		EntryID:     ev.entry.ID,
+		DetectedAt:  time.Now().UTC(),
+		key:         rule + ":" + key,
+	}
+	if ev.record != nil {
+		alert.PatientID = &ev.record.PatientID
+	}
+	return alert
+}
+
+type timedRead struct {
+	at      time.Time
+	patient uuid.UUID
+}
+
+// bulkReadRule flags a user reading many distinct patients in a short time
+type bulkReadRule struct {
+	limit  int
+	window time.Duration
+	reads  map[uuid.UUID][]timedRead
+}
+
+func newBulkReadRule(limit int, window time.Duration) *bulkReadRule {
+	return &bulkReadRule{limit: limit, window: window, reads: make(map[uuid.UUID][]timedRead)}
+}
+
+func (r *bulkReadRule) evaluate(ev *event) []Alert {
+	if ev.record == nil || ev.entry.Action != models.AuditActionRead {
+		return nil
+	}
+	userID := *ev.entry.UserID
+	at := ev.entry.Timestamp
+
+	reads := pruneReads(append(r.reads[userID], timedRead{at: at, patient: ev.record.PatientID}), at.Add(-r.window))
+	r.reads[userID] = reads
+
+	patients := make(map[uuid.UUID]bool, len(reads))
+	for _, read := range reads {
+		patients[read.patient] = true
+	}
+	if len(patients) < r.limit {
+		return nil
+	}
+
+	minutes := int(r.window / time.Minute)
+	return []Alert{newAlert(RuleBulkRead, userID.String(), ev,
+		fmt.Sprintf("%s read %d distinct patients within %d minutes", actorName(ev), len(patients), minutes),
+		map[string]interface{}{"patients": len(patients), "minutes": minutes})}
+}
+
+func (r *bulkReadRule) sweep(now time.Time) {
+	for userID, reads := range r.reads {
+		if reads = pruneReads(reads, now.Add(-r.window)); len(reads) == 0 {
+			delete(r.reads, userID)
+		} else {
+			r.reads[userID] = reads
+		}
+	}
+}
+
+func pruneReads(reads []timedRead, since time.Time) []timedRead {
+	i := 0
+	for i < len(reads) && reads[i].at.Before(since) {
+		i++
+	}
+	return reads[i:]
+}
+
+// failedLoginRule flags many failed logins against one account or from one
+// address
+type failedLoginRule struct {
+	limit    int
+	window   time.Duration
+	attempts map[string][]time.Time
+}
+
+func newFailedLoginRule(limit int, window time.Duration) *failedLoginRule {
+	return &failedLoginRule{limit: limit, window: window, attempts: make(map[string][]time.Time)}
+}
+
+func (r *failedLoginRule) evaluate(ev *event) []Alert {
+	if ev.entry.Action != models.AuditActionLoginFailed {
+		return nil
+	}
+
+	var keys []string
+	if account := failedLoginAccount(ev.entry); account != "" {
+		keys = append(keys, "account:"+account)
+	}
+	if ev.entry.IPAddress != "" {
+		keys = append(keys, "ip:"+ev.entry.IPAddress)
+	}
+
+	var alerts []Alert
+	at := ev.entry.Timestamp
+	for _, key := range keys {
+		attempts := pruneTimes(append(r.attempts[key], at), at.Add(-r.window))
+		r.attempts[key] = attempts
+		if len(attempts) < r.limit {
+			continue
+		}
+
+		minutes := int(r.window / time.Minute)
+		kind, value, _ := strings.Cut(key, ":")
+		alerts = append(alerts, newAlert(RuleFailedLogins, key, ev,
+			fmt.Sprintf("%d failed logins for %s %s within %d minutes", len(attempts), kind, value, minutes),
+			map[string]interface{}{"attempts": len(attempts), "minutes": minutes, kind: value}))
+	}
+	return alerts
+}
+
+func (r *failedLoginRule) sweep(now time.Time) {
+	for key, attempts := range r.attempts {
+		if attempts = pruneTimes(attempts, now.Add(-r.window)); len(attempts) == 0 {
+			delete(r.attempts, key)
+		} else {
+			r.attempts[key] = attempts
+		}
+	}
+}
+
+// failedLoginAccount identifies the account a failed login was for: the user
+// when known, otherwise the email that was tried
+func failedLoginAccount(entry *models.AuditLog) string {
+	if entry.UserID != nil {
+		return entry.UserID.String()
+	}
+	var metadata struct {
+		Email string `json:"email"`
+	}
+	if entry.Metadata != "" && json.Unmarshal([]byte(entry.Metadata), &metadata) == nil && metadata.Email != "" {
+		return strings.ToLower(metadata.Email)
+	}
+	return entry.Username
+}
+
+func pruneTimes(times []time.Time, since time.Time) []time.Time {
+	i := 0
+	for i < len(times) && times[i].Before(since) {
+		i++
+	}
+	return times[i:]
+}
+
+// shiftRule flags record access outside the user's shift hours
+type shiftRule struct {
+	location     *time.Location
+	defaultStart string
+	defaultEnd   string
+	exempt       map[string]bool
+}
+
+func (r *shiftRule) evaluate(ev *event) []Alert {
+	if ev.record == nil || ev.user == nil || hasExemptRole(ev.user, r.exempt) {
+		return nil
+	}
+
+	start, end := ev.user.ShiftStart, ev.user.ShiftEnd
+	if start == "" || end == "" {
+		start, end = r.defaultStart, r.defaultEnd
+	}
+	startMinute, ok := minuteOfDay(start)
+	if !ok {
+		return nil
+	}
+	endMinute, ok := minuteOfDay(end)
+	if !ok {
+		return nil
+	}
+
+	local := ev.entry.Timestamp.In(r.location)
+	minute := local.Hour()*60 + local.Minute()
+	if withinShift(minute, startMinute, endMinute) {
+		return nil
+	}
+
+	return []Alert{newAlert(RuleOffShift, ev.user.ID.String(), ev,
+		fmt.Sprintf("%s accessed a patient record at %s, outside their %s-%s shift", actorName(ev), local.Format("15:04"), start, end),
+		map[string]interface{}{"local_time": local.Format(time.RFC3339), "shift_start": start, "shift_end": end})}
+}
+
+func (r *shiftRule) sweep(time.Time) {}
+
+// withinShift reports whether a minute of the day falls in a shift. A shift
+// ending before it starts runs overnight.
+func withinShift(minute, start, end int) bool {
+	if start == end {
+		return true
+	}
+	if start < end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// minuteOfDay parses an HH:MM time
+func minuteOfDay(value string) (int, bool) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// departmentRule flags access to encounters and appointments of another
+// department
+type departmentRule struct {
+	exempt map[string]bool
+}
+
+func (r *departmentRule) evaluate(ev *event) []Alert {
+	if ev.record == nil || ev.user == nil || hasExemptRole(ev.user, r.exempt) {
+		return nil
+	}
+	recordDepartment := strings.TrimSpace(ev.record.Department)
+	userDepartment := strings.TrimSpace(ev.user.Department)
+	if recordDepartment == "" || userDepartment == "" || strings.EqualFold(recordDepartment, userDepartment) {
+		return nil
+	}
+
+	return []Alert{newAlert(RuleDepartment, ev.user.ID.String()+":"+strings.ToLower(recordDepartment), ev,
+		fmt.Sprintf("%s of %s accessed a %s record of %s", actorName(ev), userDepartment, ev.entry.Resource, recordDepartment),
+		map[string]interface{}{"user_department": userDepartment, "record_department": recordDepartment})}
+}
+
+func (r *departmentRule) sweep(time.Time) {}
+
+// familyRule flags users opening their own record or a relative's, taken to
+// be a patient with the same surname at the same address
+type familyRule struct{}
+
+func (familyRule) evaluate(ev *event) []Alert {
+	if ev.record == nil || ev.user == nil {
+		return nil
+	}
+	address := normalize(ev.user.Address)
+	if address == "" || address != normalize(ev.record.Address) || normalize(ev.user.LastName) != normalize(ev.record.LastName) {
+		return nil
+	}
+
+	relation, whose := "family", "a family member's"
+	if normalize(ev.user.FirstName) == normalize(ev.record.FirstName) {
+		relation, whose = "own", "their own"
+	}
+	return []Alert{newAlert(RuleFamilyRecord, ev.user.ID.String()+":"+ev.record.PatientID.String(), ev,
+		fmt.Sprintf("%s accessed %s record", actorName(ev), whose),
+		map[string]interface{}{"relation": relation})}
+}
+
+func (familyRule) sweep(time.Time) {}
+
+// normalize folds case and whitespace for comparing names and addresses
+func normalize(value string) string {
+	return strings.ToLower(strings.Join(strings.Fields(value), " "))
+}
+
+func hasExemptRole(user *userProfile, exempt map[string]bool) bool {
+	for _, role := range user.Roles {
+		if exempt[role] {
+			return true
+		}
+	}
+	return false
+}
+
+func actorName(ev *event) string {
+	if ev.entry.Username != "" {
+		return ev.entry.Username
+	}
+	if ev.user != nil {
+		return strings.TrimSpace(ev.user.FirstName + " " + ev.user.LastName)
+	}
+	if ev.entry.UserID != nil {
+		return "user " + ev.entry.UserID.String()
+	}
+	return "unknown user"
+}
@@ -86,6 +86,33 @@ func (h *Handler) GetEncounter(c *gin.Context) {
 	c.JSON(http.StatusOK, encounter)
 }
 
+// GetEncounterByNumber godoc
+// @Summary Get encounter by number
+// @Description Get an encounter by encounter number; a mistyped number returns 400
+// @Tags encounters
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param number path string true "Encounter number"
+// @Success 200 {object} models.Encounter
+// @Failure 400 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/kunjungan/nomor/{number} [get]
+func (h *Handler) GetEncounterByNumber(c *gin.Context) {
+	encounter, err := h.service.GetEncounterByNumber(c.Request.Context(), c.Param("number"))
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.Set("audit_resource_id", encounter.ID)
+	c.JSON(http.StatusOK, encounter)
+}
+
 // ListEncounters godoc
 // @Summary List encounters
 // @Description Get a paginated list of encounters
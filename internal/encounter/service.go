@@ -2,12 +2,13 @@ package encounter
 
 import (
 	"context"
-	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/access"
 	"github.com/hospital-emr/backend/internal/common/errors"
 	"github.com/hospital-emr/backend/internal/models"
+	"github.com/hospital-emr/backend/internal/numbering"
 	"github.com/hospital-emr/backend/pkg/messaging"
 	"gorm.io/gorm"
 )
@@ -16,13 +17,17 @@ import (
 type Service struct {
 	db         *gorm.DB
 	natsClient *messaging.NATSClient
+	access     *access.Policy
+	numbers    *numbering.Service
 }
 
 // NewService creates a new encounter service
-func NewService(db *gorm.DB, natsClient *messaging.NATSClient) *Service {
+func NewService(db *gorm.DB, natsClient *messaging.NATSClient, accessPolicy *access.Policy, numbers *numbering.Service) *Service {
 	return &Service{
 		db:         db,
 		natsClient: natsClient,
+		access:     accessPolicy,
+		numbers:    numbers,
 	}
 }
 
@@ -50,6 +55,12 @@ func (s *Service) CreateEncounter(ctx context.Context, req *CreateEncounterReque
 		return nil, errors.ErrDatabaseError
 	}
 
+	// Opening an encounter creates a care relationship, so restricted
+	// clinicians need one with the patient already
+	if err := s.access.CheckPatient(ctx, req.PatientID); err != nil {
+		return nil, err
+	}
+
 	// Verify provider exists
 	var provider models.User
 	if err := s.db.WithContext(ctx).Where("id = ?", req.ProviderID).First(&provider).Error; err != nil {
@@ -60,7 +71,10 @@ func (s *Service) CreateEncounter(ctx context.Context, req *CreateEncounterReque
 	}
 
 	// Generate encounter number
-	encounterNumber := s.generateEncounterNumber()
+	encounterNumber, err := s.numbers.Next(ctx, models.NumberKindEncounter)
+	if err != nil {
+		return nil, errors.ErrDatabaseError.WithDetails(err.Error())
+	}
 
 	encounter := &models.Encounter{
 		EncounterNumber: encounterNumber,
@@ -116,12 +130,38 @@ func (s *Service) GetEncounter(ctx context.Context, id uuid.UUID) (*models.Encou
 	return &encounter, nil
 }
 
+// GetEncounterByNumber retrieves an encounter by encounter number. Lookups are
+// not covered by the access middleware, so the policy is applied here.
+func (s *Service) GetEncounterByNumber(ctx context.Context, number string) (*models.Encounter, error) {
+	if err := s.numbers.Validate(ctx, models.NumberKindEncounter, number); err != nil {
+		return nil, err
+	}
+
+	var id []uuid.UUID
+	if err := s.db.WithContext(ctx).Model(&models.Encounter{}).Where("encounter_number = ?", number).Pluck("id", &id).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+	if len(id) == 0 {
+		return nil, errors.ErrEncounterNotFound(number)
+	}
+
+	encounter, err := s.GetEncounter(ctx, id[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := s.access.CheckPatient(ctx, encounter.PatientID); err != nil {
+		return nil, err
+	}
+	return encounter, nil
+}
+
 // ListEncounters lists encounters with pagination
 func (s *Service) ListEncounters(ctx context.Context, page, pageSize int, patientID *uuid.UUID, providerID *uuid.UUID, status *models.EncounterStatus) ([]models.Encounter, int64, error) {
 	var encounters []models.Encounter
 	var total int64
 
-	query := s.db.WithContext(ctx).Model(&models.Encounter{})
+	query := s.db.WithContext(ctx).Model(&models.Encounter{}).
+		Scopes(s.access.ScopePatients(ctx, "encounters.patient_id"))
 
 	// Apply filters
 	if patientID != nil {
@@ -307,11 +347,6 @@ func (s *Service) RecordVitalSigns(ctx context.Context, encounterID uuid.UUID, r
 	return vitalSign, nil
 }
 
-// generateEncounterNumber generates a unique encounter number
-func (s *Service) generateEncounterNumber() string {
-	return fmt.Sprintf("ENC%d", time.Now().UnixNano()%1000000000)
-}
-
 // Request structures
 type AddClinicalNoteRequest struct {
 	NoteType   models.NoteType `json:"note_type" binding:"required"`
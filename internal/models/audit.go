@@ -9,25 +9,78 @@ import (
 
 // AuditLog represents an audit trail entry
 type AuditLog struct {
+	ID               uuid.UUID     `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Timestamp        time.Time     `gorm:"not null;index" json:"timestamp"`
+	UserID           *uuid.UUID    `gorm:"type:uuid;index" json:"user_id"`
+	Username         string        `json:"username"`
+	ServiceAccountID *uuid.UUID    `gorm:"type:uuid;index" json:"service_account_id"` // Set when a service account acted
+	Action           string        `gorm:"not null;index" json:"action"`              // CREATE, READ, UPDATE, DELETE, LOGIN, LOGOUT
+	Resource         string        `gorm:"not null;index" json:"resource"`            // patient, encounter, order, etc.
+	ResourceID       *uuid.UUID    `gorm:"type:uuid;index" json:"resource_id"`
+	Description      string        `json:"description"`
+	IPAddress        string        `json:"ip_address"`
+	UserAgent        string        `json:"user_agent"`
+	RequestMethod    string        `json:"request_method"`
+	RequestPath      string        `json:"request_path"`
+	StatusCode       int           `json:"status_code"`
+	RequestID        string        `gorm:"type:varchar(64);index" json:"request_id"` // Correlates entries with request logs
+	ChangesOld       string        `gorm:"type:jsonb" json:"changes_old"`
+	ChangesNew       string        `gorm:"type:jsonb" json:"changes_new"`
+	Metadata         string        `gorm:"type:jsonb" json:"metadata"`
+	Severity         AuditSeverity `gorm:"type:varchar(20)" json:"severity"`
+
+	// Hash chain; entries written before the chain was enabled have no sequence
+	Sequence *int64 `gorm:"uniqueIndex" json:"sequence"`
+	PrevHash string `gorm:"type:varchar(64)" json:"prev_hash"`
+	HMAC     string `gorm:"column:hmac;type:varchar(64)" json:"hmac"`
+}
+
+// AuditArchive records a monthly audit_logs partition moved to an archive
+// file. The row outlives the file so the hash chain can still be verified
+// across the gap the partition leaves behind.
+type AuditArchive struct {
 	ID            uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	Timestamp     time.Time  `gorm:"not null;index" json:"timestamp"`
-	UserID        *uuid.UUID `gorm:"type:uuid;index" json:"user_id"`
-	Username      string     `json:"username"`
-	Action        string     `gorm:"not null;index" json:"action"` // CREATE, READ, UPDATE, DELETE, LOGIN, LOGOUT
-	Resource      string     `gorm:"not null;index" json:"resource"` // patient, encounter, order, etc.
-	ResourceID    *uuid.UUID `gorm:"type:uuid;index" json:"resource_id"`
-	Description   string     `json:"description"`
-	IPAddress     string     `json:"ip_address"`
-	UserAgent     string     `json:"user_agent"`
-	RequestMethod string     `json:"request_method"`
-	RequestPath   string     `json:"request_path"`
-	StatusCode    int        `json:"status_code"`
-	ChangesOld    string     `gorm:"type:jsonb" json:"changes_old"`
-	ChangesNew    string     `gorm:"type:jsonb" json:"changes_new"`
-	Metadata      string     `gorm:"type:jsonb" json:"metadata"`
-	Severity      AuditSeverity `gorm:"type:varchar(20)" json:"severity"`
+	Partition     string     `gorm:"type:varchar(63);uniqueIndex;not null" json:"partition"`
+	PeriodStart   time.Time  `gorm:"not null" json:"period_start"`
+	PeriodEnd     time.Time  `gorm:"not null" json:"period_end"`
+	FileName      string     `gorm:"not null" json:"file_name"`
+	SHA256        string     `gorm:"column:sha256;type:varchar(64);not null" json:"sha256"` // Of the compressed file
+	SizeBytes     int64      `json:"size_bytes"`
+	Entries       int64      `json:"entries"`
+	Segments      string     `gorm:"type:jsonb" json:"segments"` // Runs of consecutive chain sequences in the archive
+	Signature     string     `gorm:"type:varchar(64)" json:"signature"`
+	ArchivedAt    time.Time  `gorm:"not null" json:"archived_at"`
+	RetainUntil   time.Time  `gorm:"not null;index" json:"retain_until"`
+	PurgedAt      *time.Time `json:"purged_at"`
+	RestoredTable string     `gorm:"type:varchar(63)" json:"restored_table,omitempty"`
+	RestoredAt    *time.Time `json:"restored_at,omitempty"`
+}
+
+// TableName specifies table name
+func (AuditArchive) TableName() string { return "audit_archives" }
+
+// LegalHold exempts the audit trail of a patient or user from purging
+type LegalHold struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	SubjectType string     `gorm:"type:varchar(20);not null;index:idx_legal_holds_subject" json:"subject_type"` // patient, user
+	SubjectID   uuid.UUID  `gorm:"type:uuid;not null;index:idx_legal_holds_subject" json:"subject_id"`
+	Reason      string     `gorm:"not null" json:"reason"`
+	Reference   string     `json:"reference"` // Case or request number
+	PlacedBy    string     `gorm:"not null" json:"placed_by"`
+	PlacedAt    time.Time  `gorm:"not null" json:"placed_at"`
+	ReleasedBy  string     `json:"released_by,omitempty"`
+	ReleasedAt  *time.Time `json:"released_at,omitempty"`
 }
 
+// Legal hold subjects
+const (
+	LegalHoldPatient = "patient"
+	LegalHoldUser    = "user"
+)
+
+// TableName specifies table name
+func (LegalHold) TableName() string { return "legal_holds" }
+
 // AuditSeverity represents audit log severity
 type AuditSeverity string
 
@@ -38,6 +91,44 @@ const (
 	AuditSeverityCritical AuditSeverity = "critical"
 )
 
+// Audit actions
+const (
+	AuditActionCreate = "CREATE"
+	AuditActionRead   = "READ"
+	AuditActionUpdate = "UPDATE"
+	AuditActionDelete = "DELETE"
+	AuditActionLogin  = "LOGIN"
+	AuditActionLogout = "LOGOUT"
+
+	AuditActionLoginFailed          = "LOGIN_FAILED"
+	AuditActionAccountLocked        = "ACCOUNT_LOCKED"
+	AuditActionPasswordChange       = "PASSWORD_CHANGE"
+	AuditActionPasswordResetRequest = "PASSWORD_RESET_REQUEST"
+	AuditActionPasswordReset        = "PASSWORD_RESET"
+	AuditActionTemporaryPassword    = "TEMPORARY_PASSWORD"
+	AuditActionTokenReuse           = "TOKEN_REUSE"
+	AuditActionAccessDenied         = "ACCESS_DENIED"
+	AuditActionEmergencyAccess      = "EMERGENCY_ACCESS"
+	AuditActionEmergencyReview      = "EMERGENCY_ACCESS_REVIEW"
+	AuditActionStatusChange         = "STATUS_CHANGE"
+	AuditActionAccountUnlock        = "ACCOUNT_UNLOCK"
+	AuditActionRoleAssign           = "ROLE_ASSIGN"
+	AuditActionRoleRemove           = "ROLE_REMOVE"
+	AuditActionPermissionChange     = "PERMISSION_CHANGE"
+	AuditActionAPIKeyCreate         = "API_KEY_CREATE"
+	AuditActionAPIKeyRevoke         = "API_KEY_REVOKE"
+	AuditActionIdentityLink         = "IDENTITY_LINK"
+	AuditActionSessionEvicted       = "SESSION_EVICTED"
+	AuditActionWebAuthnRegister     = "WEBAUTHN_REGISTER"
+	AuditActionWebAuthnRemove       = "WEBAUTHN_REMOVE"
+	AuditActionArchive              = "ARCHIVE"
+	AuditActionPurge                = "PURGE"
+	AuditActionRestore              = "RESTORE"
+	AuditActionLegalHold            = "LEGAL_HOLD"
+	AuditActionLegalHoldRelease     = "LEGAL_HOLD_RELEASE"
+	AuditActionSuspiciousAccess     = "SUSPICIOUS_ACCESS"
+)
+
 // TableName specifies table name
 func (AuditLog) TableName() string { return "audit_logs" }
 
@@ -49,5 +140,15 @@ func (a *AuditLog) BeforeCreate(tx *gorm.DB) error {
 	if a.Timestamp.IsZero() {
 		a.Timestamp = time.Now().UTC()
 	}
+	// jsonb columns reject empty strings
+	if a.ChangesOld == "" {
+		a.ChangesOld = "{}"
+	}
+	if a.ChangesNew == "" {
+		a.ChangesNew = "{}"
+	}
+	if a.Metadata == "" {
+		a.Metadata = "{}"
+	}
 	return nil
 }
@@ -38,3 +38,17 @@ type AuditableModel struct {
 	CreatedBy uuid.UUID `gorm:"type:uuid" json:"created_by"`
 	UpdatedBy uuid.UUID `gorm:"type:uuid" json:"updated_by"`
 }
+
+// AuditActor returns the user who last wrote the record
+func (m AuditableModel) AuditActor() uuid.UUID {
+	if m.UpdatedBy != uuid.Nil {
+		return m.UpdatedBy
+	}
+	return m.CreatedBy
+}
+
+// Auditable is implemented by models whose creates, updates and deletes are
+// recorded field by field in the audit trail
+type Auditable interface {
+	AuditActor() uuid.UUID
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CareTeamAssignment explicitly grants a clinician access to a patient's
+// record for a period of time, independent of encounters and appointments
+type CareTeamAssignment struct {
+	BaseModel
+	PatientID  uuid.UUID  `gorm:"type:uuid;not null;index" json:"patient_id"`
+	UserID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	User       User       `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Role       string     `gorm:"type:varchar(50)" json:"role"` // e.g. attending, consulting, primary_nurse
+	Reason     string     `json:"reason"`
+	StartsAt   time.Time  `gorm:"not null" json:"starts_at"`
+	EndsAt     *time.Time `json:"ends_at"`
+	AssignedBy uuid.UUID  `gorm:"type:uuid" json:"assigned_by"`
+	EndedBy    *uuid.UUID `gorm:"type:uuid" json:"ended_by"`
+}
+
+// TableName specifies table name
+func (CareTeamAssignment) TableName() string { return "care_team_assignments" }
+
+// EmergencyAccessReviewStatus represents the review outcome of a break-the-glass override
+type EmergencyAccessReviewStatus string
+
+const (
+	EmergencyAccessPending     EmergencyAccessReviewStatus = "pending"
+	EmergencyAccessJustified   EmergencyAccessReviewStatus = "justified"
+	EmergencyAccessUnjustified EmergencyAccessReviewStatus = "unjustified"
+)
+
+// EmergencyAccess is a time-boxed break-the-glass override granting a user
+// access to one patient's record outside any care relationship. Every
+// override is queued for review by a privacy officer.
+type EmergencyAccess struct {
+	BaseModel
+	PatientID    uuid.UUID                   `gorm:"type:uuid;not null;index" json:"patient_id"`
+	UserID       uuid.UUID                   `gorm:"type:uuid;not null;index" json:"user_id"`
+	User         User                        `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Reason       string                      `gorm:"type:text;not null" json:"reason"`
+	ExpiresAt    time.Time                   `gorm:"not null;index" json:"expires_at"`
+	IPAddress    string                      `json:"ip_address"`
+	ReviewStatus EmergencyAccessReviewStatus `gorm:"type:varchar(20);not null;default:'pending';index" json:"review_status"`
+	ReviewedBy   *uuid.UUID                  `gorm:"type:uuid" json:"reviewed_by"`
+	ReviewedAt   *time.Time                  `json:"reviewed_at"`
+	ReviewNotes  string                      `gorm:"type:text" json:"review_notes"`
+}
+
+// TableName specifies table name
+func (EmergencyAccess) TableName() string { return "emergency_accesses" }
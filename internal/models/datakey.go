@@ -0,0 +1,15 @@
+package models
+
+// DataKey is a version of the data encryption key of a table, stored wrapped
+// by a key-encryption key (KEK) of the configured key provider. Encrypted
+// values name the version they were written with in their header.
+type DataKey struct {
+	BaseModel
+	Scope      string `gorm:"not null;uniqueIndex:idx_data_keys_version" json:"scope"` // Table the key encrypts
+	Version    int    `gorm:"not null;uniqueIndex:idx_data_keys_version" json:"version"`
+	KEKID      string `gorm:"column:kek_id;not null" json:"kek_id"`
+	WrappedKey []byte `gorm:"not null" json:"-"`
+}
+
+// TableName specifies table name
+func (DataKey) TableName() string { return "data_keys" }
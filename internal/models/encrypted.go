@@ -0,0 +1,174 @@
+package models
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/hospital-emr/backend/pkg/encryption"
+)
+
+// fieldCipher encrypts EncryptedString and encrypted JSONB columns. Nil
+// leaves them in plaintext.
+var fieldCipher atomic.Pointer[encryption.FieldCipher]
+
+// SetFieldCipher turns field encryption on, or off with nil. Values already
+// encrypted can only be read while it is on.
+func SetFieldCipher(c *encryption.FieldCipher) {
+	fieldCipher.Store(c)
+}
+
+// FieldEncryptionEnabled reports whether field encryption is on
+func FieldEncryptionEnabled() bool {
+	return fieldCipher.Load() != nil
+}
+
+// FieldCipher returns the cipher of encrypted fields, nil while field
+// encryption is off
+func FieldCipher() *encryption.FieldCipher {
+	return fieldCipher.Load()
+}
+
+// EncryptedString is a string column stored encrypted while field encryption
+// is on. Values written in plaintext before are read as they are.
+type EncryptedString string
+
+// Value implements driver.Valuer interface
+func (s EncryptedString) Value() (driver.Value, error) {
+	return encryptField(string(s))
+}
+
+// Scan implements sql.Scanner interface
+func (s *EncryptedString) Scan(value interface{}) error {
+	var raw string
+	switch v := value.(type) {
+	case nil:
+		*s = ""
+		return nil
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("failed to scan encrypted value: %T", value)
+	}
+
+	plaintext, err := decryptField(raw)
+	if err != nil {
+		return err
+	}
+	*s = EncryptedString(plaintext)
+	return nil
+}
+
+// Column types are converted by database/sql without the request context,
+// so the keyring is called with the background one. It only reaches the key
+// store and KEK provider on first use and once per refresh interval.
+func encryptField(plaintext string) (string, error) {
+	c := fieldCipher.Load()
+	if c == nil || plaintext == "" {
+		return plaintext, nil
+	}
+	return c.Encrypt(context.Background(), plaintext)
+}
+
+func decryptField(value string) (string, error) {
+	if !encryption.IsEncrypted(value) {
+		return value, nil
+	}
+	c := fieldCipher.Load()
+	if c == nil {
+		return "", fmt.Errorf("value is encrypted but field encryption is not enabled")
+	}
+	return c.Decrypt(context.Background(), value)
+}
+
+// encryptJSON marshals a JSONB value. While field encryption is on the JSON
+// is stored encrypted as a JSON string, so the column stays valid jsonb.
+func encryptJSON(v interface{}) (driver.Value, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	c := fieldCipher.Load()
+	if c == nil {
+		return data, nil
+	}
+	encrypted, err := c.Encrypt(context.Background(), string(data))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(encrypted)
+}
+
+// decryptJSON unmarshals a JSONB value written by encryptJSON
+func decryptJSON(value interface{}, v interface{}) error {
+	var data []byte
+	switch raw := value.(type) {
+	case []byte:
+		data = raw
+	case string:
+		data = []byte(raw)
+	default:
+		return fmt.Errorf("failed to unmarshal JSONB value: %v", value)
+	}
+
+	var encrypted string
+	if json.Unmarshal(data, &encrypted) == nil {
+		plaintext, err := decryptField(encrypted)
+		if err != nil {
+			return err
+		}
+		data = []byte(plaintext)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// blindIndexes normalize the encrypted patient columns that can be looked up
+// by exact match before they are hashed into their <column>_index column
+var blindIndexes = map[string]func(string) string{
+	"ssn":           digitsOnly,
+	"email":         func(email string) string { return strings.ToLower(strings.TrimSpace(email)) },
+	"phone_number":  digitsOnly,
+	"mobile_number": digitsOnly,
+}
+
+func blindIndex(column, value string) string {
+	c := fieldCipher.Load()
+	if c == nil {
+		return ""
+	}
+	return c.BlindIndex(blindIndexes[column](value))
+}
+
+// PatientLookup returns a condition matching patients whose column equals
+// any of values. While field encryption is on it compares the blind indexes
+// of the normalized values, so "+62 812-3456" matches "62812 3456".
+func PatientLookup(column string, values ...string) (string, []string) {
+	if !FieldEncryptionEnabled() {
+		return column + " IN ?", values
+	}
+
+	seen := make(map[string]bool)
+	var indexes []string
+	for _, value := range values {
+		if index := blindIndex(column, value); index != "" && !seen[index] {
+			seen[index] = true
+			indexes = append(indexes, index)
+		}
+	}
+	return column + "_index IN ?", indexes
+}
+
+func digitsOnly(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, value)
+}
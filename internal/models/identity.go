@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserIdentity links a user to an account at an external identity provider.
+// The subject is the provider's stable ID for the account (OIDC sub, LDAP DN).
+type UserIdentity struct {
+	BaseModel
+	UserID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	User        User       `gorm:"foreignKey:UserID" json:"-"`
+	Provider    string     `gorm:"type:varchar(50);not null;uniqueIndex:idx_user_identities_subject" json:"provider"`
+	Subject     string     `gorm:"not null;uniqueIndex:idx_user_identities_subject" json:"subject"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+// SSOLoginState tracks an OIDC login between the redirect to the provider and
+// the callback. Only the hash of the state parameter is stored; each state
+// can complete one login.
+type SSOLoginState struct {
+	BaseModel
+	StateHash    string     `gorm:"uniqueIndex;not null" json:"-"`
+	Provider     string     `gorm:"type:varchar(50);not null" json:"provider"`
+	Nonce        string     `gorm:"not null" json:"-"`
+	CodeVerifier string     `gorm:"not null" json:"-"`
+	IPAddress    string     `json:"ip_address"`
+	ExpiresAt    time.Time  `gorm:"not null;index" json:"expires_at"`
+	UsedAt       *time.Time `json:"used_at"`
+}
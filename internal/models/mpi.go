@@ -0,0 +1,143 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DuplicateLevel grades how likely two patient records are the same person
+type DuplicateLevel string
+
+const (
+	DuplicatePossible DuplicateLevel = "possible"
+	DuplicateProbable DuplicateLevel = "probable"
+)
+
+// DuplicateStatus represents the review outcome of a suspected duplicate
+type DuplicateStatus string
+
+const (
+	DuplicatePending      DuplicateStatus = "pending"
+	DuplicateConfirmed    DuplicateStatus = "duplicate"
+	DuplicateNotDuplicate DuplicateStatus = "not_duplicate"
+	DuplicateMerged       DuplicateStatus = "merged"
+)
+
+// Sources of suspected duplicates
+const (
+	DuplicateSourceRegistration = "registration" // Created after the registering user confirmed a warning
+	DuplicateSourceScan         = "scan"         // Found by cmd/mpiscan
+)
+
+// PatientDuplicate is a pair of patient records the master patient index
+// suspects belong to the same person, queued for review. PatientID is the
+// newer of the two records.
+type PatientDuplicate struct {
+	BaseModel
+	PatientID   uuid.UUID       `gorm:"type:uuid;not null;uniqueIndex:idx_patient_duplicates_pair" json:"patient_id"`
+	Patient     Patient         `gorm:"foreignKey:PatientID" json:"patient,omitempty"`
+	CandidateID uuid.UUID       `gorm:"type:uuid;not null;uniqueIndex:idx_patient_duplicates_pair;index" json:"candidate_id"`
+	Candidate   Patient         `gorm:"foreignKey:CandidateID" json:"candidate,omitempty"`
+	Score       float64         `gorm:"not null" json:"score"`
+	Level       DuplicateLevel  `gorm:"type:varchar(20);not null" json:"level"`
+	Fields      MatchScores     `gorm:"type:jsonb" json:"fields"`
+	Source      string          `gorm:"type:varchar(20);not null" json:"source"`
+	Status      DuplicateStatus `gorm:"type:varchar(20);not null;default:'pending';index" json:"status"`
+	ReviewedBy  *uuid.UUID      `gorm:"type:uuid" json:"reviewed_by"`
+	ReviewedAt  *time.Time      `json:"reviewed_at"`
+	ReviewNotes string          `gorm:"type:text" json:"review_notes"`
+}
+
+// TableName specifies table name
+func (PatientDuplicate) TableName() string { return "patient_duplicates" }
+
+// MatchScores holds the similarity, from 0 to 1, of each field compared
+// between two patient records
+type MatchScores map[string]float64
+
+// Scan implements sql.Scanner interface for JSONB
+func (m *MatchScores) Scan(value interface{}) error {
+	if value == nil {
+		*m = nil
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("failed to unmarshal JSONB value: %v", value)
+	}
+
+	return json.Unmarshal(bytes, m)
+}
+
+// Value implements driver.Valuer interface for JSONB
+func (m MatchScores) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	return json.Marshal(m)
+}
+
+// PatientMerge records a retired patient record merged into a surviving one.
+// Rows moved to the survivor are listed so the merge can be undone until
+// UnmergeableAfter.
+type PatientMerge struct {
+	BaseModel
+	SurvivorID       uuid.UUID     `gorm:"type:uuid;not null;index" json:"survivor_id"`
+	RetiredID        uuid.UUID     `gorm:"type:uuid;not null;index" json:"retired_id"`
+	RetiredMRN       string        `gorm:"not null" json:"retired_mrn"`
+	RetiredStatus    PatientStatus `gorm:"type:varchar(20)" json:"retired_status"` // Restored on unmerge
+	DuplicateID      *uuid.UUID    `gorm:"type:uuid" json:"duplicate_id"`
+	Reason           string        `gorm:"type:text" json:"reason"`
+	MovedRows        MovedRows     `gorm:"type:jsonb" json:"moved_rows"`
+	MergedBy         uuid.UUID     `gorm:"type:uuid" json:"merged_by"`
+	UnmergeableAfter time.Time     `gorm:"not null" json:"unmergeable_after"`
+	UnmergedBy       *uuid.UUID    `gorm:"type:uuid" json:"unmerged_by"`
+	UnmergedAt       *time.Time    `json:"unmerged_at"`
+	UnmergeReason    string        `gorm:"type:text" json:"unmerge_reason"`
+}
+
+// TableName specifies table name
+func (PatientMerge) TableName() string { return "patient_merges" }
+
+// PatientMRNAlias keeps the MRN of a retired record pointing at the patient
+// it was merged into
+type PatientMRNAlias struct {
+	BaseModel
+	MRN       string    `gorm:"uniqueIndex;not null" json:"mrn"`
+	PatientID uuid.UUID `gorm:"type:uuid;not null;index" json:"patient_id"`
+	MergeID   uuid.UUID `gorm:"type:uuid;not null;index" json:"merge_id"`
+}
+
+// TableName specifies table name
+func (PatientMRNAlias) TableName() string { return "patient_mrn_aliases" }
+
+// MovedRows lists the IDs of the rows a merge moved, keyed by table
+type MovedRows map[string][]uuid.UUID
+
+// Scan implements sql.Scanner interface for JSONB
+func (m *MovedRows) Scan(value interface{}) error {
+	if value == nil {
+		*m = nil
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("failed to unmarshal JSONB value: %v", value)
+	}
+
+	return json.Unmarshal(bytes, m)
+}
+
+// Value implements driver.Valuer interface for JSONB
+func (m MovedRows) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	return json.Marshal(m)
+}
@@ -0,0 +1,49 @@
+package models
+
+// NumberKind identifies a series of generated numbers
+type NumberKind string
+
+const (
+	NumberKindMRN         NumberKind = "mrn"
+	NumberKindEncounter   NumberKind = "encounter"
+	NumberKindAppointment NumberKind = "appointment"
+)
+
+// DateSegment is the date written between the prefix and the counter. The
+// counter restarts whenever the segment changes.
+type DateSegment string
+
+const (
+	DateSegmentNone   DateSegment = ""
+	DateSegmentYYYY   DateSegment = "YYYY"
+	DateSegmentYY     DateSegment = "YY"
+	DateSegmentYYYYMM DateSegment = "YYYYMM"
+	DateSegmentYYMM   DateSegment = "YYMM"
+)
+
+// CheckDigit is the algorithm of the digit appended to catch mistyped numbers
+type CheckDigit string
+
+const (
+	CheckDigitNone  CheckDigit = "none"
+	CheckDigitLuhn  CheckDigit = "luhn"
+	CheckDigitMod11 CheckDigit = "mod11"
+)
+
+// NumberFormat is the layout of the numbers of a kind issued at a facility in
+// a year: prefix, date segment, zero-padded counter and check digit. An empty
+// facility or a year of 0 applies to all of them. Replaced formats are soft
+// deleted and kept so the numbers issued in them still validate.
+type NumberFormat struct {
+	AuditableModel
+	Kind         NumberKind  `gorm:"type:varchar(20);not null;uniqueIndex:idx_number_formats_scope,where:deleted_at IS NULL" json:"kind"`
+	Facility     string      `gorm:"type:varchar(20);not null;default:'';uniqueIndex:idx_number_formats_scope" json:"facility"`
+	Year         int         `gorm:"not null;default:0;uniqueIndex:idx_number_formats_scope" json:"year"`
+	Prefix       string      `gorm:"type:varchar(12)" json:"prefix"`
+	DateSegment  DateSegment `gorm:"type:varchar(8)" json:"date_segment"`
+	CounterWidth int         `gorm:"not null" json:"counter_width"`
+	CheckDigit   CheckDigit  `gorm:"type:varchar(10);not null;default:'none'" json:"check_digit"`
+}
+
+// TableName specifies table name
+func (NumberFormat) TableName() string { return "number_formats" }
@@ -2,11 +2,10 @@ package models
 
 import (
 	"database/sql/driver"
-	"encoding/json"
-	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 // Patient represents a patient in the system
@@ -16,25 +15,30 @@ type Patient struct {
 	FirstName       string          `gorm:"not null" json:"first_name"`
 	LastName        string          `gorm:"not null" json:"last_name"`
 	MiddleName      string          `json:"middle_name"`
-	DateOfBirth     time.Time       `gorm:"not null" json:"date_of_birth"`
+	DateOfBirth     time.Time       `gorm:"not null;index" json:"date_of_birth"`
 	Gender          Gender          `gorm:"type:varchar(20);not null" json:"gender"`
 	BloodType       string          `json:"blood_type"`
 	MaritalStatus   MaritalStatus   `gorm:"type:varchar(20)" json:"marital_status"`
 	Nationality     string          `json:"nationality"`
 	Religion        string          `json:"religion"`
-	SSN             string          `gorm:"index" json:"ssn"` // Social Security Number / National ID
-	PassportNumber  string          `json:"passport_number"`
-	Email           string          `json:"email"`
-	PhoneNumber     string          `json:"phone_number"`
-	MobileNumber    string          `json:"mobile_number"`
-	Address         string          `json:"address"`
+	SSN             EncryptedString `json:"ssn" audit:"mask"` // Social Security Number / National ID
+	PassportNumber  EncryptedString `json:"passport_number" audit:"mask"`
+	Email           EncryptedString `json:"email" audit:"mask"`
+	PhoneNumber     EncryptedString `json:"phone_number" audit:"mask"`
+	MobileNumber    EncryptedString `json:"mobile_number" audit:"mask"`
+	Address         EncryptedString `json:"address" audit:"mask"`
+	SSNIndex        string          `gorm:"column:ssn_index;index" json:"-"` // Blind indexes for exact-match lookups, see PatientLookup
+	EmailIndex      string          `gorm:"column:email_index;index" json:"-"`
+	PhoneIndex      string          `gorm:"column:phone_number_index;index" json:"-"`
+	MobileIndex     string          `gorm:"column:mobile_number_index;index" json:"-"`
 	City            string          `json:"city"`
 	State           string          `json:"state"`
 	ZipCode         string          `json:"zip_code"`
 	Country         string          `json:"country"`
-	EmergencyContact EmergencyContact `gorm:"type:jsonb" json:"emergency_contact"`
-	Insurance       Insurance       `gorm:"type:jsonb" json:"insurance"`
+	EmergencyContact EmergencyContact `gorm:"type:jsonb" json:"emergency_contact" audit:"mask"`
+	Insurance       Insurance       `gorm:"type:jsonb" json:"insurance" audit:"mask"`
 	Status          PatientStatus   `gorm:"type:varchar(20);default:'active'" json:"status"`
+	MergedIntoID    *uuid.UUID      `gorm:"type:uuid;index" json:"merged_into_id,omitempty"` // Surviving record once this one is merged
 	ProfilePhoto    string          `json:"profile_photo"`
 	Language        string          `json:"language"`
 	Occupation      string          `json:"occupation"`
@@ -44,6 +48,21 @@ type Patient struct {
 	Medications     []Medication    `gorm:"foreignKey:PatientID" json:"medications,omitempty"`
 }
 
+// BeforeSave refreshes the blind indexes of the encrypted lookup columns
+func (p *Patient) BeforeSave(tx *gorm.DB) error {
+	p.SetBlindIndexes()
+	return nil
+}
+
+// SetBlindIndexes computes the blind indexes from the current field values.
+// They stay empty while field encryption is off.
+func (p *Patient) SetBlindIndexes() {
+	p.SSNIndex = blindIndex("ssn", string(p.SSN))
+	p.EmailIndex = blindIndex("email", string(p.Email))
+	p.PhoneIndex = blindIndex("phone_number", string(p.PhoneNumber))
+	p.MobileIndex = blindIndex("mobile_number", string(p.MobileNumber))
+}
+
 // Gender represents patient gender
 type Gender string
 
@@ -71,6 +90,7 @@ const (
 	PatientStatusActive   PatientStatus = "active"
 	PatientStatusInactive PatientStatus = "inactive"
 	PatientStatusDeceased PatientStatus = "deceased"
+	PatientStatusMerged   PatientStatus = "merged"
 )
 
 // EmergencyContact represents emergency contact information
@@ -89,12 +109,7 @@ func (ec *EmergencyContact) Scan(value interface{}) error {
 		return nil
 	}
 	
-	bytes, ok := value.([]byte)
-	if !ok {
-		return fmt.Errorf("failed to unmarshal JSONB value: %v", value)
-	}
-	
-	return json.Unmarshal(bytes, ec)
+	return decryptJSON(value, ec)
 }
 
 // Value implements driver.Valuer interface for JSONB
@@ -102,7 +117,7 @@ func (ec EmergencyContact) Value() (driver.Value, error) {
 	if ec == (EmergencyContact{}) {
 		return nil, nil
 	}
-	return json.Marshal(ec)
+	return encryptJSON(ec)
 }
 
 // Insurance represents insurance information
@@ -122,12 +137,7 @@ func (ins *Insurance) Scan(value interface{}) error {
 		return nil
 	}
 	
-	bytes, ok := value.([]byte)
-	if !ok {
-		return fmt.Errorf("failed to unmarshal JSONB value: %v", value)
-	}
-	
-	return json.Unmarshal(bytes, ins)
+	return decryptJSON(value, ins)
 }
 
 // Value implements driver.Valuer interface for JSONB
@@ -135,7 +145,7 @@ func (ins Insurance) Value() (driver.Value, error) {
 	if ins == (Insurance{}) {
 		return nil, nil
 	}
-	return json.Marshal(ins)
+	return encryptJSON(ins)
 }
 
 // Allergy represents patient allergies
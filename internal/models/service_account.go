@@ -0,0 +1,71 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ServiceAccount is a non-human principal used by integrations such as the
+// LIS, RIS and ERP connectors. It authenticates with API keys.
+type ServiceAccount struct {
+	BaseModel
+	Name        string    `gorm:"uniqueIndex;not null" json:"name"`
+	Description string    `json:"description"`
+	System      string    `gorm:"type:varchar(20)" json:"system"` // lis, ris, erp, fhir, other
+	IsActive    bool      `gorm:"default:true" json:"is_active"`
+	CreatedBy   uuid.UUID `gorm:"type:uuid" json:"created_by"`
+	APIKeys     []APIKey  `gorm:"foreignKey:ServiceAccountID" json:"api_keys,omitempty"`
+}
+
+// APIKey is a scoped credential of a service account. Only the hash of the
+// key is stored; the prefix identifies the key in listings and logs.
+type APIKey struct {
+	BaseModel
+	ServiceAccountID uuid.UUID      `gorm:"type:uuid;not null;index" json:"service_account_id"`
+	ServiceAccount   ServiceAccount `gorm:"foreignKey:ServiceAccountID" json:"-"`
+	Name             string         `json:"name"`
+	KeyPrefix        string         `gorm:"type:varchar(20);index" json:"key_prefix"`
+	KeyHash          string         `gorm:"uniqueIndex;not null" json:"-"`
+	Scopes           StringList     `gorm:"type:jsonb" json:"scopes"`      // Permission codes granted to the key
+	AllowedIPs       StringList     `gorm:"type:jsonb" json:"allowed_ips"` // IPs or CIDR ranges; empty allows any
+	ExpiresAt        *time.Time     `json:"expires_at"`
+	LastUsedAt       *time.Time     `json:"last_used_at"`
+	LastUsedIP       string         `json:"last_used_ip"`
+	RevokedAt        *time.Time     `json:"revoked_at"`
+	RevokedBy        *uuid.UUID     `gorm:"type:uuid" json:"revoked_by"`
+	CreatedBy        uuid.UUID      `gorm:"type:uuid" json:"created_by"`
+}
+
+// StringList is a list of strings stored as a JSONB array
+type StringList []string
+
+// Scan implements sql.Scanner interface
+func (l *StringList) Scan(value interface{}) error {
+	if value == nil {
+		*l = nil
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("failed to unmarshal JSONB value: %v", value)
+	}
+
+	return json.Unmarshal(bytes, l)
+}
+
+// Value implements driver.Valuer interface
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	return json.Marshal(l)
+}
+
+// TableName specifies table names
+func (ServiceAccount) TableName() string { return "service_accounts" }
+func (APIKey) TableName() string         { return "api_keys" }
@@ -9,22 +9,30 @@ import (
 // User represents a system user (doctor, nurse, admin, etc.)
 type User struct {
 	BaseModel
-	Email           string     `gorm:"uniqueIndex;not null" json:"email"`
-	PasswordHash    string     `gorm:"not null" json:"-"`
-	FirstName       string     `gorm:"not null" json:"first_name"`
-	LastName        string     `gorm:"not null" json:"last_name"`
-	PhoneNumber     string     `json:"phone_number"`
-	Status          UserStatus `gorm:"type:varchar(20);not null;default:'active'" json:"status"`
-	MFAEnabled      bool       `gorm:"default:false" json:"mfa_enabled"`
-	MFASecret       string     `json:"-"`
-	LastLoginAt     *time.Time `json:"last_login_at"`
-	LastLoginIP     string     `json:"last_login_ip"`
-	PasswordExpiry  *time.Time `json:"password_expiry"`
-	LicenseNumber   string     `json:"license_number"`
-	Specialty       string     `json:"specialty"`
-	Department      string     `json:"department"`
-	Roles           []Role     `gorm:"many2many:user_roles;" json:"roles"`
-	Sessions        []Session  `gorm:"foreignKey:UserID" json:"-"`
+	Email               string     `gorm:"uniqueIndex;not null" json:"email"`
+	PasswordHash        string     `gorm:"not null" json:"-"`
+	FirstName           string     `gorm:"not null" json:"first_name"`
+	LastName            string     `gorm:"not null" json:"last_name"`
+	PhoneNumber         string     `json:"phone_number"`
+	Status              UserStatus `gorm:"type:varchar(20);not null;default:'active'" json:"status"`
+	MFAEnabled          bool       `gorm:"default:false" json:"mfa_enabled"`
+	MFASecret           string     `json:"-"` // Encrypted TOTP secret
+	MFALastUsedStep     int64      `gorm:"default:0" json:"-"`
+	LastLoginAt         *time.Time `json:"last_login_at"`
+	LastLoginIP         string     `json:"last_login_ip"`
+	PasswordExpiry      *time.Time `json:"password_expiry"`
+	PasswordChangedAt   *time.Time `json:"password_changed_at"`
+	MustChangePassword  bool       `gorm:"default:false" json:"must_change_password"`
+	FailedLoginAttempts int        `gorm:"default:0" json:"failed_login_attempts"`
+	LockedUntil         *time.Time `json:"locked_until"`
+	LicenseNumber       string     `json:"license_number"`
+	Specialty           string     `json:"specialty"`
+	Department          string     `json:"department"`
+	Address             string     `json:"address"`
+	ShiftStart          string     `gorm:"type:varchar(5)" json:"shift_start"` // HH:MM; empty when the user has no fixed shift
+	ShiftEnd            string     `gorm:"type:varchar(5)" json:"shift_end"`   // HH:MM; before ShiftStart for overnight shifts
+	Roles               []Role     `gorm:"many2many:user_roles;" json:"roles"`
+	Sessions            []Session  `gorm:"foreignKey:UserID" json:"-"`
 }
 
 // UserStatus represents user account status
@@ -59,18 +67,50 @@ type Permission struct {
 	Roles       []Role `gorm:"many2many:role_permissions;" json:"-"`
 }
 
-// Session represents a user session
+// Session represents a user session. Each refresh token rotation creates a new
+// session in the same family and marks the previous one as rotated.
 type Session struct {
+	BaseModel
+	UserID           uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	User             User       `gorm:"foreignKey:UserID" json:"-"`
+	FamilyID         uuid.UUID  `gorm:"type:uuid;index" json:"family_id"`
+	Token            string     `gorm:"uniqueIndex;not null" json:"-"`
+	RefreshTokenHash string     `gorm:"column:refresh_token;uniqueIndex;not null" json:"-"`
+	ExpiresAt        time.Time  `gorm:"not null" json:"expires_at"`
+	RefreshExpiresAt *time.Time `json:"refresh_expires_at"`
+	IPAddress        string     `json:"ip_address"`
+	UserAgent        string     `json:"user_agent"`
+	IsActive         bool       `gorm:"default:true" json:"is_active"`
+	LastActivityAt   *time.Time `gorm:"index" json:"last_activity_at"`
+	RotatedAt        *time.Time `json:"rotated_at"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+	RevokedReason    string     `gorm:"type:varchar(30)" json:"revoked_reason,omitempty"` // logout, idle_timeout, evicted, revoked, password_change, token_reuse
+}
+
+// MFARecoveryCode represents a hashed one-time MFA recovery code
+type MFARecoveryCode struct {
+	BaseModel
+	UserID   uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	CodeHash string     `gorm:"uniqueIndex;not null" json:"-"`
+	UsedAt   *time.Time `json:"used_at"`
+}
+
+// PasswordHistory keeps previous password hashes to prevent reuse
+type PasswordHistory struct {
 	BaseModel
 	UserID       uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
-	User         User      `gorm:"foreignKey:UserID" json:"-"`
-	Token        string    `gorm:"uniqueIndex;not null" json:"-"`
-	RefreshToken string    `gorm:"uniqueIndex;not null" json:"-"`
-	ExpiresAt    time.Time `gorm:"not null" json:"expires_at"`
-	IPAddress    string    `json:"ip_address"`
-	UserAgent    string    `json:"user_agent"`
-	IsActive     bool      `gorm:"default:true" json:"is_active"`
-	RevokedAt    *time.Time `json:"revoked_at"`
+	PasswordHash string    `gorm:"not null" json:"-"`
+}
+
+// PasswordResetToken is a single-use token for the forgot-password flow.
+// Only the hash of the token is stored.
+type PasswordResetToken struct {
+	BaseModel
+	UserID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	TokenHash   string     `gorm:"uniqueIndex;not null" json:"-"`
+	ExpiresAt   time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt      *time.Time `json:"used_at"`
+	RequestedIP string     `json:"requested_ip"`
 }
 
 // TableName specifies table names
@@ -78,6 +118,9 @@ func (User) TableName() string       { return "users" }
 func (Role) TableName() string       { return "roles" }
 func (Permission) TableName() string { return "permissions" }
 func (Session) TableName() string    { return "sessions" }
+func (MFARecoveryCode) TableName() string { return "mfa_recovery_codes" }
+func (PasswordHistory) TableName() string { return "password_histories" }
+func (PasswordResetToken) TableName() string { return "password_reset_tokens" }
 
 // Common roles
 const (
@@ -97,19 +140,36 @@ const (
 	PermissionCreatePatients = "create_patients"
 	PermissionUpdatePatients = "update_patients"
 	PermissionDeletePatients = "delete_patients"
-	
+
+	PermissionManageDuplicatePatients = "manage_duplicate_patients"
+
 	PermissionViewEncounters   = "view_encounters"
 	PermissionCreateEncounters = "create_encounters"
 	PermissionUpdateEncounters = "update_encounters"
-	
+
+	PermissionCreateClinicalNotes = "create_clinical_notes"
+	PermissionManageDiagnoses     = "manage_diagnoses"
+	PermissionRecordVitalSigns    = "record_vital_signs"
+
+	PermissionViewAppointments   = "view_appointments"
+	PermissionCreateAppointments = "create_appointments"
+	PermissionUpdateAppointments = "update_appointments"
+
 	PermissionViewOrders   = "view_orders"
 	PermissionCreateOrders = "create_orders"
 	PermissionUpdateOrders = "update_orders"
-	
+
 	PermissionViewResults   = "view_results"
 	PermissionUpdateResults = "update_results"
-	
-	PermissionManageUsers = "manage_users"
-	PermissionManageRoles = "manage_roles"
-	PermissionViewAuditLog = "view_audit_log"
+
+	PermissionManageCareTeam        = "manage_care_team"
+	PermissionBreakGlass            = "break_glass"
+	PermissionReviewEmergencyAccess = "review_emergency_access"
+
+	PermissionViewUsers             = "view_users"
+	PermissionManageUsers           = "manage_users"
+	PermissionManageRoles           = "manage_roles"
+	PermissionManageServiceAccounts = "manage_service_accounts"
+	PermissionViewAuditLog          = "view_audit_log"
+	PermissionManageNumbering       = "manage_numbering"
 )
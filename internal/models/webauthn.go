@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WebAuthnCredential is a FIDO2 passkey or security key registered by a user
+type WebAuthnCredential struct {
+	BaseModel
+	UserID            uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	User              User       `gorm:"foreignKey:UserID" json:"-"`
+	Name              string     `gorm:"type:varchar(100)" json:"name"`
+	CredentialID      []byte     `gorm:"type:bytea;uniqueIndex;not null" json:"-"`
+	PublicKey         []byte     `gorm:"type:bytea;not null" json:"-"` // COSE_Key
+	Algorithm         int64      `json:"algorithm"`
+	SignCount         int64      `json:"-"`
+	AAGUID            string     `gorm:"column:aaguid;type:varchar(36)" json:"aaguid"` // Authenticator model
+	AttestationFormat string     `gorm:"type:varchar(30)" json:"attestation_format"`
+	AttestationType   string     `gorm:"type:varchar(20)" json:"attestation_type"` // none, self, basic
+	Transports        StringList `gorm:"type:jsonb" json:"transports"`
+	UserVerified      bool       `json:"user_verified"`   // Whether registration verified the user (PIN, biometric)
+	BackupEligible    bool       `json:"backup_eligible"` // Synced passkey rather than a device-bound key
+	LastUsedAt        *time.Time `json:"last_used_at"`
+}
+
+// WebAuthn ceremonies
+const (
+	WebAuthnCeremonyRegistration = "registration"
+	WebAuthnCeremonySecondFactor = "second_factor"
+	WebAuthnCeremonyPasswordless = "passwordless"
+)
+
+// WebAuthnChallenge tracks a registration or login ceremony between issuing
+// its options and verifying the authenticator's response. Each challenge can
+// be used once.
+type WebAuthnChallenge struct {
+	BaseModel
+	UserID           *uuid.UUID `gorm:"type:uuid;index" json:"user_id"` // Nil for passwordless logins with a discoverable credential
+	Ceremony         string     `gorm:"type:varchar(20);not null" json:"ceremony"`
+	Challenge        []byte     `gorm:"type:bytea;not null" json:"-"`
+	UserVerification string     `gorm:"type:varchar(20)" json:"user_verification"`
+	Attestation      string     `gorm:"type:varchar(20)" json:"attestation"`
+	ExpiresAt        time.Time  `gorm:"not null;index" json:"expires_at"`
+	UsedAt           *time.Time `json:"used_at"`
+}
+
+// TableName specifies table names
+func (WebAuthnCredential) TableName() string { return "webauthn_credentials" }
+func (WebAuthnChallenge) TableName() string  { return "webauthn_challenges" }
@@ -0,0 +1,147 @@
+package mpi
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/models"
+)
+
+// Handler handles duplicate patient work queue HTTP requests
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a new MPI handler
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// ListDuplicates godoc
+// @Summary List suspected duplicate patients
+// @Description List pairs of patient records suspected to be the same person, most likely first
+// @Tags patient-duplicates
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Page size" default(20)
+// @Param status query string false "Review status (pending, duplicate, not_duplicate)"
+// @Param patient_id query string false "Patient ID on either side of the pair"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/duplikat-pasien [get]
+func (h *Handler) ListDuplicates(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	var status *models.DuplicateStatus
+	if statusStr := c.Query("status"); statusStr != "" {
+		s := models.DuplicateStatus(statusStr)
+		status = &s
+	}
+
+	var patientID *uuid.UUID
+	if patientIDStr := c.Query("patient_id"); patientIDStr != "" {
+		id, err := uuid.Parse(patientIDStr)
+		if err == nil {
+			patientID = &id
+		}
+	}
+
+	duplicates, total, err := h.service.ListDuplicates(c.Request.Context(), page, pageSize, status, patientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":        duplicates,
+		"total":       total,
+		"page":        page,
+		"page_size":   pageSize,
+		"total_pages": (total + int64(pageSize) - 1) / int64(pageSize),
+	})
+}
+
+// GetDuplicate godoc
+// @Summary Get suspected duplicate
+// @Description Get a suspected duplicate pair with both patient records and the score of each field
+// @Tags patient-duplicates
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Suspected duplicate ID"
+// @Success 200 {object} models.PatientDuplicate
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/duplikat-pasien/{id} [get]
+func (h *Handler) GetDuplicate(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails("Invalid duplicate ID"))
+		return
+	}
+
+	duplicate, err := h.service.GetDuplicate(c.Request.Context(), id)
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, duplicate)
+}
+
+// ReviewDuplicate godoc
+// @Summary Review suspected duplicate
+// @Description Mark a suspected pair as the same person or as different people
+// @Tags patient-duplicates
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Suspected duplicate ID"
+// @Param request body ReviewDuplicateRequest true "Review"
+// @Success 200 {object} models.PatientDuplicate
+// @Failure 404 {object} errors.AppError
+// @Failure 409 {object} errors.AppError
+// @Router /api/v1/duplikat-pasien/{id}/tinjauan [put]
+func (h *Handler) ReviewDuplicate(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails("Invalid duplicate ID"))
+		return
+	}
+
+	var req ReviewDuplicateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails(err.Error()))
+		return
+	}
+
+	userIDValue, _ := c.Get("user_id")
+	reviewerID, _ := userIDValue.(uuid.UUID)
+
+	duplicate, err := h.service.ReviewDuplicate(c.Request.Context(), id, &req, reviewerID)
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, duplicate)
+}
@@ -0,0 +1,362 @@
+package mpi
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/hospital-emr/backend/internal/models"
+)
+
+// Fields scored when comparing two patient records
+const (
+	FieldName        = "name"
+	FieldDateOfBirth = "date_of_birth"
+	FieldGender      = "gender"
+	FieldNationalID  = "national_id"
+	FieldPhone       = "phone"
+	FieldAddress     = "address"
+)
+
+// Weights sets how much each field contributes to a match score
+type Weights struct {
+	Name        float64
+	DateOfBirth float64
+	Gender      float64
+	NationalID  float64
+	Phone       float64
+	Address     float64
+}
+
+// Score compares two patient records. Each field present on both records
+// contributes its weight times its similarity, and the total is divided by
+// the weights of the fields compared, giving a score from 0 to 1 along with
+// the similarity of each field.
+func Score(a, b *models.Patient, weights Weights) (float64, models.MatchScores) {
+	fields := models.MatchScores{}
+	var total, weight float64
+
+	compare := func(field string, w float64, similarity float64, ok bool) {
+		if !ok || w <= 0 {
+			return
+		}
+		fields[field] = similarity
+		total += w * similarity
+		weight += w
+	}
+
+	compare(FieldName, weights.Name, nameSimilarity(a, b), true)
+	compare(FieldDateOfBirth, weights.DateOfBirth, dateOfBirthSimilarity(a.DateOfBirth, b.DateOfBirth), !a.DateOfBirth.IsZero() && !b.DateOfBirth.IsZero())
+	compare(FieldGender, weights.Gender, boolScore(a.Gender == b.Gender), knownGender(a.Gender) && knownGender(b.Gender))
+	nationalID, ok := nationalIDSimilarity(string(a.SSN), string(b.SSN))
+	compare(FieldNationalID, weights.NationalID, nationalID, ok)
+	phone, ok := phoneSimilarity(a, b)
+	compare(FieldPhone, weights.Phone, phone, ok)
+	address, ok := addressSimilarity(a, b)
+	compare(FieldAddress, weights.Address, address, ok)
+
+	if weight == 0 {
+		return 0, fields
+	}
+	return total / weight, fields
+}
+
+// nameSimilarity compares full names, allowing for first and last names
+// given the other way round or split differently
+func nameSimilarity(a, b *models.Patient) float64 {
+	direct := (wordSimilarity(a.FirstName, b.FirstName) + wordSimilarity(a.LastName, b.LastName)) / 2
+	swapped := (wordSimilarity(a.FirstName, b.LastName) + wordSimilarity(a.LastName, b.FirstName)) / 2 * 0.95
+	whole := wordSimilarity(fullName(a), fullName(b)) * 0.95
+	return max(direct, swapped, whole)
+}
+
+func fullName(p *models.Patient) string {
+	return strings.Join(strings.Fields(p.FirstName+" "+p.MiddleName+" "+p.LastName), " ")
+}
+
+// wordSimilarity scores two names by edit distance, treating names that sound
+// alike as near matches
+func wordSimilarity(a, b string) float64 {
+	a, b = normalizeName(a), normalizeName(b)
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+
+	score := editSimilarity(a, b)
+	if phonetic(a) == phonetic(b) && score < 0.9 {
+		score = 0.9
+	}
+	return score
+}
+
+// normalizeName lower-cases a name and drops punctuation, keeping single
+// spaces between words
+func normalizeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsSpace(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// spellingVariants maps the pre-1972 Indonesian spellings still common in
+// names onto the current ones, so Soekarno and Sukarno sound the same
+var spellingVariants = strings.NewReplacer(
+	"oe", "u",
+	"dj", "j",
+	"tj", "c",
+	"sj", "sy",
+	"nj", "ny",
+	"ch", "kh",
+)
+
+// phonetic returns the Soundex code of each word of a normalized name
+func phonetic(name string) string {
+	words := strings.Fields(spellingVariants.Replace(name))
+	for i, word := range words {
+		words[i] = soundex(word)
+	}
+	return strings.Join(words, " ")
+}
+
+var soundexCodes = map[rune]byte{
+	'b': '1', 'f': '1', 'p': '1', 'v': '1',
+	'c': '2', 'g': '2', 'j': '2', 'k': '2', 'q': '2', 's': '2', 'x': '2', 'z': '2',
+	'd': '3', 't': '3',
+	'l': '4',
+	'm': '5', 'n': '5',
+	'r': '6',
+}
+
+func soundex(word string) string {
+	runes := []rune(word)
+	if len(runes) == 0 {
+		return ""
+	}
+
+	code := []byte(strings.ToUpper(string(runes[0])))
+	last := soundexCodes[runes[0]]
+	for _, r := range runes[1:] {
+		digit, ok := soundexCodes[r]
+		switch {
+		case ok && digit != last:
+			code = append(code, digit)
+			last = digit
+		case !ok && r != 'h' && r != 'w':
+			// Vowels separate repeated codes; h and w do not
+			last = 0
+		}
+		if len(code) == 4 {
+			break
+		}
+	}
+	for len(code) < 4 {
+		code = append(code, '0')
+	}
+	return string(code[:4])
+}
+
+// editSimilarity is one minus the edit distance, counting adjacent
+// transpositions as one edit, over the length of the longer string
+func editSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(editDistance(ra, rb))/float64(longest)
+}
+
+// editDistance is the optimal string alignment distance between a and b
+func editDistance(a, b []rune) int {
+	rows := make([][]int, len(a)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(b)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			rows[i][j] = min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				rows[i][j] = min(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+	return rows[len(a)][len(b)]
+}
+
+// dateOfBirthSimilarity allows for the usual entry mistakes: day and month
+// swapped, or one of day, month and year wrong
+func dateOfBirthSimilarity(a, b time.Time) float64 {
+	ay, am, ad := a.UTC().Date()
+	by, bm, bd := b.UTC().Date()
+	switch {
+	case ay == by && am == bm && ad == bd:
+		return 1
+	case ay == by && int(am) == bd && ad == int(bm):
+		return 0.8
+	}
+
+	same := 0
+	for _, equal := range []bool{ay == by, am == bm, ad == bd} {
+		if equal {
+			same++
+		}
+	}
+	if same == 2 {
+		return 0.5
+	}
+	return 0
+}
+
+// dateOfBirthVariants returns the days a mistyped date of birth is most
+// likely to have been entered as: the day itself and, when it is ambiguous,
+// day and month swapped
+func dateOfBirthVariants(dob time.Time) []time.Time {
+	year, month, day := dob.UTC().Date()
+	variants := []time.Time{time.Date(year, month, day, 0, 0, 0, 0, time.UTC)}
+	if day <= 12 && day != int(month) {
+		variants = append(variants, time.Date(year, time.Month(day), int(month), 0, 0, 0, 0, time.UTC))
+	}
+	return variants
+}
+
+func knownGender(gender models.Gender) bool {
+	return gender == models.GenderMale || gender == models.GenderFemale
+}
+
+// nationalIDSimilarity compares NIK or SSN digits, giving partial credit for
+// a single mistyped or transposed digit
+func nationalIDSimilarity(a, b string) (float64, bool) {
+	a, b = digits(a), digits(b)
+	if a == "" || b == "" {
+		return 0, false
+	}
+	if a == b {
+		return 1, true
+	}
+	if len(a) == len(b) && editDistance([]rune(a), []rune(b)) == 1 {
+		return 0.6, true
+	}
+	return 0, true
+}
+
+// phoneSimilarity matches when any phone or mobile number of one record is a
+// number of the other
+func phoneSimilarity(a, b *models.Patient) (float64, bool) {
+	numbersA, numbersB := phoneNumbers(a), phoneNumbers(b)
+	if len(numbersA) == 0 || len(numbersB) == 0 {
+		return 0, false
+	}
+	for _, x := range numbersA {
+		for _, y := range numbersB {
+			if x == y {
+				return 1, true
+			}
+		}
+	}
+	return 0, true
+}
+
+func phoneNumbers(p *models.Patient) []string {
+	var numbers []string
+	for _, number := range []string{string(p.PhoneNumber), string(p.MobileNumber)} {
+		if normalized := normalizePhone(number); normalized != "" {
+			numbers = append(numbers, normalized)
+		}
+	}
+	return numbers
+}
+
+// normalizePhone reduces a phone number to its digits in national form, so
+// +62 812..., 62812... and 0812... compare equal
+func normalizePhone(number string) string {
+	number = digits(number)
+	switch {
+	case strings.HasPrefix(number, "62"):
+		return "0" + number[2:]
+	case strings.HasPrefix(number, "0"):
+		return number
+	case number != "":
+		return "0" + number
+	}
+	return ""
+}
+
+// phoneVariants returns the forms a phone number is commonly stored in
+func phoneVariants(number string) []string {
+	national := normalizePhone(number)
+	if national == "" {
+		return nil
+	}
+	return []string{number, national, "62" + national[1:], "+62" + national[1:]}
+}
+
+// addressAbbreviations expands the abbreviations common in Indonesian
+// addresses
+var addressAbbreviations = map[string]string{
+	"jl": "jalan", "jln": "jalan",
+	"no": "nomor", "nmr": "nomor",
+	"gg": "gang", "blk": "blok",
+	"kel": "kelurahan", "kec": "kecamatan",
+	"kab": "kabupaten", "perum": "perumahan",
+}
+
+// addressSimilarity is the share of address and city words the two records
+// have in common
+func addressSimilarity(a, b *models.Patient) (float64, bool) {
+	wordsA, wordsB := addressWords(string(a.Address)+" "+a.City), addressWords(string(b.Address)+" "+b.City)
+	if len(wordsA) == 0 || len(wordsB) == 0 {
+		return 0, false
+	}
+
+	shared := 0
+	for word := range wordsA {
+		if wordsB[word] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(wordsA)+len(wordsB)-shared), true
+}
+
+func addressWords(address string) map[string]bool {
+	words := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(address), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if expanded, ok := addressAbbreviations[word]; ok {
+			word = expanded
+		}
+		words[word] = true
+	}
+	return words
+}
+
+func digits(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, value)
+}
+
+func boolScore(equal bool) float64 {
+	if equal {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,133 @@
+package mpi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+var defaultWeights = Weights{Name: 0.30, DateOfBirth: 0.20, Gender: 0.05, NationalID: 0.25, Phone: 0.10, Address: 0.10}
+
+func registered() *models.Patient {
+	return &models.Patient{
+		FirstName:    "Sukarno",
+		LastName:     "Wijaya",
+		DateOfBirth:  time.Date(1985, 4, 7, 0, 0, 0, 0, time.UTC),
+		Gender:       models.GenderMale,
+		SSN:          "3273010704850001",
+		MobileNumber: "+62 812-3456-7890",
+		Address:      "Jl. Merdeka No. 10",
+		City:         "Bandung",
+	}
+}
+
+func TestSoundex(t *testing.T) {
+	assert.Equal(t, "R163", soundex("robert"))
+	assert.Equal(t, "R163", soundex("rupert"))
+	assert.Equal(t, "A261", soundex("ashcraft"))
+	assert.Equal(t, "T522", soundex("tymczak"))
+	assert.Equal(t, "P236", soundex("pfister"))
+
+	assert.Equal(t, phonetic("sukarno"), phonetic(normalizeName("Soekarno")))
+	assert.Equal(t, phonetic("joko"), phonetic(normalizeName("Djoko")))
+}
+
+func TestEditDistance(t *testing.T) {
+	assert.Equal(t, 0, editDistance([]rune("budi"), []rune("budi")))
+	assert.Equal(t, 1, editDistance([]rune("budi"), []rune("budy")))
+	assert.Equal(t, 1, editDistance([]rune("siti"), []rune("stii")), "a transposition is one edit")
+	assert.Equal(t, 3, editDistance([]rune("ani"), []rune("")))
+}
+
+func TestDateOfBirthSimilarity(t *testing.T) {
+	dob := time.Date(1985, 4, 7, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 1.0, dateOfBirthSimilarity(dob, dob.Add(3*time.Hour)))
+	assert.Equal(t, 0.8, dateOfBirthSimilarity(dob, time.Date(1985, 7, 4, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 0.5, dateOfBirthSimilarity(dob, time.Date(1958, 4, 7, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 0.0, dateOfBirthSimilarity(dob, time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)))
+
+	assert.Len(t, dateOfBirthVariants(dob), 2)
+	assert.Len(t, dateOfBirthVariants(time.Date(1985, 4, 17, 0, 0, 0, 0, time.UTC)), 1)
+}
+
+func TestNormalizePhone(t *testing.T) {
+	assert.Equal(t, "081234567890", normalizePhone("+62 812-3456-7890"))
+	assert.Equal(t, "081234567890", normalizePhone("6281234567890"))
+	assert.Equal(t, "081234567890", normalizePhone("0812 3456 7890"))
+	assert.Equal(t, "", normalizePhone("-"))
+}
+
+func TestScore(t *testing.T) {
+	t.Run("misspelled returning patient", func(t *testing.T) {
+		returning := registered()
+		returning.FirstName = "Soekarno"
+		returning.LastName = "Wijaja"
+		returning.SSN = ""
+		returning.MobileNumber = "081234567890"
+		returning.Address = "Jalan Merdeka Nomor 10"
+
+		score, fields := Score(registered(), returning, defaultWeights)
+		assert.GreaterOrEqual(t, score, 0.9)
+		assert.Equal(t, 1.0, fields[FieldPhone])
+		assert.Equal(t, 1.0, fields[FieldAddress])
+		assert.NotContains(t, fields, FieldNationalID, "fields missing on either record are skipped")
+	})
+
+	t.Run("first and last name swapped", func(t *testing.T) {
+		swapped := registered()
+		swapped.FirstName, swapped.LastName = swapped.LastName, swapped.FirstName
+
+		score, _ := Score(registered(), swapped, defaultWeights)
+		assert.GreaterOrEqual(t, score, 0.9)
+	})
+
+	t.Run("different NIK outweighs a shared name and birthday", func(t *testing.T) {
+		namesake := registered()
+		namesake.SSN = "3171021503900002"
+		namesake.MobileNumber = "081398765432"
+		namesake.Address = "Jl. Sudirman No. 5"
+		namesake.City = "Jakarta"
+
+		score, fields := Score(registered(), namesake, defaultWeights)
+		assert.Less(t, score, 0.75)
+		assert.Equal(t, 0.0, fields[FieldNationalID])
+	})
+
+	t.Run("mistyped NIK", func(t *testing.T) {
+		mistyped := registered()
+		mistyped.SSN = "3273010704850010"
+
+		_, fields := Score(registered(), mistyped, defaultWeights)
+		assert.Equal(t, 0.6, fields[FieldNationalID])
+	})
+
+	t.Run("weights of zero drop a field", func(t *testing.T) {
+		other := registered()
+		other.Gender = models.GenderFemale
+
+		weights := defaultWeights
+		weights.Gender = 0
+		score, fields := Score(registered(), other, weights)
+		assert.Equal(t, 1.0, score)
+		assert.NotContains(t, fields, FieldGender)
+	})
+}
+
+func TestRegisteredBefore(t *testing.T) {
+	patient := registered()
+	patient.ID = uuid.MustParse("22222222-2222-2222-2222-222222222222")
+	patient.CreatedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	older := Match{PatientID: uuid.New(), createdAt: patient.CreatedAt.Add(-time.Hour)}
+	newer := Match{PatientID: uuid.New(), createdAt: patient.CreatedAt.Add(time.Hour)}
+	assert.True(t, registeredBefore(older, patient))
+	assert.False(t, registeredBefore(newer, patient))
+
+	// Same timestamp falls back to the ID, as ORDER BY created_at, id does
+	sameTime := Match{PatientID: uuid.MustParse("11111111-1111-1111-1111-111111111111"), createdAt: patient.CreatedAt}
+	assert.True(t, registeredBefore(sameTime, patient))
+}
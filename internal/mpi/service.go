@@ -0,0 +1,330 @@
+// Package mpi is the master patient index: it scores patient records against
+// each other to catch the same person registered twice, and keeps the queue
+// of suspected duplicates for review.
+package mpi
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/config"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Service finds and tracks duplicate patient records
+type Service struct {
+	db                *gorm.DB
+	weights           Weights
+	reviewThreshold   float64
+	probableThreshold float64
+	maxCandidates     int
+}
+
+// NewService creates a new MPI service
+func NewService(db *gorm.DB, cfg *config.Config) *Service {
+	maxCandidates := cfg.MPI.MaxCandidates
+	if maxCandidates <= 0 {
+		maxCandidates = 200
+	}
+	return &Service{
+		db: db,
+		weights: Weights{
+			Name:        cfg.MPI.WeightName,
+			DateOfBirth: cfg.MPI.WeightDateOfBirth,
+			Gender:      cfg.MPI.WeightGender,
+			NationalID:  cfg.MPI.WeightNationalID,
+			Phone:       cfg.MPI.WeightPhone,
+			Address:     cfg.MPI.WeightAddress,
+		},
+		reviewThreshold:   cfg.MPI.ReviewThreshold,
+		probableThreshold: cfg.MPI.ProbableThreshold,
+		maxCandidates:     maxCandidates,
+	}
+}
+
+// Match is an existing patient record that may be the same person
+type Match struct {
+	PatientID   uuid.UUID             `json:"patient_id"`
+	MRN         string                `json:"mrn"`
+	FirstName   string                `json:"first_name"`
+	LastName    string                `json:"last_name"`
+	DateOfBirth time.Time             `json:"date_of_birth"`
+	Gender      models.Gender         `json:"gender"`
+	Score       float64               `json:"score"`
+	Level       models.DuplicateLevel `json:"level"`
+	Fields      models.MatchScores    `json:"fields"`
+
+	createdAt time.Time
+}
+
+// ReviewDuplicateRequest represents a reviewer's verdict on a suspected duplicate
+type ReviewDuplicateRequest struct {
+	Status models.DuplicateStatus `json:"status" binding:"required,oneof=duplicate not_duplicate"`
+	Notes  string                 `json:"notes"`
+}
+
+// ScanReport summarizes a scan of the patient table for duplicates
+type ScanReport struct {
+	Patients   int `json:"patients"`
+	Suspected  int `json:"suspected"`
+	NewInQueue int `json:"new_in_queue"`
+}
+
+// FindDuplicates scores existing patients that share a date of birth, NIK or
+// phone number with p and returns those at or above the review threshold,
+// best first. Records whose date of birth and identifiers were all entered
+// differently are not found.
+func (s *Service) FindDuplicates(ctx context.Context, p *models.Patient) ([]Match, error) {
+	candidates, err := s.candidates(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []Match
+	for i := range candidates {
+		candidate := &candidates[i]
+		score, fields := Score(p, candidate, s.weights)
+		if score < s.reviewThreshold {
+			continue
+		}
+		matches = append(matches, Match{
+			PatientID:   candidate.ID,
+			MRN:         candidate.MRN,
+			FirstName:   candidate.FirstName,
+			LastName:    candidate.LastName,
+			DateOfBirth: candidate.DateOfBirth,
+			Gender:      candidate.Gender,
+			Score:       score,
+			Level:       s.level(score),
+			Fields:      fields,
+			createdAt:   candidate.CreatedAt,
+		})
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	return matches, nil
+}
+
+// candidates loads the existing patients worth scoring against p. Each
+// condition can use an index of its own.
+func (s *Service) candidates(ctx context.Context, p *models.Patient) ([]models.Patient, error) {
+	var conditions *gorm.DB
+	or := func(query string, args ...interface{}) {
+		if conditions == nil {
+			conditions = s.db.Where(query, args...)
+		} else {
+			conditions = conditions.Or(query, args...)
+		}
+	}
+
+	if !p.DateOfBirth.IsZero() {
+		for _, day := range dateOfBirthVariants(p.DateOfBirth) {
+			or("date_of_birth >= ? AND date_of_birth < ?", day, day.AddDate(0, 0, 1))
+		}
+	}
+	if p.SSN != "" {
+		or(models.PatientLookup("ssn", string(p.SSN)))
+	}
+	var phones []string
+	for _, number := range []string{string(p.PhoneNumber), string(p.MobileNumber)} {
+		phones = append(phones, phoneVariants(number)...)
+	}
+	if len(phones) > 0 {
+		or(models.PatientLookup("phone_number", phones...))
+		or(models.PatientLookup("mobile_number", phones...))
+	}
+	if conditions == nil {
+		return nil, nil
+	}
+
+	query := s.db.WithContext(ctx).Where(conditions)
+	if p.ID != uuid.Nil {
+		query = query.Where("id <> ?", p.ID)
+	}
+
+	var candidates []models.Patient
+	if err := query.Limit(s.maxCandidates).Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+	return candidates, nil
+}
+
+func (s *Service) level(score float64) models.DuplicateLevel {
+	if score >= s.probableThreshold {
+		return models.DuplicateProbable
+	}
+	return models.DuplicatePossible
+}
+
+// Enqueue adds suspected duplicates of a patient to the review queue. Pairs
+// already queued keep their existing review.
+func (s *Service) Enqueue(ctx context.Context, patientID uuid.UUID, matches []Match, source string) (int64, error) {
+	if len(matches) == 0 {
+		return 0, nil
+	}
+
+	duplicates := make([]models.PatientDuplicate, len(matches))
+	for i, match := range matches {
+		duplicates[i] = models.PatientDuplicate{
+			PatientID:   patientID,
+			CandidateID: match.PatientID,
+			Score:       match.Score,
+			Level:       match.Level,
+			Fields:      match.Fields,
+			Source:      source,
+			Status:      models.DuplicatePending,
+		}
+	}
+
+	result := s.db.WithContext(ctx).
+		Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "patient_id"}, {Name: "candidate_id"}}, DoNothing: true}).
+		Create(&duplicates)
+	return result.RowsAffected, result.Error
+}
+
+// Scan checks every patient against the rest of the index and queues the
+// suspected duplicates it finds. Each pair is queued once, under the newer
+// record.
+func (s *Service) Scan(ctx context.Context, batchSize int) (*ScanReport, error) {
+	report := &ScanReport{}
+
+	var after *models.Patient
+	for {
+		query := s.db.WithContext(ctx).Order("created_at, id").Limit(batchSize)
+		if after != nil {
+			query = query.Where("(created_at, id) > (?, ?)", after.CreatedAt, after.ID)
+		}
+
+		var patients []models.Patient
+		if err := query.Find(&patients).Error; err != nil {
+			return report, err
+		}
+		if len(patients) == 0 {
+			return report, nil
+		}
+
+		for i := range patients {
+			patient := &patients[i]
+			matches, err := s.FindDuplicates(ctx, patient)
+			if err != nil {
+				return report, err
+			}
+
+			older := matches[:0]
+			for _, match := range matches {
+				if registeredBefore(match, patient) {
+					older = append(older, match)
+				}
+			}
+
+			added, err := s.Enqueue(ctx, patient.ID, older, models.DuplicateSourceScan)
+			if err != nil {
+				return report, err
+			}
+			report.Suspected += len(older)
+			report.NewInQueue += int(added)
+		}
+
+		report.Patients += len(patients)
+		after = &patients[len(patients)-1]
+	}
+}
+
+// registeredBefore reports whether a match comes before p in the order Scan
+// walks the table. Postgres orders UUIDs as their canonical strings.
+func registeredBefore(match Match, p *models.Patient) bool {
+	if !match.createdAt.Equal(p.CreatedAt) {
+		return match.createdAt.Before(p.CreatedAt)
+	}
+	return match.PatientID.String() < p.ID.String()
+}
+
+// ListDuplicates lists suspected duplicates for review, most likely first
+func (s *Service) ListDuplicates(ctx context.Context, page, pageSize int, status *models.DuplicateStatus, patientID *uuid.UUID) ([]models.PatientDuplicate, int64, error) {
+	var duplicates []models.PatientDuplicate
+	var total int64
+
+	query := s.db.WithContext(ctx).Model(&models.PatientDuplicate{})
+
+	// Apply filters
+	if status != nil {
+		query = query.Where("status = ?", *status)
+	}
+	if patientID != nil {
+		query = query.Where("patient_id = ? OR candidate_id = ?", *patientID, *patientID)
+	}
+
+	// Get total count
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, errors.ErrDatabaseError
+	}
+
+	// Get paginated results
+	offset := (page - 1) * pageSize
+	if err := query.
+		Preload("Patient").
+		Preload("Candidate").
+		Offset(offset).
+		Limit(pageSize).
+		Order("score DESC, created_at").
+		Find(&duplicates).Error; err != nil {
+		return nil, 0, errors.ErrDatabaseError
+	}
+
+	return duplicates, total, nil
+}
+
+// GetDuplicate retrieves a suspected duplicate with both patient records
+func (s *Service) GetDuplicate(ctx context.Context, id uuid.UUID) (*models.PatientDuplicate, error) {
+	var duplicate models.PatientDuplicate
+	if err := s.db.WithContext(ctx).
+		Preload("Patient").
+		Preload("Candidate").
+		Where("id = ?", id).
+		First(&duplicate).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrDuplicateNotFound(id.String())
+		}
+		return nil, errors.ErrDatabaseError
+	}
+
+	return &duplicate, nil
+}
+
+// ReviewDuplicate records whether a suspected pair is the same person. Each
+// pair is reviewed once.
+func (s *Service) ReviewDuplicate(ctx context.Context, id uuid.UUID, req *ReviewDuplicateRequest, reviewerID uuid.UUID) (*models.PatientDuplicate, error) {
+	duplicate, err := s.GetDuplicate(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	result := s.db.WithContext(ctx).
+		Model(&models.PatientDuplicate{}).
+		Where("id = ? AND status = ?", id, models.DuplicatePending).
+		Updates(map[string]interface{}{
+			"status":       req.Status,
+			"reviewed_by":  reviewerID,
+			"reviewed_at":  now,
+			"review_notes": req.Notes,
+		})
+	if result.Error != nil {
+		return nil, errors.ErrDatabaseError
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.ErrDuplicateReviewed(id.String())
+	}
+
+	duplicate.Status = req.Status
+	duplicate.ReviewedBy = &reviewerID
+	duplicate.ReviewedAt = &now
+	duplicate.ReviewNotes = req.Notes
+
+	return duplicate, nil
+}
@@ -0,0 +1,248 @@
+package numbering
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hospital-emr/backend/internal/models"
+)
+
+// defaultFormats apply to kinds with no format configured. Their numbers
+// carry eleven digits, more than the legacy ones ever had, so the two series
+// cannot collide.
+var defaultFormats = map[models.NumberKind]models.NumberFormat{
+	models.NumberKindMRN:         {Kind: models.NumberKindMRN, Prefix: "MRN", CounterWidth: 10, CheckDigit: models.CheckDigitLuhn},
+	models.NumberKindEncounter:   {Kind: models.NumberKindEncounter, Prefix: "ENC", DateSegment: models.DateSegmentYYYY, CounterWidth: 6, CheckDigit: models.CheckDigitLuhn},
+	models.NumberKindAppointment: {Kind: models.NumberKindAppointment, Prefix: "APT", DateSegment: models.DateSegmentYYYY, CounterWidth: 6, CheckDigit: models.CheckDigitLuhn},
+}
+
+// legacyNumbers match the numbers issued before the numbering service: the
+// prefix and up to nine digits of the clock. They are accepted on lookup but
+// never issued.
+var legacyNumbers = map[models.NumberKind]*regexp.Regexp{
+	models.NumberKindMRN:         regexp.MustCompile(`^MRN-?[0-9]{1,9}$`),
+	models.NumberKindEncounter:   regexp.MustCompile(`^ENC-?[0-9]{1,9}$`),
+	models.NumberKindAppointment: regexp.MustCompile(`^APT-?[0-9]{1,9}$`),
+}
+
+var (
+	prefixPattern   = regexp.MustCompile(`^([A-Z][A-Z0-9-]{0,11})?$`)
+	facilityPattern = regexp.MustCompile(`^[A-Za-z0-9-]{0,20}$`)
+)
+
+const maxCounterWidth = 12
+
+// validateFormat checks that a format can be issued and read back
+func validateFormat(f *models.NumberFormat) error {
+	legacy, ok := legacyNumbers[f.Kind]
+	if !ok {
+		return fmt.Errorf("unknown kind %q", f.Kind)
+	}
+	if !facilityPattern.MatchString(f.Facility) {
+		return fmt.Errorf("facility must be up to 20 letters, digits or dashes")
+	}
+	if f.Year != 0 && (f.Year < 2000 || f.Year > 9999) {
+		return fmt.Errorf("year must be 0 for every year or between 2000 and 9999")
+	}
+	if !prefixPattern.MatchString(f.Prefix) {
+		return fmt.Errorf("prefix must start with a capital letter followed by up to 11 capital letters, digits or dashes")
+	}
+	if segmentLength(f.DateSegment) < 0 {
+		return fmt.Errorf("date segment must be one of YYYY, YY, YYYYMM, YYMM or empty")
+	}
+	if f.CounterWidth < 1 || f.CounterWidth > maxCounterWidth {
+		return fmt.Errorf("counter width must be between 1 and %d", maxCounterWidth)
+	}
+	switch f.CheckDigit {
+	case models.CheckDigitNone, models.CheckDigitLuhn, models.CheckDigitMod11:
+	default:
+		return fmt.Errorf("check digit must be none, luhn or mod11")
+	}
+
+	// The shortest number of the format must not look like a legacy one
+	shortest := render(*f, strings.Repeat("0", segmentLength(f.DateSegment)), 0)
+	if legacy.MatchString(shortest) {
+		return fmt.Errorf("numbers in this format could collide with legacy numbers; use a longer counter or another prefix")
+	}
+	return nil
+}
+
+// checkOverlap checks that a format cannot issue numbers another format of
+// its kind may have issued. Numbers are a prefix followed by digits, so two
+// formats can only meet when one prefix starts the other and the longer one
+// goes on with a digit. Formats with the same prefix, date segment and check
+// digit count on the same sequence and differ only in padding, so their
+// numbers stay apart.
+func checkOverlap(f *models.NumberFormat, others []models.NumberFormat) error {
+	for _, g := range others {
+		short, long := f.Prefix, g.Prefix
+		if len(short) > len(long) {
+			short, long = long, short
+		}
+		if !strings.HasPrefix(long, short) {
+			continue
+		}
+		if len(long) > len(short) && !isDigits(long[len(short):len(short)+1]) {
+			continue
+		}
+		if f.Prefix == g.Prefix && f.DateSegment == g.DateSegment && f.CheckDigit == g.CheckDigit {
+			continue
+		}
+
+		example := render(g, strings.Repeat("0", segmentLength(g.DateSegment)), 1)
+		return fmt.Errorf("numbers in this format could collide with numbers like %s issued in another format; keep its prefix, date segment and check digit or use a prefix that does not overlap", example)
+	}
+	return nil
+}
+
+// segmentLength returns the number of digits of a date segment, or -1 for an
+// unknown one
+func segmentLength(segment models.DateSegment) int {
+	switch segment {
+	case models.DateSegmentNone:
+		return 0
+	case models.DateSegmentYYYY, models.DateSegmentYYMM:
+		return 4
+	case models.DateSegmentYY:
+		return 2
+	case models.DateSegmentYYYYMM:
+		return 6
+	}
+	return -1
+}
+
+// dateSegment writes the date segment of a format for t
+func dateSegment(segment models.DateSegment, t time.Time) string {
+	switch segment {
+	case models.DateSegmentYYYY:
+		return t.Format("2006")
+	case models.DateSegmentYY:
+		return t.Format("06")
+	case models.DateSegmentYYYYMM:
+		return t.Format("200601")
+	case models.DateSegmentYYMM:
+		return t.Format("0601")
+	}
+	return ""
+}
+
+// render writes a number: prefix, date segment, counter padded to its width
+// and the check digit over the digits
+func render(f models.NumberFormat, segment string, counter int64) string {
+	digits := segment + fmt.Sprintf("%0*d", f.CounterWidth, counter)
+	return f.Prefix + digits + checkDigit(f.CheckDigit, digits)
+}
+
+// matches reports whether number could have been issued in format f. The
+// counter may have outgrown its width.
+func matches(f models.NumberFormat, number string) bool {
+	digits, ok := strings.CutPrefix(number, f.Prefix)
+	if !ok {
+		return false
+	}
+	if f.CheckDigit != models.CheckDigitNone {
+		if digits == "" {
+			return false
+		}
+		check := digits[len(digits)-1:]
+		digits = digits[:len(digits)-1]
+		if !isDigits(digits) || checkDigit(f.CheckDigit, digits) != check {
+			return false
+		}
+	}
+	if !isDigits(digits) {
+		return false
+	}
+
+	length := segmentLength(f.DateSegment)
+	if len(digits) < length+f.CounterWidth {
+		return false
+	}
+	return validSegment(f.DateSegment, digits[:length])
+}
+
+// validSegment checks the month of a date segment
+func validSegment(segment models.DateSegment, digits string) bool {
+	var month string
+	switch segment {
+	case models.DateSegmentYYYYMM:
+		month = digits[4:]
+	case models.DateSegmentYYMM:
+		month = digits[2:]
+	default:
+		return true
+	}
+	m, _ := strconv.Atoi(month)
+	return m >= 1 && m <= 12
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// checkDigit computes the check digit of a string of digits
+func checkDigit(algorithm models.CheckDigit, digits string) string {
+	switch algorithm {
+	case models.CheckDigitLuhn:
+		return strconv.Itoa(luhn(digits))
+	case models.CheckDigitMod11:
+		if check := mod11(digits); check < 10 {
+			return strconv.Itoa(check)
+		}
+		return "X"
+	}
+	return ""
+}
+
+// luhn returns the Luhn check digit of digits: every second digit from the
+// right, starting with the rightmost, is doubled
+func luhn(digits string) int {
+	sum := 0
+	double := true
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return (10 - sum%10) % 10
+}
+
+// mod11 returns the modulus 11 check digit of digits, weighting them 2 to 7
+// from the right and starting again at 2. A result of 10 is written as X.
+func mod11(digits string) int {
+	sum := 0
+	weight := 2
+	for i := len(digits) - 1; i >= 0; i-- {
+		sum += int(digits[i]-'0') * weight
+		weight++
+		if weight > 7 {
+			weight = 2
+		}
+	}
+	return (11 - sum%11) % 11
+}
+
+// sequenceName names the database sequence counting the numbers that share a
+// prefix and date segment. Formats that differ only in padding share a
+// counter, so their numbers stay unique; checkOverlap rejects formats whose
+// numbers could meet otherwise.
+func sequenceName(kind models.NumberKind, prefix, segment string) string {
+	return fmt.Sprintf("numbering_%s_%s_%s", kind, prefix, segment)
+}
@@ -0,0 +1,122 @@
+package numbering
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckDigits(t *testing.T) {
+	assert.Equal(t, 3, luhn("7992739871"))
+	assert.Equal(t, 0, luhn("0"))
+
+	assert.Equal(t, 5, mod11("12345"))
+	assert.Equal(t, "X", checkDigit(models.CheckDigitMod11, "6"), "a remainder of 1 is written as X")
+	assert.Equal(t, "", checkDigit(models.CheckDigitNone, "12345"))
+}
+
+func TestRenderAndMatch(t *testing.T) {
+	march := time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)
+
+	t.Run("built-in MRN", func(t *testing.T) {
+		f := defaultFormats[models.NumberKindMRN]
+		number := render(f, dateSegment(f.DateSegment, march), 42)
+		assert.Equal(t, "MRN00000000422", number)
+		assert.True(t, matches(f, number))
+		assert.False(t, matches(f, "MRN00000000423"), "wrong check digit")
+		assert.False(t, matches(f, "MRN00000000242"), "transposed digits")
+	})
+
+	t.Run("monthly counter with mod 11", func(t *testing.T) {
+		f := models.NumberFormat{Prefix: "RJ-", DateSegment: models.DateSegmentYYMM, CounterWidth: 5, CheckDigit: models.CheckDigitMod11}
+		segment := dateSegment(f.DateSegment, march)
+		assert.Equal(t, "2603", segment)
+
+		number := render(f, segment, 7)
+		assert.True(t, matches(f, number))
+		assert.True(t, matches(f, render(f, segment, 1234567)), "the counter may outgrow its width")
+		assert.False(t, matches(f, render(f, "2613", 7)), "month 13")
+		assert.False(t, matches(f, "RI-"+number[3:]), "other prefix")
+	})
+
+	t.Run("no check digit", func(t *testing.T) {
+		f := models.NumberFormat{Prefix: "APT", DateSegment: models.DateSegmentYYYY, CounterWidth: 6, CheckDigit: models.CheckDigitNone}
+		assert.Equal(t, "APT2026000012", render(f, "2026", 12))
+		assert.True(t, matches(f, "APT2026000012"))
+		assert.False(t, matches(f, "APT202612"), "shorter than the format")
+		assert.False(t, matches(f, "APT2026ABC012"))
+	})
+}
+
+func TestValidateFormat(t *testing.T) {
+	for kind, f := range defaultFormats {
+		assert.NoError(t, validateFormat(&f), kind)
+	}
+
+	valid := models.NumberFormat{Kind: models.NumberKindMRN, Facility: "RSUD-1", Year: 2026, Prefix: "RM", CounterWidth: 8, CheckDigit: models.CheckDigitLuhn}
+	assert.NoError(t, validateFormat(&valid))
+
+	invalid := map[string]func(f *models.NumberFormat){
+		"unknown kind":          func(f *models.NumberFormat) { f.Kind = "invoice" },
+		"lower case prefix":     func(f *models.NumberFormat) { f.Prefix = "rm" },
+		"unknown date segment":  func(f *models.NumberFormat) { f.DateSegment = "DDMMYY" },
+		"zero width":            func(f *models.NumberFormat) { f.CounterWidth = 0 },
+		"unknown check digit":   func(f *models.NumberFormat) { f.CheckDigit = "crc" },
+		"year out of range":     func(f *models.NumberFormat) { f.Year = 26 },
+		"facility with a space": func(f *models.NumberFormat) { f.Facility = "RSUD 1" },
+		"collides with legacy MRNs": func(f *models.NumberFormat) {
+			f.Prefix = "MRN"
+			f.CounterWidth = 6
+		},
+	}
+	for name, change := range invalid {
+		f := valid
+		change(&f)
+		assert.Error(t, validateFormat(&f), name)
+	}
+}
+
+func TestLegacyNumbers(t *testing.T) {
+	assert.True(t, legacyNumbers[models.NumberKindMRN].MatchString("MRN123456789"))
+	assert.True(t, legacyNumbers[models.NumberKindEncounter].MatchString("ENC-001"))
+	assert.False(t, legacyNumbers[models.NumberKindAppointment].MatchString("APT20260000121"))
+}
+
+func TestCheckOverlap(t *testing.T) {
+	current := models.NumberFormat{Kind: models.NumberKindMRN, Prefix: "RM", DateSegment: models.DateSegmentYYYY, CounterWidth: 6, CheckDigit: models.CheckDigitLuhn}
+	others := []models.NumberFormat{current, defaultFormats[models.NumberKindMRN]}
+
+	tests := []struct {
+		name   string
+		change func(f *models.NumberFormat)
+		ok     bool
+	}{
+		{"same format", func(f *models.NumberFormat) {}, true},
+		{"wider counter", func(f *models.NumberFormat) { f.CounterWidth = 8 }, true},
+		{"other facility and year", func(f *models.NumberFormat) { f.Facility, f.Year = "RSUD-2", 2027 }, true},
+		{"unrelated prefix", func(f *models.NumberFormat) { f.Prefix, f.DateSegment = "PX", models.DateSegmentNone }, true},
+		{"prefix continued by a letter", func(f *models.NumberFormat) { f.Prefix, f.CheckDigit = "RMB", models.CheckDigitNone }, true},
+		{"prefix continued by a dash", func(f *models.NumberFormat) { f.Prefix, f.DateSegment = "RM-", models.DateSegmentYYMM }, true},
+		{"other date segment", func(f *models.NumberFormat) { f.DateSegment = models.DateSegmentYYMM }, false},
+		{"no date segment", func(f *models.NumberFormat) { f.DateSegment, f.CounterWidth = models.DateSegmentNone, 10 }, false},
+		{"other check digit", func(f *models.NumberFormat) { f.CheckDigit = models.CheckDigitNone }, false},
+		{"prefix continued by a digit", func(f *models.NumberFormat) { f.Prefix = "RM2" }, false},
+		{"shorter prefix continued by a letter", func(f *models.NumberFormat) { f.Prefix = "R" }, true},
+		{"built-in prefix with a date", func(f *models.NumberFormat) { f.Prefix = "MRN" }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := current
+			tt.change(&f)
+			err := checkOverlap(&f, others)
+			if tt.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
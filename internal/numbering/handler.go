@@ -0,0 +1,83 @@
+package numbering
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/models"
+)
+
+// Handler handles number format HTTP requests
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a new numbering handler
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// ListFormats godoc
+// @Summary List number formats
+// @Description List the MRN, encounter and appointment number formats configured per facility and year, and the built-in formats used where none is configured
+// @Tags number-formats
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param kind query string false "Kind (mrn, encounter, appointment)"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/format-nomor [get]
+func (h *Handler) ListFormats(c *gin.Context) {
+	var kind *models.NumberKind
+	if kindStr := c.Query("kind"); kindStr != "" {
+		k := models.NumberKind(kindStr)
+		kind = &k
+	}
+
+	formats, err := h.service.ListFormats(c.Request.Context(), kind)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":     formats,
+		"defaults": h.service.DefaultFormats(),
+	})
+}
+
+// SaveFormat godoc
+// @Summary Set a number format
+// @Description Set the number format of a kind for a facility and year, replacing the current one. Numbers already issued keep validating. The counter restarts when the prefix or date segment changes.
+// @Tags number-formats
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body SaveFormatRequest true "Format"
+// @Success 200 {object} models.NumberFormat
+// @Failure 400 {object} errors.AppError
+// @Router /api/v1/format-nomor [put]
+func (h *Handler) SaveFormat(c *gin.Context) {
+	var req SaveFormatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails(err.Error()))
+		return
+	}
+
+	userIDValue, _ := c.Get("user_id")
+	savedBy, _ := userIDValue.(uuid.UUID)
+
+	format, err := h.service.SaveFormat(c.Request.Context(), &req, savedBy)
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, format)
+}
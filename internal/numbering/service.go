@@ -0,0 +1,230 @@
+// Package numbering issues MRNs and encounter and appointment numbers from
+// database sequences, in formats configured per facility and year, and checks
+// numbers given on lookup against those formats.
+package numbering
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/config"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/common/logger"
+	"github.com/hospital-emr/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// Service issues and validates numbers
+type Service struct {
+	db       *gorm.DB
+	facility string
+	location *time.Location
+
+	mu        sync.Mutex
+	sequences map[string]bool // Sequences known to exist
+}
+
+// NewService creates a new numbering service
+func NewService(db *gorm.DB, cfg *config.Config) *Service {
+	location, err := time.LoadLocation(cfg.Numbering.Timezone)
+	if err != nil {
+		// Rejected by config validation; fall back rather than fail
+		location = time.UTC
+	}
+	return &Service{
+		db:        db,
+		facility:  cfg.Numbering.Facility,
+		location:  location,
+		sequences: make(map[string]bool),
+	}
+}
+
+// SaveFormatRequest represents a request to set the number format of a kind
+// for a facility and year
+type SaveFormatRequest struct {
+	Kind         models.NumberKind  `json:"kind" binding:"required,oneof=mrn encounter appointment"`
+	Facility     string             `json:"facility"` // Empty for every facility
+	Year         int                `json:"year"`     // 0 for every year
+	Prefix       string             `json:"prefix"`
+	DateSegment  models.DateSegment `json:"date_segment"`
+	CounterWidth int                `json:"counter_width" binding:"required"`
+	CheckDigit   models.CheckDigit  `json:"check_digit" binding:"required"`
+}
+
+// Next issues the next number of a kind in the format in force at this
+// facility today. Numbers are never reused; a failed create leaves a gap.
+func (s *Service) Next(ctx context.Context, kind models.NumberKind) (string, error) {
+	now := time.Now().In(s.location)
+	format, err := s.Format(ctx, kind, now.Year())
+	if err != nil {
+		return "", err
+	}
+
+	segment := dateSegment(format.DateSegment, now)
+	counter, err := s.nextval(ctx, sequenceName(kind, format.Prefix, segment))
+	if err != nil {
+		return "", err
+	}
+	return render(format, segment, counter), nil
+}
+
+// Format returns the format of a kind at this facility in a year: the most
+// specific of the facility's format for the year, its format for every year,
+// the format for every facility for the year and the one for every facility
+// and year, falling back to the built-in format.
+func (s *Service) Format(ctx context.Context, kind models.NumberKind, year int) (models.NumberFormat, error) {
+	var formats []models.NumberFormat
+	if err := s.db.WithContext(ctx).
+		Where("kind = ? AND facility IN ? AND year IN ?", kind, []string{s.facility, ""}, []int{year, 0}).
+		Find(&formats).Error; err != nil {
+		return models.NumberFormat{}, err
+	}
+
+	best := -1
+	for i, f := range formats {
+		if best < 0 || specificity(f) > specificity(formats[best]) {
+			best = i
+		}
+	}
+	if best >= 0 {
+		return formats[best], nil
+	}
+	return defaultFormats[kind], nil
+}
+
+func specificity(f models.NumberFormat) int {
+	score := 0
+	if f.Facility != "" {
+		score += 2
+	}
+	if f.Year != 0 {
+		score++
+	}
+	return score
+}
+
+// Validate checks that a number is one a format of its kind, current or
+// replaced, at any facility could have issued, so a mistyped number is
+// reported instead of looked up.
+func (s *Service) Validate(ctx context.Context, kind models.NumberKind, number string) error {
+	if legacy, ok := legacyNumbers[kind]; ok && legacy.MatchString(number) {
+		return nil
+	}
+
+	var formats []models.NumberFormat
+	if err := s.db.WithContext(ctx).Unscoped().Where("kind = ?", kind).Find(&formats).Error; err != nil {
+		return errors.ErrDatabaseError
+	}
+	if f, ok := defaultFormats[kind]; ok {
+		formats = append(formats, f)
+	}
+
+	for _, f := range formats {
+		if matches(f, number) {
+			return nil
+		}
+	}
+	return errors.ErrInvalidNumber(number)
+}
+
+// ListFormats lists the configured number formats in force
+func (s *Service) ListFormats(ctx context.Context, kind *models.NumberKind) ([]models.NumberFormat, error) {
+	var formats []models.NumberFormat
+
+	query := s.db.WithContext(ctx).Model(&models.NumberFormat{})
+	if kind != nil {
+		query = query.Where("kind = ?", *kind)
+	}
+
+	if err := query.Order("kind, facility, year").Find(&formats).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+	return formats, nil
+}
+
+// DefaultFormats lists the built-in formats used where none is configured
+func (s *Service) DefaultFormats() []models.NumberFormat {
+	return []models.NumberFormat{
+		defaultFormats[models.NumberKindMRN],
+		defaultFormats[models.NumberKindEncounter],
+		defaultFormats[models.NumberKindAppointment],
+	}
+}
+
+// SaveFormat sets the format of a kind for a facility and year. The format it
+// replaces is kept so numbers issued in it still validate.
+func (s *Service) SaveFormat(ctx context.Context, req *SaveFormatRequest, savedBy uuid.UUID) (*models.NumberFormat, error) {
+	format := &models.NumberFormat{
+		Kind:         req.Kind,
+		Facility:     req.Facility,
+		Year:         req.Year,
+		Prefix:       req.Prefix,
+		DateSegment:  req.DateSegment,
+		CounterWidth: req.CounterWidth,
+		CheckDigit:   req.CheckDigit,
+	}
+	format.CreatedBy = savedBy
+	format.UpdatedBy = savedBy
+
+	if err := validateFormat(format); err != nil {
+		return nil, errors.ErrValidation.WithDetails(err.Error())
+	}
+
+	// Replaced formats count too: the numbers they issued are still in use
+	var existing []models.NumberFormat
+	if err := s.db.WithContext(ctx).Unscoped().Where("kind = ?", format.Kind).Find(&existing).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+	if err := checkOverlap(format, append(existing, defaultFormats[format.Kind])); err != nil {
+		return nil, errors.ErrValidation.WithDetails(err.Error())
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var current []models.NumberFormat
+		if err := tx.Where("kind = ? AND facility = ? AND year = ?", format.Kind, format.Facility, format.Year).
+			Find(&current).Error; err != nil {
+			return err
+		}
+		for i := range current {
+			if err := tx.Delete(&current[i]).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(format).Error
+	})
+	if err != nil {
+		return nil, errors.ErrDatabaseError.WithDetails(err.Error())
+	}
+
+	return format, nil
+}
+
+// nextval takes the next value of a sequence, creating it on first use
+func (s *Service) nextval(ctx context.Context, name string) (int64, error) {
+	quoted := `"` + name + `"`
+
+	s.mu.Lock()
+	known := s.sequences[name]
+	s.mu.Unlock()
+	if !known {
+		// Concurrent creation by another instance can fail; nextval below
+		// tells whether the sequence exists regardless
+		if err := s.db.WithContext(ctx).Exec("CREATE SEQUENCE IF NOT EXISTS " + quoted).Error; err != nil {
+			logger.Warnf("Failed to create number sequence %s: %v", name, err)
+		}
+	}
+
+	var value int64
+	if err := s.db.WithContext(ctx).Raw("SELECT nextval(?::regclass)", quoted).Scan(&value).Error; err != nil {
+		return 0, err
+	}
+
+	if !known {
+		s.mu.Lock()
+		s.sequences[name] = true
+		s.mu.Unlock()
+	}
+	return value, nil
+}
@@ -0,0 +1,132 @@
+package patient
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/hospital-emr/backend/pkg/encryption"
+	"gorm.io/gorm"
+)
+
+// staleCiphertext matches patients with a PHI column in plaintext or
+// encrypted with another data key than the active one (@current is its
+// header followed by %). Encrypted JSONB is stored as a JSON string instead
+// of an object.
+const staleCiphertext = `(ssn <> '' AND ssn NOT LIKE @current)
+	OR (passport_number <> '' AND passport_number NOT LIKE @current)
+	OR (email <> '' AND email NOT LIKE @current)
+	OR (phone_number <> '' AND phone_number NOT LIKE @current)
+	OR (mobile_number <> '' AND mobile_number NOT LIKE @current)
+	OR (address <> '' AND address NOT LIKE @current)
+	OR jsonb_typeof(emergency_contact) = 'object'
+	OR (jsonb_typeof(emergency_contact) = 'string' AND emergency_contact #>> '{}' NOT LIKE @current)
+	OR jsonb_typeof(insurance) = 'object'
+	OR (jsonb_typeof(insurance) = 'string' AND insurance #>> '{}' NOT LIKE @current)`
+
+// missingIndex matches patients with a value but no blind index. The index
+// stays empty for values that normalize to nothing, such as a phone number
+// without digits, so EncryptExisting only rewrites the rows it matches when
+// an index actually changes.
+const missingIndex = `(ssn <> '' AND COALESCE(ssn_index, '') = '')
+	OR (email <> '' AND COALESCE(email_index, '') = '')
+	OR (phone_number <> '' AND COALESCE(phone_number_index, '') = '')
+	OR (mobile_number <> '' AND COALESCE(mobile_number_index, '') = '')`
+
+// EncryptionReport summarizes a pass encrypting existing patient rows
+type EncryptionReport struct {
+	KeyVersion int `json:"key_version"` // Data key version the rows were encrypted with
+	Rewrapped  int `json:"rewrapped"`   // Data keys rewrapped with the active KEK
+	Encrypted  int `json:"encrypted"`
+}
+
+// EncryptExisting encrypts the PHI of patients written before field
+// encryption was enabled and re-encrypts values written with an older data
+// key, deleted and merged records included. Rows are rewritten in place
+// without touching updated_at, so it is safe to run repeatedly and alongside
+// the API.
+func EncryptExisting(ctx context.Context, db *gorm.DB, batchSize int) (*EncryptionReport, error) {
+	cipher := models.FieldCipher()
+	if cipher == nil {
+		return nil, fmt.Errorf("data encryption is not enabled")
+	}
+	version, err := cipher.Keys().ActiveVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	current := encryption.VersionPrefix(version)
+
+	report := &EncryptionReport{KeyVersion: version}
+	after := uuid.Nil
+	for {
+		var patients []models.Patient
+		if err := db.WithContext(ctx).Unscoped().
+			Where("id > ?", after).
+			Where("("+staleCiphertext+") OR ("+missingIndex+")", sql.Named("current", current+"%")).
+			Order("id").
+			Limit(batchSize).
+			Find(&patients).Error; err != nil {
+			return report, err
+		}
+		if len(patients) == 0 {
+			return report, nil
+		}
+
+		// Rows matched only for a missing index are already encrypted with
+		// the active key
+		ids := make([]uuid.UUID, len(patients))
+		for i := range patients {
+			ids[i] = patients[i].ID
+		}
+		var staleIDs []uuid.UUID
+		if err := db.WithContext(ctx).Unscoped().Model(&models.Patient{}).
+			Where("id IN ?", ids).
+			Where(staleCiphertext, sql.Named("current", current+"%")).
+			Pluck("id", &staleIDs).Error; err != nil {
+			return report, err
+		}
+		stale := make(map[uuid.UUID]bool, len(staleIDs))
+		for _, id := range staleIDs {
+			stale[id] = true
+		}
+
+		encrypted := 0
+		err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			for i := range patients {
+				p := &patients[i]
+				indexes := [4]string{p.SSNIndex, p.EmailIndex, p.PhoneIndex, p.MobileIndex}
+				p.SetBlindIndexes()
+				if !stale[p.ID] && indexes == [4]string{p.SSNIndex, p.EmailIndex, p.PhoneIndex, p.MobileIndex} {
+					continue
+				}
+				// The column types encrypt the values loaded in plaintext
+				if err := tx.Unscoped().Model(p).UpdateColumns(map[string]interface{}{
+					"ssn":                 p.SSN,
+					"passport_number":     p.PassportNumber,
+					"email":               p.Email,
+					"phone_number":        p.PhoneNumber,
+					"mobile_number":       p.MobileNumber,
+					"address":             p.Address,
+					"emergency_contact":   p.EmergencyContact,
+					"insurance":           p.Insurance,
+					"ssn_index":           p.SSNIndex,
+					"email_index":         p.EmailIndex,
+					"phone_number_index":  p.PhoneIndex,
+					"mobile_number_index": p.MobileIndex,
+				}).Error; err != nil {
+					return err
+				}
+				encrypted++
+			}
+			return nil
+		})
+		if err != nil {
+			return report, err
+		}
+
+		report.Encrypted += encrypted
+		after = patients[len(patients)-1].ID
+	}
+}
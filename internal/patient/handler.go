@@ -22,7 +22,7 @@ func NewHandler(service *Service) *Handler {
 
 // CreatePatient godoc
 // @Summary Create a new patient
-// @Description Register a new patient in the system
+// @Description Register a new patient in the system. Returns 409 with the possible duplicates when the patient may already be registered, showing only the ID, score and level of patients the caller cannot access; resend with confirm_not_duplicate to register them anyway.
 // @Tags patients
 // @Accept json
 // @Produce json
@@ -31,6 +31,7 @@ func NewHandler(service *Service) *Handler {
 // @Success 201 {object} models.Patient
 // @Failure 400 {object} errors.AppError
 // @Failure 401 {object} errors.AppError
+// @Failure 409 {object} errors.AppError
 // @Router /api/v1/patients [post]
 func (h *Handler) CreatePatient(c *gin.Context) {
 	var req CreatePatientRequest
@@ -86,6 +87,33 @@ func (h *Handler) GetPatient(c *gin.Context) {
 	c.JSON(http.StatusOK, patient)
 }
 
+// GetPatientByMRN godoc
+// @Summary Get patient by MRN
+// @Description Get a patient by medical record number. The MRN of a merged record returns the record it was merged into; a mistyped MRN returns 400.
+// @Tags patients
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param mrn path string true "Medical record number"
+// @Success 200 {object} models.Patient
+// @Failure 400 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/pasien/mrn/{mrn} [get]
+func (h *Handler) GetPatientByMRN(c *gin.Context) {
+	patient, err := h.service.GetPatientByMRN(c.Request.Context(), c.Param("mrn"))
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.Set("audit_resource_id", patient.ID)
+	c.JSON(http.StatusOK, patient)
+}
+
 // ListPatients godoc
 // @Summary List patients
 // @Description Get a paginated list of patients
@@ -95,7 +123,7 @@ func (h *Handler) GetPatient(c *gin.Context) {
 // @Security BearerAuth
 // @Param page query int false "Page number" default(1)
 // @Param page_size query int false "Page size" default(20)
-// @Param search query string false "Search term"
+// @Param search query string false "Search term: name or MRN, exact SSN/NIK or email"
 // @Success 200 {object} map[string]interface{}
 // @Router /api/v1/patients [get]
 func (h *Handler) ListPatients(c *gin.Context) {
@@ -226,3 +254,158 @@ func (h *Handler) GetPatientTimeline(c *gin.Context) {
 
 	c.JSON(http.StatusOK, timeline)
 }
+
+// MergePatients godoc
+// @Summary Merge patient records
+// @Description Merge a duplicate patient record into the surviving one. Clinical records move to the survivor and the retired MRN keeps resolving to it. The merge can be undone during the grace period.
+// @Tags patient-merges
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body MergePatientsRequest true "Merge"
+// @Success 201 {object} models.PatientMerge
+// @Failure 400 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Failure 409 {object} errors.AppError
+// @Router /api/v1/penggabungan-pasien [post]
+func (h *Handler) MergePatients(c *gin.Context) {
+	var req MergePatientsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails(err.Error()))
+		return
+	}
+
+	userIDValue, _ := c.Get("user_id")
+	mergedBy, _ := userIDValue.(uuid.UUID)
+
+	merge, err := h.service.MergePatients(c.Request.Context(), &req, mergedBy)
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, merge)
+}
+
+// ListMerges godoc
+// @Summary List patient merges
+// @Description List patient record merges, newest first
+// @Tags patient-merges
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Page size" default(20)
+// @Param patient_id query string false "Surviving or retired patient ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/penggabungan-pasien [get]
+func (h *Handler) ListMerges(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	var patientID *uuid.UUID
+	if patientIDStr := c.Query("patient_id"); patientIDStr != "" {
+		id, err := uuid.Parse(patientIDStr)
+		if err == nil {
+			patientID = &id
+		}
+	}
+
+	merges, total, err := h.service.ListMerges(c.Request.Context(), page, pageSize, patientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":        merges,
+		"total":       total,
+		"page":        page,
+		"page_size":   pageSize,
+		"total_pages": (total + int64(pageSize) - 1) / int64(pageSize),
+	})
+}
+
+// GetMerge godoc
+// @Summary Get patient merge
+// @Description Get a patient record merge with the rows it moved
+// @Tags patient-merges
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Merge ID"
+// @Success 200 {object} models.PatientMerge
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/penggabungan-pasien/{id} [get]
+func (h *Handler) GetMerge(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails("Invalid merge ID"))
+		return
+	}
+
+	merge, err := h.service.GetMerge(c.Request.Context(), id)
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, merge)
+}
+
+// UnmergePatients godoc
+// @Summary Undo a patient merge
+// @Description Restore the retired patient record and move its records back. Only possible during the grace period and while the surviving record has not been merged again.
+// @Tags patient-merges
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Merge ID"
+// @Param request body UnmergePatientsRequest true "Unmerge"
+// @Success 200 {object} models.PatientMerge
+// @Failure 404 {object} errors.AppError
+// @Failure 409 {object} errors.AppError
+// @Router /api/v1/penggabungan-pasien/{id}/pembatalan [post]
+func (h *Handler) UnmergePatients(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails("Invalid merge ID"))
+		return
+	}
+
+	var req UnmergePatientsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails(err.Error()))
+		return
+	}
+
+	userIDValue, _ := c.Get("user_id")
+	unmergedBy, _ := userIDValue.(uuid.UUID)
+
+	merge, err := h.service.UnmergePatients(c.Request.Context(), id, &req, unmergedBy)
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, merge)
+}
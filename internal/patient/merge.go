@@ -0,0 +1,326 @@
+package patient
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/hospital-emr/backend/pkg/messaging"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type tabler interface {
+	TableName() string
+}
+
+// mergedModels are the records that follow a patient into the record it is
+// merged into. Care team assignments move too, so the clinicians looking
+// after either record keep access to the merged history.
+var mergedModels = []tabler{
+	&models.Encounter{},
+	&models.Appointment{},
+	&models.Allergy{},
+	&models.Medication{},
+	&models.VitalSign{},
+	&models.Order{},
+	&models.CareTeamAssignment{},
+	&models.PatientMRNAlias{},
+}
+
+// MergePatientsRequest represents a request to merge two records of the same patient
+type MergePatientsRequest struct {
+	SurvivorID  uuid.UUID  `json:"survivor_id" binding:"required"`
+	RetiredID   uuid.UUID  `json:"retired_id" binding:"required"`
+	DuplicateID *uuid.UUID `json:"duplicate_id"` // Suspected duplicate the merge resolves
+	Reason      string     `json:"reason" binding:"required"`
+}
+
+// UnmergePatientsRequest represents a request to undo a merge
+type UnmergePatientsRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// MergePatients moves the clinical records of the retired patient to the
+// survivor in a single transaction. The retired record is soft deleted and
+// its MRN kept as an alias of the survivor. The merge can be undone with
+// UnmergePatients until the grace period ends.
+func (s *Service) MergePatients(ctx context.Context, req *MergePatientsRequest, mergedBy uuid.UUID) (*models.PatientMerge, error) {
+	if req.SurvivorID == req.RetiredID {
+		return nil, errors.ErrValidation.WithDetails("A patient cannot be merged into itself")
+	}
+
+	var survivor, retired models.Patient
+	merge := &models.PatientMerge{
+		SurvivorID:       req.SurvivorID,
+		RetiredID:        req.RetiredID,
+		DuplicateID:      req.DuplicateID,
+		Reason:           req.Reason,
+		MovedRows:        models.MovedRows{},
+		MergedBy:         mergedBy,
+		UnmergeableAfter: time.Now().Add(s.unmergeGrace),
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		patients, err := lockPatients(tx, req.SurvivorID, req.RetiredID)
+		if err != nil {
+			return err
+		}
+		survivor, retired = patients[0], patients[1]
+		for _, patient := range patients {
+			if patient.MergedIntoID != nil {
+				return errors.ErrPatientMerged(patient.ID.String())
+			}
+		}
+
+		if req.DuplicateID != nil {
+			if err := resolveDuplicate(tx, *req.DuplicateID, req.SurvivorID, req.RetiredID); err != nil {
+				return err
+			}
+		}
+
+		for _, model := range mergedModels {
+			var ids []uuid.UUID
+			if err := tx.Unscoped().Model(model).Where("patient_id = ?", retired.ID).Pluck("id", &ids).Error; err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				continue
+			}
+			if err := tx.Unscoped().Model(model).Where("id IN ?", ids).Update("patient_id", survivor.ID).Error; err != nil {
+				return err
+			}
+			merge.MovedRows[model.TableName()] = ids
+		}
+
+		merge.RetiredMRN = retired.MRN
+		merge.RetiredStatus = retired.Status
+		if err := tx.Create(merge).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.PatientMRNAlias{MRN: retired.MRN, PatientID: survivor.ID, MergeID: merge.ID}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&retired).Updates(map[string]interface{}{
+			"status":         models.PatientStatusMerged,
+			"merged_into_id": survivor.ID,
+			"updated_by":     mergedBy,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&retired).Error
+	})
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			return nil, appErr
+		}
+		return nil, errors.ErrDatabaseError
+	}
+
+	// Publish event
+	s.natsClient.Publish(messaging.SubjectPatientMerged, map[string]interface{}{
+		"merge_id":          merge.ID,
+		"survivor_id":       survivor.ID,
+		"survivor_mrn":      survivor.MRN,
+		"retired_id":        retired.ID,
+		"retired_mrn":       retired.MRN,
+		"merged_by":         mergedBy,
+		"unmergeable_after": merge.UnmergeableAfter,
+	})
+
+	return merge, nil
+}
+
+// UnmergePatients undoes a merge within its grace period. Rows the merge moved
+// return to the retired record unless they have since been moved elsewhere;
+// rows added to the survivor after the merge stay with it.
+func (s *Service) UnmergePatients(ctx context.Context, id uuid.UUID, req *UnmergePatientsRequest, unmergedBy uuid.UUID) (*models.PatientMerge, error) {
+	var merge models.PatientMerge
+	var survivor, retired models.Patient
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&merge, "id = ?", id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errors.ErrPatientMergeNotFound(id.String())
+			}
+			return err
+		}
+		if merge.UnmergedAt != nil {
+			return errors.ErrUnmergeNotAllowed("The merge has already been undone")
+		}
+		if time.Now().After(merge.UnmergeableAfter) {
+			return errors.ErrUnmergeNotAllowed(fmt.Sprintf("The merge could only be undone until %s", merge.UnmergeableAfter.Format(time.RFC3339)))
+		}
+
+		patients, err := lockPatients(tx.Unscoped(), merge.SurvivorID, merge.RetiredID)
+		if err != nil {
+			return err
+		}
+		survivor, retired = patients[0], patients[1]
+		if survivor.MergedIntoID != nil {
+			return errors.ErrUnmergeNotAllowed("The surviving record has since been merged into another; undo that merge first")
+		}
+		if retired.MergedIntoID == nil || *retired.MergedIntoID != survivor.ID {
+			return errors.ErrUnmergeNotAllowed("The retired record is no longer merged into the surviving one")
+		}
+
+		for _, model := range mergedModels {
+			ids := merge.MovedRows[model.TableName()]
+			if len(ids) == 0 {
+				continue
+			}
+			if err := tx.Unscoped().Model(model).
+				Where("id IN ? AND patient_id = ?", ids, survivor.ID).
+				Update("patient_id", retired.ID).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Unscoped().Where("merge_id = ?", merge.ID).Delete(&models.PatientMRNAlias{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&retired).Updates(map[string]interface{}{
+			"deleted_at":     nil,
+			"status":         merge.RetiredStatus,
+			"merged_into_id": nil,
+			"updated_by":     unmergedBy,
+		}).Error; err != nil {
+			return err
+		}
+
+		// The pair goes back to the work queue for another look
+		if merge.DuplicateID != nil {
+			if err := tx.Model(&models.PatientDuplicate{}).Where("id = ?", *merge.DuplicateID).Updates(map[string]interface{}{
+				"status":       models.DuplicatePending,
+				"reviewed_by":  nil,
+				"reviewed_at":  nil,
+				"review_notes": "",
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		merge.UnmergedBy = &unmergedBy
+		merge.UnmergedAt = &now
+		merge.UnmergeReason = req.Reason
+		return tx.Model(&merge).Updates(map[string]interface{}{
+			"unmerged_by":    unmergedBy,
+			"unmerged_at":    now,
+			"unmerge_reason": req.Reason,
+		}).Error
+	})
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			return nil, appErr
+		}
+		return nil, errors.ErrDatabaseError
+	}
+
+	// Publish event
+	s.natsClient.Publish(messaging.SubjectPatientUnmerged, map[string]interface{}{
+		"merge_id":     merge.ID,
+		"survivor_id":  survivor.ID,
+		"survivor_mrn": survivor.MRN,
+		"retired_id":   retired.ID,
+		"retired_mrn":  retired.MRN,
+		"unmerged_by":  unmergedBy,
+	})
+
+	return &merge, nil
+}
+
+// ListMerges lists patient merges, newest first
+func (s *Service) ListMerges(ctx context.Context, page, pageSize int, patientID *uuid.UUID) ([]models.PatientMerge, int64, error) {
+	var merges []models.PatientMerge
+	var total int64
+
+	query := s.db.WithContext(ctx).Model(&models.PatientMerge{})
+
+	// Apply filters
+	if patientID != nil {
+		query = query.Where("survivor_id = ? OR retired_id = ?", *patientID, *patientID)
+	}
+
+	// Get total count
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, errors.ErrDatabaseError
+	}
+
+	// Get paginated results
+	offset := (page - 1) * pageSize
+	if err := query.
+		Offset(offset).
+		Limit(pageSize).
+		Order("created_at DESC").
+		Find(&merges).Error; err != nil {
+		return nil, 0, errors.ErrDatabaseError
+	}
+
+	return merges, total, nil
+}
+
+// GetMerge retrieves a patient merge
+func (s *Service) GetMerge(ctx context.Context, id uuid.UUID) (*models.PatientMerge, error) {
+	var merge models.PatientMerge
+	if err := s.db.WithContext(ctx).Where("id = ?", id).First(&merge).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrPatientMergeNotFound(id.String())
+		}
+		return nil, errors.ErrDatabaseError
+	}
+
+	return &merge, nil
+}
+
+// lockPatients loads and locks two patients, returned in the order given.
+// Rows are locked in ID order so concurrent merges cannot deadlock.
+func lockPatients(tx *gorm.DB, first, second uuid.UUID) ([]models.Patient, error) {
+	var found []models.Patient
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", []uuid.UUID{first, second}).
+		Order("id").
+		Find(&found).Error; err != nil {
+		return nil, err
+	}
+
+	patients := make([]models.Patient, 2)
+	for i, id := range []uuid.UUID{first, second} {
+		j := 0
+		for j < len(found) && found[j].ID != id {
+			j++
+		}
+		if j == len(found) {
+			return nil, errors.ErrPatientNotFound(id.String())
+		}
+		patients[i] = found[j]
+	}
+	return patients, nil
+}
+
+// resolveDuplicate marks the suspected duplicate a merge settles as merged.
+// It must be the pair being merged and not have been found distinct.
+func resolveDuplicate(tx *gorm.DB, id, survivorID, retiredID uuid.UUID) error {
+	var duplicate models.PatientDuplicate
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&duplicate, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return errors.ErrDuplicateNotFound(id.String())
+		}
+		return err
+	}
+
+	pair := (duplicate.PatientID == survivorID && duplicate.CandidateID == retiredID) ||
+		(duplicate.PatientID == retiredID && duplicate.CandidateID == survivorID)
+	if !pair {
+		return errors.ErrValidation.WithDetails("The suspected duplicate is not the pair being merged")
+	}
+	if duplicate.Status != models.DuplicatePending && duplicate.Status != models.DuplicateConfirmed {
+		return errors.ErrDuplicateReviewed(id.String())
+	}
+
+	return tx.Model(&duplicate).Update("status", models.DuplicateMerged).Error
+}
@@ -0,0 +1,178 @@
+package patient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hospital-emr/backend/internal/audit"
+	"github.com/hospital-emr/backend/internal/common/logger"
+	"github.com/hospital-emr/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// reencryptionLockID is the advisory lock that keeps re-encryption to one
+// API instance at a time
+const reencryptionLockID = 0x7265656e63 // "reenc"
+
+// Reencryption rolls patient PHI over to the latest keys in the background.
+// Every run reloads the data keys so the instance encrypts with versions
+// rotated elsewhere, rewraps data keys still wrapped by an old KEK and
+// re-encrypts rows written with an old data key or in plaintext.
+type Reencryption struct {
+	db        *gorm.DB
+	interval  time.Duration
+	batchSize int
+
+	mu      sync.Mutex
+	started bool
+	stopped bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewReencryption creates the re-encryption job
+func NewReencryption(db *gorm.DB, interval time.Duration, batchSize int) *Reencryption {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	return &Reencryption{
+		db:        db,
+		interval:  interval,
+		batchSize: batchSize,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start runs the job now and then at every interval until Close
+func (r *Reencryption) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.started || r.stopped {
+		return
+	}
+	r.started = true
+
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			r.runScheduled()
+			select {
+			case <-ticker.C:
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the job, waiting for a run in progress to finish
+func (r *Reencryption) Close(ctx context.Context) error {
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		return nil
+	}
+	r.stopped = true
+	started := r.started
+	close(r.stop)
+	r.mu.Unlock()
+
+	if !started {
+		return nil
+	}
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Reencryption) runScheduled() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-r.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	report, err := r.Run(ctx)
+	if err != nil {
+		logger.WithFields(map[string]interface{}{
+			"error": err.Error(),
+		}).Error("Patient re-encryption run failed")
+		return
+	}
+	if report.Rewrapped+report.Encrypted > 0 {
+		logger.WithFields(map[string]interface{}{
+			"key_version": report.KeyVersion,
+			"rewrapped":   report.Rewrapped,
+			"encrypted":   report.Encrypted,
+		}).Info("Patient re-encryption run completed")
+	}
+}
+
+// Run reloads the data keys and, unless another instance holds the job,
+// rewraps and re-encrypts what is not under the latest keys yet
+func (r *Reencryption) Run(ctx context.Context) (*EncryptionReport, error) {
+	ctx = audit.WithJob(ctx, "patient-reencryption")
+	report := &EncryptionReport{}
+	cipher := models.FieldCipher()
+	if cipher == nil {
+		return report, nil
+	}
+	if err := cipher.Keys().Reload(ctx); err != nil {
+		return report, err
+	}
+
+	unlock, locked, err := r.lock(ctx)
+	if err != nil || !locked {
+		return report, err
+	}
+	defer unlock()
+
+	rewrapped, err := cipher.Keys().Rewrap(ctx)
+	if err != nil {
+		return report, err
+	}
+	if report, err = EncryptExisting(ctx, r.db, r.batchSize); report != nil {
+		report.Rewrapped = rewrapped
+	}
+	return report, err
+}
+
+// lock takes the session-level advisory lock on a dedicated connection
+func (r *Reencryption) lock(ctx context.Context) (func(), bool, error) {
+	sqlDB, err := r.db.DB()
+	if err != nil {
+		return nil, false, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", reencryptionLockID).Scan(&locked); err != nil || !locked {
+		conn.Close()
+		return nil, false, err
+	}
+	return func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", reencryptionLockID); err != nil {
+			logger.Warnf("Failed to release re-encryption lock: %v", err)
+		}
+		conn.Close()
+	}, true, nil
+}
@@ -2,12 +2,15 @@ package patient
 
 import (
 	"context"
-	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/access"
 	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/common/logger"
 	"github.com/hospital-emr/backend/internal/models"
+	"github.com/hospital-emr/backend/internal/mpi"
+	"github.com/hospital-emr/backend/internal/numbering"
 	"github.com/hospital-emr/backend/pkg/messaging"
 	"gorm.io/gorm"
 )
@@ -16,13 +19,21 @@ import (
 type Service struct {
 	db           *gorm.DB
 	natsClient   *messaging.NATSClient
+	access       *access.Policy
+	numbers      *numbering.Service
+	mpi          *mpi.Service  // Nil when duplicate checks are disabled
+	unmergeGrace time.Duration // How long a merge can be undone
 }
 
 // NewService creates a new patient service
-func NewService(db *gorm.DB, natsClient *messaging.NATSClient) *Service {
+func NewService(db *gorm.DB, natsClient *messaging.NATSClient, accessPolicy *access.Policy, numbers *numbering.Service, mpiService *mpi.Service, unmergeGrace time.Duration) *Service {
 	return &Service{
-		db:         db,
-		natsClient: natsClient,
+		db:           db,
+		natsClient:   natsClient,
+		access:       accessPolicy,
+		numbers:      numbers,
+		mpi:          mpiService,
+		unmergeGrace: unmergeGrace,
 	}
 }
 
@@ -51,15 +62,14 @@ type CreatePatientRequest struct {
 	Insurance        models.Insurance         `json:"insurance"`
 	Language         string                   `json:"language"`
 	Occupation       string                   `json:"occupation"`
+
+	// Set after a possible duplicate warning to register a new patient anyway
+	ConfirmNotDuplicate bool `json:"confirm_not_duplicate"`
 }
 
 // CreatePatient creates a new patient
 func (s *Service) CreatePatient(ctx context.Context, req *CreatePatientRequest, createdBy uuid.UUID) (*models.Patient, error) {
-	// Generate MRN (Medical Record Number)
-	mrn := s.generateMRN()
-
 	patient := &models.Patient{
-		MRN:              mrn,
 		FirstName:        req.FirstName,
 		LastName:         req.LastName,
 		MiddleName:       req.MiddleName,
@@ -69,12 +79,12 @@ func (s *Service) CreatePatient(ctx context.Context, req *CreatePatientRequest,
 		MaritalStatus:    req.MaritalStatus,
 		Nationality:      req.Nationality,
 		Religion:         req.Religion,
-		SSN:              req.SSN,
-		PassportNumber:   req.PassportNumber,
-		Email:            req.Email,
-		PhoneNumber:      req.PhoneNumber,
-		MobileNumber:     req.MobileNumber,
-		Address:          req.Address,
+		SSN:              models.EncryptedString(req.SSN),
+		PassportNumber:   models.EncryptedString(req.PassportNumber),
+		Email:            models.EncryptedString(req.Email),
+		PhoneNumber:      models.EncryptedString(req.PhoneNumber),
+		MobileNumber:     models.EncryptedString(req.MobileNumber),
+		Address:          models.EncryptedString(req.Address),
 		City:             req.City,
 		State:            req.State,
 		ZipCode:          req.ZipCode,
@@ -88,10 +98,40 @@ func (s *Service) CreatePatient(ctx context.Context, req *CreatePatientRequest,
 	patient.CreatedBy = createdBy
 	patient.UpdatedBy = createdBy
 
+	// Check the master patient index for the same person registered before
+	var matches []mpi.Match
+	if s.mpi != nil {
+		var err error
+		if matches, err = s.mpi.FindDuplicates(ctx, patient); err != nil {
+			return nil, errors.ErrDatabaseError
+		}
+		if len(matches) > 0 && !req.ConfirmNotDuplicate {
+			candidates, err := s.duplicateCandidates(ctx, matches)
+			if err != nil {
+				return nil, err
+			}
+			return nil, errors.ErrPossibleDuplicatePatient(candidates)
+		}
+	}
+
+	// Generate MRN (Medical Record Number)
+	mrn, err := s.numbers.Next(ctx, models.NumberKindMRN)
+	if err != nil {
+		return nil, errors.ErrDatabaseError.WithDetails(err.Error())
+	}
+	patient.MRN = mrn
+
 	if err := s.db.WithContext(ctx).Create(patient).Error; err != nil {
 		return nil, errors.ErrDatabaseError.WithDetails(err.Error())
 	}
 
+	// Registrations confirmed over a warning are still queued for review
+	if len(matches) > 0 {
+		if _, err := s.mpi.Enqueue(ctx, patient.ID, matches, models.DuplicateSourceRegistration); err != nil {
+			logger.Errorf("Failed to queue possible duplicates of patient %s: %v", patient.ID, err)
+		}
+	}
+
 	// Publish event
 	s.natsClient.Publish(messaging.SubjectPatientCreated, map[string]interface{}{
 		"patient_id": patient.ID,
@@ -102,6 +142,45 @@ func (s *Service) CreatePatient(ctx context.Context, req *CreatePatientRequest,
 	return patient, nil
 }
 
+// redactedMatch is a possible duplicate the caller has no care relationship
+// with: enough to confirm over it, while reviewers see the details in the
+// duplicate review queue
+type redactedMatch struct {
+	PatientID uuid.UUID             `json:"patient_id"`
+	Score     float64               `json:"score"`
+	Level     models.DuplicateLevel `json:"level"`
+}
+
+// duplicateCandidates returns the matches to show a caller registering a
+// patient, leaving out the demographics of patients they cannot access
+func (s *Service) duplicateCandidates(ctx context.Context, matches []mpi.Match) ([]interface{}, error) {
+	ids := make([]uuid.UUID, len(matches))
+	for i, match := range matches {
+		ids[i] = match.PatientID
+	}
+	var accessible []uuid.UUID
+	if err := s.db.WithContext(ctx).Model(&models.Patient{}).
+		Scopes(s.access.ScopePatients(ctx, "patients.id")).
+		Where("id IN ?", ids).
+		Pluck("id", &accessible).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+	visible := make(map[uuid.UUID]bool, len(accessible))
+	for _, id := range accessible {
+		visible[id] = true
+	}
+
+	candidates := make([]interface{}, len(matches))
+	for i, match := range matches {
+		if visible[match.PatientID] {
+			candidates[i] = match
+		} else {
+			candidates[i] = redactedMatch{PatientID: match.PatientID, Score: match.Score, Level: match.Level}
+		}
+	}
+	return candidates, nil
+}
+
 // GetPatient retrieves a patient by ID
 func (s *Service) GetPatient(ctx context.Context, id uuid.UUID) (*models.Patient, error) {
 	var patient models.Patient
@@ -119,21 +198,40 @@ func (s *Service) GetPatient(ctx context.Context, id uuid.UUID) (*models.Patient
 	return &patient, nil
 }
 
-// GetPatientByMRN retrieves a patient by MRN
+// GetPatientByMRN retrieves a patient by MRN. The MRN of a record merged
+// into another resolves to the record it was merged into. Lookups are not
+// covered by the access middleware, so the policy is applied here.
 func (s *Service) GetPatientByMRN(ctx context.Context, mrn string) (*models.Patient, error) {
-	var patient models.Patient
-	if err := s.db.WithContext(ctx).
+	if err := s.numbers.Validate(ctx, models.NumberKindMRN, mrn); err != nil {
+		return nil, err
+	}
+
+	var patient *models.Patient
+	var found models.Patient
+	err := s.db.WithContext(ctx).
 		Preload("Allergies").
 		Preload("Medications").
 		Where("mrn = ?", mrn).
-		First(&patient).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+		First(&found).Error
+	switch {
+	case err == nil:
+		patient = &found
+	case err == gorm.ErrRecordNotFound:
+		var alias models.PatientMRNAlias
+		if err := s.db.WithContext(ctx).Where("mrn = ?", mrn).First(&alias).Error; err != nil {
 			return nil, errors.ErrPatientNotFound(mrn)
 		}
+		if patient, err = s.GetPatient(ctx, alias.PatientID); err != nil {
+			return nil, err
+		}
+	default:
 		return nil, errors.ErrDatabaseError
 	}
 
-	return &patient, nil
+	if err := s.access.CheckPatient(ctx, patient.ID); err != nil {
+		return nil, err
+	}
+	return patient, nil
 }
 
 // ListPatients lists patients with pagination
@@ -141,14 +239,22 @@ func (s *Service) ListPatients(ctx context.Context, page, pageSize int, search s
 	var patients []models.Patient
 	var total int64
 
-	query := s.db.WithContext(ctx).Model(&models.Patient{})
+	query := s.db.WithContext(ctx).Model(&models.Patient{}).
+		Scopes(s.access.ScopePatients(ctx, "patients.id"))
 
 	// Apply search filter
 	if search != "" {
-		query = query.Where(
-			"first_name ILIKE ? OR last_name ILIKE ? OR mrn ILIKE ? OR email ILIKE ?",
-			"%"+search+"%", "%"+search+"%", "%"+search+"%", "%"+search+"%",
-		)
+		conditions := s.db.Where(
+			"first_name ILIKE ? OR last_name ILIKE ? OR mrn ILIKE ?",
+			"%"+search+"%", "%"+search+"%", "%"+search+"%",
+		).Or(models.PatientLookup("ssn", search))
+		if models.FieldEncryptionEnabled() {
+			// Encrypted emails can only be matched in full
+			conditions = conditions.Or(models.PatientLookup("email", search))
+		} else {
+			conditions = conditions.Or("email ILIKE ?", "%"+search+"%")
+		}
+		query = query.Where(conditions)
 	}
 
 	// Get total count
@@ -189,12 +295,12 @@ func (s *Service) UpdatePatient(ctx context.Context, id uuid.UUID, req *CreatePa
 	patient.MaritalStatus = req.MaritalStatus
 	patient.Nationality = req.Nationality
 	patient.Religion = req.Religion
-	patient.SSN = req.SSN
-	patient.PassportNumber = req.PassportNumber
-	patient.Email = req.Email
-	patient.PhoneNumber = req.PhoneNumber
-	patient.MobileNumber = req.MobileNumber
-	patient.Address = req.Address
+	patient.SSN = models.EncryptedString(req.SSN)
+	patient.PassportNumber = models.EncryptedString(req.PassportNumber)
+	patient.Email = models.EncryptedString(req.Email)
+	patient.PhoneNumber = models.EncryptedString(req.PhoneNumber)
+	patient.MobileNumber = models.EncryptedString(req.MobileNumber)
+	patient.Address = models.EncryptedString(req.Address)
 	patient.City = req.City
 	patient.State = req.State
 	patient.ZipCode = req.ZipCode
@@ -231,12 +337,6 @@ func (s *Service) DeletePatient(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
-// generateMRN generates a unique Medical Record Number
-func (s *Service) generateMRN() string {
-	// Simple implementation - in production, use a more sophisticated approach
-	return fmt.Sprintf("MRN%d", time.Now().UnixNano()%1000000000)
-}
-
 // GetPatientTimeline gets patient medical timeline
 func (s *Service) GetPatientTimeline(ctx context.Context, patientID uuid.UUID) (map[string]interface{}, error) {
 	var patient models.Patient
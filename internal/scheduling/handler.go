@@ -87,6 +87,33 @@ func (h *Handler) GetAppointment(c *gin.Context) {
 	c.JSON(http.StatusOK, appointment)
 }
 
+// GetAppointmentByNumber godoc
+// @Summary Get appointment by number
+// @Description Get an appointment by appointment number; a mistyped number returns 400
+// @Tags appointments
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param number path string true "Appointment number"
+// @Success 200 {object} models.Appointment
+// @Failure 400 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/janji-temu/nomor/{number} [get]
+func (h *Handler) GetAppointmentByNumber(c *gin.Context) {
+	appointment, err := h.service.GetAppointmentByNumber(c.Request.Context(), c.Param("number"))
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.Set("audit_resource_id", appointment.ID)
+	c.JSON(http.StatusOK, appointment)
+}
+
 // ListAppointments godoc
 // @Summary List appointments
 // @Description Get a paginated list of appointments
@@ -2,12 +2,13 @@ package scheduling
 
 import (
 	"context"
-	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/access"
 	"github.com/hospital-emr/backend/internal/common/errors"
 	"github.com/hospital-emr/backend/internal/models"
+	"github.com/hospital-emr/backend/internal/numbering"
 	"github.com/hospital-emr/backend/pkg/messaging"
 	"gorm.io/gorm"
 )
@@ -16,13 +17,17 @@ import (
 type Service struct {
 	db         *gorm.DB
 	natsClient *messaging.NATSClient
+	access     *access.Policy
+	numbers    *numbering.Service
 }
 
 // NewService creates a new scheduling service
-func NewService(db *gorm.DB, natsClient *messaging.NATSClient) *Service {
+func NewService(db *gorm.DB, natsClient *messaging.NATSClient, accessPolicy *access.Policy, numbers *numbering.Service) *Service {
 	return &Service{
 		db:         db,
 		natsClient: natsClient,
+		access:     accessPolicy,
+		numbers:    numbers,
 	}
 }
 
@@ -51,6 +56,12 @@ func (s *Service) CreateAppointment(ctx context.Context, req *CreateAppointmentR
 		return nil, errors.ErrDatabaseError
 	}
 
+	// Booking an appointment creates a care relationship, so restricted
+	// clinicians need one with the patient already
+	if err := s.access.CheckPatient(ctx, req.PatientID); err != nil {
+		return nil, err
+	}
+
 	// Verify provider exists
 	var provider models.User
 	if err := s.db.WithContext(ctx).Where("id = ?", req.ProviderID).First(&provider).Error; err != nil {
@@ -67,7 +78,10 @@ func (s *Service) CreateAppointment(ctx context.Context, req *CreateAppointmentR
 	}
 
 	// Generate appointment number
-	appointmentNumber := s.generateAppointmentNumber()
+	appointmentNumber, err := s.numbers.Next(ctx, models.NumberKindAppointment)
+	if err != nil {
+		return nil, errors.ErrDatabaseError.WithDetails(err.Error())
+	}
 
 	appointment := &models.Appointment{
 		AppointmentNumber: appointmentNumber,
@@ -121,12 +135,39 @@ func (s *Service) GetAppointment(ctx context.Context, id uuid.UUID) (*models.App
 	return &appointment, nil
 }
 
+// GetAppointmentByNumber retrieves an appointment by appointment number.
+// Lookups are not covered by the access middleware, so the policy is applied
+// here.
+func (s *Service) GetAppointmentByNumber(ctx context.Context, number string) (*models.Appointment, error) {
+	if err := s.numbers.Validate(ctx, models.NumberKindAppointment, number); err != nil {
+		return nil, err
+	}
+
+	var appointment models.Appointment
+	if err := s.db.WithContext(ctx).
+		Preload("Patient").
+		Preload("Provider").
+		Where("appointment_number = ?", number).
+		First(&appointment).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrAppointmentNotFound(number)
+		}
+		return nil, errors.ErrDatabaseError
+	}
+
+	if err := s.access.CheckPatient(ctx, appointment.PatientID); err != nil {
+		return nil, err
+	}
+	return &appointment, nil
+}
+
 // ListAppointments lists appointments with pagination and filters
 func (s *Service) ListAppointments(ctx context.Context, page, pageSize int, patientID *uuid.UUID, providerID *uuid.UUID, status *models.AppointmentStatus, date *time.Time) ([]models.Appointment, int64, error) {
 	var appointments []models.Appointment
 	var total int64
 
-	query := s.db.WithContext(ctx).Model(&models.Appointment{})
+	query := s.db.WithContext(ctx).Model(&models.Appointment{}).
+		Scopes(s.access.ScopePatients(ctx, "appointments.patient_id"))
 
 	// Apply filters
 	if patientID != nil {
@@ -337,10 +378,6 @@ func (s *Service) isProviderAvailableExcept(ctx context.Context, providerID uuid
 	return count == 0
 }
 
-func (s *Service) generateAppointmentNumber() string {
-	return fmt.Sprintf("APT%d", time.Now().UnixNano()%1000000000)
-}
-
 // TimeSlot represents an available time slot
 type TimeSlot struct {
 	StartTime time.Time `json:"start_time"`
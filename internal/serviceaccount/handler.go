@@ -0,0 +1,233 @@
+package serviceaccount
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/errors"
+)
+
+// Handler handles service account HTTP requests
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a new service account handler
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// CreateServiceAccount godoc
+// @Summary Create service account
+// @Description Create a service account for a machine-to-machine integration
+// @Tags service-accounts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateServiceAccountRequest true "Service account data"
+// @Success 201 {object} models.ServiceAccount
+// @Failure 400 {object} errors.AppError
+// @Failure 409 {object} errors.AppError
+// @Router /api/v1/akun-layanan [post]
+func (h *Handler) CreateServiceAccount(c *gin.Context) {
+	var req CreateServiceAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails(err.Error()))
+		return
+	}
+
+	userIDValue, _ := c.Get("user_id")
+	userID, _ := userIDValue.(uuid.UUID)
+
+	account, err := h.service.CreateServiceAccount(c.Request.Context(), &req, userID)
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, account)
+}
+
+// ListServiceAccounts godoc
+// @Summary List service accounts
+// @Description List every service account with its API keys
+// @Tags service-accounts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.ServiceAccount
+// @Router /api/v1/akun-layanan [get]
+func (h *Handler) ListServiceAccounts(c *gin.Context) {
+	accounts, err := h.service.ListServiceAccounts(c.Request.Context())
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, accounts)
+}
+
+// GetServiceAccount godoc
+// @Summary Get service account by ID
+// @Description Get a service account with its API keys
+// @Tags service-accounts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Service account ID"
+// @Success 200 {object} models.ServiceAccount
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/akun-layanan/{id} [get]
+func (h *Handler) GetServiceAccount(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails("Invalid service account ID"))
+		return
+	}
+
+	account, err := h.service.GetServiceAccount(c.Request.Context(), id)
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// SetServiceAccountActive godoc
+// @Summary Activate or deactivate service account
+// @Description Deactivated service accounts can no longer authenticate with any of their keys
+// @Tags service-accounts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Service account ID"
+// @Param request body SetActiveRequest true "Active flag"
+// @Success 200 {object} models.ServiceAccount
+// @Failure 400 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/akun-layanan/{id}/status [put]
+func (h *Handler) SetServiceAccountActive(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails("Invalid service account ID"))
+		return
+	}
+
+	var req SetActiveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails(err.Error()))
+		return
+	}
+
+	userIDValue, _ := c.Get("user_id")
+	userID, _ := userIDValue.(uuid.UUID)
+
+	account, err := h.service.SetActive(c.Request.Context(), id, *req.IsActive, userID)
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// CreateAPIKey godoc
+// @Summary Create API key
+// @Description Issue a scoped API key for a service account. The key is only shown in this response. Scopes are limited to permissions the caller holds and exclude manage_users, manage_roles and manage_service_accounts.
+// @Tags service-accounts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Service account ID"
+// @Param request body CreateAPIKeyRequest true "Key settings"
+// @Success 201 {object} CreateAPIKeyResponse
+// @Failure 400 {object} errors.AppError
+// @Failure 403 {object} errors.AppError
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/akun-layanan/{id}/kunci [post]
+func (h *Handler) CreateAPIKey(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails("Invalid service account ID"))
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails(err.Error()))
+		return
+	}
+
+	userIDValue, _ := c.Get("user_id")
+	userID, _ := userIDValue.(uuid.UUID)
+
+	response, err := h.service.CreateAPIKey(c.Request.Context(), id, &req, userID)
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke API key
+// @Description Revoke an API key immediately
+// @Tags service-accounts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Service account ID"
+// @Param key_id path string true "API key ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} errors.AppError
+// @Router /api/v1/akun-layanan/{id}/kunci/{key_id} [delete]
+func (h *Handler) RevokeAPIKey(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails("Invalid service account ID"))
+		return
+	}
+
+	keyID, err := uuid.Parse(c.Param("key_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.ErrBadRequest.WithDetails("Invalid API key ID"))
+		return
+	}
+
+	userIDValue, _ := c.Get("user_id")
+	userID, _ := userIDValue.(uuid.UUID)
+
+	if err := h.service.RevokeAPIKey(c.Request.Context(), id, keyID, userID); err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, appErr)
+		} else {
+			c.JSON(http.StatusInternalServerError, errors.ErrInternal)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+}
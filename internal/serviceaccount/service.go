@@ -0,0 +1,334 @@
+package serviceaccount
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/access"
+	"github.com/hospital-emr/backend/internal/audit"
+	"github.com/hospital-emr/backend/internal/auth"
+	"github.com/hospital-emr/backend/internal/common/config"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/hospital-emr/backend/pkg/encryption"
+	"gorm.io/gorm"
+)
+
+// PermissionResolver resolves the effective permissions of a user
+type PermissionResolver interface {
+	EffectivePermissions(ctx context.Context, userID uuid.UUID) (map[string]struct{}, error)
+}
+
+// adminScopes are never granted to API keys: they would let a key manage
+// users, roles or other keys, including issuing itself more keys
+var adminScopes = map[string]bool{
+	models.PermissionManageUsers:           true,
+	models.PermissionManageRoles:           true,
+	models.PermissionManageServiceAccounts: true,
+}
+
+// Service manages service accounts and their API keys
+type Service struct {
+	db            *gorm.DB
+	apiKeys       *auth.APIKeyAuthenticator
+	permissions   PermissionResolver
+	audit         *audit.Recorder
+	defaultExpiry time.Duration
+}
+
+// NewService creates a new service account service
+func NewService(db *gorm.DB, cfg *config.Config, apiKeys *auth.APIKeyAuthenticator, permissions PermissionResolver, auditRecorder *audit.Recorder) *Service {
+	return &Service{
+		db:            db,
+		apiKeys:       apiKeys,
+		permissions:   permissions,
+		audit:         auditRecorder,
+		defaultExpiry: time.Duration(cfg.Security.APIKeyDefaultExpiryDays) * 24 * time.Hour,
+	}
+}
+
+// CreateServiceAccountRequest represents create service account request
+type CreateServiceAccountRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	System      string `json:"system" binding:"omitempty,oneof=lis ris erp fhir other"`
+}
+
+// SetActiveRequest activates or deactivates a service account
+type SetActiveRequest struct {
+	IsActive *bool `json:"is_active" binding:"required"`
+}
+
+// CreateAPIKeyRequest represents a request for a new API key
+type CreateAPIKeyRequest struct {
+	Name       string     `json:"name" binding:"required"`
+	Scopes     []string   `json:"scopes" binding:"required,min=1"` // Permission codes
+	AllowedIPs []string   `json:"allowed_ips"`                     // IPs or CIDR ranges
+	ExpiresAt  *time.Time `json:"expires_at"`
+}
+
+// CreateAPIKeyResponse carries a new API key. The key itself is only
+// returned here and cannot be recovered later.
+type CreateAPIKeyResponse struct {
+	APIKey *models.APIKey `json:"api_key"`
+	Key    string         `json:"key"`
+}
+
+// CreateServiceAccount creates a service account
+func (s *Service) CreateServiceAccount(ctx context.Context, req *CreateServiceAccountRequest, createdBy uuid.UUID) (*models.ServiceAccount, error) {
+	name := strings.TrimSpace(req.Name)
+
+	var count int64
+	if err := s.db.WithContext(ctx).Unscoped().Model(&models.ServiceAccount{}).Where("name = ?", name).Count(&count).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+	if count > 0 {
+		return nil, errors.ErrServiceAccountAlreadyExists(name)
+	}
+
+	account := &models.ServiceAccount{
+		Name:        name,
+		Description: req.Description,
+		System:      req.System,
+		IsActive:    true,
+		CreatedBy:   createdBy,
+	}
+	if err := s.db.WithContext(ctx).Create(account).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+
+	s.record(ctx, createdBy, models.AuditActionCreate, "service_account", account.ID,
+		fmt.Sprintf("Created service account %s", account.Name), nil)
+
+	return account, nil
+}
+
+// ListServiceAccounts lists every service account with its keys
+func (s *Service) ListServiceAccounts(ctx context.Context) ([]models.ServiceAccount, error) {
+	var accounts []models.ServiceAccount
+	if err := s.db.WithContext(ctx).
+		Preload("APIKeys", func(db *gorm.DB) *gorm.DB { return db.Order("created_at DESC") }).
+		Order("name").
+		Find(&accounts).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+
+	return accounts, nil
+}
+
+// GetServiceAccount retrieves a service account with its keys
+func (s *Service) GetServiceAccount(ctx context.Context, id uuid.UUID) (*models.ServiceAccount, error) {
+	var account models.ServiceAccount
+	if err := s.db.WithContext(ctx).
+		Preload("APIKeys", func(db *gorm.DB) *gorm.DB { return db.Order("created_at DESC") }).
+		First(&account, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrServiceAccountNotFound(id.String())
+		}
+		return nil, errors.ErrDatabaseError
+	}
+
+	return &account, nil
+}
+
+// SetActive activates or deactivates a service account. A deactivated
+// account's keys stop working immediately.
+func (s *Service) SetActive(ctx context.Context, id uuid.UUID, active bool, changedBy uuid.UUID) (*models.ServiceAccount, error) {
+	account, err := s.GetServiceAccount(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if account.IsActive == active {
+		return account, nil
+	}
+
+	if err := s.db.WithContext(ctx).Model(&models.ServiceAccount{}).Where("id = ?", id).Update("is_active", active).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+	account.IsActive = active
+	s.apiKeys.InvalidateServiceAccount(id)
+
+	state := "Deactivated"
+	if active {
+		state = "Activated"
+	}
+	s.record(ctx, changedBy, models.AuditActionStatusChange, "service_account", account.ID,
+		fmt.Sprintf("%s service account %s", state, account.Name), nil)
+
+	return account, nil
+}
+
+// CreateAPIKey issues a new API key for a service account. Scopes must be
+// existing permission codes the creator holds, other than the administrative
+// ones.
+func (s *Service) CreateAPIKey(ctx context.Context, serviceAccountID uuid.UUID, req *CreateAPIKeyRequest, createdBy uuid.UUID) (*CreateAPIKeyResponse, error) {
+	account, err := s.GetServiceAccount(ctx, serviceAccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.validateScopes(ctx, req.Scopes); err != nil {
+		return nil, err
+	}
+	if err := s.authorizeScopes(ctx, req.Scopes, createdBy); err != nil {
+		return nil, err
+	}
+	for _, entry := range req.AllowedIPs {
+		if net.ParseIP(entry) == nil {
+			if _, _, err := net.ParseCIDR(entry); err != nil {
+				return nil, errors.ErrValidation.WithDetails(fmt.Sprintf("allowed_ips: %q is not an IP address or CIDR range", entry))
+			}
+		}
+	}
+
+	expiresAt := req.ExpiresAt
+	if expiresAt == nil && s.defaultExpiry > 0 {
+		t := time.Now().Add(s.defaultExpiry)
+		expiresAt = &t
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, errors.ErrValidation.WithDetails("expires_at must be in the future")
+	}
+
+	rawKey, prefix, err := auth.GenerateAPIKey()
+	if err != nil {
+		return nil, errors.ErrInternal
+	}
+
+	key := &models.APIKey{
+		ServiceAccountID: account.ID,
+		Name:             req.Name,
+		KeyPrefix:        prefix,
+		KeyHash:          encryption.HashToken(rawKey),
+		Scopes:           req.Scopes,
+		AllowedIPs:       req.AllowedIPs,
+		ExpiresAt:        expiresAt,
+		CreatedBy:        createdBy,
+	}
+	if err := s.db.WithContext(ctx).Create(key).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+
+	s.record(ctx, createdBy, models.AuditActionAPIKeyCreate, "service_account", account.ID,
+		fmt.Sprintf("Issued API key %s for service account %s", prefix, account.Name),
+		map[string]interface{}{
+			"api_key_id":  key.ID,
+			"scopes":      key.Scopes,
+			"allowed_ips": key.AllowedIPs,
+			"expires_at":  key.ExpiresAt,
+		})
+
+	return &CreateAPIKeyResponse{APIKey: key, Key: rawKey}, nil
+}
+
+// RevokeAPIKey revokes an API key immediately
+func (s *Service) RevokeAPIKey(ctx context.Context, serviceAccountID, keyID, revokedBy uuid.UUID) error {
+	var key models.APIKey
+	if err := s.db.WithContext(ctx).
+		Where("id = ? AND service_account_id = ? AND revoked_at IS NULL", keyID, serviceAccountID).
+		First(&key).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return errors.ErrAPIKeyNotFound(keyID.String())
+		}
+		return errors.ErrDatabaseError
+	}
+
+	if err := s.db.WithContext(ctx).
+		Model(&models.APIKey{}).
+		Where("id = ?", keyID).
+		Updates(map[string]interface{}{
+			"revoked_at": time.Now(),
+			"revoked_by": revokedBy,
+		}).Error; err != nil {
+		return errors.ErrDatabaseError
+	}
+	s.apiKeys.InvalidateServiceAccount(serviceAccountID)
+
+	s.record(ctx, revokedBy, models.AuditActionAPIKeyRevoke, "service_account", serviceAccountID,
+		fmt.Sprintf("Revoked API key %s", key.KeyPrefix),
+		map[string]interface{}{"api_key_id": key.ID})
+
+	return nil
+}
+
+// validateScopes checks that every scope is an existing permission code
+func (s *Service) validateScopes(ctx context.Context, scopes []string) error {
+	var known []string
+	if err := s.db.WithContext(ctx).
+		Model(&models.Permission{}).
+		Where("code IN ?", scopes).
+		Pluck("code", &known).Error; err != nil {
+		return errors.ErrDatabaseError
+	}
+
+	found := make(map[string]bool, len(known))
+	for _, code := range known {
+		found[code] = true
+	}
+	var missing []string
+	for _, scope := range scopes {
+		if !found[scope] {
+			missing = append(missing, scope)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.ErrPermissionNotFound(missing)
+	}
+	return nil
+}
+
+// authorizeScopes checks that a key is granted no administrative scope and
+// nothing the user creating it does not hold
+func (s *Service) authorizeScopes(ctx context.Context, scopes []string, createdBy uuid.UUID) error {
+	var admin []string
+	for _, scope := range scopes {
+		if adminScopes[scope] {
+			admin = append(admin, scope)
+		}
+	}
+	if len(admin) > 0 {
+		return errors.ErrAPIKeyScopeNotAllowed(admin)
+	}
+
+	granted, err := s.permissions.EffectivePermissions(ctx, createdBy)
+	if err != nil {
+		return errors.ErrDatabaseError
+	}
+	var notHeld []string
+	for _, scope := range scopes {
+		if _, ok := granted[scope]; !ok {
+			notHeld = append(notHeld, scope)
+		}
+	}
+	if len(notHeld) > 0 {
+		return errors.ErrAPIKeyScopeNotHeld(notHeld)
+	}
+	return nil
+}
+
+// record writes a service account change to the audit log
+func (s *Service) record(ctx context.Context, userID uuid.UUID, action, resource string, resourceID uuid.UUID, description string, metadata map[string]interface{}) {
+	entry := &models.AuditLog{
+		UserID:      &userID,
+		Action:      action,
+		Resource:    resource,
+		ResourceID:  &resourceID,
+		Description: description,
+		Severity:    models.AuditSeverityWarning,
+	}
+	if metadata != nil {
+		raw, _ := json.Marshal(metadata)
+		entry.Metadata = string(raw)
+	}
+	if subject := access.SubjectFromContext(ctx); subject != nil {
+		entry.IPAddress = subject.IPAddress
+		entry.UserAgent = subject.UserAgent
+	}
+
+	s.audit.Record(ctx, entry)
+}
@@ -0,0 +1,63 @@
+package serviceaccount
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePermissions is a PermissionResolver over fixed permissions per user
+type fakePermissions map[uuid.UUID][]string
+
+func (f fakePermissions) EffectivePermissions(ctx context.Context, userID uuid.UUID) (map[string]struct{}, error) {
+	permissions := make(map[string]struct{})
+	for _, code := range f[userID] {
+		permissions[code] = struct{}{}
+	}
+	return permissions, nil
+}
+
+func TestAuthorizeScopes(t *testing.T) {
+	adminID := uuid.New()
+	service := &Service{permissions: fakePermissions{adminID: {
+		models.PermissionViewPatients,
+		models.PermissionViewEncounters,
+		models.PermissionManageUsers,
+		models.PermissionManageRoles,
+		models.PermissionManageServiceAccounts,
+	}}}
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		userID    uuid.UUID
+		scopes    []string
+		errorCode string
+		details   []string
+	}{
+		{"held scopes", adminID, []string{models.PermissionViewPatients, models.PermissionViewEncounters}, "", nil},
+		{"scope not held", adminID, []string{models.PermissionViewPatients, models.PermissionCreateOrders}, "API_KEY_SCOPE_NOT_HELD", []string{models.PermissionCreateOrders}},
+		{"caller holds nothing", uuid.New(), []string{models.PermissionViewPatients}, "API_KEY_SCOPE_NOT_HELD", []string{models.PermissionViewPatients}},
+		{"administrative scope even when held", adminID, []string{models.PermissionViewPatients, models.PermissionManageServiceAccounts}, "API_KEY_SCOPE_NOT_ALLOWED", []string{models.PermissionManageServiceAccounts}},
+		{"every administrative scope", adminID, []string{models.PermissionManageUsers, models.PermissionManageRoles}, "API_KEY_SCOPE_NOT_ALLOWED", []string{models.PermissionManageUsers, models.PermissionManageRoles}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := service.authorizeScopes(ctx, tt.scopes, tt.userID)
+			if tt.errorCode == "" {
+				assert.NoError(t, err)
+				return
+			}
+			appErr, ok := err.(*errors.AppError)
+			require.True(t, ok, "expected an AppError, got %v", err)
+			assert.Equal(t, tt.errorCode, appErr.Code)
+			assert.Equal(t, tt.details, appErr.Details)
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// CreateRoleRequest represents create role request
+type CreateRoleRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Code        string   `json:"code" binding:"required"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"` // Permission codes
+}
+
+// UpdateRoleRequest represents update role request. Only provided fields are changed.
+type UpdateRoleRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	IsActive    *bool   `json:"is_active"`
+}
+
+// SetRolePermissionsRequest replaces the permissions of a role
+type SetRolePermissionsRequest struct {
+	Permissions []string `json:"permissions" binding:"required"` // Permission codes
+}
+
+// ListRoles lists every role with its permissions
+func (s *Service) ListRoles(ctx context.Context) ([]models.Role, error) {
+	var roles []models.Role
+	if err := s.db.WithContext(ctx).Preload("Permissions").Order("name").Find(&roles).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+
+	return roles, nil
+}
+
+// GetRole retrieves a role with its permissions
+func (s *Service) GetRole(ctx context.Context, id uuid.UUID) (*models.Role, error) {
+	var role models.Role
+	if err := s.db.WithContext(ctx).Preload("Permissions").First(&role, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrRoleNotFound(id.String())
+		}
+		return nil, errors.ErrDatabaseError
+	}
+
+	return &role, nil
+}
+
+// CreateRole creates a role with the given permissions
+func (s *Service) CreateRole(ctx context.Context, req *CreateRoleRequest, actor Actor) (*models.Role, error) {
+	code := strings.ToLower(strings.TrimSpace(req.Code))
+	name := strings.TrimSpace(req.Name)
+
+	var count int64
+	if err := s.db.WithContext(ctx).Unscoped().Model(&models.Role{}).
+		Where("code = ? OR name = ?", code, name).
+		Count(&count).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+	if count > 0 {
+		return nil, errors.ErrRoleAlreadyExists(code)
+	}
+
+	permissions, err := s.findPermissions(ctx, req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	role := &models.Role{
+		Name:        name,
+		Code:        code,
+		Description: req.Description,
+		IsActive:    true,
+	}
+
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Permissions").Create(role).Error; err != nil {
+			return errors.ErrDatabaseError
+		}
+		if len(permissions) > 0 {
+			if err := tx.Model(role).Association("Permissions").Append(permissions); err != nil {
+				return errors.ErrDatabaseError
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	role.Permissions = permissions
+
+	s.record(ctx, actor, models.AuditActionCreate, "role", role.ID,
+		fmt.Sprintf("Created role %s with permissions %s", role.Code, strings.Join(permissionCodes(permissions), ", ")),
+		models.AuditSeverityWarning)
+
+	return role, nil
+}
+
+// UpdateRole updates a role's name, description or active flag. Deactivating
+// a role withdraws its permissions from every user holding it.
+func (s *Service) UpdateRole(ctx context.Context, id uuid.UUID, req *UpdateRoleRequest, actor Actor) (*models.Role, error) {
+	role, err := s.GetRole(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(map[string]interface{})
+	if req.Name != nil && strings.TrimSpace(*req.Name) != role.Name {
+		name := strings.TrimSpace(*req.Name)
+		var count int64
+		if err := s.db.WithContext(ctx).Unscoped().Model(&models.Role{}).
+			Where("name = ? AND id <> ?", name, id).
+			Count(&count).Error; err != nil {
+			return nil, errors.ErrDatabaseError
+		}
+		if count > 0 {
+			return nil, errors.ErrRoleAlreadyExists(name)
+		}
+		updates["name"] = name
+		role.Name = name
+	}
+	if req.Description != nil {
+		updates["description"] = *req.Description
+		role.Description = *req.Description
+	}
+	if req.IsActive != nil && *req.IsActive != role.IsActive {
+		updates["is_active"] = *req.IsActive
+		role.IsActive = *req.IsActive
+	}
+
+	if len(updates) == 0 {
+		return role, nil
+	}
+
+	if err := s.db.WithContext(ctx).Model(&models.Role{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+	var revoked int64
+	if _, ok := updates["is_active"]; ok {
+		s.permissions.InvalidateAll()
+		// Holders' tokens still name the role, so they sign in again
+		var holders []uuid.UUID
+		if err := s.db.WithContext(ctx).Table("user_roles").Where("role_id = ?", id).Pluck("user_id", &holders).Error; err != nil {
+			return nil, errors.ErrDatabaseError
+		}
+		revoked = s.rolesChanged(ctx, holders...)
+	}
+
+	fields := make([]string, 0, len(updates))
+	for field := range updates {
+		fields = append(fields, field)
+	}
+	s.record(ctx, actor, models.AuditActionUpdate, "role", role.ID,
+		fmt.Sprintf("Updated role %s: %s%s", role.Code, strings.Join(fields, ", "), revokedSuffix(revoked)),
+		models.AuditSeverityWarning)
+
+	return role, nil
+}
+
+// DeleteRole deletes a role that is no longer assigned to any user
+func (s *Service) DeleteRole(ctx context.Context, id uuid.UUID, actor Actor) error {
+	role, err := s.GetRole(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	var assigned int64
+	if err := s.db.WithContext(ctx).Table("user_roles").Where("role_id = ?", id).Count(&assigned).Error; err != nil {
+		return errors.ErrDatabaseError
+	}
+	if assigned > 0 {
+		return errors.ErrRoleInUse(role.Code)
+	}
+
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(role).Association("Permissions").Clear(); err != nil {
+			return errors.ErrDatabaseError
+		}
+		if err := tx.Delete(role).Error; err != nil {
+			return errors.ErrDatabaseError
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	s.record(ctx, actor, models.AuditActionDelete, "role", role.ID,
+		fmt.Sprintf("Deleted role %s", role.Code), models.AuditSeverityWarning)
+
+	return nil
+}
+
+// SetRolePermissions replaces the permissions of a role
+func (s *Service) SetRolePermissions(ctx context.Context, id uuid.UUID, req *SetRolePermissionsRequest, actor Actor) (*models.Role, error) {
+	role, err := s.GetRole(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := s.findPermissions(ctx, req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := permissionCodes(role.Permissions)
+	if err := s.db.WithContext(ctx).Model(role).Association("Permissions").Replace(permissions); err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+	role.Permissions = permissions
+	s.permissions.InvalidateAll()
+
+	s.record(ctx, actor, models.AuditActionPermissionChange, "role", role.ID,
+		fmt.Sprintf("Changed permissions of role %s from [%s] to [%s]",
+			role.Code, strings.Join(previous, ", "), strings.Join(permissionCodes(permissions), ", ")),
+		models.AuditSeverityWarning)
+
+	return role, nil
+}
+
+// ListPermissions lists every permission that can be granted to a role
+func (s *Service) ListPermissions(ctx context.Context) ([]models.Permission, error) {
+	var permissions []models.Permission
+	if err := s.db.WithContext(ctx).Order("resource, action").Find(&permissions).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+
+	return permissions, nil
+}
+
+// findPermissions loads permissions by code, failing if any code is unknown
+func (s *Service) findPermissions(ctx context.Context, codes []string) ([]models.Permission, error) {
+	permissions := []models.Permission{}
+	if len(codes) == 0 {
+		return permissions, nil
+	}
+
+	if err := s.db.WithContext(ctx).Where("code IN ?", codes).Find(&permissions).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+
+	found := make(map[string]bool, len(permissions))
+	for _, permission := range permissions {
+		found[permission.Code] = true
+	}
+	var missing []string
+	for _, code := range codes {
+		if !found[code] {
+			missing = append(missing, code)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, errors.ErrPermissionNotFound(missing)
+	}
+
+	return permissions, nil
+}
+
+// permissionCodes returns the codes of the given permissions
+func permissionCodes(permissions []models.Permission) []string {
+	codes := make([]string, len(permissions))
+	for i, permission := range permissions {
+		codes[i] = permission.Code
+	}
+	return codes
+}
@@ -2,22 +2,411 @@ package user
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/audit"
+	"github.com/hospital-emr/backend/internal/auth"
 	"github.com/hospital-emr/backend/internal/common/errors"
 	"github.com/hospital-emr/backend/internal/models"
 	"gorm.io/gorm"
 )
 
+// SessionRevoker revokes every session of a user, e.g. when the account is
+// deactivated
+type SessionRevoker interface {
+	RevokeAllSessions(ctx context.Context, userID uuid.UUID) (int64, error)
+}
+
+// Actor identifies the administrator making a change, for the audit trail
+type Actor struct {
+	UserID    uuid.UUID
+	IPAddress string
+	UserAgent string
+}
+
 // Service provides user management services
 type Service struct {
-	db *gorm.DB
+	db          *gorm.DB
+	passwords   *auth.PasswordPolicy
+	permissions *auth.PermissionCache
+	sessions    SessionRevoker
+	audit       *audit.Recorder
 }
 
 // NewService creates a new user service
-func NewService(db *gorm.DB) *Service {
+func NewService(db *gorm.DB, passwords *auth.PasswordPolicy, permissions *auth.PermissionCache, sessions SessionRevoker, auditRecorder *audit.Recorder) *Service {
 	return &Service{
-		db: db,
+		db:          db,
+		passwords:   passwords,
+		permissions: permissions,
+		sessions:    sessions,
+		audit:       auditRecorder,
+	}
+}
+
+// CreateUserRequest represents create user request
+type CreateUserRequest struct {
+	Email         string   `json:"email" binding:"required,email"`
+	FirstName     string   `json:"first_name" binding:"required"`
+	LastName      string   `json:"last_name" binding:"required"`
+	PhoneNumber   string   `json:"phone_number"`
+	Password      string   `json:"password"` // Optional; a temporary password is generated when empty
+	LicenseNumber string   `json:"license_number"`
+	Specialty     string   `json:"specialty"`
+	Department    string   `json:"department"`
+	Address       string   `json:"address"`
+	ShiftStart    string   `json:"shift_start" binding:"required_with=ShiftEnd,omitempty,datetime=15:04"`
+	ShiftEnd      string   `json:"shift_end" binding:"required_with=ShiftStart,omitempty,datetime=15:04"`
+	Roles         []string `json:"roles" binding:"required,min=1"` // Role codes
+}
+
+// CreateUserResponse carries the created user and, when generated, the
+// temporary password to hand over to them
+type CreateUserResponse struct {
+	User              *models.User `json:"user"`
+	TemporaryPassword string       `json:"temporary_password,omitempty"`
+}
+
+// UpdateUserRequest represents update user request. Only provided fields are changed.
+type UpdateUserRequest struct {
+	Email         *string `json:"email" binding:"omitempty,email"`
+	FirstName     *string `json:"first_name"`
+	LastName      *string `json:"last_name"`
+	PhoneNumber   *string `json:"phone_number"`
+	LicenseNumber *string `json:"license_number"`
+	Specialty     *string `json:"specialty"`
+	Department    *string `json:"department"`
+	Address       *string `json:"address"`
+	ShiftStart    *string `json:"shift_start" binding:"omitempty,datetime=15:04"` // Empty string clears the shift
+	ShiftEnd      *string `json:"shift_end" binding:"omitempty,datetime=15:04"`
+}
+
+// SetStatusRequest represents a request to activate, deactivate or suspend a user
+type SetStatusRequest struct {
+	Status models.UserStatus `json:"status" binding:"required,oneof=active inactive suspended"`
+	Reason string            `json:"reason"`
+}
+
+// AssignRolesRequest represents a request to add roles to a user
+type AssignRolesRequest struct {
+	Roles []string `json:"roles" binding:"required,min=1"` // Role codes
+}
+
+// CreateUser creates a user with the given roles. The initial password,
+// whether chosen by the admin or generated, must be changed at first login.
+func (s *Service) CreateUser(ctx context.Context, req *CreateUserRequest, actor Actor) (*CreateUserResponse, error) {
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+
+	var count int64
+	if err := s.db.WithContext(ctx).Unscoped().Model(&models.User{}).Where("email = ?", email).Count(&count).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+	if count > 0 {
+		return nil, errors.ErrUserAlreadyExists(email)
+	}
+
+	roles, err := s.findRoles(ctx, req.Roles)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &models.User{
+		Email:         email,
+		FirstName:     strings.TrimSpace(req.FirstName),
+		LastName:      strings.TrimSpace(req.LastName),
+		PhoneNumber:   req.PhoneNumber,
+		Status:        models.UserStatusActive,
+		LicenseNumber: strings.TrimSpace(req.LicenseNumber),
+		Specialty:     strings.TrimSpace(req.Specialty),
+		Department:    strings.TrimSpace(req.Department),
+		Address:       strings.TrimSpace(req.Address),
+		ShiftStart:    req.ShiftStart,
+		ShiftEnd:      req.ShiftEnd,
+	}
+	if err := ValidateClinicalProfile(user, roles); err != nil {
+		return nil, err
+	}
+
+	password := req.Password
+	generated := password == ""
+	if generated {
+		if password, err = s.passwords.GenerateTemporaryPassword(); err != nil {
+			return nil, errors.ErrInternal
+		}
+	}
+
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// The hash is replaced by SetPassword once the row exists for the history
+		user.PasswordHash = "!"
+		if err := tx.Omit("Roles").Create(user).Error; err != nil {
+			return errors.ErrDatabaseError
+		}
+		if err := tx.Model(user).Association("Roles").Append(roles); err != nil {
+			return errors.ErrDatabaseError
+		}
+		return s.passwords.SetPassword(ctx, tx, user, password, true)
+	}); err != nil {
+		return nil, err
+	}
+	user.Roles = roles
+
+	s.record(ctx, actor, models.AuditActionCreate, "user", user.ID,
+		fmt.Sprintf("Created user %s with roles %s", user.Email, strings.Join(roleCodes(roles), ", ")),
+		models.AuditSeverityInfo)
+
+	response := &CreateUserResponse{User: user}
+	if generated {
+		response.TemporaryPassword = password
+	}
+	return response, nil
+}
+
+// GetUser retrieves a user with their roles
+func (s *Service) GetUser(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).Preload("Roles").First(&user, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrUserNotFound(id.String())
+		}
+		return nil, errors.ErrDatabaseError
+	}
+
+	return &user, nil
+}
+
+// UpdateUser updates a user's profile. Clinical users must keep a complete
+// professional profile.
+func (s *Service) UpdateUser(ctx context.Context, id uuid.UUID, req *UpdateUserRequest, actor Actor) (*models.User, error) {
+	user, err := s.GetUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(map[string]interface{})
+	if req.Email != nil {
+		email := strings.ToLower(strings.TrimSpace(*req.Email))
+		if email != user.Email {
+			var count int64
+			if err := s.db.WithContext(ctx).Unscoped().Model(&models.User{}).Where("email = ?", email).Count(&count).Error; err != nil {
+				return nil, errors.ErrDatabaseError
+			}
+			if count > 0 {
+				return nil, errors.ErrUserAlreadyExists(email)
+			}
+			updates["email"] = email
+			user.Email = email
+		}
+	}
+	if req.FirstName != nil {
+		updates["first_name"] = strings.TrimSpace(*req.FirstName)
+		user.FirstName = strings.TrimSpace(*req.FirstName)
+	}
+	if req.LastName != nil {
+		updates["last_name"] = strings.TrimSpace(*req.LastName)
+		user.LastName = strings.TrimSpace(*req.LastName)
+	}
+	if req.PhoneNumber != nil {
+		updates["phone_number"] = *req.PhoneNumber
+		user.PhoneNumber = *req.PhoneNumber
+	}
+	if req.LicenseNumber != nil {
+		updates["license_number"] = strings.TrimSpace(*req.LicenseNumber)
+		user.LicenseNumber = strings.TrimSpace(*req.LicenseNumber)
+	}
+	if req.Specialty != nil {
+		updates["specialty"] = strings.TrimSpace(*req.Specialty)
+		user.Specialty = strings.TrimSpace(*req.Specialty)
+	}
+	if req.Department != nil {
+		updates["department"] = strings.TrimSpace(*req.Department)
+		user.Department = strings.TrimSpace(*req.Department)
+	}
+	if req.Address != nil {
+		updates["address"] = strings.TrimSpace(*req.Address)
+		user.Address = strings.TrimSpace(*req.Address)
+	}
+	if req.ShiftStart != nil {
+		updates["shift_start"] = *req.ShiftStart
+		user.ShiftStart = *req.ShiftStart
+	}
+	if req.ShiftEnd != nil {
+		updates["shift_end"] = *req.ShiftEnd
+		user.ShiftEnd = *req.ShiftEnd
+	}
+	if (user.ShiftStart == "") != (user.ShiftEnd == "") {
+		return nil, errors.ErrValidation.WithDetails("shift_start and shift_end must be set together")
+	}
+
+	if len(updates) == 0 {
+		return user, nil
+	}
+
+	if err := ValidateClinicalProfile(user, user.Roles); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+
+	fields := make([]string, 0, len(updates))
+	for field := range updates {
+		fields = append(fields, field)
+	}
+	s.record(ctx, actor, models.AuditActionUpdate, "user", user.ID,
+		fmt.Sprintf("Updated user %s: %s", user.Email, strings.Join(fields, ", ")),
+		models.AuditSeverityInfo)
+
+	return user, nil
+}
+
+// SetStatus activates, deactivates or suspends a user. Users leaving the
+// active state have all of their sessions revoked.
+func (s *Service) SetStatus(ctx context.Context, id uuid.UUID, req *SetStatusRequest, actor Actor) (*models.User, error) {
+	if id == actor.UserID {
+		return nil, errors.ErrForbidden.WithDetails("You cannot change the status of your own account")
 	}
+
+	user, err := s.GetUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status == req.Status {
+		return user, nil
+	}
+
+	previous := user.Status
+	if err := s.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).Update("status", req.Status).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+	user.Status = req.Status
+
+	var revoked int64
+	if req.Status != models.UserStatusActive {
+		revoked, _ = s.sessions.RevokeAllSessions(ctx, user.ID)
+	}
+	s.permissions.InvalidateUser(user.ID)
+
+	description := fmt.Sprintf("Changed status of %s from %s to %s", user.Email, previous, req.Status) + revokedSuffix(revoked)
+	if req.Reason != "" {
+		description += ": " + req.Reason
+	}
+	s.record(ctx, actor, models.AuditActionStatusChange, "user", user.ID, description, models.AuditSeverityWarning)
+
+	return user, nil
+}
+
+// UnlockUser clears both temporary and permanent lockouts of a user
+func (s *Service) UnlockUser(ctx context.Context, id uuid.UUID, actor Actor) (*models.User, error) {
+	user, err := s.GetUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{
+		"failed_login_attempts": 0,
+		"locked_until":          nil,
+	}
+	if user.Status == models.UserStatusLocked {
+		updates["status"] = models.UserStatusActive
+	}
+
+	if err := s.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+
+	if user.Status == models.UserStatusLocked {
+		user.Status = models.UserStatusActive
+	}
+	user.FailedLoginAttempts = 0
+	user.LockedUntil = nil
+
+	s.record(ctx, actor, models.AuditActionAccountUnlock, "user", user.ID,
+		fmt.Sprintf("Unlocked account %s", user.Email), models.AuditSeverityWarning)
+
+	return user, nil
+}
+
+// AssignRoles adds roles to a user. The user's profile must satisfy the
+// requirements of every clinical role they end up with.
+func (s *Service) AssignRoles(ctx context.Context, id uuid.UUID, req *AssignRolesRequest, actor Actor) (*models.User, error) {
+	user, err := s.GetUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := s.findRoles(ctx, req.Roles)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ValidateClinicalProfile(user, append(append([]models.Role{}, user.Roles...), roles...)); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.WithContext(ctx).Model(user).Association("Roles").Append(roles); err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+	revoked := s.rolesChanged(ctx, user.ID)
+
+	s.record(ctx, actor, models.AuditActionRoleAssign, "user", user.ID,
+		fmt.Sprintf("Assigned roles %s to %s%s", strings.Join(roleCodes(roles), ", "), user.Email, revokedSuffix(revoked)),
+		models.AuditSeverityWarning)
+
+	return s.GetUser(ctx, id)
+}
+
+// RemoveRole removes a role from a user
+func (s *Service) RemoveRole(ctx context.Context, id uuid.UUID, roleCode string, actor Actor) (*models.User, error) {
+	user, err := s.GetUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var role *models.Role
+	for i := range user.Roles {
+		if user.Roles[i].Code == roleCode {
+			role = &user.Roles[i]
+			break
+		}
+	}
+	if role == nil {
+		return nil, errors.ErrRoleNotFound(roleCode)
+	}
+
+	if err := s.db.WithContext(ctx).Model(user).Association("Roles").Delete(role); err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+	revoked := s.rolesChanged(ctx, user.ID)
+
+	s.record(ctx, actor, models.AuditActionRoleRemove, "user", user.ID,
+		fmt.Sprintf("Removed role %s from %s%s", roleCode, user.Email, revokedSuffix(revoked)), models.AuditSeverityWarning)
+
+	return s.GetUser(ctx, id)
+}
+
+// rolesChanged drops the cached permissions of users whose roles changed and
+// revokes their sessions. Access tokens carry the role codes the access
+// policy decides on, so users must sign in again to pick up the new roles.
+func (s *Service) rolesChanged(ctx context.Context, userIDs ...uuid.UUID) int64 {
+	s.permissions.InvalidateUser(userIDs...)
+
+	var revoked int64
+	for _, id := range userIDs {
+		n, _ := s.sessions.RevokeAllSessions(ctx, id)
+		revoked += n
+	}
+	return revoked
+}
+
+// revokedSuffix describes revoked sessions at the end of an audit description
+func revokedSuffix(revoked int64) string {
+	if revoked == 0 {
+		return ""
+	}
+	return fmt.Sprintf("; %d session(s) revoked", revoked)
 }
 
 // ListUsers lists users with optional role filtering
@@ -51,3 +440,48 @@ func (s *Service) ListUsers(ctx context.Context, roleFilter string, page, pageSi
 
 	return users, total, nil
 }
+
+// findRoles loads active roles by code, failing if any code is unknown
+func (s *Service) findRoles(ctx context.Context, codes []string) ([]models.Role, error) {
+	var roles []models.Role
+	if err := s.db.WithContext(ctx).
+		Where("code IN ? AND is_active = ?", codes, true).
+		Find(&roles).Error; err != nil {
+		return nil, errors.ErrDatabaseError
+	}
+
+	found := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		found[role.Code] = true
+	}
+	for _, code := range codes {
+		if !found[code] {
+			return nil, errors.ErrRoleNotFound(code)
+		}
+	}
+
+	return roles, nil
+}
+
+// record writes a user or role administration change to the audit log
+func (s *Service) record(ctx context.Context, actor Actor, action, resource string, resourceID uuid.UUID, description string, severity models.AuditSeverity) {
+	s.audit.Record(ctx, &models.AuditLog{
+		UserID:      &actor.UserID,
+		Action:      action,
+		Resource:    resource,
+		ResourceID:  &resourceID,
+		Description: description,
+		IPAddress:   actor.IPAddress,
+		UserAgent:   actor.UserAgent,
+		Severity:    severity,
+	})
+}
+
+// roleCodes returns the codes of the given roles
+func roleCodes(roles []models.Role) []string {
+	codes := make([]string, len(roles))
+	for i, role := range roles {
+		codes[i] = role.Code
+	}
+	return codes
+}
@@ -0,0 +1,63 @@
+package user
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/models"
+)
+
+// clinicalRequirement lists the professional profile fields a clinical role requires
+type clinicalRequirement struct {
+	License    bool
+	Specialty  bool
+	Department bool
+}
+
+// clinicalRequirements maps clinical role codes to their profile requirements
+var clinicalRequirements = map[string]clinicalRequirement{
+	models.RoleDoctor:      {License: true, Specialty: true, Department: true},
+	models.RoleNurse:       {License: true, Department: true},
+	models.RolePharmacist:  {License: true},
+	models.RoleLabTech:     {License: true, Department: true},
+	models.RoleRadiologist: {License: true, Specialty: true, Department: true},
+}
+
+// licenseNumberPattern accepts registration numbers such as STR/SIP numbers:
+// letters, digits and the separators . / -
+var licenseNumberPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9./-]{4,39}$`)
+
+// ValidateClinicalProfile checks that the user's license number, specialty and
+// department satisfy every clinical role among the given roles
+func ValidateClinicalProfile(user *models.User, roles []models.Role) error {
+	var required clinicalRequirement
+	for _, role := range roles {
+		req, ok := clinicalRequirements[role.Code]
+		if !ok {
+			continue
+		}
+		required.License = required.License || req.License
+		required.Specialty = required.Specialty || req.Specialty
+		required.Department = required.Department || req.Department
+	}
+
+	var violations []string
+	if required.License && user.LicenseNumber == "" {
+		violations = append(violations, "license_number is required for clinical roles")
+	}
+	if user.LicenseNumber != "" && !licenseNumberPattern.MatchString(user.LicenseNumber) {
+		violations = append(violations, fmt.Sprintf("license_number %q is not a valid registration number", user.LicenseNumber))
+	}
+	if required.Specialty && user.Specialty == "" {
+		violations = append(violations, "specialty is required for this role")
+	}
+	if required.Department && user.Department == "" {
+		violations = append(violations, "department is required for this role")
+	}
+
+	if len(violations) > 0 {
+		return errors.ErrClinicalProfileIncomplete(violations)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package user
+
+import (
+	"testing"
+
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateClinicalProfile(t *testing.T) {
+	doctor := models.Role{Code: models.RoleDoctor}
+	pharmacist := models.Role{Code: models.RolePharmacist}
+	receptionist := models.Role{Code: models.RoleReceptionist}
+
+	tests := []struct {
+		name       string
+		user       models.User
+		roles      []models.Role
+		violations int
+	}{
+		{"non-clinical role needs nothing", models.User{}, []models.Role{receptionist}, 0},
+		{"complete doctor", models.User{LicenseNumber: "STR-3171/2023.001", Specialty: "Cardiology", Department: "Cardiology"}, []models.Role{doctor}, 0},
+		{"doctor missing everything", models.User{}, []models.Role{doctor}, 3},
+		{"pharmacist only needs a license", models.User{LicenseNumber: "SIPA12345"}, []models.Role{pharmacist}, 0},
+		{"malformed license", models.User{LicenseNumber: "12 34"}, []models.Role{pharmacist}, 1},
+		{"requirements combine across roles", models.User{LicenseNumber: "SIPA12345"}, []models.Role{pharmacist, doctor}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateClinicalProfile(&tt.user, tt.roles)
+			if tt.violations == 0 {
+				assert.NoError(t, err)
+				return
+			}
+
+			appErr, ok := err.(*errors.AppError)
+			require.True(t, ok)
+			assert.Equal(t, "CLINICAL_PROFILE_INCOMPLETE", appErr.Code)
+			assert.Len(t, appErr.Details, tt.violations)
+		})
+	}
+}
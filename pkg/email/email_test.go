@@ -0,0 +1,112 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSMTPServer accepts a single SMTP session and captures the envelope and data
+type fakeSMTPServer struct {
+	listener net.Listener
+	from     string
+	to       []string
+	data     string
+	done     chan struct{}
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := &fakeSMTPServer{listener: listener, done: make(chan struct{})}
+	go server.serve()
+	t.Cleanup(func() { listener.Close() })
+
+	return server
+}
+
+func (s *fakeSMTPServer) serve() {
+	defer close(s.done)
+
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP fake")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			s.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			s.to = append(s.to, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			s.data = data.String()
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSMTPSenderSend(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	host, port, err := net.SplitHostPort(server.listener.Addr().String())
+	require.NoError(t, err)
+
+	sender := NewSMTPSender(host, port, "", "", "noreply@hospital-emr.com")
+	err = sender.Send(context.Background(), &Message{
+		To:      []string{"budi@hospital-emr.com"},
+		Subject: "Atur ulang kata sandi",
+		Body:    "Line one\nLine two",
+	})
+	require.NoError(t, err)
+	<-server.done
+
+	assert.Equal(t, "noreply@hospital-emr.com", server.from)
+	assert.Equal(t, []string{"budi@hospital-emr.com"}, server.to)
+	assert.Contains(t, server.data, "Subject: Atur ulang kata sandi\r\n")
+	assert.Contains(t, server.data, "To: budi@hospital-emr.com\r\n")
+	assert.True(t, strings.HasSuffix(server.data, "\r\n\r\nLine one\r\nLine two\r\n"))
+}
+
+func TestSMTPSenderRequiresRecipients(t *testing.T) {
+	sender := NewSMTPSender("127.0.0.1", "25", "", "", "noreply@hospital-emr.com")
+	assert.Error(t, sender.Send(context.Background(), &Message{Subject: "No recipients"}))
+}
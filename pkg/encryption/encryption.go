@@ -4,7 +4,9 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"io"
 
@@ -23,13 +25,42 @@ func CheckPasswordHash(password, hash string) bool {
 	return err == nil
 }
 
+// HashToken returns the hex encoded SHA-256 hash of a high-entropy token.
+// Use it for random secrets such as recovery codes; passwords must use HashPassword.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateRandomToken generates a URL-safe random token with n bytes of entropy
+func GenerateRandomToken(n int) (string, error) {
+	raw := make([]byte, n)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
 // Encrypt encrypts data using AES-256
 func Encrypt(data, key string) (string, error) {
 	if len(key) != 32 {
 		return "", errors.New("encryption key must be 32 bytes for AES-256")
 	}
+	return seal([]byte(key), []byte(data), nil)
+}
+
+// Decrypt decrypts data using AES-256
+func Decrypt(encryptedData, key string) (string, error) {
+	if len(key) != 32 {
+		return "", errors.New("encryption key must be 32 bytes for AES-256")
+	}
+	return open([]byte(key), encryptedData, nil)
+}
 
-	block, err := aes.NewCipher([]byte(key))
+// seal encrypts data with AES-GCM under a random nonce. additionalData is
+// authenticated but not encrypted: open fails unless given the same.
+func seal(key, data, additionalData []byte) (string, error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return "", err
 	}
@@ -44,22 +75,18 @@ func Encrypt(data, key string) (string, error) {
 		return "", err
 	}
 
-	ciphertext := gcm.Seal(nonce, nonce, []byte(data), nil)
+	ciphertext := gcm.Seal(nonce, nonce, data, additionalData)
 	return base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
-// Decrypt decrypts data using AES-256
-func Decrypt(encryptedData, key string) (string, error) {
-	if len(key) != 32 {
-		return "", errors.New("encryption key must be 32 bytes for AES-256")
-	}
-
+// open decrypts a value written by seal
+func open(key []byte, encryptedData string, additionalData []byte) (string, error) {
 	data, err := base64.StdEncoding.DecodeString(encryptedData)
 	if err != nil {
 		return "", err
 	}
 
-	block, err := aes.NewCipher([]byte(key))
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return "", err
 	}
@@ -75,7 +102,7 @@ func Decrypt(encryptedData, key string) (string, error) {
 	}
 
 	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, additionalData)
 	if err != nil {
 		return "", err
 	}
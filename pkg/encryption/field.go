@@ -0,0 +1,71 @@
+package encryption
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// FieldCipher encrypts individual column values with a Keyring and computes
+// blind indexes: keyed hashes of a value that allow exact-match lookups on
+// the encrypted column without decrypting it.
+type FieldCipher struct {
+	keys     *Keyring
+	indexKey []byte
+}
+
+// NewFieldCipher creates a field cipher. The blind index key must stay the
+// same for as long as the indexes are in use; when empty it is derived from
+// the keyring's legacy key.
+func NewFieldCipher(keys *Keyring, indexKey string) (*FieldCipher, error) {
+	c := &FieldCipher{keys: keys, indexKey: []byte(indexKey)}
+	switch {
+	case indexKey == "" && keys.legacyKey == "":
+		return nil, errors.New("blind index key is required without a legacy key")
+	case indexKey == "":
+		mac := hmac.New(sha256.New, []byte(keys.legacyKey))
+		mac.Write([]byte("blind-index"))
+		c.indexKey = mac.Sum(nil)
+	case len(indexKey) < 32:
+		return nil, errors.New("blind index key must be at least 32 bytes")
+	}
+	return c, nil
+}
+
+// Encrypt encrypts a column value
+func (c *FieldCipher) Encrypt(ctx context.Context, plaintext string) (string, error) {
+	return c.keys.Encrypt(ctx, plaintext)
+}
+
+// Decrypt decrypts a column value. Values that were never encrypted are
+// returned as they are.
+func (c *FieldCipher) Decrypt(ctx context.Context, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	return c.keys.Decrypt(ctx, value)
+}
+
+// Keys returns the keyring the cipher encrypts with
+func (c *FieldCipher) Keys() *Keyring {
+	return c.keys
+}
+
+// BlindIndex returns the hex encoded HMAC-SHA256 of a value. Callers
+// normalize the value first so equal values in different forms match.
+func (c *FieldCipher) BlindIndex(value string) string {
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, c.indexKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// IsEncrypted reports whether a column value was written by a FieldCipher
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
@@ -0,0 +1,66 @@
+package encryption
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testKey = "0123456789abcdef0123456789abcdef"
+
+func TestFieldCipher(t *testing.T) {
+	c, err := NewFieldCipher(newTestKeyring(t, &memoryKeyStore{}, testKEKs, "K1"), "")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	encrypted, err := c.Encrypt(ctx, "3273010704850001")
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(encrypted))
+	assert.NotContains(t, encrypted, "3273010704850001")
+
+	again, err := c.Encrypt(ctx, "3273010704850001")
+	require.NoError(t, err)
+	assert.NotEqual(t, encrypted, again, "each value gets its own nonce")
+
+	plaintext, err := c.Decrypt(ctx, encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "3273010704850001", plaintext)
+
+	plaintext, err = c.Decrypt(ctx, "written before encryption")
+	require.NoError(t, err)
+	assert.Equal(t, "written before encryption", plaintext)
+
+	other, err := NewFieldCipher(newTestKeyring(t, &memoryKeyStore{}, testKEKs, "K1"), "")
+	require.NoError(t, err)
+	_, err = other.Decrypt(ctx, encrypted)
+	assert.Error(t, err, "another data key cannot decrypt")
+}
+
+func TestBlindIndex(t *testing.T) {
+	keys := newTestKeyring(t, &memoryKeyStore{}, testKEKs, "K1")
+	c, err := NewFieldCipher(keys, "")
+	require.NoError(t, err)
+
+	index := c.BlindIndex("3273010704850001")
+	assert.Len(t, index, 64)
+	assert.Equal(t, index, c.BlindIndex("3273010704850001"), "equal values share an index")
+	assert.NotEqual(t, index, c.BlindIndex("3273010704850002"))
+	assert.Empty(t, c.BlindIndex(""))
+
+	rotated, err := NewFieldCipher(newTestKeyring(t, &memoryKeyStore{}, testKEKs, "K2"), "")
+	require.NoError(t, err)
+	assert.Equal(t, index, rotated.BlindIndex("3273010704850001"), "indexes do not depend on the data keys")
+
+	separate, err := NewFieldCipher(keys, "a separate blind index key of 32+ bytes")
+	require.NoError(t, err)
+	assert.NotEqual(t, index, separate.BlindIndex("3273010704850001"))
+
+	_, err = NewFieldCipher(keys, "short")
+	assert.Error(t, err)
+	noLegacy, err := NewKeyring("patients", keys.provider, &memoryKeyStore{}, "", 0)
+	require.NoError(t, err)
+	_, err = NewFieldCipher(noLegacy, "")
+	assert.Error(t, err, "nothing to derive the index key from")
+}
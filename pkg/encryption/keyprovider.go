@@ -0,0 +1,133 @@
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// KeyProvider holds key-encryption keys (KEKs) and wraps data keys with
+// them. The methods mirror the encrypt and decrypt calls of a KMS, so a
+// provider backed by AWS KMS, GCP KMS or Vault transit can be added without
+// the KEKs ever leaving it.
+type KeyProvider interface {
+	// ActiveKeyID is the KEK new data keys are wrapped with
+	ActiveKeyID() string
+	// WrapKey encrypts a data key with the KEK keyID
+	WrapKey(ctx context.Context, keyID string, dataKey []byte) ([]byte, error)
+	// UnwrapKey decrypts a data key wrapped with the KEK keyID
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// keyIDPattern limits KEK IDs to names usable in file and variable names
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// LocalKeyProvider keeps KEKs in memory and wraps data keys with AES-256-GCM
+type LocalKeyProvider struct {
+	keys   map[string][]byte
+	active string
+}
+
+// NewLocalKeyProvider creates a provider from KEKs by ID. Every KEK must be
+// 32 bytes and active must be one of them.
+func NewLocalKeyProvider(keys map[string][]byte, active string) (*LocalKeyProvider, error) {
+	for id, key := range keys {
+		if !keyIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("invalid key ID %q", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %s must be 32 bytes for AES-256", id)
+		}
+	}
+	if _, ok := keys[active]; !ok {
+		return nil, fmt.Errorf("active key %q not found", active)
+	}
+	return &LocalKeyProvider{keys: keys, active: active}, nil
+}
+
+// ReadKeyFiles reads KEKs from <dir>/<id>.key files for a local provider.
+// Surrounding whitespace in a file is ignored.
+func ReadKeyFiles(dir string) (map[string][]byte, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.key"))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string][]byte)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		keys[strings.TrimSuffix(filepath.Base(path), ".key")] = []byte(strings.TrimSpace(string(data)))
+	}
+	return keys, nil
+}
+
+// ReadEnvKeys reads KEKs for a local provider from environment variables
+// named prefix followed by the key ID, e.g. ENCRYPTION_KEK_2026A
+func ReadEnvKeys(prefix string) map[string][]byte {
+	keys := make(map[string][]byte)
+	for _, variable := range os.Environ() {
+		name, value, _ := strings.Cut(variable, "=")
+		if id, ok := strings.CutPrefix(name, prefix); ok && id != "" {
+			keys[id] = []byte(value)
+		}
+	}
+	return keys
+}
+
+// ActiveKeyID implements KeyProvider
+func (p *LocalKeyProvider) ActiveKeyID() string {
+	return p.active
+}
+
+// WrapKey implements KeyProvider
+func (p *LocalKeyProvider) WrapKey(ctx context.Context, keyID string, dataKey []byte) ([]byte, error) {
+	gcm, err := p.gcm(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	// The key ID is authenticated so a wrapped key cannot be passed off as
+	// wrapped by another KEK
+	return gcm.Seal(nonce, nonce, dataKey, []byte(keyID)), nil
+}
+
+// UnwrapKey implements KeyProvider
+func (p *LocalKeyProvider) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	gcm, err := p.gcm(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := gcm.NonceSize()
+	if len(wrapped) < nonceSize {
+		return nil, errors.New("wrapped key too short")
+	}
+	return gcm.Open(nil, wrapped[:nonceSize], wrapped[nonceSize:], []byte(keyID))
+}
+
+func (p *LocalKeyProvider) gcm(keyID string) (cipher.AEAD, error) {
+	key, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("key %q not found", keyID)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
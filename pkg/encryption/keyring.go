@@ -0,0 +1,291 @@
+package encryption
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Encrypted values start with a header naming the format. v1 values were
+// encrypted directly with the legacy key; v2 values name the version of the
+// data key they were encrypted with: enc:v2:<version>:<ciphertext>. The
+// header is authenticated with the ciphertext, so it cannot be swapped.
+const (
+	encryptedPrefix = "enc:"
+	legacyPrefix    = "enc:v1:"
+	versionedPrefix = "enc:v2:"
+)
+
+// defaultRefresh is how long a keyring trusts its active version when no
+// refresh interval is given
+const defaultRefresh = time.Minute
+
+// DataKey is one version of the data encryption key of a scope, stored
+// wrapped by a KEK
+type DataKey struct {
+	Scope      string
+	Version    int
+	KEKID      string
+	WrappedKey []byte
+}
+
+// KeyStore persists wrapped data keys
+type KeyStore interface {
+	// DataKeys returns every version of a scope's data key
+	DataKeys(ctx context.Context, scope string) ([]DataKey, error)
+	// CreateDataKey stores a new version and fails if it already exists
+	CreateDataKey(ctx context.Context, key *DataKey) error
+	// UpdateDataKey stores a data key rewrapped with another KEK
+	UpdateDataKey(ctx context.Context, key *DataKey) error
+}
+
+// Keyring encrypts values with envelope encryption: each scope, such as a
+// table, has its own data keys, stored wrapped by a KEK of the KeyProvider
+// and unwrapped once when loaded. New values use the latest data key
+// version; older versions are kept to decrypt values not re-encrypted yet.
+// The keys are reloaded every refresh interval so a version rotated by
+// another instance becomes active here too.
+type Keyring struct {
+	scope     string
+	provider  KeyProvider
+	store     KeyStore
+	legacyKey string
+	refresh   time.Duration
+
+	reloading sync.Mutex // One reload at a time when the keys expire
+	mu        sync.RWMutex
+	keys      map[int][]byte
+	active    int
+	loadedAt  time.Time
+}
+
+// NewKeyring creates the keyring of a scope. Its data keys are loaded on
+// first use and reloaded every refresh interval, a minute when not
+// positive. legacyKey decrypts v1 values and may be empty when there are
+// none.
+func NewKeyring(scope string, provider KeyProvider, store KeyStore, legacyKey string, refresh time.Duration) (*Keyring, error) {
+	if legacyKey != "" && len(legacyKey) != 32 {
+		return nil, errors.New("encryption key must be 32 bytes for AES-256")
+	}
+	if refresh <= 0 {
+		refresh = defaultRefresh
+	}
+	return &Keyring{scope: scope, provider: provider, store: store, legacyKey: legacyKey, refresh: refresh}, nil
+}
+
+// Encrypt encrypts a value with the active data key
+func (k *Keyring) Encrypt(ctx context.Context, plaintext string) (string, error) {
+	version, err := k.ActiveVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+	key, err := k.key(ctx, version)
+	if err != nil {
+		return "", err
+	}
+
+	header := VersionPrefix(version)
+	ciphertext, err := seal(key, []byte(plaintext), []byte(header))
+	if err != nil {
+		return "", err
+	}
+	return header + ciphertext, nil
+}
+
+// Decrypt decrypts a value encrypted by Encrypt or with the legacy key
+func (k *Keyring) Decrypt(ctx context.Context, value string) (string, error) {
+	if ciphertext, ok := strings.CutPrefix(value, legacyPrefix); ok {
+		if k.legacyKey == "" {
+			return "", errors.New("no legacy key to decrypt v1 value")
+		}
+		return Decrypt(ciphertext, k.legacyKey)
+	}
+
+	version, ok := KeyVersion(value)
+	if !ok {
+		return "", errors.New("unknown ciphertext format")
+	}
+	key, err := k.key(ctx, version)
+	if err != nil {
+		return "", err
+	}
+	header := VersionPrefix(version)
+	return open(key, strings.TrimPrefix(value, header), []byte(header))
+}
+
+// ActiveVersion returns the data key version new values are encrypted with,
+// reloading the keys once they are older than the refresh interval
+func (k *Keyring) ActiveVersion(ctx context.Context) (int, error) {
+	if active, ok := k.fresh(); ok {
+		return active, nil
+	}
+
+	k.reloading.Lock()
+	defer k.reloading.Unlock()
+	// Another caller may have reloaded while this one waited
+	if active, ok := k.fresh(); ok {
+		return active, nil
+	}
+	if err := k.Reload(ctx); err != nil {
+		return 0, err
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active, nil
+}
+
+// fresh returns the active version while it is within the refresh interval
+func (k *Keyring) fresh() (int, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active, k.active > 0 && time.Since(k.loadedAt) < k.refresh
+}
+
+// Reload loads the data keys from the store, picking up versions created by
+// other instances. The first version is created when there is none.
+func (k *Keyring) Reload(ctx context.Context) error {
+	stored, err := k.store.DataKeys(ctx, k.scope)
+	if err != nil {
+		return err
+	}
+	if len(stored) == 0 {
+		// Another instance may create it first, so the result is reread
+		_ = k.create(ctx, 1)
+		if stored, err = k.store.DataKeys(ctx, k.scope); err != nil {
+			return err
+		}
+		if len(stored) == 0 {
+			return fmt.Errorf("failed to create the first %s data key", k.scope)
+		}
+	}
+
+	keys := make(map[int][]byte, len(stored))
+	active := 0
+	for _, dataKey := range stored {
+		key, err := k.provider.UnwrapKey(ctx, dataKey.KEKID, dataKey.WrappedKey)
+		if err != nil {
+			return fmt.Errorf("failed to unwrap %s data key v%d: %w", k.scope, dataKey.Version, err)
+		}
+		keys[dataKey.Version] = key
+		active = max(active, dataKey.Version)
+	}
+
+	k.mu.Lock()
+	k.keys, k.active, k.loadedAt = keys, active, time.Now()
+	k.mu.Unlock()
+	return nil
+}
+
+// Rotate creates a new data key version and makes it active. Values under
+// older versions stay readable until they are re-encrypted.
+func (k *Keyring) Rotate(ctx context.Context) (int, error) {
+	stored, err := k.store.DataKeys(ctx, k.scope)
+	if err != nil {
+		return 0, err
+	}
+	version := 1
+	for _, dataKey := range stored {
+		version = max(version, dataKey.Version+1)
+	}
+
+	if err := k.create(ctx, version); err != nil {
+		return 0, err
+	}
+	return version, k.Reload(ctx)
+}
+
+// Rewrap rewraps the data keys wrapped by a KEK other than the active one
+// and returns how many it rewrapped. Once done the old KEK is no longer
+// needed.
+func (k *Keyring) Rewrap(ctx context.Context) (int, error) {
+	stored, err := k.store.DataKeys(ctx, k.scope)
+	if err != nil {
+		return 0, err
+	}
+
+	kekID := k.provider.ActiveKeyID()
+	rewrapped := 0
+	for i := range stored {
+		dataKey := &stored[i]
+		if dataKey.KEKID == kekID {
+			continue
+		}
+		key, err := k.provider.UnwrapKey(ctx, dataKey.KEKID, dataKey.WrappedKey)
+		if err != nil {
+			return rewrapped, fmt.Errorf("failed to unwrap %s data key v%d: %w", k.scope, dataKey.Version, err)
+		}
+		if dataKey.WrappedKey, err = k.provider.WrapKey(ctx, kekID, key); err != nil {
+			return rewrapped, err
+		}
+		dataKey.KEKID = kekID
+		if err := k.store.UpdateDataKey(ctx, dataKey); err != nil {
+			return rewrapped, err
+		}
+		rewrapped++
+	}
+	return rewrapped, nil
+}
+
+func (k *Keyring) create(ctx context.Context, version int) error {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+
+	kekID := k.provider.ActiveKeyID()
+	wrapped, err := k.provider.WrapKey(ctx, kekID, key)
+	if err != nil {
+		return err
+	}
+	return k.store.CreateDataKey(ctx, &DataKey{Scope: k.scope, Version: version, KEKID: kekID, WrappedKey: wrapped})
+}
+
+// key returns a data key version, reloading once for a version created
+// after the keyring was loaded
+func (k *Keyring) key(ctx context.Context, version int) ([]byte, error) {
+	k.mu.RLock()
+	key, ok := k.keys[version]
+	k.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	if err := k.Reload(ctx); err != nil {
+		return nil, err
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if key, ok = k.keys[version]; !ok {
+		return nil, fmt.Errorf("%s data key v%d not found", k.scope, version)
+	}
+	return key, nil
+}
+
+// VersionPrefix returns the header of values encrypted with a data key
+// version
+func VersionPrefix(version int) string {
+	return versionedPrefix + strconv.Itoa(version) + ":"
+}
+
+// KeyVersion returns the data key version in the header of an encrypted
+// value. v1 values have none.
+func KeyVersion(value string) (int, bool) {
+	rest, ok := strings.CutPrefix(value, versionedPrefix)
+	if !ok {
+		return 0, false
+	}
+	digits, _, ok := strings.Cut(rest, ":")
+	if !ok {
+		return 0, false
+	}
+	version, err := strconv.Atoi(digits)
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
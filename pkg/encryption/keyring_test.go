@@ -0,0 +1,212 @@
+package encryption
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryKeyStore struct {
+	mu   sync.Mutex
+	keys []DataKey
+}
+
+func (s *memoryKeyStore) DataKeys(ctx context.Context, scope string) ([]DataKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []DataKey
+	for _, key := range s.keys {
+		if key.Scope == scope {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (s *memoryKeyStore) CreateDataKey(ctx context.Context, key *DataKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.keys {
+		if existing.Scope == key.Scope && existing.Version == key.Version {
+			return fmt.Errorf("%s v%d exists", key.Scope, key.Version)
+		}
+	}
+	s.keys = append(s.keys, *key)
+	return nil
+}
+
+func (s *memoryKeyStore) UpdateDataKey(ctx context.Context, key *DataKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, existing := range s.keys {
+		if existing.Scope == key.Scope && existing.Version == key.Version {
+			s.keys[i] = *key
+		}
+	}
+	return nil
+}
+
+func newTestKeyring(t *testing.T, store KeyStore, keks map[string][]byte, active string) *Keyring {
+	provider, err := NewLocalKeyProvider(keks, active)
+	require.NoError(t, err)
+	keys, err := NewKeyring("patients", provider, store, testKey, 0)
+	require.NoError(t, err)
+	return keys
+}
+
+var testKEKs = map[string][]byte{
+	"K1": []byte("kek-one-kek-one-kek-one-kek-one!"),
+	"K2": []byte("kek-two-kek-two-kek-two-kek-two!"),
+}
+
+func TestKeyringRotation(t *testing.T) {
+	ctx := context.Background()
+	store := &memoryKeyStore{}
+	keys := newTestKeyring(t, store, testKEKs, "K1")
+
+	v1, err := keys.Encrypt(ctx, "3273010704850001")
+	require.NoError(t, err)
+	assert.Equal(t, "enc:v2:1:", v1[:9], "the first data key is created on first use")
+	version, ok := KeyVersion(v1)
+	assert.True(t, ok)
+	assert.Equal(t, 1, version)
+
+	// Another instance rotates; this one picks up the new version on reload
+	other := newTestKeyring(t, store, testKEKs, "K1")
+	rotated, err := other.Rotate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, rotated)
+
+	v2, err := other.Encrypt(ctx, "3273010704850001")
+	require.NoError(t, err)
+	assert.Equal(t, "enc:v2:2:", v2[:9])
+
+	plaintext, err := keys.Decrypt(ctx, v2)
+	require.NoError(t, err, "unknown versions are loaded on demand")
+	assert.Equal(t, "3273010704850001", plaintext)
+	plaintext, err = other.Decrypt(ctx, v1)
+	require.NoError(t, err, "old versions stay readable")
+	assert.Equal(t, "3273010704850001", plaintext)
+
+	active, err := keys.ActiveVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, active)
+}
+
+func TestKeyringRefresh(t *testing.T) {
+	ctx := context.Background()
+	store := &memoryKeyStore{}
+	provider, err := NewLocalKeyProvider(testKEKs, "K1")
+	require.NoError(t, err)
+	keys, err := NewKeyring("patients", provider, store, testKey, time.Hour)
+	require.NoError(t, err)
+
+	_, err = keys.Encrypt(ctx, "3273010704850001")
+	require.NoError(t, err)
+	_, err = newTestKeyring(t, store, testKEKs, "K1").Rotate(ctx)
+	require.NoError(t, err)
+
+	encrypted, err := keys.Encrypt(ctx, "3273010704850001")
+	require.NoError(t, err)
+	assert.Equal(t, "enc:v2:1:", encrypted[:9], "the active version is kept within the refresh interval")
+
+	keys.loadedAt = time.Now().Add(-time.Hour)
+	encrypted, err = keys.Encrypt(ctx, "3273010704850001")
+	require.NoError(t, err)
+	assert.Equal(t, "enc:v2:2:", encrypted[:9], "a version rotated elsewhere is used once the keys expire")
+}
+
+func TestKeyringAuthenticatesHeader(t *testing.T) {
+	ctx := context.Background()
+	store := &memoryKeyStore{}
+	keys := newTestKeyring(t, store, testKEKs, "K1")
+	encrypted, err := keys.Encrypt(ctx, "3273010704850001")
+	require.NoError(t, err)
+
+	// Even under a version holding the same key, a swapped header is rejected
+	copied := store.keys[0]
+	copied.Version = 2
+	require.NoError(t, store.CreateDataKey(ctx, &copied))
+	_, err = keys.Decrypt(ctx, VersionPrefix(2)+strings.TrimPrefix(encrypted, VersionPrefix(1)))
+	assert.Error(t, err)
+
+	plaintext, err := keys.Decrypt(ctx, encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "3273010704850001", plaintext)
+}
+
+func TestKeyringLegacyValues(t *testing.T) {
+	ctx := context.Background()
+	keys := newTestKeyring(t, &memoryKeyStore{}, testKEKs, "K1")
+
+	legacy, err := Encrypt("A1234567", testKey)
+	require.NoError(t, err)
+	plaintext, err := keys.Decrypt(ctx, legacyPrefix+legacy)
+	require.NoError(t, err)
+	assert.Equal(t, "A1234567", plaintext)
+
+	_, ok := KeyVersion(legacyPrefix + legacy)
+	assert.False(t, ok, "v1 values have no key version")
+	_, err = keys.Decrypt(ctx, "enc:v9:whatever")
+	assert.Error(t, err)
+}
+
+func TestKeyringRewrap(t *testing.T) {
+	ctx := context.Background()
+	store := &memoryKeyStore{}
+	before := newTestKeyring(t, store, testKEKs, "K1")
+	encrypted, err := before.Encrypt(ctx, "0812-3456-7890")
+	require.NoError(t, err)
+
+	after := newTestKeyring(t, store, testKEKs, "K2")
+	rewrapped, err := after.Rewrap(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, rewrapped)
+	assert.Equal(t, "K2", store.keys[0].KEKID)
+
+	// K1 can be retired: only K2 is needed to read the data now
+	retired := newTestKeyring(t, store, map[string][]byte{"K2": testKEKs["K2"]}, "K2")
+	plaintext, err := retired.Decrypt(ctx, encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "0812-3456-7890", plaintext)
+
+	rewrapped, err = after.Rewrap(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, rewrapped)
+}
+
+func TestKeyProviders(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "K1.key"), append(testKEKs["K1"], '\n'), 0600))
+	fileKeys, err := ReadKeyFiles(dir)
+	require.NoError(t, err)
+	fromFile, err := NewLocalKeyProvider(fileKeys, "K1")
+	require.NoError(t, err)
+
+	t.Setenv("TEST_KEK_K1", string(testKEKs["K1"]))
+	fromEnv, err := NewLocalKeyProvider(ReadEnvKeys("TEST_KEK_"), "K1")
+	require.NoError(t, err)
+
+	wrapped, err := fromFile.WrapKey(ctx, "K1", []byte("data key"))
+	require.NoError(t, err)
+	unwrapped, err := fromEnv.UnwrapKey(ctx, "K1", wrapped)
+	require.NoError(t, err)
+	assert.Equal(t, "data key", string(unwrapped))
+
+	_, err = fromEnv.UnwrapKey(ctx, "K2", wrapped)
+	assert.Error(t, err)
+	_, err = NewLocalKeyProvider(ReadEnvKeys("TEST_KEK_"), "K2")
+	assert.Error(t, err, "the active key must exist")
+	_, err = NewLocalKeyProvider(map[string][]byte{"K1": []byte("short")}, "K1")
+	assert.Error(t, err)
+}
@@ -8,21 +8,38 @@ import (
 	"github.com/google/uuid"
 )
 
+// Token types carried in the typ claim. A token is only accepted where its type is expected,
+// so e.g. an access token can never be presented in place of another kind of token.
+const (
+	TokenTypeAccess         = "access"
+	TokenTypePasswordChange = "password_change"
+	TokenTypeMFA            = "mfa" // Proves the first factor of a login still awaiting its second
+)
+
 // Claims represents JWT claims
 type Claims struct {
-	UserID uuid.UUID `json:"user_id"`
-	Email  string    `json:"email"`
-	Roles  []string  `json:"roles"`
+	UserID    uuid.UUID `json:"user_id"`
+	Email     string    `json:"email"`
+	Roles     []string  `json:"roles"`
+	TokenType string    `json:"typ"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken generates a new JWT token
-func GenerateToken(userID uuid.UUID, email string, roles []string, secret string, expiration time.Duration) (string, error) {
+// SessionID returns the session ID carried in the jti claim
+func (c *Claims) SessionID() (uuid.UUID, error) {
+	return uuid.Parse(c.ID)
+}
+
+// GenerateToken generates a new JWT token of the given type bound to a server-side session,
+// signed with the active key of the set
+func (ks *KeySet) GenerateToken(userID uuid.UUID, email string, roles []string, sessionID uuid.UUID, tokenType string, expiration time.Duration) (string, error) {
 	claims := Claims{
-		UserID: userID,
-		Email:  email,
-		Roles:  roles,
+		UserID:    userID,
+		Email:     email,
+		Roles:     roles,
+		TokenType: tokenType,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID.String(),
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
@@ -30,38 +47,26 @@ func GenerateToken(userID uuid.UUID, email string, roles []string, secret string
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	return ks.sign(claims)
 }
 
-// ValidateToken validates and parses a JWT token
-func ValidateToken(tokenString, secret string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		// Validate signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(secret), nil
-	})
+// ValidateToken validates and parses a JWT token against the keys in the set,
+// rejecting tokens of any other type
+func (ks *KeySet) ValidateToken(tokenString, expectedType string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, ks.keyFunc)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid token")
 	}
 
-	return nil, fmt.Errorf("invalid token")
-}
-
-// RefreshToken generates a new token from an existing one
-func RefreshToken(oldToken, secret string, expiration time.Duration) (string, error) {
-	claims, err := ValidateToken(oldToken, secret)
-	if err != nil {
-		return "", err
+	if claims.TokenType != expectedType {
+		return nil, fmt.Errorf("unexpected token type: %q", claims.TokenType)
 	}
 
-	// Generate new token with extended expiration
-	return GenerateToken(claims.UserID, claims.Email, claims.Roles, secret, expiration)
+	return claims, nil
 }
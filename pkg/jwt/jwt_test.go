@@ -0,0 +1,121 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func newRSAKey(t *testing.T, id string) *Key {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	return &Key{ID: id, Method: jwt.SigningMethodRS256, signingKey: priv, verifyKey: &priv.PublicKey}
+}
+
+func newEdDSAKey(t *testing.T, id string) *Key {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate Ed25519 key: %v", err)
+	}
+	return &Key{ID: id, Method: jwt.SigningMethodEdDSA, signingKey: priv, verifyKey: pub}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey := newRSAKey(t, "2024-01")
+	newKey := newEdDSAKey(t, "2025-01")
+
+	oldSet, err := NewKeySet(oldKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	token, err := oldSet.GenerateToken(uuid.New(), "doctor@hospital-emr.com", []string{"doctor"}, uuid.New(), TokenTypeAccess, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	t.Run("Retiring key still validates", func(t *testing.T) {
+		rotated, _ := NewKeySet(newKey, oldKey)
+		if _, err := rotated.ValidateToken(token, TokenTypeAccess); err != nil {
+			t.Errorf("expected token signed by retiring key to validate, got %v", err)
+		}
+	})
+
+	t.Run("Removed key is rejected", func(t *testing.T) {
+		rotated, _ := NewKeySet(newKey)
+		if _, err := rotated.ValidateToken(token, TokenTypeAccess); err == nil {
+			t.Error("expected token signed by removed key to be rejected")
+		}
+	})
+}
+
+func TestValidateTokenType(t *testing.T) {
+	keys, _ := NewKeySet(NewHMACKey("default", []byte("secure_secret")))
+	token, _ := keys.GenerateToken(uuid.New(), "admin@hospital-emr.com", nil, uuid.New(), "other", time.Hour)
+
+	if _, err := keys.ValidateToken(token, TokenTypeAccess); err == nil {
+		t.Error("expected token of another type to be rejected")
+	}
+}
+
+func TestAlgorithmMismatchRejected(t *testing.T) {
+	rsaKey := newRSAKey(t, "rsa")
+	keys, _ := NewKeySet(rsaKey)
+
+	// HS256 token signed with the RSA key ID must not be accepted
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{TokenType: TokenTypeAccess})
+	forged.Header["kid"] = "rsa"
+	tokenString, _ := forged.SignedString([]byte("attacker"))
+
+	if _, err := keys.ValidateToken(tokenString, TokenTypeAccess); err == nil {
+		t.Error("expected algorithm mismatch to be rejected")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	keys, _ := NewKeySet(newEdDSAKey(t, "ed"), newRSAKey(t, "rsa"), NewHMACKey("hmac", []byte("secret")))
+
+	set := keys.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("expected 2 published keys, got %d", len(set.Keys))
+	}
+	for _, key := range set.Keys {
+		if key.Kid == "hmac" {
+			t.Error("symmetric key must not be published")
+		}
+	}
+}
+
+func TestJWKPublicKeyRoundTrip(t *testing.T) {
+	rsaKey, edKey := newRSAKey(t, "rsa"), newEdDSAKey(t, "ed")
+	keys, _ := NewKeySet(edKey, rsaKey)
+
+	for _, jwk := range keys.JWKS().Keys {
+		pub, err := jwk.PublicKey()
+		if err != nil {
+			t.Fatalf("failed to decode %s: %v", jwk.Kid, err)
+		}
+		switch want := keys.keys[jwk.Kid].verifyKey.(type) {
+		case *rsa.PublicKey:
+			if !want.Equal(pub) {
+				t.Errorf("RSA key %s did not round-trip", jwk.Kid)
+			}
+		case ed25519.PublicKey:
+			if !want.Equal(pub) {
+				t.Errorf("Ed25519 key %s did not round-trip", jwk.Kid)
+			}
+		}
+	}
+
+	if _, err := (JWK{Kty: "oct", Kid: "hmac"}).PublicKey(); err == nil {
+		t.Error("expected symmetric JWK to be rejected")
+	}
+}
@@ -0,0 +1,253 @@
+package ldap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BER identifier octets used by LDAPv3 (RFC 4511)
+const (
+	TagBoolean     byte = 0x01
+	TagInteger     byte = 0x02
+	TagOctetString byte = 0x04
+	TagEnumerated  byte = 0x0a
+	TagSequence    byte = 0x30
+	TagSet         byte = 0x31
+
+	classApplication byte = 0x40
+	classContext     byte = 0x80
+	constructed      byte = 0x20
+)
+
+// maxPacketSize bounds the size of a decoded message
+const maxPacketSize = 16 << 20
+
+// Packet is a BER element. Constructed elements carry children; primitive
+// elements carry raw data.
+type Packet struct {
+	Tag      byte
+	Data     []byte
+	Children []*Packet
+}
+
+// Application returns the identifier of an application-class element
+func Application(number byte, isConstructed bool) byte {
+	if isConstructed {
+		return classApplication | constructed | number
+	}
+	return classApplication | number
+}
+
+// Context returns the identifier of a context-specific element
+func Context(number byte, isConstructed bool) byte {
+	if isConstructed {
+		return classContext | constructed | number
+	}
+	return classContext | number
+}
+
+// IsConstructed reports whether the packet holds children
+func (p *Packet) IsConstructed() bool {
+	return p.Tag&constructed != 0
+}
+
+// NewSequence creates a constructed packet with the given children
+func NewSequence(tag byte, children ...*Packet) *Packet {
+	return &Packet{Tag: tag, Children: children}
+}
+
+// NewString creates a primitive packet holding a string
+func NewString(tag byte, value string) *Packet {
+	return &Packet{Tag: tag, Data: []byte(value)}
+}
+
+// NewInteger creates a primitive packet holding an integer
+func NewInteger(tag byte, value int64) *Packet {
+	var data []byte
+	for {
+		data = append([]byte{byte(value)}, data...)
+		value >>= 8
+		if (value == 0 && data[0]&0x80 == 0) || (value == -1 && data[0]&0x80 != 0) {
+			break
+		}
+	}
+	return &Packet{Tag: tag, Data: data}
+}
+
+// NewBoolean creates a primitive packet holding a boolean
+func NewBoolean(value bool) *Packet {
+	if value {
+		return &Packet{Tag: TagBoolean, Data: []byte{0xff}}
+	}
+	return &Packet{Tag: TagBoolean, Data: []byte{0x00}}
+}
+
+// Int returns the integer value of a primitive packet
+func (p *Packet) Int() int64 {
+	if len(p.Data) == 0 {
+		return 0
+	}
+	var value int64
+	if p.Data[0]&0x80 != 0 {
+		value = -1
+	}
+	for _, b := range p.Data {
+		value = value<<8 | int64(b)
+	}
+	return value
+}
+
+// String returns the data of a primitive packet as a string
+func (p *Packet) String() string {
+	return string(p.Data)
+}
+
+// Child returns the i-th child, or nil when there is none
+func (p *Packet) Child(i int) *Packet {
+	if i < 0 || i >= len(p.Children) {
+		return nil
+	}
+	return p.Children[i]
+}
+
+// Encode returns the BER encoding of the packet
+func (p *Packet) Encode() []byte {
+	content := p.Data
+	if p.IsConstructed() {
+		content = nil
+		for _, child := range p.Children {
+			content = append(content, child.Encode()...)
+		}
+	}
+
+	out := []byte{p.Tag}
+	out = append(out, encodeLength(len(content))...)
+	return append(out, content...)
+}
+
+// encodeLength encodes a definite length in short or long form
+func encodeLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var digits []byte
+	for n > 0 {
+		digits = append([]byte{byte(n)}, digits...)
+		n >>= 8
+	}
+	return append([]byte{0x80 | byte(len(digits))}, digits...)
+}
+
+// ReadPacket reads one BER element from r
+func ReadPacket(r *bufio.Reader) (*Packet, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if tag&0x1f == 0x1f {
+		return nil, errors.New("ldap: multi-byte BER tags are not supported")
+	}
+
+	length, err := readLength(r)
+	if err != nil {
+		return nil, err
+	}
+
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+
+	return decodeContent(tag, content)
+}
+
+// DecodePacket decodes a single BER element occupying all of data
+func DecodePacket(data []byte) (*Packet, error) {
+	packet, rest, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("ldap: trailing data after BER element")
+	}
+	return packet, nil
+}
+
+func readLength(r *bufio.Reader) (int, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if first&0x80 == 0 {
+		return int(first), nil
+	}
+
+	octets := int(first & 0x7f)
+	if octets == 0 || octets > 4 {
+		return 0, errors.New("ldap: unsupported BER length")
+	}
+	length := 0
+	for i := 0; i < octets; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		length = length<<8 | int(b)
+	}
+	if length > maxPacketSize {
+		return 0, fmt.Errorf("ldap: BER element of %d bytes exceeds limit", length)
+	}
+	return length, nil
+}
+
+func decode(data []byte) (*Packet, []byte, error) {
+	if len(data) < 2 {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	tag := data[0]
+	if tag&0x1f == 0x1f {
+		return nil, nil, errors.New("ldap: multi-byte BER tags are not supported")
+	}
+
+	length, offset := int(data[1]), 2
+	if data[1]&0x80 != 0 {
+		octets := int(data[1] & 0x7f)
+		if octets == 0 || octets > 4 || len(data) < 2+octets {
+			return nil, nil, errors.New("ldap: unsupported BER length")
+		}
+		length = 0
+		for _, b := range data[2 : 2+octets] {
+			length = length<<8 | int(b)
+		}
+		offset += octets
+	}
+	if length < 0 || len(data)-offset < length {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+
+	packet, err := decodeContent(tag, data[offset:offset+length])
+	if err != nil {
+		return nil, nil, err
+	}
+	return packet, data[offset+length:], nil
+}
+
+func decodeContent(tag byte, content []byte) (*Packet, error) {
+	packet := &Packet{Tag: tag}
+	if !packet.IsConstructed() {
+		packet.Data = content
+		return packet, nil
+	}
+
+	for len(content) > 0 {
+		child, rest, err := decode(content)
+		if err != nil {
+			return nil, err
+		}
+		packet.Children = append(packet.Children, child)
+		content = rest
+	}
+	return packet, nil
+}
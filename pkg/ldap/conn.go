@@ -0,0 +1,300 @@
+// Package ldap implements the subset of LDAPv3 needed to authenticate users
+// against a directory: simple bind and search.
+package ldap
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// LDAP result codes (RFC 4511 appendix A)
+const (
+	ResultSuccess            = 0
+	ResultSizeLimitExceeded  = 4
+	ResultNoSuchObject       = 32
+	ResultInvalidCredentials = 49
+	ResultUnwillingToPerform = 53
+)
+
+// Protocol operations (RFC 4511 section 4.2 onwards)
+const (
+	opBindRequest      byte = 0
+	opBindResponse     byte = 1
+	opUnbindRequest    byte = 2
+	opSearchRequest    byte = 3
+	opSearchEntry      byte = 4
+	opSearchDone       byte = 5
+	opSearchReference  byte = 19
+	authSimple         byte = 0
+	protocolVersion         = 3
+	defaultDialTimeout      = 10 * time.Second
+)
+
+// Search scopes
+const (
+	ScopeBaseObject   = 0
+	ScopeSingleLevel  = 1
+	ScopeWholeSubtree = 2
+)
+
+// ErrEmptyPassword is returned when binding with an empty password, which
+// servers treat as an unauthenticated bind that always succeeds
+var ErrEmptyPassword = errors.New("ldap: empty password")
+
+// Error is an LDAP result other than success
+type Error struct {
+	ResultCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("ldap: result code %d", e.ResultCode)
+	}
+	return fmt.Sprintf("ldap: result code %d: %s", e.ResultCode, e.Message)
+}
+
+// IsResultCode reports whether err is an LDAP error with the given code
+func IsResultCode(err error, code int) bool {
+	var ldapErr *Error
+	return errors.As(err, &ldapErr) && ldapErr.ResultCode == code
+}
+
+// Entry is a search result
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// Get returns the first value of an attribute, or "" when it is absent
+func (e *Entry) Get(name string) string {
+	values := e.Values(name)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// Values returns every value of an attribute
+func (e *Entry) Values(name string) []string {
+	return attributeValues(e.Attributes, name)
+}
+
+// SearchRequest describes a search operation
+type SearchRequest struct {
+	BaseDN     string
+	Scope      int
+	Filter     string
+	Attributes []string
+	SizeLimit  int
+	TimeLimit  int // Seconds
+}
+
+// Conn is a connection to an LDAP server. Operations are serialised.
+type Conn struct {
+	mu      sync.Mutex
+	conn    net.Conn
+	reader  *bufio.Reader
+	nextID  int64
+	timeout time.Duration
+}
+
+// Dial connects to an ldap:// or ldaps:// URL. tlsConfig is used for ldaps
+// and may be nil.
+func Dial(rawURL string, timeout time.Duration, tlsConfig *tls.Config) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: invalid URL: %w", err)
+	}
+	if timeout <= 0 {
+		timeout = defaultDialTimeout
+	}
+
+	host := u.Host
+	dialer := &net.Dialer{Timeout: timeout}
+
+	var conn net.Conn
+	switch u.Scheme {
+	case "ldap":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "389")
+		}
+		conn, err = dialer.Dial("tcp", host)
+	case "ldaps":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "636")
+		}
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig = tlsConfig.Clone()
+			tlsConfig.ServerName = u.Hostname()
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, tlsConfig)
+	default:
+		return nil, fmt.Errorf("ldap: unsupported scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conn{conn: conn, reader: bufio.NewReader(conn), timeout: timeout}, nil
+}
+
+// Bind performs a simple bind
+func (c *Conn) Bind(dn, password string) error {
+	if password == "" {
+		return ErrEmptyPassword
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	request := NewSequence(Application(opBindRequest, true),
+		NewInteger(TagInteger, protocolVersion),
+		NewString(TagOctetString, dn),
+		NewString(Context(authSimple, false), password))
+
+	id, err := c.send(request)
+	if err != nil {
+		return err
+	}
+
+	response, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	if response.Tag != Application(opBindResponse, true) {
+		return fmt.Errorf("ldap: unexpected response to bind")
+	}
+	return resultError(response)
+}
+
+// Search runs a search and collects every entry returned
+func (c *Conn) Search(req *SearchRequest) ([]*Entry, error) {
+	filter, err := CompileFilter(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := NewSequence(TagSequence)
+	for _, attr := range req.Attributes {
+		attributes.Children = append(attributes.Children, NewString(TagOctetString, attr))
+	}
+
+	request := NewSequence(Application(opSearchRequest, true),
+		NewString(TagOctetString, req.BaseDN),
+		NewInteger(TagEnumerated, int64(req.Scope)),
+		NewInteger(TagEnumerated, 0), // neverDerefAliases
+		NewInteger(TagInteger, int64(req.SizeLimit)),
+		NewInteger(TagInteger, int64(req.TimeLimit)),
+		NewBoolean(false),
+		filter,
+		attributes)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id, err := c.send(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*Entry
+	for {
+		response, err := c.receive(id)
+		if err != nil {
+			return nil, err
+		}
+
+		switch response.Tag {
+		case Application(opSearchEntry, true):
+			entries = append(entries, parseEntry(response))
+		case Application(opSearchReference, true):
+			// Referrals are not followed
+		case Application(opSearchDone, true):
+			return entries, resultError(response)
+		default:
+			return nil, fmt.Errorf("ldap: unexpected response to search")
+		}
+	}
+}
+
+// Close sends an unbind request and closes the connection
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.send(&Packet{Tag: Application(opUnbindRequest, false)})
+	return c.conn.Close()
+}
+
+// send writes a request wrapped in an LDAPMessage and returns its message ID
+func (c *Conn) send(op *Packet) (int64, error) {
+	c.nextID++
+	message := NewSequence(TagSequence, NewInteger(TagInteger, c.nextID), op)
+
+	c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	if _, err := c.conn.Write(message.Encode()); err != nil {
+		return 0, err
+	}
+	return c.nextID, nil
+}
+
+// receive reads the next response to the given message ID
+func (c *Conn) receive(id int64) (*Packet, error) {
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(c.timeout))
+		message, err := ReadPacket(c.reader)
+		if err != nil {
+			return nil, err
+		}
+		if message.Tag != TagSequence || len(message.Children) < 2 {
+			return nil, fmt.Errorf("ldap: malformed message")
+		}
+		// Unsolicited notifications use message ID 0
+		if message.Children[0].Int() != id {
+			continue
+		}
+		return message.Children[1], nil
+	}
+}
+
+// resultError converts an LDAPResult into an error
+func resultError(result *Packet) error {
+	if len(result.Children) < 3 {
+		return fmt.Errorf("ldap: malformed result")
+	}
+	code := int(result.Children[0].Int())
+	if code == ResultSuccess {
+		return nil
+	}
+	return &Error{ResultCode: code, Message: result.Children[2].String()}
+}
+
+// parseEntry converts a SearchResultEntry into an Entry
+func parseEntry(packet *Packet) *Entry {
+	entry := &Entry{Attributes: make(map[string][]string)}
+	if name := packet.Child(0); name != nil {
+		entry.DN = name.String()
+	}
+	if attributes := packet.Child(1); attributes != nil {
+		for _, attr := range attributes.Children {
+			name, values := attr.Child(0), attr.Child(1)
+			if name == nil || values == nil {
+				continue
+			}
+			for _, value := range values.Children {
+				entry.Attributes[name.String()] = append(entry.Attributes[name.String()], value.String())
+			}
+		}
+	}
+	return entry
+}
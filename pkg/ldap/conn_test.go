@@ -0,0 +1,132 @@
+package ldap_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hospital-emr/backend/pkg/ldap"
+	"github.com/hospital-emr/backend/pkg/ldap/ldaptest"
+)
+
+func newServer(t *testing.T) *ldaptest.Server {
+	t.Helper()
+	server, err := ldaptest.NewServer()
+	if err != nil {
+		t.Fatalf("failed to start LDAP server: %v", err)
+	}
+	t.Cleanup(server.Close)
+
+	server.AddEntry("cn=reader,dc=hospital,dc=local", "reader-secret", map[string][]string{
+		"objectClass": {"organizationalRole"},
+	})
+	server.AddEntry("uid=siti,ou=people,dc=hospital,dc=local", "siti-secret", map[string][]string{
+		"objectClass": {"inetOrgPerson"},
+		"uid":         {"siti"},
+		"mail":        {"siti@hospital.local"},
+		"memberOf":    {"cn=doctors,ou=groups,dc=hospital,dc=local", "cn=staff,ou=groups,dc=hospital,dc=local"},
+	})
+	server.AddEntry("uid=budi,ou=people,dc=hospital,dc=local", "budi-secret", map[string][]string{
+		"objectClass": {"inetOrgPerson"},
+		"uid":         {"budi"},
+	})
+	return server
+}
+
+func TestBindAndSearch(t *testing.T) {
+	server := newServer(t)
+
+	conn, err := ldap.Dial(server.URL(), time.Second, nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.Bind("cn=reader,dc=hospital,dc=local", "reader-secret"); err != nil {
+		t.Fatalf("service bind failed: %v", err)
+	}
+
+	entries, err := conn.Search(&ldap.SearchRequest{
+		BaseDN:     "ou=people,dc=hospital,dc=local",
+		Scope:      ldap.ScopeWholeSubtree,
+		Filter:     "(&(objectClass=inetOrgPerson)(uid=" + ldap.EscapeFilter("siti") + "))",
+		Attributes: []string{"mail", "memberOf"},
+	})
+	if err != nil {
+		t.Fatalf("search failed: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	if entries[0].DN != "uid=siti,ou=people,dc=hospital,dc=local" {
+		t.Errorf("unexpected DN %q", entries[0].DN)
+	}
+	if entries[0].Get("mail") != "siti@hospital.local" || len(entries[0].Values("memberof")) != 2 {
+		t.Errorf("unexpected attributes %v", entries[0].Attributes)
+	}
+	if entries[0].Get("uid") != "" {
+		t.Error("attributes that were not requested must not be returned")
+	}
+
+	if err := conn.Bind(entries[0].DN, "wrong"); !ldap.IsResultCode(err, ldap.ResultInvalidCredentials) {
+		t.Errorf("expected invalid credentials, got %v", err)
+	}
+	if err := conn.Bind(entries[0].DN, ""); err != ldap.ErrEmptyPassword {
+		t.Errorf("expected empty password to be rejected, got %v", err)
+	}
+}
+
+func TestEscapeFilterPreventsInjection(t *testing.T) {
+	server := newServer(t)
+
+	conn, err := ldap.Dial(server.URL(), time.Second, nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	entries, err := conn.Search(&ldap.SearchRequest{
+		BaseDN: "dc=hospital,dc=local",
+		Scope:  ldap.ScopeWholeSubtree,
+		Filter: "(uid=" + ldap.EscapeFilter("siti)(uid=budi") + ")",
+	})
+	if err != nil {
+		t.Fatalf("search failed: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("escaped value must match literally, got %d entries", len(entries))
+	}
+}
+
+func TestCompileFilter(t *testing.T) {
+	attributes := map[string][]string{"uid": {"siti"}, "objectClass": {"person"}}
+
+	tests := []struct {
+		filter string
+		match  bool
+	}{
+		{"(uid=siti)", true},
+		{"(UID=SITI)", true},
+		{"(uid=budi)", false},
+		{"(mail=*)", false},
+		{"(&(uid=siti)(objectClass=person))", true},
+		{"(|(uid=budi)(objectClass=person))", true},
+		{"(!(uid=siti))", false},
+		{"(uid=\\73iti)", true},
+	}
+	for _, tt := range tests {
+		compiled, err := ldap.CompileFilter(tt.filter)
+		if err != nil {
+			t.Errorf("%s: %v", tt.filter, err)
+			continue
+		}
+		if got := ldap.MatchFilter(compiled, attributes); got != tt.match {
+			t.Errorf("%s: expected %v, got %v", tt.filter, tt.match, got)
+		}
+	}
+
+	for _, invalid := range []string{"uid=siti", "(uid=siti", "(&)", "(uid=si*)", "(uid=\\7)"} {
+		if _, err := ldap.CompileFilter(invalid); err == nil {
+			t.Errorf("%s: expected error", invalid)
+		}
+	}
+}
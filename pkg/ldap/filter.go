@@ -0,0 +1,196 @@
+package ldap
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Filter choices (RFC 4511 section 4.5.1)
+const (
+	filterAnd      byte = 0
+	filterOr       byte = 1
+	filterNot      byte = 2
+	filterEquality byte = 3
+	filterPresent  byte = 7
+)
+
+// EscapeFilter escapes a value for use in a search filter (RFC 4515)
+func EscapeFilter(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch c {
+		case '*', '(', ')', '\\', 0:
+			fmt.Fprintf(&b, "\\%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// CompileFilter compiles a string search filter. Conjunction, disjunction,
+// negation, equality and presence filters are supported.
+func CompileFilter(filter string) (*Packet, error) {
+	packet, rest, err := parseFilter(strings.TrimSpace(filter))
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("ldap: unexpected %q after filter", rest)
+	}
+	return packet, nil
+}
+
+func parseFilter(s string) (*Packet, string, error) {
+	if !strings.HasPrefix(s, "(") {
+		return nil, "", fmt.Errorf("ldap: filter %q must start with '('", s)
+	}
+	s = s[1:]
+	if s == "" {
+		return nil, "", fmt.Errorf("ldap: unterminated filter")
+	}
+
+	switch s[0] {
+	case '&', '|':
+		tag := Context(filterAnd, true)
+		if s[0] == '|' {
+			tag = Context(filterOr, true)
+		}
+		packet := NewSequence(tag)
+		s = s[1:]
+		for strings.HasPrefix(s, "(") {
+			child, rest, err := parseFilter(s)
+			if err != nil {
+				return nil, "", err
+			}
+			packet.Children = append(packet.Children, child)
+			s = rest
+		}
+		if len(packet.Children) == 0 {
+			return nil, "", fmt.Errorf("ldap: empty filter set")
+		}
+		return closeFilter(packet, s)
+
+	case '!':
+		child, rest, err := parseFilter(s[1:])
+		if err != nil {
+			return nil, "", err
+		}
+		return closeFilter(NewSequence(Context(filterNot, true), child), rest)
+	}
+
+	end := strings.IndexByte(s, ')')
+	if end < 0 {
+		return nil, "", fmt.Errorf("ldap: unterminated filter")
+	}
+	item, rest := s[:end], s[end:]
+
+	eq := strings.IndexByte(item, '=')
+	if eq <= 0 {
+		return nil, "", fmt.Errorf("ldap: invalid filter item %q", item)
+	}
+	attr, value := item[:eq], item[eq+1:]
+	if strings.ContainsAny(attr, "~<>:") {
+		return nil, "", fmt.Errorf("ldap: unsupported filter item %q", item)
+	}
+
+	if value == "*" {
+		return closeFilter(NewString(Context(filterPresent, false), attr), rest)
+	}
+	if strings.Contains(value, "*") {
+		return nil, "", fmt.Errorf("ldap: substring filters are not supported")
+	}
+
+	unescaped, err := unescapeFilter(value)
+	if err != nil {
+		return nil, "", err
+	}
+	packet := NewSequence(Context(filterEquality, true),
+		NewString(TagOctetString, attr),
+		NewString(TagOctetString, unescaped))
+	return closeFilter(packet, rest)
+}
+
+func closeFilter(packet *Packet, rest string) (*Packet, string, error) {
+	if !strings.HasPrefix(rest, ")") {
+		return nil, "", fmt.Errorf("ldap: unterminated filter")
+	}
+	return packet, rest[1:], nil
+}
+
+func unescapeFilter(value string) (string, error) {
+	if !strings.Contains(value, "\\") {
+		return value, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			b.WriteByte(value[i])
+			continue
+		}
+		if i+3 > len(value) {
+			return "", fmt.Errorf("ldap: invalid escape in %q", value)
+		}
+		decoded, err := hex.DecodeString(value[i+1 : i+3])
+		if err != nil {
+			return "", fmt.Errorf("ldap: invalid escape in %q", value)
+		}
+		b.Write(decoded)
+		i += 2
+	}
+	return b.String(), nil
+}
+
+// MatchFilter evaluates a compiled filter against an entry's attributes.
+// Attribute names and values are compared case-insensitively.
+func MatchFilter(filter *Packet, attributes map[string][]string) bool {
+	switch filter.Tag {
+	case Context(filterAnd, true):
+		for _, child := range filter.Children {
+			if !MatchFilter(child, attributes) {
+				return false
+			}
+		}
+		return true
+
+	case Context(filterOr, true):
+		for _, child := range filter.Children {
+			if MatchFilter(child, attributes) {
+				return true
+			}
+		}
+		return false
+
+	case Context(filterNot, true):
+		return len(filter.Children) == 1 && !MatchFilter(filter.Children[0], attributes)
+
+	case Context(filterEquality, true):
+		if len(filter.Children) != 2 {
+			return false
+		}
+		for _, value := range attributeValues(attributes, filter.Children[0].String()) {
+			if strings.EqualFold(value, filter.Children[1].String()) {
+				return true
+			}
+		}
+		return false
+
+	case Context(filterPresent, false):
+		return len(attributeValues(attributes, filter.String())) > 0
+	}
+
+	return false
+}
+
+// attributeValues looks up an attribute by case-insensitive name
+func attributeValues(attributes map[string][]string, name string) []string {
+	for attr, values := range attributes {
+		if strings.EqualFold(attr, name) {
+			return values
+		}
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+// Package ldaptest provides an in-memory LDAP server for tests
+package ldaptest
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/hospital-emr/backend/pkg/ldap"
+)
+
+// Server is an in-memory directory answering simple binds and searches
+type Server struct {
+	listener net.Listener
+	mu       sync.RWMutex
+	entries  map[string]*entry
+	wg       sync.WaitGroup
+}
+
+type entry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// NewServer starts a server listening on a random local port
+func NewServer() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{listener: listener, entries: make(map[string]*entry)}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// URL returns the ldap:// URL of the server
+func (s *Server) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+// AddEntry adds an entry. Entries with a password accept simple binds.
+func (s *Server) AddEntry(dn, password string, attributes map[string][]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[normalizeDN(dn)] = &entry{dn: dn, password: password, attributes: attributes}
+}
+
+// Close stops the server
+func (s *Server) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	for {
+		message, err := ldap.ReadPacket(reader)
+		if err != nil || len(message.Children) < 2 {
+			return
+		}
+		id, op := message.Children[0].Int(), message.Children[1]
+
+		var responses []*ldap.Packet
+		switch op.Tag {
+		case ldap.Application(0, true):
+			responses = []*ldap.Packet{s.bind(op)}
+		case ldap.Application(3, true):
+			responses = s.search(op)
+		default:
+			// Unbind or unsupported operation
+			return
+		}
+
+		for _, response := range responses {
+			reply := ldap.NewSequence(ldap.TagSequence, ldap.NewInteger(ldap.TagInteger, id), response)
+			if _, err := conn.Write(reply.Encode()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) bind(op *ldap.Packet) *ldap.Packet {
+	dn, password := op.Child(1), op.Child(2)
+	if dn == nil || password == nil {
+		return result(1, ldap.ResultUnwillingToPerform, "malformed bind")
+	}
+
+	s.mu.RLock()
+	e, ok := s.entries[normalizeDN(dn.String())]
+	s.mu.RUnlock()
+
+	if !ok || e.password == "" || e.password != password.String() {
+		return result(1, ldap.ResultInvalidCredentials, "invalid credentials")
+	}
+	return result(1, ldap.ResultSuccess, "")
+}
+
+func (s *Server) search(op *ldap.Packet) []*ldap.Packet {
+	if len(op.Children) < 8 {
+		return []*ldap.Packet{result(5, ldap.ResultUnwillingToPerform, "malformed search")}
+	}
+	base := normalizeDN(op.Children[0].String())
+	scope := int(op.Children[1].Int())
+	filter := op.Children[6]
+
+	var requested []string
+	for _, attr := range op.Children[7].Children {
+		requested = append(requested, attr.String())
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var responses []*ldap.Packet
+	for key, e := range s.entries {
+		if !inScope(key, base, scope) || !ldap.MatchFilter(filter, e.attributes) {
+			continue
+		}
+		responses = append(responses, searchEntry(e, requested))
+	}
+	return append(responses, result(5, ldap.ResultSuccess, ""))
+}
+
+func searchEntry(e *entry, requested []string) *ldap.Packet {
+	attributes := ldap.NewSequence(ldap.TagSequence)
+	for name, values := range e.attributes {
+		if !wanted(name, requested) {
+			continue
+		}
+		set := ldap.NewSequence(ldap.TagSet)
+		for _, value := range values {
+			set.Children = append(set.Children, ldap.NewString(ldap.TagOctetString, value))
+		}
+		attributes.Children = append(attributes.Children,
+			ldap.NewSequence(ldap.TagSequence, ldap.NewString(ldap.TagOctetString, name), set))
+	}
+	return ldap.NewSequence(ldap.Application(4, true), ldap.NewString(ldap.TagOctetString, e.dn), attributes)
+}
+
+func result(op byte, code int, message string) *ldap.Packet {
+	return ldap.NewSequence(ldap.Application(op, true),
+		ldap.NewInteger(ldap.TagEnumerated, int64(code)),
+		ldap.NewString(ldap.TagOctetString, ""),
+		ldap.NewString(ldap.TagOctetString, message))
+}
+
+func wanted(name string, requested []string) bool {
+	if len(requested) == 0 {
+		return true
+	}
+	for _, attr := range requested {
+		if attr == "*" || strings.EqualFold(attr, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func inScope(dn, base string, scope int) bool {
+	switch scope {
+	case ldap.ScopeBaseObject:
+		return dn == base
+	case ldap.ScopeSingleLevel:
+		parent := ""
+		if i := strings.IndexByte(dn, ','); i >= 0 {
+			parent = dn[i+1:]
+		}
+		return parent == base
+	default:
+		return base == "" || dn == base || strings.HasSuffix(dn, ","+base)
+	}
+}
+
+func normalizeDN(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i, part := range parts {
+		parts[i] = strings.ToLower(strings.TrimSpace(part))
+	}
+	return strings.Join(parts, ",")
+}
@@ -69,6 +69,8 @@ func (c *NATSClient) Close() {
 const (
 	SubjectPatientCreated    = "patient.created"
 	SubjectPatientUpdated    = "patient.updated"
+	SubjectPatientMerged     = "patient.merged"
+	SubjectPatientUnmerged   = "patient.unmerged"
 	SubjectEncounterCreated  = "encounter.created"
 	SubjectEncounterUpdated  = "encounter.updated"
 	SubjectOrderCreated      = "order.created"
@@ -77,5 +79,8 @@ const (
 	SubjectAppointmentBooked = "appointment.booked"
 	SubjectAppointmentCancelled = "appointment.cancelled"
 	SubjectNotificationSend  = "notification.send"
+	SubjectEmergencyAccess   = "access.emergency"
 	SubjectERPSync           = "erp.sync"
+	SubjectAuditEvent        = "audit.event"
+	SubjectSuspiciousAccess  = "security.suspicious_access"
 )
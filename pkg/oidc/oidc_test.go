@@ -0,0 +1,120 @@
+package oidc_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/hospital-emr/backend/pkg/oidc"
+	"github.com/hospital-emr/backend/pkg/oidc/oidctest"
+)
+
+func newProvider(t *testing.T) (*oidctest.Server, *oidc.Provider) {
+	t.Helper()
+	server, err := oidctest.NewServer("emr", "client-secret")
+	if err != nil {
+		t.Fatalf("failed to start provider: %v", err)
+	}
+	t.Cleanup(server.Close)
+
+	provider, err := oidc.Discover(context.Background(), oidc.Config{
+		IssuerURL:    server.Issuer(),
+		ClientID:     "emr",
+		ClientSecret: "client-secret",
+		RedirectURL:  "http://localhost/callback",
+	})
+	if err != nil {
+		t.Fatalf("discovery failed: %v", err)
+	}
+	return server, provider
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	server, provider := newProvider(t)
+	server.SetUser(map[string]interface{}{
+		"sub":    "user-1",
+		"email":  "siti@hospital.local",
+		"groups": []string{"doctors", "staff"},
+	})
+
+	verifier, _ := oidc.GenerateVerifier()
+	redirect, err := server.Login(provider.AuthCodeURL("state-1", "nonce-1", verifier))
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if redirect.Query().Get("state") != "state-1" {
+		t.Fatalf("state was not returned")
+	}
+
+	ctx := context.Background()
+	if _, err := provider.Exchange(ctx, redirect.Query().Get("code"), "wrong-verifier"); err == nil {
+		t.Fatal("expected exchange with the wrong verifier to fail")
+	}
+
+	redirect, _ = server.Login(provider.AuthCodeURL("state-2", "nonce-2", verifier))
+	token, err := provider.Exchange(ctx, redirect.Query().Get("code"), verifier)
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+
+	if _, err := provider.VerifyIDToken(ctx, token.IDToken, "nonce-1"); err == nil {
+		t.Error("expected nonce mismatch to be rejected")
+	}
+
+	idToken, err := provider.VerifyIDToken(ctx, token.IDToken, "nonce-2")
+	if err != nil {
+		t.Fatalf("verification failed: %v", err)
+	}
+	if idToken.Subject != "user-1" || idToken.String("email") != "siti@hospital.local" {
+		t.Errorf("unexpected claims %v", idToken.Claims)
+	}
+	if groups := idToken.Strings("groups"); len(groups) != 2 {
+		t.Errorf("expected 2 groups, got %v", groups)
+	}
+}
+
+func TestVerifyIDTokenRejectsInvalidClaims(t *testing.T) {
+	server, provider := newProvider(t)
+	now := time.Now()
+
+	tests := map[string]jwt.MapClaims{
+		"wrong audience": {"iss": server.Issuer(), "aud": "other", "sub": "u", "nonce": "n", "exp": now.Add(time.Minute).Unix()},
+		"wrong issuer":   {"iss": "https://evil.example", "aud": "emr", "sub": "u", "nonce": "n", "exp": now.Add(time.Minute).Unix()},
+		"expired":        {"iss": server.Issuer(), "aud": "emr", "sub": "u", "nonce": "n", "exp": now.Add(-time.Hour).Unix()},
+		"no expiry":      {"iss": server.Issuer(), "aud": "emr", "sub": "u", "nonce": "n"},
+		"no subject":     {"iss": server.Issuer(), "aud": "emr", "nonce": "n", "exp": now.Add(time.Minute).Unix()},
+		"foreign azp":    {"iss": server.Issuer(), "aud": []string{"emr", "other"}, "azp": "other", "sub": "u", "nonce": "n", "exp": now.Add(time.Minute).Unix()},
+	}
+	for name, claims := range tests {
+		raw, err := server.SignIDToken(claims)
+		if err != nil {
+			t.Fatalf("%s: failed to sign: %v", name, err)
+		}
+		if _, err := provider.VerifyIDToken(context.Background(), raw, "n"); err == nil {
+			t.Errorf("%s: expected token to be rejected", name)
+		}
+	}
+
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{
+		"iss": server.Issuer(), "aud": "emr", "sub": "u", "nonce": "n", "exp": now.Add(time.Minute).Unix(),
+	})
+	raw, _ := unsigned.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if _, err := provider.VerifyIDToken(context.Background(), raw, "n"); err == nil {
+		t.Error("expected unsigned token to be rejected")
+	}
+}
+
+func TestAuthCodeURLUsesPKCE(t *testing.T) {
+	_, provider := newProvider(t)
+
+	authURL := provider.AuthCodeURL("s", "n", "verifier")
+	if !strings.Contains(authURL, "code_challenge_method=S256") ||
+		!strings.Contains(authURL, "code_challenge="+oidc.CodeChallenge("verifier")) {
+		t.Errorf("authorization URL lacks a PKCE challenge: %s", authURL)
+	}
+	if strings.Contains(authURL, "verifier&") {
+		t.Error("authorization URL must not contain the verifier")
+	}
+}
@@ -0,0 +1,74 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B test secret ("12345678901234567890")
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestGenerateCode(t *testing.T) {
+	tests := []struct {
+		unix     int64
+		expected string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		code, err := GenerateCode(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if code != tt.expected {
+			t.Errorf("at %d: expected %s, got %s", tt.unix, tt.expected, code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+
+	t.Run("Current step", func(t *testing.T) {
+		step, ok := Validate(rfcSecret, "081804", now)
+		if !ok || step != Step(now) {
+			t.Errorf("expected code to validate at step %d, got %d (%v)", Step(now), step, ok)
+		}
+	})
+
+	t.Run("Previous step within skew", func(t *testing.T) {
+		code, _ := GenerateCode(rfcSecret, Step(now)-1)
+		if _, ok := Validate(rfcSecret, code, now); !ok {
+			t.Error("expected code from previous step to validate")
+		}
+	})
+
+	t.Run("Outside skew", func(t *testing.T) {
+		code, _ := GenerateCode(rfcSecret, Step(now)-3)
+		if _, ok := Validate(rfcSecret, code, now); ok {
+			t.Error("expected stale code to be rejected")
+		}
+	})
+
+	t.Run("Malformed code", func(t *testing.T) {
+		if _, ok := Validate(rfcSecret, "12345", now); ok {
+			t.Error("expected short code to be rejected")
+		}
+	})
+}
+
+func TestKeyURI(t *testing.T) {
+	uri := KeyURI("Hospital-EMR", "doctor@hospital-emr.com", rfcSecret)
+	if !strings.HasPrefix(uri, "otpauth://totp/Hospital-EMR:doctor@hospital-emr.com?") {
+		t.Errorf("unexpected URI label: %s", uri)
+	}
+	if !strings.Contains(uri, "secret="+rfcSecret) || !strings.Contains(uri, "issuer=Hospital-EMR") {
+		t.Errorf("URI missing secret or issuer: %s", uri)
+	}
+}
@@ -0,0 +1,185 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Attestation conveyance preferences
+const (
+	AttestationNone     = "none"
+	AttestationIndirect = "indirect"
+	AttestationDirect   = "direct"
+)
+
+// Attestation types recorded for registered credentials
+const (
+	AttestationTypeNone  = "none"  // No attestation statement
+	AttestationTypeSelf  = "self"  // Signed by the credential key itself
+	AttestationTypeBasic = "basic" // Signed by an attestation certificate
+)
+
+// idFIDOGenCeAAGUID is the certificate extension carrying the authenticator model
+var idFIDOGenCeAAGUID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+
+// verifyAttestation checks an attestation statement and returns the
+// attestation type it proves
+func (rp *RelyingParty) verifyAttestation(format string, stmt map[interface{}]interface{}, rawAuthData []byte, authData *AuthenticatorData, credentialKey *PublicKey, clientDataHash []byte) (string, error) {
+	signed := append(append([]byte(nil), rawAuthData...), clientDataHash...)
+
+	switch format {
+	case "none":
+		if len(stmt) != 0 {
+			return "", errors.New("webauthn: none attestation with a statement")
+		}
+		return AttestationTypeNone, nil
+
+	case "packed":
+		alg, _ := stmt["alg"].(int64)
+		sig, _ := stmt["sig"].([]byte)
+		chain, err := certificateChain(stmt)
+		if err != nil {
+			return "", err
+		}
+
+		if len(chain) == 0 {
+			if alg != credentialKey.Algorithm {
+				return "", errors.New("webauthn: self attestation algorithm mismatch")
+			}
+			if err := credentialKey.Verify(signed, sig); err != nil {
+				return "", err
+			}
+			return AttestationTypeSelf, nil
+		}
+
+		cert := chain[0]
+		if err := verifySignature(alg, cert.PublicKey, signed, sig); err != nil {
+			return "", err
+		}
+		if err := checkPackedCertificate(cert, authData.AAGUID); err != nil {
+			return "", err
+		}
+		if err := rp.verifyChain(chain); err != nil {
+			return "", err
+		}
+		return AttestationTypeBasic, nil
+
+	case "fido-u2f":
+		sig, _ := stmt["sig"].([]byte)
+		chain, err := certificateChain(stmt)
+		if err != nil {
+			return "", err
+		}
+		if len(chain) != 1 {
+			return "", errors.New("webauthn: fido-u2f attestation needs exactly one certificate")
+		}
+		certKey, ok := chain[0].PublicKey.(*ecdsa.PublicKey)
+		if !ok || certKey.Curve != elliptic.P256() {
+			return "", errors.New("webauthn: fido-u2f certificate must hold a P-256 key")
+		}
+		credKey, ok := credentialKey.Key.(*ecdsa.PublicKey)
+		if !ok {
+			return "", errors.New("webauthn: fido-u2f credential must be a P-256 key")
+		}
+
+		point := make([]byte, 65)
+		point[0] = 4
+		credKey.X.FillBytes(point[1:33])
+		credKey.Y.FillBytes(point[33:])
+
+		u2f := []byte{0}
+		u2f = append(u2f, authData.RPIDHash...)
+		u2f = append(u2f, clientDataHash...)
+		u2f = append(u2f, authData.CredentialID...)
+		u2f = append(u2f, point...)
+		if err := verifySignature(AlgES256, certKey, u2f, sig); err != nil {
+			return "", err
+		}
+		if err := rp.verifyChain(chain); err != nil {
+			return "", err
+		}
+		return AttestationTypeBasic, nil
+	}
+
+	return "", fmt.Errorf("webauthn: unsupported attestation format %q", format)
+}
+
+// certificateChain parses the optional x5c entry of an attestation statement
+func certificateChain(stmt map[interface{}]interface{}) ([]*x509.Certificate, error) {
+	raw, ok := stmt["x5c"]
+	if !ok {
+		return nil, nil
+	}
+	entries, ok := raw.([]interface{})
+	if !ok || len(entries) == 0 {
+		return nil, errors.New("webauthn: invalid x5c")
+	}
+
+	chain := make([]*x509.Certificate, 0, len(entries))
+	for _, entry := range entries {
+		der, ok := entry.([]byte)
+		if !ok {
+			return nil, errors.New("webauthn: invalid x5c")
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("webauthn: invalid attestation certificate: %w", err)
+		}
+		chain = append(chain, cert)
+	}
+	return chain, nil
+}
+
+// checkPackedCertificate applies the packed attestation certificate requirements
+func checkPackedCertificate(cert *x509.Certificate, aaguid []byte) error {
+	if cert.Version != 3 || cert.IsCA {
+		return errors.New("webauthn: attestation certificate must be a v3 end-entity certificate")
+	}
+
+	ou := false
+	for _, unit := range cert.Subject.OrganizationalUnit {
+		if strings.EqualFold(unit, "Authenticator Attestation") {
+			ou = true
+		}
+	}
+	if !ou {
+		return errors.New("webauthn: attestation certificate subject lacks the Authenticator Attestation unit")
+	}
+
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(idFIDOGenCeAAGUID) {
+			continue
+		}
+		var value []byte
+		if _, err := asn1.Unmarshal(ext.Value, &value); err != nil || string(value) != string(aaguid) {
+			return errors.New("webauthn: attestation certificate AAGUID mismatch")
+		}
+	}
+	return nil
+}
+
+// verifyChain checks an attestation certificate chain against the trusted
+// roots. Without configured roots any certificate is accepted.
+func (rp *RelyingParty) verifyChain(chain []*x509.Certificate) error {
+	if rp.AttestationRoots == nil {
+		return nil
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         rp.AttestationRoots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return fmt.Errorf("webauthn: untrusted attestation certificate: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Authenticator data flags
+const (
+	FlagUserPresent        byte = 0x01
+	FlagUserVerified       byte = 0x04
+	FlagBackupEligible     byte = 0x08
+	FlagBackupState        byte = 0x10
+	FlagAttestedCredential byte = 0x40
+	FlagExtensionData      byte = 0x80
+)
+
+// maxCredentialIDLength is the longest credential ID WebAuthn allows
+const maxCredentialIDLength = 1023
+
+// AuthenticatorData is the parsed authenticator data of a registration or assertion
+type AuthenticatorData struct {
+	RPIDHash  []byte
+	Flags     byte
+	SignCount uint32
+
+	// Attested credential data, present during registration only
+	AAGUID              []byte
+	CredentialID        []byte
+	CredentialPublicKey []byte // COSE_Key
+}
+
+// Has reports whether all of the given flags are set
+func (a *AuthenticatorData) Has(flags byte) bool {
+	return a.Flags&flags == flags
+}
+
+// ParseAuthenticatorData parses the authenticator data structure
+func ParseAuthenticatorData(raw []byte) (*AuthenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, errors.New("webauthn: authenticator data too short")
+	}
+
+	data := &AuthenticatorData{
+		RPIDHash:  raw[:32],
+		Flags:     raw[32],
+		SignCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	rest := raw[37:]
+
+	if data.Has(FlagAttestedCredential) {
+		if len(rest) < 18 {
+			return nil, errors.New("webauthn: attested credential data too short")
+		}
+		data.AAGUID = rest[:16]
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength > maxCredentialIDLength || len(rest) < idLength {
+			return nil, errors.New("webauthn: invalid credential ID length")
+		}
+		data.CredentialID = rest[:idLength]
+		rest = rest[idLength:]
+
+		_, after, err := DecodeCBOR(rest)
+		if err != nil {
+			return nil, err
+		}
+		data.CredentialPublicKey = rest[:len(rest)-len(after)]
+		rest = after
+	}
+
+	if data.Has(FlagExtensionData) {
+		_, after, err := DecodeCBOR(rest)
+		if err != nil {
+			return nil, err
+		}
+		rest = after
+	}
+
+	if len(rest) != 0 {
+		return nil, errors.New("webauthn: trailing data after authenticator data")
+	}
+	return data, nil
+}
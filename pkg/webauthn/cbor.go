@@ -0,0 +1,253 @@
+package webauthn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// The subset of CBOR (RFC 8949) used by WebAuthn: integers, byte and text
+// strings, arrays, maps, booleans and null. Indefinite lengths and floats
+// are not used by authenticators and are rejected.
+
+const (
+	cborUnsigned = 0
+	cborNegative = 1
+	cborBytes    = 2
+	cborText     = 3
+	cborArray    = 4
+	cborMap      = 5
+	cborTag      = 6
+	cborSimple   = 7
+
+	cborMaxDepth = 16
+)
+
+var errCBORTruncated = errors.New("webauthn: truncated CBOR data")
+
+// DecodeCBOR decodes the first CBOR data item in data and returns it with the
+// bytes that follow it. Integers decode to int64, byte strings to []byte,
+// text to string, arrays to []interface{} and maps to
+// map[interface{}]interface{} keyed by int64 or string.
+func DecodeCBOR(data []byte) (interface{}, []byte, error) {
+	d := &cborDecoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return v, d.data, nil
+}
+
+type cborDecoder struct {
+	data []byte
+}
+
+func (d *cborDecoder) head() (major byte, arg uint64, err error) {
+	if len(d.data) < 1 {
+		return 0, 0, errCBORTruncated
+	}
+	major, info := d.data[0]>>5, d.data[0]&0x1f
+	d.data = d.data[1:]
+
+	var n int
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		n = 1
+	case info == 25:
+		n = 2
+	case info == 26:
+		n = 4
+	case info == 27:
+		n = 8
+	default:
+		return 0, 0, fmt.Errorf("webauthn: unsupported CBOR additional info %d", info)
+	}
+	if len(d.data) < n {
+		return 0, 0, errCBORTruncated
+	}
+	for _, b := range d.data[:n] {
+		arg = arg<<8 | uint64(b)
+	}
+	d.data = d.data[n:]
+	return major, arg, nil
+}
+
+func (d *cborDecoder) value(depth int) (interface{}, error) {
+	if depth > cborMaxDepth {
+		return nil, errors.New("webauthn: CBOR nesting too deep")
+	}
+
+	major, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case cborUnsigned:
+		if arg > math.MaxInt64 {
+			return nil, errors.New("webauthn: CBOR integer overflow")
+		}
+		return int64(arg), nil
+	case cborNegative:
+		if arg > math.MaxInt64 {
+			return nil, errors.New("webauthn: CBOR integer overflow")
+		}
+		return -1 - int64(arg), nil
+	case cborBytes, cborText:
+		if arg > uint64(len(d.data)) {
+			return nil, errCBORTruncated
+		}
+		raw := d.data[:arg]
+		d.data = d.data[arg:]
+		if major == cborText {
+			return string(raw), nil
+		}
+		return append([]byte(nil), raw...), nil
+	case cborArray:
+		if arg > uint64(len(d.data)) {
+			return nil, errCBORTruncated
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			item, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case cborMap:
+		if arg > uint64(len(d.data)) {
+			return nil, errCBORTruncated
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, errors.New("webauthn: unsupported CBOR map key")
+			}
+			if _, dup := m[key]; dup {
+				return nil, errors.New("webauthn: duplicate CBOR map key")
+			}
+			val, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = val
+		}
+		return m, nil
+	case cborTag:
+		return d.value(depth + 1)
+	default:
+		switch arg {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		}
+		return nil, fmt.Errorf("webauthn: unsupported CBOR simple value %d", arg)
+	}
+}
+
+// EncodeCBOR encodes v using the same types DecodeCBOR produces, plus int.
+// Map keys are written in canonical CTAP2 order.
+func EncodeCBOR(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeCBOR(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeCBOR(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(cborSimple<<5 | 22)
+	case bool:
+		if v {
+			buf.WriteByte(cborSimple<<5 | 21)
+		} else {
+			buf.WriteByte(cborSimple<<5 | 20)
+		}
+	case int:
+		return encodeCBOR(buf, int64(v))
+	case int64:
+		if v >= 0 {
+			writeCBORHead(buf, cborUnsigned, uint64(v))
+		} else {
+			writeCBORHead(buf, cborNegative, uint64(-1-v))
+		}
+	case []byte:
+		writeCBORHead(buf, cborBytes, uint64(len(v)))
+		buf.Write(v)
+	case string:
+		writeCBORHead(buf, cborText, uint64(len(v)))
+		buf.WriteString(v)
+	case []interface{}:
+		writeCBORHead(buf, cborArray, uint64(len(v)))
+		for _, item := range v {
+			if err := encodeCBOR(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[interface{}]interface{}:
+		type pair struct{ key, value []byte }
+		pairs := make([]pair, 0, len(v))
+		for key, value := range v {
+			k, err := EncodeCBOR(key)
+			if err != nil {
+				return err
+			}
+			val, err := EncodeCBOR(value)
+			if err != nil {
+				return err
+			}
+			pairs = append(pairs, pair{k, val})
+		}
+		sort.Slice(pairs, func(i, j int) bool {
+			if len(pairs[i].key) != len(pairs[j].key) {
+				return len(pairs[i].key) < len(pairs[j].key)
+			}
+			return bytes.Compare(pairs[i].key, pairs[j].key) < 0
+		})
+		writeCBORHead(buf, cborMap, uint64(len(pairs)))
+		for _, p := range pairs {
+			buf.Write(p.key)
+			buf.Write(p.value)
+		}
+	default:
+		return fmt.Errorf("webauthn: cannot encode %T as CBOR", v)
+	}
+	return nil
+}
+
+func writeCBORHead(buf *bytes.Buffer, major byte, arg uint64) {
+	switch {
+	case arg < 24:
+		buf.WriteByte(major<<5 | byte(arg))
+	case arg <= math.MaxUint8:
+		buf.WriteByte(major<<5 | 24)
+		buf.WriteByte(byte(arg))
+	case arg <= math.MaxUint16:
+		buf.WriteByte(major<<5 | 25)
+		binary.Write(buf, binary.BigEndian, uint16(arg))
+	case arg <= math.MaxUint32:
+		buf.WriteByte(major<<5 | 26)
+		binary.Write(buf, binary.BigEndian, uint32(arg))
+	default:
+		buf.WriteByte(major<<5 | 27)
+		binary.Write(buf, binary.BigEndian, arg)
+	}
+}
@@ -0,0 +1,175 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers (RFC 9053) accepted for credentials
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+	AlgRS256 int64 = -257
+)
+
+// SupportedAlgorithms lists the accepted algorithms in order of preference
+var SupportedAlgorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+// COSE key parameters
+const (
+	coseKeyType   = 1
+	coseAlgorithm = 3
+	coseCurve     = -1 // Also the RSA modulus
+	coseX         = -2 // Also the RSA exponent
+	coseY         = -3
+
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+
+	minRSAKeyBits = 2048
+)
+
+// PublicKey is a credential public key together with its signature algorithm
+type PublicKey struct {
+	Algorithm int64
+	Key       crypto.PublicKey
+}
+
+// ParsePublicKey decodes a COSE_Key. Only ES256, EdDSA (Ed25519) and RS256
+// keys are accepted.
+func ParsePublicKey(data []byte) (*PublicKey, error) {
+	v, rest, err := DecodeCBOR(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("webauthn: trailing data after COSE key")
+	}
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("webauthn: COSE key is not a map")
+	}
+
+	kty, _ := m[int64(coseKeyType)].(int64)
+	alg, _ := m[int64(coseAlgorithm)].(int64)
+
+	switch {
+	case kty == coseKeyTypeEC2 && alg == AlgES256:
+		crv, _ := m[int64(coseCurve)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		y, _ := m[int64(coseY)].([]byte)
+		if crv != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("webauthn: invalid P-256 key")
+		}
+		point := append(append([]byte{4}, x...), y...)
+		// Rejects points that are not on the curve
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, errors.New("webauthn: invalid P-256 key")
+		}
+		return &PublicKey{Algorithm: alg, Key: &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}}, nil
+
+	case kty == coseKeyTypeOKP && alg == AlgEdDSA:
+		crv, _ := m[int64(coseCurve)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		if crv != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("webauthn: invalid Ed25519 key")
+		}
+		return &PublicKey{Algorithm: alg, Key: ed25519.PublicKey(x)}, nil
+
+	case kty == coseKeyTypeRSA && alg == AlgRS256:
+		n, _ := m[int64(coseCurve)].([]byte)
+		e, _ := m[int64(coseX)].([]byte)
+		if len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("webauthn: invalid RSA key")
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.N.BitLen() < minRSAKeyBits || key.E < 3 {
+			return nil, errors.New("webauthn: invalid RSA key")
+		}
+		return &PublicKey{Algorithm: alg, Key: key}, nil
+	}
+
+	return nil, fmt.Errorf("webauthn: unsupported COSE key type %d with algorithm %d", kty, alg)
+}
+
+// Verify checks a signature made by the key over data
+func (k *PublicKey) Verify(data, sig []byte) error {
+	return verifySignature(k.Algorithm, k.Key, data, sig)
+}
+
+// verifySignature checks sig over data with a key of the given algorithm
+func verifySignature(alg int64, key crypto.PublicKey, data, sig []byte) error {
+	ok := false
+	switch alg {
+	case AlgES256:
+		if pub, isEC := key.(*ecdsa.PublicKey); isEC {
+			digest := sha256.Sum256(data)
+			ok = ecdsa.VerifyASN1(pub, digest[:], sig)
+		}
+	case AlgEdDSA:
+		if pub, isEd := key.(ed25519.PublicKey); isEd {
+			ok = ed25519.Verify(pub, data, sig)
+		}
+	case AlgRS256:
+		if pub, isRSA := key.(*rsa.PublicKey); isRSA {
+			digest := sha256.Sum256(data)
+			ok = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil
+		}
+	}
+	if !ok {
+		return errors.New("webauthn: invalid signature")
+	}
+	return nil
+}
+
+// EncodePublicKey encodes an ECDSA P-256, Ed25519 or RSA public key as a COSE_Key
+func EncodePublicKey(key crypto.PublicKey) ([]byte, error) {
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return nil, errors.New("webauthn: only P-256 ECDSA keys are supported")
+		}
+		x := make([]byte, 32)
+		y := make([]byte, 32)
+		key.X.FillBytes(x)
+		key.Y.FillBytes(y)
+		return EncodeCBOR(map[interface{}]interface{}{
+			int64(coseKeyType):   int64(coseKeyTypeEC2),
+			int64(coseAlgorithm): AlgES256,
+			int64(coseCurve):     int64(coseCurveP256),
+			int64(coseX):         x,
+			int64(coseY):         y,
+		})
+	case ed25519.PublicKey:
+		return EncodeCBOR(map[interface{}]interface{}{
+			int64(coseKeyType):   int64(coseKeyTypeOKP),
+			int64(coseAlgorithm): AlgEdDSA,
+			int64(coseCurve):     int64(coseCurveEd25519),
+			int64(coseX):         []byte(key),
+		})
+	case *rsa.PublicKey:
+		return EncodeCBOR(map[interface{}]interface{}{
+			int64(coseKeyType):   int64(coseKeyTypeRSA),
+			int64(coseAlgorithm): AlgRS256,
+			int64(coseCurve):     key.N.Bytes(),
+			int64(coseX):         big.NewInt(int64(key.E)).Bytes(),
+		})
+	}
+	return nil, fmt.Errorf("webauthn: unsupported public key type %T", key)
+}
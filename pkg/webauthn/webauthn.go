@@ -0,0 +1,367 @@
+// Package webauthn implements the relying party side of the W3C Web
+// Authentication (FIDO2) registration and authentication ceremonies.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// User verification requirements
+const (
+	UserVerificationRequired    = "required"
+	UserVerificationPreferred   = "preferred"
+	UserVerificationDiscouraged = "discouraged"
+)
+
+// Client data types
+const (
+	ceremonyCreate = "webauthn.create"
+	ceremonyGet    = "webauthn.get"
+)
+
+// challengeLength is the number of random bytes in a challenge
+const challengeLength = 32
+
+// ErrSignCount is returned when an assertion's signature counter did not
+// increase, which indicates a cloned authenticator
+var ErrSignCount = errors.New("webauthn: signature counter did not increase")
+
+// RelyingParty verifies ceremonies for one relying party ID
+type RelyingParty struct {
+	ID      string // Registrable domain credentials are scoped to
+	Name    string
+	Origins []string // Origins allowed to run ceremonies
+
+	// AttestationRoots, when set, must anchor every certificate-based
+	// attestation. When nil, attestation signatures are still verified but
+	// the certificate's issuer is not.
+	AttestationRoots *x509.CertPool
+}
+
+// URLEncodedBase64 is binary data encoded as unpadded base64url in JSON, as
+// used by the WebAuthn JSON serialization
+type URLEncodedBase64 []byte
+
+// MarshalJSON encodes the data as unpadded base64url
+func (b URLEncodedBase64) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON accepts padded or unpadded base64url
+func (b *URLEncodedBase64) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return fmt.Errorf("webauthn: invalid base64url: %w", err)
+	}
+	*b = decoded
+	return nil
+}
+
+// RelyingPartyEntity identifies the relying party to the authenticator
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// UserEntity identifies the account a credential is created for
+type UserEntity struct {
+	ID          URLEncodedBase64 `json:"id"`
+	Name        string           `json:"name"`
+	DisplayName string           `json:"displayName"`
+}
+
+// CredentialParameter is an acceptable credential type and algorithm
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// CredentialDescriptor identifies an existing credential
+type CredentialDescriptor struct {
+	Type       string           `json:"type"`
+	ID         URLEncodedBase64 `json:"id"`
+	Transports []string         `json:"transports,omitempty"`
+}
+
+// AuthenticatorSelection restricts which authenticators may be used
+type AuthenticatorSelection struct {
+	AuthenticatorAttachment string `json:"authenticatorAttachment,omitempty"` // platform or cross-platform
+	ResidentKey             string `json:"residentKey,omitempty"`
+	RequireResidentKey      bool   `json:"requireResidentKey"`
+	UserVerification        string `json:"userVerification,omitempty"`
+}
+
+// CreationOptions are the PublicKeyCredentialCreationOptions passed to
+// navigator.credentials.create()
+type CreationOptions struct {
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	Challenge              URLEncodedBase64       `json:"challenge"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout,omitempty"` // Milliseconds
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials,omitempty"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation,omitempty"`
+}
+
+// RequestOptions are the PublicKeyCredentialRequestOptions passed to
+// navigator.credentials.get()
+type RequestOptions struct {
+	Challenge        URLEncodedBase64       `json:"challenge"`
+	Timeout          int64                  `json:"timeout,omitempty"` // Milliseconds
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials,omitempty"`
+	UserVerification string                 `json:"userVerification,omitempty"`
+}
+
+// CredentialCreationResponse is the JSON serialization of the credential
+// returned by navigator.credentials.create()
+type CredentialCreationResponse struct {
+	ID       string                           `json:"id"`
+	RawID    URLEncodedBase64                 `json:"rawId"`
+	Type     string                           `json:"type"`
+	Response AuthenticatorAttestationResponse `json:"response"`
+}
+
+// AuthenticatorAttestationResponse is the authenticator's response to a registration
+type AuthenticatorAttestationResponse struct {
+	ClientDataJSON    URLEncodedBase64 `json:"clientDataJSON"`
+	AttestationObject URLEncodedBase64 `json:"attestationObject"`
+	Transports        []string         `json:"transports,omitempty"`
+}
+
+// CredentialAssertionResponse is the JSON serialization of the credential
+// returned by navigator.credentials.get()
+type CredentialAssertionResponse struct {
+	ID       string                         `json:"id"`
+	RawID    URLEncodedBase64               `json:"rawId"`
+	Type     string                         `json:"type"`
+	Response AuthenticatorAssertionResponse `json:"response"`
+}
+
+// AuthenticatorAssertionResponse is the authenticator's response to an authentication
+type AuthenticatorAssertionResponse struct {
+	ClientDataJSON    URLEncodedBase64 `json:"clientDataJSON"`
+	AuthenticatorData URLEncodedBase64 `json:"authenticatorData"`
+	Signature         URLEncodedBase64 `json:"signature"`
+	UserHandle        URLEncodedBase64 `json:"userHandle,omitempty"`
+}
+
+// CollectedClientData is the client data the browser signs over
+type CollectedClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin,omitempty"`
+}
+
+// RegistrationPolicy sets the requirements a new credential must meet
+type RegistrationPolicy struct {
+	UserVerification string // required enforces the UV flag
+	Attestation      string // none skips attestation; direct requires a certificate-based attestation
+}
+
+// Credential is a verified new credential
+type Credential struct {
+	ID                []byte
+	PublicKey         []byte // COSE_Key
+	Algorithm         int64
+	SignCount         uint32
+	AAGUID            []byte
+	AttestationFormat string
+	AttestationType   string
+	UserVerified      bool
+	BackupEligible    bool
+	BackupState       bool
+	Transports        []string
+}
+
+// Assertion is a verified authentication
+type Assertion struct {
+	CredentialID []byte
+	SignCount    uint32
+	UserVerified bool
+	BackupState  bool
+}
+
+// NewChallenge returns a random ceremony challenge
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, challengeLength)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// VerifyRegistration verifies a registration ceremony response against the
+// challenge that was issued for it
+func (rp *RelyingParty) VerifyRegistration(resp *CredentialCreationResponse, challenge []byte, policy RegistrationPolicy) (*Credential, error) {
+	if resp.Type != "public-key" {
+		return nil, errors.New("webauthn: unexpected credential type")
+	}
+	clientDataHash, err := rp.verifyClientData(resp.Response.ClientDataJSON, ceremonyCreate, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	v, rest, err := DecodeCBOR(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, err
+	}
+	object, ok := v.(map[interface{}]interface{})
+	if !ok || len(rest) != 0 {
+		return nil, errors.New("webauthn: invalid attestation object")
+	}
+	format, _ := object["fmt"].(string)
+	stmt, _ := object["attStmt"].(map[interface{}]interface{})
+	rawAuthData, _ := object["authData"].([]byte)
+	if format == "" || stmt == nil {
+		return nil, errors.New("webauthn: invalid attestation object")
+	}
+
+	authData, err := rp.verifyAuthenticatorData(rawAuthData, policy.UserVerification)
+	if err != nil {
+		return nil, err
+	}
+	if !authData.Has(FlagAttestedCredential) {
+		return nil, errors.New("webauthn: registration without attested credential data")
+	}
+	if !bytes.Equal(authData.CredentialID, resp.RawID) {
+		return nil, errors.New("webauthn: credential ID mismatch")
+	}
+
+	key, err := ParsePublicKey(authData.CredentialPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	attestationType := AttestationTypeNone
+	if policy.Attestation != "" && policy.Attestation != AttestationNone {
+		if attestationType, err = rp.verifyAttestation(format, stmt, rawAuthData, authData, key, clientDataHash); err != nil {
+			return nil, err
+		}
+		if policy.Attestation == AttestationDirect && attestationType != AttestationTypeBasic {
+			return nil, errors.New("webauthn: authenticator attestation is required")
+		}
+	}
+
+	return &Credential{
+		ID:                append([]byte(nil), authData.CredentialID...),
+		PublicKey:         append([]byte(nil), authData.CredentialPublicKey...),
+		Algorithm:         key.Algorithm,
+		SignCount:         authData.SignCount,
+		AAGUID:            append([]byte(nil), authData.AAGUID...),
+		AttestationFormat: format,
+		AttestationType:   attestationType,
+		UserVerified:      authData.Has(FlagUserVerified),
+		BackupEligible:    authData.Has(FlagBackupEligible),
+		BackupState:       authData.Has(FlagBackupState),
+		Transports:        resp.Response.Transports,
+	}, nil
+}
+
+// VerifyAssertion verifies an authentication ceremony response made with a
+// registered credential. storedSignCount is the counter seen last time;
+// a counter that does not increase yields ErrSignCount.
+func (rp *RelyingParty) VerifyAssertion(resp *CredentialAssertionResponse, challenge []byte, publicKey []byte, storedSignCount uint32, userVerification string) (*Assertion, error) {
+	if resp.Type != "public-key" {
+		return nil, errors.New("webauthn: unexpected credential type")
+	}
+	clientDataHash, err := rp.verifyClientData(resp.Response.ClientDataJSON, ceremonyGet, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	authData, err := rp.verifyAuthenticatorData(resp.Response.AuthenticatorData, userVerification)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	signed := append(append([]byte(nil), resp.Response.AuthenticatorData...), clientDataHash...)
+	if err := key.Verify(signed, resp.Response.Signature); err != nil {
+		return nil, err
+	}
+
+	// Authenticators that do not implement a counter always report zero
+	if (authData.SignCount != 0 || storedSignCount != 0) && authData.SignCount <= storedSignCount {
+		return nil, ErrSignCount
+	}
+
+	return &Assertion{
+		CredentialID: append([]byte(nil), resp.RawID...),
+		SignCount:    authData.SignCount,
+		UserVerified: authData.Has(FlagUserVerified),
+		BackupState:  authData.Has(FlagBackupState),
+	}, nil
+}
+
+// verifyClientData checks the ceremony type, challenge and origin of the
+// client data and returns its hash
+func (rp *RelyingParty) verifyClientData(raw []byte, ceremony string, challenge []byte) ([]byte, error) {
+	var clientData CollectedClientData
+	if err := json.Unmarshal(raw, &clientData); err != nil {
+		return nil, errors.New("webauthn: invalid client data")
+	}
+	if clientData.Type != ceremony {
+		return nil, fmt.Errorf("webauthn: unexpected ceremony type %q", clientData.Type)
+	}
+
+	got, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(clientData.Challenge, "="))
+	if err != nil || len(challenge) == 0 || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return nil, errors.New("webauthn: challenge mismatch")
+	}
+
+	if clientData.CrossOrigin {
+		return nil, errors.New("webauthn: cross-origin ceremonies are not allowed")
+	}
+	allowed := false
+	for _, origin := range rp.Origins {
+		if clientData.Origin == origin {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return nil, fmt.Errorf("webauthn: origin %q is not allowed", clientData.Origin)
+	}
+
+	hash := sha256.Sum256(raw)
+	return hash[:], nil
+}
+
+// verifyAuthenticatorData checks the RP ID hash and user presence and
+// verification flags of authenticator data
+func (rp *RelyingParty) verifyAuthenticatorData(raw []byte, userVerification string) (*AuthenticatorData, error) {
+	authData, err := ParseAuthenticatorData(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(authData.RPIDHash, rpIDHash[:]) {
+		return nil, errors.New("webauthn: relying party ID mismatch")
+	}
+	if !authData.Has(FlagUserPresent) {
+		return nil, errors.New("webauthn: user was not present")
+	}
+	if userVerification == UserVerificationRequired && !authData.Has(FlagUserVerified) {
+		return nil, errors.New("webauthn: user was not verified")
+	}
+	return authData, nil
+}
@@ -0,0 +1,171 @@
+package webauthn_test
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"github.com/hospital-emr/backend/pkg/webauthn"
+	"github.com/hospital-emr/backend/pkg/webauthn/webauthntest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const origin = "https://emr.hospital.test"
+
+func newRelyingParty() *webauthn.RelyingParty {
+	return &webauthn.RelyingParty{ID: "emr.hospital.test", Name: "Hospital EMR", Origins: []string{origin}}
+}
+
+func creationOptions(t *testing.T, rp *webauthn.RelyingParty, attestation string) *webauthn.CreationOptions {
+	challenge, err := webauthn.NewChallenge()
+	require.NoError(t, err)
+	return &webauthn.CreationOptions{
+		RP:               webauthn.RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:             webauthn.UserEntity{ID: []byte("user-1"), Name: "doctor@hospital-emr.com"},
+		Challenge:        challenge,
+		PubKeyCredParams: []webauthn.CredentialParameter{{Type: "public-key", Alg: webauthn.AlgES256}},
+		Attestation:      attestation,
+	}
+}
+
+func register(t *testing.T, rp *webauthn.RelyingParty, authenticator *webauthntest.Authenticator, policy webauthn.RegistrationPolicy) (*webauthn.Credential, error) {
+	options := creationOptions(t, rp, policy.Attestation)
+	resp, err := authenticator.Create(options, origin)
+	require.NoError(t, err)
+	return rp.VerifyRegistration(resp, options.Challenge, policy)
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	rp := newRelyingParty()
+	authenticator := webauthntest.NewAuthenticator()
+
+	cred, err := register(t, rp, authenticator, webauthn.RegistrationPolicy{UserVerification: webauthn.UserVerificationRequired})
+	require.NoError(t, err)
+	assert.Equal(t, webauthn.AlgES256, cred.Algorithm)
+	assert.Equal(t, "none", cred.AttestationFormat)
+	assert.True(t, cred.UserVerified)
+
+	challenge, err := webauthn.NewChallenge()
+	require.NoError(t, err)
+	options := &webauthn.RequestOptions{
+		Challenge:        challenge,
+		RPID:             rp.ID,
+		AllowCredentials: []webauthn.CredentialDescriptor{{Type: "public-key", ID: cred.ID}},
+	}
+	resp, err := authenticator.Get(options, origin)
+	require.NoError(t, err)
+
+	assertion, err := rp.VerifyAssertion(resp, challenge, cred.PublicKey, cred.SignCount, webauthn.UserVerificationRequired)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), assertion.SignCount)
+
+	t.Run("replayed challenge from another ceremony", func(t *testing.T) {
+		other, err := webauthn.NewChallenge()
+		require.NoError(t, err)
+		_, err = rp.VerifyAssertion(resp, other, cred.PublicKey, cred.SignCount, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("cloned authenticator", func(t *testing.T) {
+		_, err := rp.VerifyAssertion(resp, challenge, cred.PublicKey, assertion.SignCount, "")
+		assert.ErrorIs(t, err, webauthn.ErrSignCount)
+	})
+
+	t.Run("tampered signature", func(t *testing.T) {
+		tampered := *resp
+		tampered.Response.Signature = append([]byte(nil), resp.Response.Signature...)
+		tampered.Response.Signature[len(tampered.Response.Signature)-1] ^= 1
+		_, err := rp.VerifyAssertion(&tampered, challenge, cred.PublicKey, 0, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("foreign origin", func(t *testing.T) {
+		phished, err := authenticator.Get(options, "https://emr.hospital.test.evil")
+		require.NoError(t, err)
+		_, err = rp.VerifyAssertion(phished, challenge, cred.PublicKey, 0, "")
+		assert.Error(t, err)
+	})
+}
+
+func TestUserVerificationRequired(t *testing.T) {
+	rp := newRelyingParty()
+	authenticator := webauthntest.NewAuthenticator()
+	authenticator.UserVerified = false
+
+	_, err := register(t, rp, authenticator, webauthn.RegistrationPolicy{UserVerification: webauthn.UserVerificationRequired})
+	assert.Error(t, err)
+
+	_, err = register(t, rp, authenticator, webauthn.RegistrationPolicy{UserVerification: webauthn.UserVerificationPreferred})
+	assert.NoError(t, err)
+}
+
+func TestAttestation(t *testing.T) {
+	rp := newRelyingParty()
+
+	t.Run("direct rejects none attestation", func(t *testing.T) {
+		_, err := register(t, rp, webauthntest.NewAuthenticator(), webauthn.RegistrationPolicy{Attestation: webauthn.AttestationDirect})
+		assert.Error(t, err)
+	})
+
+	t.Run("direct rejects self attestation", func(t *testing.T) {
+		authenticator := webauthntest.NewAuthenticator()
+		authenticator.Attestation = webauthntest.AttestationPackedSelf
+
+		_, err := register(t, rp, authenticator, webauthn.RegistrationPolicy{Attestation: webauthn.AttestationDirect})
+		assert.Error(t, err)
+
+		cred, err := register(t, rp, authenticator, webauthn.RegistrationPolicy{Attestation: webauthn.AttestationIndirect})
+		require.NoError(t, err)
+		assert.Equal(t, webauthn.AttestationTypeSelf, cred.AttestationType)
+	})
+
+	t.Run("direct accepts a certificate from a trusted root", func(t *testing.T) {
+		authenticator := webauthntest.NewAuthenticator()
+		authenticator.Attestation = webauthntest.AttestationPacked
+		root, err := authenticator.Root()
+		require.NoError(t, err)
+
+		trusted := newRelyingParty()
+		trusted.AttestationRoots = x509.NewCertPool()
+		trusted.AttestationRoots.AddCert(root)
+
+		cred, err := register(t, trusted, authenticator, webauthn.RegistrationPolicy{Attestation: webauthn.AttestationDirect})
+		require.NoError(t, err)
+		assert.Equal(t, webauthn.AttestationTypeBasic, cred.AttestationType)
+
+		untrusted := newRelyingParty()
+		untrusted.AttestationRoots = x509.NewCertPool()
+		_, err = register(t, untrusted, authenticator, webauthn.RegistrationPolicy{Attestation: webauthn.AttestationDirect})
+		assert.Error(t, err)
+	})
+}
+
+func TestRelyingPartyIDMismatch(t *testing.T) {
+	rp := newRelyingParty()
+	options := creationOptions(t, rp, webauthn.AttestationNone)
+	options.RP.ID = "evil.test"
+
+	resp, err := webauthntest.NewAuthenticator().Create(options, origin)
+	require.NoError(t, err)
+	_, err = rp.VerifyRegistration(resp, options.Challenge, webauthn.RegistrationPolicy{})
+	assert.Error(t, err)
+}
+
+func TestCBORRoundTrip(t *testing.T) {
+	value := map[interface{}]interface{}{
+		int64(1):  int64(2),
+		int64(-1): []byte{1, 2, 3},
+		"fmt":     "packed",
+		"list":    []interface{}{true, nil, int64(-300)},
+	}
+	encoded, err := webauthn.EncodeCBOR(value)
+	require.NoError(t, err)
+
+	decoded, rest, err := webauthn.DecodeCBOR(encoded)
+	require.NoError(t, err)
+	assert.Empty(t, rest)
+	assert.Equal(t, value, decoded)
+
+	_, _, err = webauthn.DecodeCBOR(encoded[:len(encoded)-1])
+	assert.Error(t, err)
+}
@@ -0,0 +1,322 @@
+// Package webauthntest provides a software FIDO2 authenticator for tests
+package webauthntest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/hospital-emr/backend/pkg/webauthn"
+)
+
+// Attestation formats the authenticator can produce
+const (
+	AttestationNone       = "none"
+	AttestationPackedSelf = "packed-self"
+	AttestationPacked     = "packed" // Signed by a certificate issued by Root()
+)
+
+// Authenticator is an in-memory authenticator holding discoverable ES256
+// credentials. It behaves like a platform authenticator that always
+// performs user verification unless UserVerified is cleared.
+type Authenticator struct {
+	AAGUID       []byte
+	Attestation  string
+	UserVerified bool
+	BackupState  bool // Report credentials as synced passkeys
+
+	mu          sync.Mutex
+	credentials []*credential
+	rootKey     *ecdsa.PrivateKey
+	root        *x509.Certificate
+}
+
+type credential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+	signCount  uint32
+}
+
+// NewAuthenticator creates an authenticator producing none attestation
+func NewAuthenticator() *Authenticator {
+	return &Authenticator{
+		AAGUID:       []byte("emr-test-authn!!"),
+		Attestation:  AttestationNone,
+		UserVerified: true,
+	}
+}
+
+// Create performs a registration ceremony as the browser would for origin
+func (a *Authenticator) Create(options *webauthn.CreationOptions, origin string) (*webauthn.CredentialCreationResponse, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	supported := false
+	for _, param := range options.PubKeyCredParams {
+		if param.Type == "public-key" && param.Alg == webauthn.AlgES256 {
+			supported = true
+		}
+	}
+	if !supported {
+		return nil, errors.New("webauthntest: ES256 not offered")
+	}
+	for _, excluded := range options.ExcludeCredentials {
+		if a.find(options.RP.ID, excluded.ID) != nil {
+			return nil, errors.New("webauthntest: credential already registered")
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	cred := &credential{id: id, rpID: options.RP.ID, userHandle: options.User.ID, key: key}
+
+	publicKey, err := webauthn.EncodePublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	authData := a.authenticatorData(cred.rpID, webauthn.FlagAttestedCredential, 0)
+	authData = append(authData, a.AAGUID...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(id)))
+	authData = append(authData, id...)
+	authData = append(authData, publicKey...)
+
+	clientData, err := clientDataJSON("webauthn.create", options.Challenge, origin)
+	if err != nil {
+		return nil, err
+	}
+	clientDataHash := sha256.Sum256(clientData)
+	signed := append(append([]byte(nil), authData...), clientDataHash[:]...)
+
+	format, stmt := "none", map[interface{}]interface{}{}
+	switch a.Attestation {
+	case AttestationPackedSelf:
+		sig, err := sign(key, signed)
+		if err != nil {
+			return nil, err
+		}
+		format, stmt = "packed", map[interface{}]interface{}{"alg": webauthn.AlgES256, "sig": sig}
+	case AttestationPacked:
+		certKey, certDER, err := a.attestationCertificate()
+		if err != nil {
+			return nil, err
+		}
+		sig, err := sign(certKey, signed)
+		if err != nil {
+			return nil, err
+		}
+		format, stmt = "packed", map[interface{}]interface{}{
+			"alg": webauthn.AlgES256,
+			"sig": sig,
+			"x5c": []interface{}{certDER},
+		}
+	}
+
+	attestationObject, err := webauthn.EncodeCBOR(map[interface{}]interface{}{
+		"fmt":      format,
+		"attStmt":  stmt,
+		"authData": authData,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	a.credentials = append(a.credentials, cred)
+	return &webauthn.CredentialCreationResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(id),
+		RawID: id,
+		Type:  "public-key",
+		Response: webauthn.AuthenticatorAttestationResponse{
+			ClientDataJSON:    clientData,
+			AttestationObject: attestationObject,
+			Transports:        []string{"internal"},
+		},
+	}, nil
+}
+
+// Get performs an authentication ceremony as the browser would for origin.
+// Without allowed credentials any credential for the RP ID is used.
+func (a *Authenticator) Get(options *webauthn.RequestOptions, origin string) (*webauthn.CredentialAssertionResponse, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var cred *credential
+	if len(options.AllowCredentials) == 0 {
+		for _, c := range a.credentials {
+			if c.rpID == options.RPID {
+				cred = c
+				break
+			}
+		}
+	}
+	for _, allowed := range options.AllowCredentials {
+		if cred = a.find(options.RPID, allowed.ID); cred != nil {
+			break
+		}
+	}
+	if cred == nil {
+		return nil, errors.New("webauthntest: no matching credential")
+	}
+
+	cred.signCount++
+	authData := a.authenticatorData(cred.rpID, 0, cred.signCount)
+
+	clientData, err := clientDataJSON("webauthn.get", options.Challenge, origin)
+	if err != nil {
+		return nil, err
+	}
+	clientDataHash := sha256.Sum256(clientData)
+	sig, err := sign(cred.key, append(append([]byte(nil), authData...), clientDataHash[:]...))
+	if err != nil {
+		return nil, err
+	}
+
+	return &webauthn.CredentialAssertionResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(cred.id),
+		RawID: cred.id,
+		Type:  "public-key",
+		Response: webauthn.AuthenticatorAssertionResponse{
+			ClientDataJSON:    clientData,
+			AuthenticatorData: authData,
+			Signature:         sig,
+			UserHandle:        cred.userHandle,
+		},
+	}, nil
+}
+
+// SetSignCount overrides the counter of every credential, e.g. to simulate a
+// cloned authenticator
+func (a *Authenticator) SetSignCount(count uint32) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, cred := range a.credentials {
+		cred.signCount = count
+	}
+}
+
+// Root returns the CA certificate that issues packed attestation certificates
+func (a *Authenticator) Root() (*x509.Certificate, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.ensureRoot(); err != nil {
+		return nil, err
+	}
+	return a.root, nil
+}
+
+func (a *Authenticator) find(rpID string, id []byte) *credential {
+	for _, cred := range a.credentials {
+		if cred.rpID == rpID && bytes.Equal(cred.id, id) {
+			return cred
+		}
+	}
+	return nil
+}
+
+func (a *Authenticator) authenticatorData(rpID string, flags byte, signCount uint32) []byte {
+	flags |= webauthn.FlagUserPresent | webauthn.FlagBackupEligible
+	if a.UserVerified {
+		flags |= webauthn.FlagUserVerified
+	}
+	if a.BackupState {
+		flags |= webauthn.FlagBackupState
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append([]byte(nil), rpIDHash[:]...)
+	data = append(data, flags)
+	return binary.BigEndian.AppendUint32(data, signCount)
+}
+
+// attestationCertificate issues a packed attestation certificate for the
+// authenticator model
+func (a *Authenticator) attestationCertificate() (*ecdsa.PrivateKey, []byte, error) {
+	if err := a.ensureRoot(); err != nil {
+		return nil, nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	aaguid, err := asn1.Marshal(a.AAGUID)
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject: pkix.Name{
+			Country:            []string{"ID"},
+			Organization:       []string{"Hospital EMR Test"},
+			OrganizationalUnit: []string{"Authenticator Attestation"},
+			CommonName:         "Software Authenticator",
+		},
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}, Value: aaguid}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, a.root, &key.PublicKey, a.rootKey)
+	return key, der, err
+}
+
+func (a *Authenticator) ensureRoot() error {
+	if a.root != nil {
+		return nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Software Authenticator Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	root, err := x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+	a.rootKey, a.root = key, root
+	return nil
+}
+
+func clientDataJSON(ceremony string, challenge []byte, origin string) ([]byte, error) {
+	return json.Marshal(webauthn.CollectedClientData{
+		Type:      ceremony,
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		Origin:    origin,
+	})
+}
+
+func sign(key *ecdsa.PrivateKey, data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	return ecdsa.SignASN1(rand.Reader, key, digest[:])
+}
@@ -0,0 +1,154 @@
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/access"
+	"github.com/hospital-emr/backend/internal/audit"
+	"github.com/hospital-emr/backend/internal/common/config"
+	"github.com/hospital-emr/backend/internal/common/database"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/hospital-emr/backend/internal/mpi"
+	"github.com/hospital-emr/backend/internal/numbering"
+	"github.com/hospital-emr/backend/internal/patient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// restrictedDoctor returns the seeded doctor as a restricted access subject
+func restrictedDoctor(t *testing.T, db *database.DB, policy *access.Policy) *access.Subject {
+	var doctor models.User
+	require.NoError(t, db.Preload("Roles").Where("email = ?", "doctor@hospital-emr.com").First(&doctor).Error)
+
+	var roles []string
+	for _, role := range doctor.Roles {
+		roles = append(roles, role.Code)
+	}
+	subject, err := policy.NewSubject(context.Background(), doctor.ID, roles)
+	require.NoError(t, err)
+	require.True(t, subject.Restricted)
+	return subject
+}
+
+// createTestPatient creates a patient nobody has a care relationship with
+func createTestPatient(t *testing.T, db *database.DB, numbers *numbering.Service, lastName string) *models.Patient {
+	mrn, err := numbers.Next(context.Background(), models.NumberKindMRN)
+	require.NoError(t, err)
+
+	patient := &models.Patient{
+		MRN:         mrn,
+		FirstName:   "Test",
+		LastName:    lastName,
+		DateOfBirth: time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC),
+		Gender:      models.GenderFemale,
+		Status:      models.PatientStatusActive,
+	}
+	require.NoError(t, db.Create(patient).Error)
+	t.Cleanup(func() { db.Unscoped().Delete(patient) })
+	return patient
+}
+
+func assertAccessDenied(t *testing.T, err error) {
+	appErr, ok := err.(*errors.AppError)
+	require.True(t, ok, "expected an access denial, got %v", err)
+	assert.Equal(t, "PATIENT_ACCESS_DENIED", appErr.Code)
+}
+
+func TestIntegrationBreakGlass(t *testing.T) {
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	db, err := database.New(cfg)
+	require.NoError(t, err)
+	defer db.Close()
+
+	policy := access.NewPolicy(db.DB, nil, cfg, audit.NewRecorder(db.DB, nil))
+	subject := restrictedDoctor(t, db, policy)
+	ctx := access.WithSubject(context.Background(), subject)
+	numbers := numbering.NewService(db.DB, cfg)
+	patient := createTestPatient(t, db, numbers, "BreakGlass")
+	defer db.Unscoped().Where("patient_id = ?", patient.ID).Delete(&models.EmergencyAccess{})
+
+	assertAccessDenied(t, policy.CheckPatient(ctx, patient.ID))
+
+	grant, err := policy.BreakGlass(ctx, patient.ID, &access.BreakGlassRequest{Reason: "Unconscious patient in the emergency room"}, subject.UserID)
+	require.NoError(t, err)
+	assert.Equal(t, models.EmergencyAccessPending, grant.ReviewStatus)
+	assert.WithinDuration(t, time.Now().Add(cfg.GetBreakGlassDuration()), grant.ExpiresAt, time.Minute)
+
+	t.Run("Grants Access", func(t *testing.T) {
+		assert.NoError(t, policy.CheckPatient(ctx, patient.ID))
+	})
+
+	t.Run("Only For The Invoking User", func(t *testing.T) {
+		other := access.WithSubject(context.Background(), &access.Subject{UserID: uuid.New(), Roles: subject.Roles, Restricted: true})
+		assertAccessDenied(t, policy.CheckPatient(other, patient.ID))
+	})
+
+	t.Run("Only For The Patient", func(t *testing.T) {
+		otherPatient := createTestPatient(t, db, numbers, "Bystander")
+		assertAccessDenied(t, policy.CheckPatient(ctx, otherPatient.ID))
+	})
+
+	t.Run("Expires", func(t *testing.T) {
+		require.NoError(t, db.Model(grant).Update("expires_at", time.Now().Add(-time.Second)).Error)
+		assertAccessDenied(t, policy.CheckPatient(ctx, patient.ID))
+	})
+}
+
+func TestIntegrationDuplicateWarningHidesInaccessiblePatients(t *testing.T) {
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	db, err := database.New(cfg)
+	require.NoError(t, err)
+	defer db.Close()
+
+	policy := access.NewPolicy(db.DB, nil, cfg, audit.NewRecorder(db.DB, nil))
+	subject := restrictedDoctor(t, db, policy)
+	numbers := numbering.NewService(db.DB, cfg)
+	existing := createTestPatient(t, db, numbers, "DuplicateWarning")
+	service := patient.NewService(db.DB, nil, policy, numbers, mpi.NewService(db.DB, cfg), cfg.GetUnmergeGracePeriod())
+
+	// The same person registered again
+	req := &patient.CreatePatientRequest{
+		FirstName:   existing.FirstName,
+		LastName:    existing.LastName,
+		DateOfBirth: existing.DateOfBirth,
+		Gender:      existing.Gender,
+	}
+	candidates := func(ctx context.Context) []map[string]interface{} {
+		_, err := service.CreatePatient(ctx, req, subject.UserID)
+		appErr, ok := err.(*errors.AppError)
+		require.True(t, ok, "expected a duplicate warning, got %v", err)
+		require.Equal(t, "POSSIBLE_DUPLICATE_PATIENT", appErr.Code)
+
+		encoded, err := json.Marshal(appErr.Details)
+		require.NoError(t, err)
+		var candidates []map[string]interface{}
+		require.NoError(t, json.Unmarshal(encoded, &candidates))
+		for _, candidate := range candidates {
+			if candidate["patient_id"] == existing.ID.String() {
+				return []map[string]interface{}{candidate}
+			}
+		}
+		t.Fatalf("patient %s is not among the candidates", existing.ID)
+		return nil
+	}
+
+	restricted := candidates(access.WithSubject(context.Background(), subject))[0]
+	assert.Contains(t, restricted, "score")
+	assert.Contains(t, restricted, "level")
+	assert.NotContains(t, restricted, "mrn")
+	assert.NotContains(t, restricted, "last_name")
+	assert.NotContains(t, restricted, "date_of_birth")
+
+	unrestricted := candidates(context.Background())[0]
+	assert.Equal(t, existing.MRN, unrestricted["mrn"])
+	assert.Equal(t, existing.LastName, unrestricted["last_name"])
+}
@@ -0,0 +1,60 @@
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hospital-emr/backend/internal/audit"
+	"github.com/hospital-emr/backend/internal/common/config"
+	"github.com/hospital-emr/backend/internal/common/database"
+	"github.com/hospital-emr/backend/internal/common/middleware"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/hospital-emr/backend/internal/numbering"
+	"github.com/hospital-emr/backend/internal/patient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrationMRNLookupInAccessReport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	db, err := database.New(cfg)
+	require.NoError(t, err)
+	defer db.Close()
+
+	var admin models.User
+	require.NoError(t, db.Where("email = ?", "admin@hospital-emr.com").First(&admin).Error)
+	numbers := numbering.NewService(db.DB, cfg)
+	p := createTestPatient(t, db, numbers, "LookupByMRN")
+
+	handler := patient.NewHandler(patient.NewService(db.DB, nil, nil, numbers, nil, cfg.GetUnmergeGracePeriod()))
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", admin.ID)
+		c.Set("email", admin.Email)
+	}, middleware.AuditLog(audit.NewRecorder(db.DB, nil)))
+	router.GET("/api/v1/pasien/mrn/:mrn", handler.GetPatientByMRN)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/pasien/mrn/"+p.MRN, nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	report, _, err := audit.NewService(db.DB).PatientAccessReport(context.Background(), p.ID, nil, nil, false, 1, 20)
+	require.NoError(t, err)
+	var lookups []audit.AccessReportEntry
+	for _, entry := range report {
+		if entry.Description == "GET /api/v1/pasien/mrn/:mrn" {
+			lookups = append(lookups, entry)
+		}
+	}
+	require.Len(t, lookups, 1, "the lookup is logged against the patient it resolved to")
+	assert.Equal(t, admin.ID, *lookups[0].UserID)
+}
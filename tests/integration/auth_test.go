@@ -4,16 +4,22 @@ package integration
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/hospital-emr/backend/internal/audit"
 	"github.com/hospital-emr/backend/internal/auth"
 	"github.com/hospital-emr/backend/internal/common/config"
 	"github.com/hospital-emr/backend/internal/common/database"
+	"github.com/hospital-emr/backend/internal/common/middleware"
+	"github.com/hospital-emr/backend/pkg/email"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func setupTestRouter() (*gin.Engine, *database.DB) {
@@ -22,7 +28,9 @@ func setupTestRouter() (*gin.Engine, *database.DB) {
 	cfg, _ := config.Load()
 	db, _ := database.New(cfg)
 	
-	authService := auth.NewService(db.DB, cfg)
+	keys, _ := auth.NewKeySet(cfg)
+	passwords, _ := auth.NewPasswordPolicy(cfg)
+	authService := auth.NewService(db.DB, cfg, keys, auth.NewSessionCache(db.DB, cfg.GetSessionCacheTTL(), cfg.GetSessionIdleTimeout()), passwords, email.NewSMTPSender(cfg.Email.SMTPHost, cfg.Email.SMTPPort, cfg.Email.SMTPUser, cfg.Email.SMTPPassword, cfg.Email.EmailFrom), audit.NewRecorder(db.DB, nil))
 	authHandler := auth.NewHandler(authService)
 	
 	router := gin.New()
@@ -31,6 +39,129 @@ func setupTestRouter() (*gin.Engine, *database.DB) {
 	return router, db
 }
 
+// setupSessionRouter serves the session endpoints. Session lookups are cached
+// for an hour, so a rejected token shows the cache entry was dropped rather
+// than expired.
+func setupSessionRouter(t *testing.T) (*gin.Engine, *auth.Service, *database.DB) {
+	gin.SetMode(gin.TestMode)
+
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	cfg.Security.MaxConcurrentSessions = 0
+	cfg.Security.RoleMaxSessions = nil
+	db, err := database.New(cfg)
+	require.NoError(t, err)
+
+	keys, _ := auth.NewKeySet(cfg)
+	passwords, _ := auth.NewPasswordPolicy(cfg)
+	sessions := auth.NewSessionCache(db.DB, time.Hour, 0)
+	authService := auth.NewService(db.DB, cfg, keys, sessions, passwords, email.NewSMTPSender(cfg.Email.SMTPHost, cfg.Email.SMTPPort, cfg.Email.SMTPUser, cfg.Email.SMTPPassword, cfg.Email.EmailFrom), audit.NewRecorder(db.DB, nil))
+	authHandler := auth.NewHandler(authService)
+
+	router := gin.New()
+	router.POST("/api/v1/otentikasi/masuk", authHandler.Login)
+	router.POST("/api/v1/otentikasi/segarkan", authHandler.RefreshToken)
+
+	authenticated := router.Group("/api/v1/otentikasi")
+	authenticated.Use(middleware.AuthMiddleware(keys, sessions, nil))
+	authenticated.POST("/keluar", authHandler.Logout)
+	authenticated.GET("/sesi", authHandler.ListMySessions)
+
+	return router, authService, db
+}
+
+func login(t *testing.T, router *gin.Engine) *auth.LoginResponse {
+	w := postJSON(router, "/api/v1/otentikasi/masuk", "", map[string]string{"email": "admin@hospital-emr.com", "password": "admin123"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp auth.LoginResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.NotEmpty(t, resp.AccessToken)
+	return &resp
+}
+
+func getWithToken(router *gin.Engine, path, token string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIntegrationSessionRevocation(t *testing.T) {
+	router, authService, db := setupSessionRouter(t)
+	defer db.Close()
+
+	t.Run("Logout", func(t *testing.T) {
+		session := login(t, router)
+		require.Equal(t, http.StatusOK, getWithToken(router, "/api/v1/otentikasi/sesi", session.AccessToken).Code)
+
+		require.Equal(t, http.StatusOK, postJSON(router, "/api/v1/otentikasi/keluar", session.AccessToken, nil).Code)
+		assert.Equal(t, http.StatusUnauthorized, getWithToken(router, "/api/v1/otentikasi/sesi", session.AccessToken).Code)
+	})
+
+	t.Run("Revoke All Sessions", func(t *testing.T) {
+		first, second := login(t, router), login(t, router)
+		for _, session := range []*auth.LoginResponse{first, second} {
+			require.Equal(t, http.StatusOK, getWithToken(router, "/api/v1/otentikasi/sesi", session.AccessToken).Code)
+		}
+
+		_, err := authService.RevokeAllSessions(context.Background(), first.User.ID)
+		require.NoError(t, err)
+		for _, session := range []*auth.LoginResponse{first, second} {
+			assert.Equal(t, http.StatusUnauthorized, getWithToken(router, "/api/v1/otentikasi/sesi", session.AccessToken).Code)
+		}
+	})
+}
+
+func TestIntegrationRefreshTokenRotation(t *testing.T) {
+	router, _, db := setupSessionRouter(t)
+	defer db.Close()
+
+	refresh := func(token string) *httptest.ResponseRecorder {
+		return postJSON(router, "/api/v1/otentikasi/segarkan", "", map[string]string{"refresh_token": token})
+	}
+	rotate := func(t *testing.T, token string) *auth.LoginResponse {
+		w := refresh(token)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp auth.LoginResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return &resp
+	}
+
+	t.Run("Rotation", func(t *testing.T) {
+		session := login(t, router)
+		rotated := rotate(t, session.RefreshToken)
+		assert.NotEmpty(t, rotated.AccessToken)
+		assert.NotEqual(t, session.RefreshToken, rotated.RefreshToken)
+
+		// The old session ends with the rotation and its token is single-use
+		assert.Equal(t, http.StatusUnauthorized, getWithToken(router, "/api/v1/otentikasi/sesi", session.AccessToken).Code)
+		assert.Equal(t, http.StatusOK, getWithToken(router, "/api/v1/otentikasi/sesi", rotated.AccessToken).Code)
+		assert.Equal(t, http.StatusUnauthorized, refresh(session.RefreshToken).Code)
+	})
+
+	t.Run("Reuse Revokes Family", func(t *testing.T) {
+		session := login(t, router)
+		rotated := rotate(t, session.RefreshToken)
+		latest := rotate(t, rotated.RefreshToken)
+		require.Equal(t, http.StatusOK, getWithToken(router, "/api/v1/otentikasi/sesi", latest.AccessToken).Code)
+
+		// Replaying a rotated token signs out every session descended from the login
+		assert.Equal(t, http.StatusUnauthorized, refresh(session.RefreshToken).Code)
+		assert.Equal(t, http.StatusUnauthorized, getWithToken(router, "/api/v1/otentikasi/sesi", latest.AccessToken).Code)
+		assert.Equal(t, http.StatusUnauthorized, refresh(latest.RefreshToken).Code)
+	})
+
+	t.Run("Other Families Unaffected", func(t *testing.T) {
+		victim, bystander := login(t, router), login(t, router)
+		rotate(t, victim.RefreshToken)
+
+		assert.Equal(t, http.StatusUnauthorized, refresh(victim.RefreshToken).Code)
+		assert.Equal(t, http.StatusOK, getWithToken(router, "/api/v1/otentikasi/sesi", bystander.AccessToken).Code)
+		rotate(t, bystander.RefreshToken)
+	})
+}
+
 func TestIntegrationLogin(t *testing.T) {
 	router, db := setupTestRouter()
 	defer db.Close()
@@ -0,0 +1,47 @@
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hospital-emr/backend/internal/common/config"
+	"github.com/hospital-emr/backend/internal/common/database"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/hospital-emr/backend/internal/numbering"
+	"github.com/hospital-emr/backend/internal/patient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrationEncryptExistingIsIdempotent(t *testing.T) {
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	db, err := database.New(cfg)
+	require.NoError(t, err)
+	defer db.Close()
+	if !models.FieldEncryptionEnabled() {
+		t.Skip("data encryption is not enabled")
+	}
+
+	ctx := context.Background()
+	p := createTestPatient(t, db, numbering.NewService(db.DB, cfg), "Encryption")
+	// Neither value has digits, so both blind indexes stay empty
+	require.NoError(t, db.Model(p).Updates(map[string]interface{}{
+		"ssn":          models.EncryptedString("unknown"),
+		"phone_number": models.EncryptedString("n/a"),
+	}).Error)
+
+	_, err = patient.EncryptExisting(ctx, db.DB, 100)
+	require.NoError(t, err)
+
+	var stored models.Patient
+	require.NoError(t, db.Unscoped().First(&stored, "id = ?", p.ID).Error)
+	assert.Empty(t, stored.SSNIndex)
+	assert.Empty(t, stored.PhoneIndex)
+
+	report, err := patient.EncryptExisting(ctx, db.DB, 100)
+	require.NoError(t, err)
+	assert.Zero(t, report.Encrypted, "rows already encrypted with the active key must not be rewritten")
+}
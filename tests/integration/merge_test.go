@@ -0,0 +1,199 @@
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hospital-emr/backend/internal/common/config"
+	"github.com/hospital-emr/backend/internal/common/database"
+	"github.com/hospital-emr/backend/internal/common/errors"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/hospital-emr/backend/internal/numbering"
+	"github.com/hospital-emr/backend/internal/patient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mergeFixture struct {
+	db       *database.DB
+	numbers  *numbering.Service
+	service  *patient.Service
+	userID   uuid.UUID
+	survivor *models.Patient
+	retired  *models.Patient
+}
+
+func setupMerge(t *testing.T) *mergeFixture {
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	db, err := database.New(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	var admin models.User
+	require.NoError(t, db.Where("email = ?", "admin@hospital-emr.com").First(&admin).Error)
+
+	numbers := numbering.NewService(db.DB, cfg)
+	f := &mergeFixture{
+		db:      db,
+		numbers: numbers,
+		service: patient.NewService(db.DB, nil, nil, numbers, nil, cfg.GetUnmergeGracePeriod()),
+		userID:  admin.ID,
+	}
+	f.survivor = createTestPatient(t, db, numbers, "Survivor")
+	f.retired = createTestPatient(t, db, numbers, "Retired")
+	return f
+}
+
+func (f *mergeFixture) addAllergy(t *testing.T, patientID uuid.UUID, allergen string) *models.Allergy {
+	allergy := &models.Allergy{PatientID: patientID, AllergyType: models.AllergyTypeDrug, Allergen: allergen}
+	require.NoError(t, f.db.Create(allergy).Error)
+	t.Cleanup(func() { f.db.Unscoped().Delete(allergy) })
+	return allergy
+}
+
+func (f *mergeFixture) addEncounter(t *testing.T, patientID uuid.UUID) *models.Encounter {
+	number, err := f.numbers.Next(context.Background(), models.NumberKindEncounter)
+	require.NoError(t, err)
+	encounter := &models.Encounter{
+		EncounterNumber: number,
+		PatientID:       patientID,
+		ProviderID:      f.userID,
+		EncounterType:   models.EncounterTypeOutpatient,
+		AdmissionDate:   time.Now(),
+	}
+	require.NoError(t, f.db.Create(encounter).Error)
+	t.Cleanup(func() { f.db.Unscoped().Delete(encounter) })
+	return encounter
+}
+
+func (f *mergeFixture) merge(t *testing.T) *models.PatientMerge {
+	merge, err := f.service.MergePatients(context.Background(), &patient.MergePatientsRequest{
+		SurvivorID: f.survivor.ID,
+		RetiredID:  f.retired.ID,
+		Reason:     "Registered twice at admission",
+	}, f.userID)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		f.db.Unscoped().Where("merge_id = ?", merge.ID).Delete(&models.PatientMRNAlias{})
+		f.db.Unscoped().Delete(merge)
+	})
+	return merge
+}
+
+// patientOf returns the patient a row currently belongs to
+func (f *mergeFixture) patientOf(t *testing.T, model interface{}, id uuid.UUID) uuid.UUID {
+	var patientIDs []uuid.UUID
+	require.NoError(t, f.db.Unscoped().Model(model).Where("id = ?", id).Pluck("patient_id", &patientIDs).Error)
+	require.Len(t, patientIDs, 1)
+	return patientIDs[0]
+}
+
+func TestIntegrationMergePatients(t *testing.T) {
+	f := setupMerge(t)
+	ctx := context.Background()
+
+	allergy := f.addAllergy(t, f.retired.ID, "Penicillin")
+	encounter := f.addEncounter(t, f.retired.ID)
+	survivorAllergy := f.addAllergy(t, f.survivor.ID, "Latex")
+
+	merge := f.merge(t)
+
+	t.Run("Moves Rows", func(t *testing.T) {
+		assert.Equal(t, f.survivor.ID, f.patientOf(t, &models.Allergy{}, allergy.ID))
+		assert.Equal(t, f.survivor.ID, f.patientOf(t, &models.Encounter{}, encounter.ID))
+		assert.Equal(t, f.survivor.ID, f.patientOf(t, &models.Allergy{}, survivorAllergy.ID))
+		assert.ElementsMatch(t, []uuid.UUID{allergy.ID}, merge.MovedRows[(&models.Allergy{}).TableName()])
+		assert.ElementsMatch(t, []uuid.UUID{encounter.ID}, merge.MovedRows[(&models.Encounter{}).TableName()])
+	})
+
+	t.Run("Retires Record", func(t *testing.T) {
+		var retired models.Patient
+		require.NoError(t, f.db.Unscoped().First(&retired, "id = ?", f.retired.ID).Error)
+		assert.Equal(t, models.PatientStatusMerged, retired.Status)
+		require.NotNil(t, retired.MergedIntoID)
+		assert.Equal(t, f.survivor.ID, *retired.MergedIntoID)
+		assert.True(t, retired.DeletedAt.Valid)
+
+		_, err := f.service.MergePatients(ctx, &patient.MergePatientsRequest{
+			SurvivorID: f.survivor.ID,
+			RetiredID:  f.retired.ID,
+			Reason:     "Merged twice",
+		}, f.userID)
+		assert.Error(t, err)
+	})
+
+	t.Run("Retired MRN Resolves To Survivor", func(t *testing.T) {
+		found, err := f.service.GetPatientByMRN(ctx, f.retired.MRN)
+		require.NoError(t, err)
+		assert.Equal(t, f.survivor.ID, found.ID)
+	})
+}
+
+func TestIntegrationUnmergePatients(t *testing.T) {
+	f := setupMerge(t)
+	ctx := context.Background()
+
+	allergy := f.addAllergy(t, f.retired.ID, "Penicillin")
+	encounter := f.addEncounter(t, f.retired.ID)
+	merge := f.merge(t)
+
+	// Recorded against the merged record, so it belongs to the survivor
+	added := f.addAllergy(t, f.survivor.ID, "Peanuts")
+
+	unmerged, err := f.service.UnmergePatients(ctx, merge.ID, &patient.UnmergePatientsRequest{Reason: "Different patients"}, f.userID)
+	require.NoError(t, err)
+	require.NotNil(t, unmerged.UnmergedAt)
+
+	t.Run("Moved Rows Return", func(t *testing.T) {
+		assert.Equal(t, f.retired.ID, f.patientOf(t, &models.Allergy{}, allergy.ID))
+		assert.Equal(t, f.retired.ID, f.patientOf(t, &models.Encounter{}, encounter.ID))
+	})
+
+	t.Run("Later Rows Stay With Survivor", func(t *testing.T) {
+		assert.Equal(t, f.survivor.ID, f.patientOf(t, &models.Allergy{}, added.ID))
+	})
+
+	t.Run("Restores Retired Record", func(t *testing.T) {
+		var retired models.Patient
+		require.NoError(t, f.db.First(&retired, "id = ?", f.retired.ID).Error)
+		assert.Equal(t, models.PatientStatusActive, retired.Status)
+		assert.Nil(t, retired.MergedIntoID)
+
+		found, err := f.service.GetPatientByMRN(ctx, f.retired.MRN)
+		require.NoError(t, err)
+		assert.Equal(t, f.retired.ID, found.ID)
+	})
+
+	t.Run("Only Once", func(t *testing.T) {
+		_, err := f.service.UnmergePatients(ctx, merge.ID, &patient.UnmergePatientsRequest{Reason: "Again"}, f.userID)
+		assertUnmergeRejected(t, err)
+	})
+}
+
+func TestIntegrationUnmergeAfterGracePeriod(t *testing.T) {
+	f := setupMerge(t)
+	allergy := f.addAllergy(t, f.retired.ID, "Penicillin")
+	merge := f.merge(t)
+
+	require.NoError(t, f.db.Model(merge).Update("unmergeable_after", time.Now().Add(-time.Minute)).Error)
+
+	_, err := f.service.UnmergePatients(context.Background(), merge.ID, &patient.UnmergePatientsRequest{Reason: "Too late"}, f.userID)
+	assertUnmergeRejected(t, err)
+
+	// Nothing was undone
+	assert.Equal(t, f.survivor.ID, f.patientOf(t, &models.Allergy{}, allergy.ID))
+	found, err := f.service.GetPatientByMRN(context.Background(), f.retired.MRN)
+	require.NoError(t, err)
+	assert.Equal(t, f.survivor.ID, found.ID)
+}
+
+func assertUnmergeRejected(t *testing.T, err error) {
+	appErr, ok := err.(*errors.AppError)
+	require.True(t, ok, "expected the unmerge to be rejected, got %v", err)
+	assert.Equal(t, "UNMERGE_NOT_ALLOWED", appErr.Code)
+}
@@ -0,0 +1,112 @@
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hospital-emr/backend/internal/audit"
+	"github.com/hospital-emr/backend/internal/auth"
+	"github.com/hospital-emr/backend/internal/common/config"
+	"github.com/hospital-emr/backend/internal/common/database"
+	"github.com/hospital-emr/backend/internal/models"
+	"github.com/hospital-emr/backend/pkg/email"
+	"github.com/hospital-emr/backend/pkg/encryption"
+	"github.com/hospital-emr/backend/pkg/oidc/oidctest"
+	"github.com/hospital-emr/backend/pkg/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrationSSOLinkedAccountRequiresLocalMFA(t *testing.T) {
+	server, err := oidctest.NewServer("emr", "client-secret")
+	require.NoError(t, err)
+	defer server.Close()
+
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	cfg.Security.MaxConcurrentSessions = 0
+	cfg.Security.RoleMaxSessions = nil
+	cfg.SSO.OIDCIssuerURL = server.Issuer()
+	cfg.SSO.OIDCClientID = "emr"
+	cfg.SSO.OIDCClientSecret = "client-secret"
+	cfg.SSO.OIDCRedirectURL = "http://localhost:8080/api/v1/otentikasi/sso/oidc/callback"
+	cfg.SSO.JITProvisioning = false
+	cfg.SSO.LinkByEmail = true
+	cfg.SSO.SyncRoles = false
+	db, err := database.New(cfg)
+	require.NoError(t, err)
+	defer db.Close()
+
+	// A local account with TOTP enabled that the first SSO login links by email
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	encryptedSecret, err := encryption.Encrypt(secret, cfg.Security.EncryptionKey)
+	require.NoError(t, err)
+	passwordHash, err := encryption.HashPassword("local-password")
+	require.NoError(t, err)
+	user := &models.User{
+		Email:        "sso-mfa@hospital-emr.com",
+		PasswordHash: passwordHash,
+		FirstName:    "Linked",
+		LastName:     "Account",
+		Status:       models.UserStatusActive,
+		MFAEnabled:   true,
+		MFASecret:    encryptedSecret,
+	}
+	require.NoError(t, db.Create(user).Error)
+	t.Cleanup(func() {
+		db.Unscoped().Where("user_id = ?", user.ID).Delete(&models.Session{})
+		db.Unscoped().Where("user_id = ?", user.ID).Delete(&models.UserIdentity{})
+		db.Unscoped().Delete(user)
+	})
+
+	keys, _ := auth.NewKeySet(cfg)
+	passwords, _ := auth.NewPasswordPolicy(cfg)
+	sessions := auth.NewSessionCache(db.DB, cfg.GetSessionCacheTTL(), cfg.GetSessionIdleTimeout())
+	authService := auth.NewService(db.DB, cfg, keys, sessions, passwords, email.NewSMTPSender(cfg.Email.SMTPHost, cfg.Email.SMTPPort, cfg.Email.SMTPUser, cfg.Email.SMTPPassword, cfg.Email.EmailFrom), audit.NewRecorder(db.DB, nil))
+	sso := auth.NewSSO(authService, nil, cfg)
+	sso.RegisterRedirectProvider(auth.NewOIDCProvider(cfg))
+
+	ctx := context.Background()
+	redirectLogin := func(amr []string) *auth.LoginResponse {
+		server.SetUser(map[string]interface{}{
+			"sub":            "sso-mfa-subject",
+			"email":          user.Email,
+			"email_verified": true,
+			"amr":            amr,
+		})
+		authURL, err := sso.BeginLogin(ctx, "oidc", "127.0.0.1")
+		require.NoError(t, err)
+		redirect, err := server.Login(authURL)
+		require.NoError(t, err)
+		resp, err := sso.CompleteLogin(ctx, "oidc", redirect.Query().Get("state"), redirect.Query().Get("code"), "127.0.0.1", "test")
+		require.NoError(t, err)
+		return resp
+	}
+
+	t.Run("provider password alone is challenged", func(t *testing.T) {
+		resp := redirectLogin([]string{"pwd"})
+		assert.True(t, resp.MFARequired)
+		assert.Equal(t, []string{auth.MFAMethodTOTP}, resp.MFAMethods)
+		assert.Empty(t, resp.AccessToken)
+		require.NotEmpty(t, resp.MFAToken)
+
+		_, err := authService.VerifyMFALogin(ctx, &auth.MFALoginRequest{MFAToken: resp.MFAToken, Code: "000000"}, "127.0.0.1", "test")
+		assert.Error(t, err)
+
+		code, err := totp.GenerateCode(secret, totp.Step(time.Now()))
+		require.NoError(t, err)
+		resp, err = authService.VerifyMFALogin(ctx, &auth.MFALoginRequest{MFAToken: resp.MFAToken, Code: code}, "127.0.0.1", "test")
+		require.NoError(t, err)
+		assert.NotEmpty(t, resp.AccessToken)
+	})
+
+	t.Run("provider second factor is trusted", func(t *testing.T) {
+		resp := redirectLogin([]string{"pwd", "mfa"})
+		assert.False(t, resp.MFARequired)
+		assert.NotEmpty(t, resp.AccessToken)
+	})
+}
@@ -0,0 +1,191 @@
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hospital-emr/backend/internal/audit"
+	"github.com/hospital-emr/backend/internal/auth"
+	"github.com/hospital-emr/backend/internal/common/config"
+	"github.com/hospital-emr/backend/internal/common/database"
+	"github.com/hospital-emr/backend/internal/common/middleware"
+	"github.com/hospital-emr/backend/pkg/email"
+	"github.com/hospital-emr/backend/pkg/webauthn/webauthntest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const webAuthnOrigin = "http://localhost:3000"
+
+func setupWebAuthnRouter(t *testing.T) (*gin.Engine, *database.DB) {
+	gin.SetMode(gin.TestMode)
+
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	cfg.WebAuthn = config.WebAuthnConfig{
+		Enabled:             true,
+		RPID:                "localhost",
+		RPName:              "Hospital EMR",
+		Origins:             []string{webAuthnOrigin},
+		TimeoutSeconds:      120,
+		UserVerification:    "preferred",
+		Attestation:         "none",
+		PasswordlessEnabled: true,
+	}
+	// Every login below must keep the registering session alive
+	cfg.Security.MaxConcurrentSessions = 0
+	cfg.Security.RoleMaxSessions = nil
+	db, err := database.New(cfg)
+	require.NoError(t, err)
+
+	keys, _ := auth.NewKeySet(cfg)
+	passwords, _ := auth.NewPasswordPolicy(cfg)
+	sessions := auth.NewSessionCache(db.DB, cfg.GetSessionCacheTTL(), cfg.GetSessionIdleTimeout())
+	authService := auth.NewService(db.DB, cfg, keys, sessions, passwords, email.NewSMTPSender(cfg.Email.SMTPHost, cfg.Email.SMTPPort, cfg.Email.SMTPUser, cfg.Email.SMTPPassword, cfg.Email.EmailFrom), audit.NewRecorder(db.DB, nil))
+	passkeys, err := auth.NewWebAuthn(authService, cfg)
+	require.NoError(t, err)
+
+	authHandler := auth.NewHandler(authService)
+	webAuthnHandler := auth.NewWebAuthnHandler(passkeys)
+
+	router := gin.New()
+	router.POST("/api/v1/otentikasi/masuk", authHandler.Login)
+	router.POST("/api/v1/otentikasi/webauthn/verifikasi/mulai", webAuthnHandler.BeginSecondFactor)
+	router.POST("/api/v1/otentikasi/webauthn/verifikasi", webAuthnHandler.FinishSecondFactor)
+	router.POST("/api/v1/otentikasi/webauthn/masuk/mulai", webAuthnHandler.BeginPasswordless)
+	router.POST("/api/v1/otentikasi/webauthn/masuk", webAuthnHandler.FinishPasswordless)
+
+	authenticated := router.Group("/api/v1/otentikasi")
+	authenticated.Use(middleware.AuthMiddleware(keys, sessions, nil))
+	authenticated.POST("/webauthn/daftar/mulai", webAuthnHandler.BeginRegistration)
+	authenticated.POST("/webauthn/daftar", webAuthnHandler.FinishRegistration)
+	authenticated.DELETE("/webauthn/kredensial/:id", webAuthnHandler.DeleteCredential)
+
+	return router, db
+}
+
+func postJSON(router *gin.Engine, path, token string, body interface{}) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", path, bytes.NewBuffer(payload))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIntegrationWebAuthn(t *testing.T) {
+	router, db := setupWebAuthnRouter(t)
+	defer db.Close()
+
+	authenticator := webauthntest.NewAuthenticator()
+	credentials := map[string]string{"email": "admin@hospital-emr.com", "password": "admin123"}
+
+	w := postJSON(router, "/api/v1/otentikasi/masuk", "", credentials)
+	require.Equal(t, http.StatusOK, w.Code)
+	var login auth.LoginResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &login))
+
+	// The access token alone cannot register a passkey
+	w = postJSON(router, "/api/v1/otentikasi/webauthn/daftar/mulai", login.AccessToken, map[string]string{})
+	require.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+	w = postJSON(router, "/api/v1/otentikasi/webauthn/daftar/mulai", login.AccessToken, map[string]string{"password": "wrong"})
+	require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+
+	// Register a passkey
+	w = postJSON(router, "/api/v1/otentikasi/webauthn/daftar/mulai", login.AccessToken, map[string]string{"password": credentials["password"]})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var registration auth.WebAuthnRegistrationOptions
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &registration))
+
+	created, err := authenticator.Create(registration.PublicKey, webAuthnOrigin)
+	require.NoError(t, err)
+	w = postJSON(router, "/api/v1/otentikasi/webauthn/daftar", login.AccessToken, map[string]interface{}{
+		"ceremony_id": registration.CeremonyID,
+		"name":        "Test passkey",
+		"credential":  created,
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var credential struct {
+		ID string `json:"id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &credential))
+	defer func() {
+		req, _ := http.NewRequest("DELETE", "/api/v1/otentikasi/webauthn/kredensial/"+credential.ID, nil)
+		req.Header.Set("Authorization", "Bearer "+login.AccessToken)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+
+	t.Run("Passwordless Login", func(t *testing.T) {
+		w := postJSON(router, "/api/v1/otentikasi/webauthn/masuk/mulai", "", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var options auth.WebAuthnLoginOptions
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &options))
+
+		assertion, err := authenticator.Get(options.PublicKey, webAuthnOrigin)
+		require.NoError(t, err)
+		body := map[string]interface{}{"ceremony_id": options.CeremonyID, "credential": assertion}
+
+		w = postJSON(router, "/api/v1/otentikasi/webauthn/masuk", "", body)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp auth.LoginResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.NotEmpty(t, resp.AccessToken)
+
+		// Ceremonies are single-use
+		w = postJSON(router, "/api/v1/otentikasi/webauthn/masuk", "", body)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Second Factor", func(t *testing.T) {
+		w := postJSON(router, "/api/v1/otentikasi/masuk", "", credentials)
+		require.Equal(t, http.StatusOK, w.Code)
+		var challenge auth.LoginResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &challenge))
+		assert.True(t, challenge.MFARequired)
+		assert.Contains(t, challenge.MFAMethods, auth.MFAMethodWebAuthn)
+		assert.Empty(t, challenge.AccessToken)
+		require.NotEmpty(t, challenge.MFAToken)
+
+		w = postJSON(router, "/api/v1/otentikasi/webauthn/verifikasi/mulai", "", map[string]string{"mfa_token": challenge.MFAToken})
+		require.Equal(t, http.StatusOK, w.Code)
+		var options auth.WebAuthnLoginOptions
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &options))
+		assert.Len(t, options.PublicKey.AllowCredentials, 1)
+
+		assertion, err := authenticator.Get(options.PublicKey, webAuthnOrigin)
+		require.NoError(t, err)
+		w = postJSON(router, "/api/v1/otentikasi/webauthn/verifikasi", "", map[string]interface{}{
+			"mfa_token":   challenge.MFAToken,
+			"ceremony_id": options.CeremonyID,
+			"credential":  assertion,
+		})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp auth.LoginResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.NotEmpty(t, resp.AccessToken)
+	})
+
+	t.Run("Cloned Authenticator", func(t *testing.T) {
+		authenticator.SetSignCount(0)
+
+		w := postJSON(router, "/api/v1/otentikasi/webauthn/masuk/mulai", "", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var options auth.WebAuthnLoginOptions
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &options))
+
+		assertion, err := authenticator.Get(options.PublicKey, webAuthnOrigin)
+		require.NoError(t, err)
+		w = postJSON(router, "/api/v1/otentikasi/webauthn/masuk", "", map[string]interface{}{"ceremony_id": options.CeremonyID, "credential": assertion})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}